@@ -71,11 +71,13 @@ type Entity struct {
 // Image represents image
 type Image struct {
 	// FileID corresponds to Telegram file_id
-	FileID   string
-	Width    int
-	Height   int
-	Caption  string    `json:",omitempty"`
-	Entities *[]Entity `json:",omitempty"`
+	FileID string
+	// FileUniqueID corresponds to Telegram file_unique_id, the same for the same file
+	FileUniqueID string `json:",omitempty"`
+	Width        int
+	Height       int
+	Caption      string    `json:",omitempty"`
+	Entities     *[]Entity `json:",omitempty"`
 }
 
 // User defines user info of the Message
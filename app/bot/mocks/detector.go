@@ -4,6 +4,7 @@
 package mocks
 
 import (
+	"context"
 	"github.com/umputun/tg-spam/lib/approved"
 	"github.com/umputun/tg-spam/lib/spamcheck"
 	"github.com/umputun/tg-spam/lib/tgspam"
@@ -26,6 +27,9 @@ import (
 //			CheckFunc: func(request spamcheck.Request) (bool, []spamcheck.Response) {
 //				panic("mock out the Check method")
 //			},
+//			CheckCtxFunc: func(ctx context.Context, request spamcheck.Request) (bool, []spamcheck.Response) {
+//				panic("mock out the CheckCtx method")
+//			},
 //			IsApprovedUserFunc: func(userID string) bool {
 //				panic("mock out the IsApprovedUser method")
 //			},
@@ -35,9 +39,18 @@ import (
 //			LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
 //				panic("mock out the LoadStopWords method")
 //			},
+//			NormalizeFunc: func(msg string) string {
+//				panic("mock out the Normalize method")
+//			},
 //			RemoveApprovedUserFunc: func(id string) error {
 //				panic("mock out the RemoveApprovedUser method")
 //			},
+//			RemoveHamFunc: func(msg string) error {
+//				panic("mock out the RemoveHam method")
+//			},
+//			RemoveSpamFunc: func(msg string) error {
+//				panic("mock out the RemoveSpam method")
+//			},
 //			UpdateHamFunc: func(msg string) error {
 //				panic("mock out the UpdateHam method")
 //			},
@@ -60,6 +73,9 @@ type DetectorMock struct {
 	// CheckFunc mocks the Check method.
 	CheckFunc func(request spamcheck.Request) (bool, []spamcheck.Response)
 
+	// CheckCtxFunc mocks the CheckCtx method.
+	CheckCtxFunc func(ctx context.Context, request spamcheck.Request) (bool, []spamcheck.Response)
+
 	// IsApprovedUserFunc mocks the IsApprovedUser method.
 	IsApprovedUserFunc func(userID string) bool
 
@@ -69,9 +85,18 @@ type DetectorMock struct {
 	// LoadStopWordsFunc mocks the LoadStopWords method.
 	LoadStopWordsFunc func(readers ...io.Reader) (tgspam.LoadResult, error)
 
+	// NormalizeFunc mocks the Normalize method.
+	NormalizeFunc func(msg string) string
+
 	// RemoveApprovedUserFunc mocks the RemoveApprovedUser method.
 	RemoveApprovedUserFunc func(id string) error
 
+	// RemoveHamFunc mocks the RemoveHam method.
+	RemoveHamFunc func(msg string) error
+
+	// RemoveSpamFunc mocks the RemoveSpam method.
+	RemoveSpamFunc func(msg string) error
+
 	// UpdateHamFunc mocks the UpdateHam method.
 	UpdateHamFunc func(msg string) error
 
@@ -93,6 +118,13 @@ type DetectorMock struct {
 			// Request is the request argument value.
 			Request spamcheck.Request
 		}
+		// CheckCtx holds details about calls to the CheckCtx method.
+		CheckCtx []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Request is the request argument value.
+			Request spamcheck.Request
+		}
 		// IsApprovedUser holds details about calls to the IsApprovedUser method.
 		IsApprovedUser []struct {
 			// UserID is the userID argument value.
@@ -112,11 +144,26 @@ type DetectorMock struct {
 			// Readers is the readers argument value.
 			Readers []io.Reader
 		}
+		// Normalize holds details about calls to the Normalize method.
+		Normalize []struct {
+			// Msg is the msg argument value.
+			Msg string
+		}
 		// RemoveApprovedUser holds details about calls to the RemoveApprovedUser method.
 		RemoveApprovedUser []struct {
 			// ID is the id argument value.
 			ID string
 		}
+		// RemoveHam holds details about calls to the RemoveHam method.
+		RemoveHam []struct {
+			// Msg is the msg argument value.
+			Msg string
+		}
+		// RemoveSpam holds details about calls to the RemoveSpam method.
+		RemoveSpam []struct {
+			// Msg is the msg argument value.
+			Msg string
+		}
 		// UpdateHam holds details about calls to the UpdateHam method.
 		UpdateHam []struct {
 			// Msg is the msg argument value.
@@ -131,10 +178,14 @@ type DetectorMock struct {
 	lockAddApprovedUser    sync.RWMutex
 	lockApprovedUsers      sync.RWMutex
 	lockCheck              sync.RWMutex
+	lockCheckCtx           sync.RWMutex
 	lockIsApprovedUser     sync.RWMutex
 	lockLoadSamples        sync.RWMutex
 	lockLoadStopWords      sync.RWMutex
+	lockNormalize          sync.RWMutex
 	lockRemoveApprovedUser sync.RWMutex
+	lockRemoveHam          sync.RWMutex
+	lockRemoveSpam         sync.RWMutex
 	lockUpdateHam          sync.RWMutex
 	lockUpdateSpam         sync.RWMutex
 }
@@ -251,6 +302,49 @@ func (mock *DetectorMock) ResetCheckCalls() {
 	mock.lockCheck.Unlock()
 }
 
+// CheckCtx calls CheckCtxFunc.
+func (mock *DetectorMock) CheckCtx(ctx context.Context, request spamcheck.Request) (bool, []spamcheck.Response) {
+	if mock.CheckCtxFunc == nil {
+		panic("DetectorMock.CheckCtxFunc: method is nil but Detector.CheckCtx was just called")
+	}
+	callInfo := struct {
+		Ctx     context.Context
+		Request spamcheck.Request
+	}{
+		Ctx:     ctx,
+		Request: request,
+	}
+	mock.lockCheckCtx.Lock()
+	mock.calls.CheckCtx = append(mock.calls.CheckCtx, callInfo)
+	mock.lockCheckCtx.Unlock()
+	return mock.CheckCtxFunc(ctx, request)
+}
+
+// CheckCtxCalls gets all the calls that were made to CheckCtx.
+// Check the length with:
+//
+//	len(mockedDetector.CheckCtxCalls())
+func (mock *DetectorMock) CheckCtxCalls() []struct {
+	Ctx     context.Context
+	Request spamcheck.Request
+} {
+	var calls []struct {
+		Ctx     context.Context
+		Request spamcheck.Request
+	}
+	mock.lockCheckCtx.RLock()
+	calls = mock.calls.CheckCtx
+	mock.lockCheckCtx.RUnlock()
+	return calls
+}
+
+// ResetCheckCtxCalls reset all the calls that were made to CheckCtx.
+func (mock *DetectorMock) ResetCheckCtxCalls() {
+	mock.lockCheckCtx.Lock()
+	mock.calls.CheckCtx = nil
+	mock.lockCheckCtx.Unlock()
+}
+
 // IsApprovedUser calls IsApprovedUserFunc.
 func (mock *DetectorMock) IsApprovedUser(userID string) bool {
 	if mock.IsApprovedUserFunc == nil {
@@ -376,6 +470,45 @@ func (mock *DetectorMock) ResetLoadStopWordsCalls() {
 	mock.lockLoadStopWords.Unlock()
 }
 
+// Normalize calls NormalizeFunc.
+func (mock *DetectorMock) Normalize(msg string) string {
+	if mock.NormalizeFunc == nil {
+		panic("DetectorMock.NormalizeFunc: method is nil but Detector.Normalize was just called")
+	}
+	callInfo := struct {
+		Msg string
+	}{
+		Msg: msg,
+	}
+	mock.lockNormalize.Lock()
+	mock.calls.Normalize = append(mock.calls.Normalize, callInfo)
+	mock.lockNormalize.Unlock()
+	return mock.NormalizeFunc(msg)
+}
+
+// NormalizeCalls gets all the calls that were made to Normalize.
+// Check the length with:
+//
+//	len(mockedDetector.NormalizeCalls())
+func (mock *DetectorMock) NormalizeCalls() []struct {
+	Msg string
+} {
+	var calls []struct {
+		Msg string
+	}
+	mock.lockNormalize.RLock()
+	calls = mock.calls.Normalize
+	mock.lockNormalize.RUnlock()
+	return calls
+}
+
+// ResetNormalizeCalls reset all the calls that were made to Normalize.
+func (mock *DetectorMock) ResetNormalizeCalls() {
+	mock.lockNormalize.Lock()
+	mock.calls.Normalize = nil
+	mock.lockNormalize.Unlock()
+}
+
 // RemoveApprovedUser calls RemoveApprovedUserFunc.
 func (mock *DetectorMock) RemoveApprovedUser(id string) error {
 	if mock.RemoveApprovedUserFunc == nil {
@@ -415,6 +548,84 @@ func (mock *DetectorMock) ResetRemoveApprovedUserCalls() {
 	mock.lockRemoveApprovedUser.Unlock()
 }
 
+// RemoveHam calls RemoveHamFunc.
+func (mock *DetectorMock) RemoveHam(msg string) error {
+	if mock.RemoveHamFunc == nil {
+		panic("DetectorMock.RemoveHamFunc: method is nil but Detector.RemoveHam was just called")
+	}
+	callInfo := struct {
+		Msg string
+	}{
+		Msg: msg,
+	}
+	mock.lockRemoveHam.Lock()
+	mock.calls.RemoveHam = append(mock.calls.RemoveHam, callInfo)
+	mock.lockRemoveHam.Unlock()
+	return mock.RemoveHamFunc(msg)
+}
+
+// RemoveHamCalls gets all the calls that were made to RemoveHam.
+// Check the length with:
+//
+//	len(mockedDetector.RemoveHamCalls())
+func (mock *DetectorMock) RemoveHamCalls() []struct {
+	Msg string
+} {
+	var calls []struct {
+		Msg string
+	}
+	mock.lockRemoveHam.RLock()
+	calls = mock.calls.RemoveHam
+	mock.lockRemoveHam.RUnlock()
+	return calls
+}
+
+// ResetRemoveHamCalls reset all the calls that were made to RemoveHam.
+func (mock *DetectorMock) ResetRemoveHamCalls() {
+	mock.lockRemoveHam.Lock()
+	mock.calls.RemoveHam = nil
+	mock.lockRemoveHam.Unlock()
+}
+
+// RemoveSpam calls RemoveSpamFunc.
+func (mock *DetectorMock) RemoveSpam(msg string) error {
+	if mock.RemoveSpamFunc == nil {
+		panic("DetectorMock.RemoveSpamFunc: method is nil but Detector.RemoveSpam was just called")
+	}
+	callInfo := struct {
+		Msg string
+	}{
+		Msg: msg,
+	}
+	mock.lockRemoveSpam.Lock()
+	mock.calls.RemoveSpam = append(mock.calls.RemoveSpam, callInfo)
+	mock.lockRemoveSpam.Unlock()
+	return mock.RemoveSpamFunc(msg)
+}
+
+// RemoveSpamCalls gets all the calls that were made to RemoveSpam.
+// Check the length with:
+//
+//	len(mockedDetector.RemoveSpamCalls())
+func (mock *DetectorMock) RemoveSpamCalls() []struct {
+	Msg string
+} {
+	var calls []struct {
+		Msg string
+	}
+	mock.lockRemoveSpam.RLock()
+	calls = mock.calls.RemoveSpam
+	mock.lockRemoveSpam.RUnlock()
+	return calls
+}
+
+// ResetRemoveSpamCalls reset all the calls that were made to RemoveSpam.
+func (mock *DetectorMock) ResetRemoveSpamCalls() {
+	mock.lockRemoveSpam.Lock()
+	mock.calls.RemoveSpam = nil
+	mock.lockRemoveSpam.Unlock()
+}
+
 // UpdateHam calls UpdateHamFunc.
 func (mock *DetectorMock) UpdateHam(msg string) error {
 	if mock.UpdateHamFunc == nil {
@@ -507,6 +718,10 @@ func (mock *DetectorMock) ResetCalls() {
 	mock.calls.Check = nil
 	mock.lockCheck.Unlock()
 
+	mock.lockCheckCtx.Lock()
+	mock.calls.CheckCtx = nil
+	mock.lockCheckCtx.Unlock()
+
 	mock.lockIsApprovedUser.Lock()
 	mock.calls.IsApprovedUser = nil
 	mock.lockIsApprovedUser.Unlock()
@@ -519,10 +734,22 @@ func (mock *DetectorMock) ResetCalls() {
 	mock.calls.LoadStopWords = nil
 	mock.lockLoadStopWords.Unlock()
 
+	mock.lockNormalize.Lock()
+	mock.calls.Normalize = nil
+	mock.lockNormalize.Unlock()
+
 	mock.lockRemoveApprovedUser.Lock()
 	mock.calls.RemoveApprovedUser = nil
 	mock.lockRemoveApprovedUser.Unlock()
 
+	mock.lockRemoveHam.Lock()
+	mock.calls.RemoveHam = nil
+	mock.lockRemoveHam.Unlock()
+
+	mock.lockRemoveSpam.Lock()
+	mock.calls.RemoveSpam = nil
+	mock.lockRemoveSpam.Unlock()
+
 	mock.lockUpdateHam.Lock()
 	mock.calls.UpdateHam = nil
 	mock.lockUpdateHam.Unlock()
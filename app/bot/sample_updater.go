@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 // SampleUpdater represents a file that can be read and appended to.
@@ -19,6 +22,11 @@ func NewSampleUpdater(fileName string) *SampleUpdater {
 	return &SampleUpdater{fileName: fileName}
 }
 
+// Name returns the file name, used by the detector to recognize samples loaded from this file as dynamic
+func (s *SampleUpdater) Name() string {
+	return s.fileName
+}
+
 // Reader returns a reader for the file, caller must close it
 func (s *SampleUpdater) Reader() (io.ReadCloser, error) {
 	fh, err := os.Open(s.fileName)
@@ -62,5 +70,46 @@ func (s *SampleUpdater) Append(msg string) error {
 	if _, err = fh.WriteString(strings.ReplaceAll(msg, "\n", " ") + "\n"); err != nil {
 		return fmt.Errorf("failed to write to %s: %w", s.fileName, err)
 	}
+	ownWrites.mark(s.fileName)
 	return nil
 }
+
+// ownWrites keeps the state of dynamic samples files after the last write made by the bot itself.
+// The samples in such files are learned already, so the watcher doesn't reload samples on these changes.
+var ownWrites = &fileWrites{files: map[string]fileState{}}
+
+// fileWrites is a thread-safe set of files with their state after the last own write
+type fileWrites struct {
+	lock  sync.Mutex
+	files map[string]fileState
+}
+
+// fileState is the size and the modification time of a file, changed by any write
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// mark keeps the current state of the file as written by the bot
+func (w *fileWrites) mark(fileName string) {
+	fi, err := os.Stat(fileName)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err != nil {
+		delete(w.files, filepath.Clean(fileName))
+		return
+	}
+	w.files[filepath.Clean(fileName)] = fileState{size: fi.Size(), modTime: fi.ModTime()}
+}
+
+// own returns true if the file is not changed since the last own write
+func (w *fileWrites) own(fileName string) bool {
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return false
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	st, ok := w.files[filepath.Clean(fileName)]
+	return ok && st.size == fi.Size() && st.modTime.Equal(fi.ModTime())
+}
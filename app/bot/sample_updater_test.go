@@ -27,6 +27,7 @@ func TestSampleUpdater(t *testing.T) {
 		content, err := io.ReadAll(reader)
 		assert.NoError(t, err)
 		assert.Equal(t, "Test message\n", string(content))
+		assert.Equal(t, file.Name(), updater.Name())
 	})
 
 	t.Run("dedup", func(t *testing.T) {
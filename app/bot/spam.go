@@ -44,6 +44,7 @@ type SpamConfig struct {
 	SpamDryMsg string
 
 	WatchDelay time.Duration
+	NoWatch    bool // don't watch samples files, for one-time loading of samples
 
 	Dry bool
 }
@@ -51,19 +52,27 @@ type SpamConfig struct {
 // Detector is a spam detector interface
 type Detector interface {
 	Check(request spamcheck.Request) (spam bool, cr []spamcheck.Response)
+	CheckCtx(ctx context.Context, request spamcheck.Request) (spam bool, cr []spamcheck.Response)
+	Normalize(msg string) string
 	LoadSamples(exclReader io.Reader, spamReaders, hamReaders []io.Reader) (tgspam.LoadResult, error)
 	LoadStopWords(readers ...io.Reader) (tgspam.LoadResult, error)
 	UpdateSpam(msg string) error
 	UpdateHam(msg string) error
+	RemoveSpam(msg string) error
+	RemoveHam(msg string) error
 	AddApprovedUser(user approved.UserInfo) error
 	RemoveApprovedUser(id string) error
 	ApprovedUsers() (res []approved.UserInfo)
 	IsApprovedUser(userID string) bool
 }
 
-// NewSpamFilter creates new spam filter
+// NewSpamFilter creates new spam filter. Samples files are watched for changes and reloaded until the context
+// is canceled, unless params.NoWatch set.
 func NewSpamFilter(ctx context.Context, detector Detector, params SpamConfig) *SpamFilter {
 	res := &SpamFilter{Detector: detector, params: params}
+	if params.NoWatch {
+		return res
+	}
 	go func() {
 		if err := res.watch(ctx, params.WatchDelay); err != nil {
 			log.Printf("[WARN] samples file watcher failed: %v", err)
@@ -73,7 +82,7 @@ func NewSpamFilter(ctx context.Context, detector Detector, params SpamConfig) *S
 }
 
 // OnMessage checks if user already approved and if not checks if user is a spammer
-func (s *SpamFilter) OnMessage(msg Message) (response Response) {
+func (s *SpamFilter) OnMessage(ctx context.Context, msg Message) (response Response) {
 	if msg.From.ID == 0 { // don't check system messages
 		return Response{}
 	}
@@ -82,9 +91,11 @@ func (s *SpamFilter) OnMessage(msg Message) (response Response) {
 	spamReq := spamcheck.Request{Msg: msg.Text, UserID: strconv.FormatInt(msg.From.ID, 10), UserName: msg.From.Username}
 	if msg.Image != nil {
 		spamReq.Meta.Images = 1
+		spamReq.Meta.ImageID = msg.Image.FileID // used by vision check to load the image
+		spamReq.Meta.ImageUniqueID = msg.Image.FileUniqueID
 	}
 	spamReq.Meta.Links = strings.Count(msg.Text, "http://") + strings.Count(msg.Text, "https://")
-	isSpam, checkResults := s.Check(spamReq)
+	isSpam, checkResults := s.CheckCtx(ctx, spamReq)
 	crs := []string{}
 	for _, cr := range checkResults {
 		crs = append(crs, fmt.Sprintf("{name: %s, spam: %v, details: %s}", cr.Name, cr.Spam, cr.Details))
@@ -149,7 +160,9 @@ func (s *SpamFilter) RemoveApprovedUser(id int64) error {
 }
 
 // watch watches for changes in samples files and reloads them
-// delay is a time to wait after the last change before reloading to avoid multiple reloads
+// delay is a time to wait after the last change before reloading to avoid multiple reloads.
+// Dynamic samples files are watched if they exist, and their changes made by the bot itself are skipped,
+// as such samples are learned or unlearned already.
 func (s *SpamFilter) watch(ctx context.Context, delay time.Duration) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -160,6 +173,7 @@ func (s *SpamFilter) watch(ctx context.Context, delay time.Duration) error {
 	done := make(chan bool)
 	reloadTimer := time.NewTimer(delay)
 	reloadPending := false
+	changed := map[string]bool{} // files changed since the last reload
 
 	go func() {
 		defer close(done)
@@ -177,6 +191,7 @@ func (s *SpamFilter) watch(ctx context.Context, delay time.Duration) error {
 					continue
 				}
 				log.Printf("[DEBUG] file %q updated, op: %v", event.Name, event.Op)
+				changed[event.Name] = true
 				if !reloadPending {
 					reloadPending = true
 					reloadTimer.Reset(delay)
@@ -184,6 +199,12 @@ func (s *SpamFilter) watch(ctx context.Context, delay time.Duration) error {
 			case <-reloadTimer.C:
 				if reloadPending {
 					reloadPending = false
+					if s.ownChanges(changed) {
+						log.Printf("[DEBUG] skip reloading samples, dynamic files updated by bot")
+						clear(changed)
+						continue
+					}
+					clear(changed)
 					if err := s.ReloadSamples(); err != nil {
 						log.Printf("[WARN] %v", err)
 					}
@@ -212,10 +233,33 @@ func (s *SpamFilter) watch(ctx context.Context, delay time.Duration) error {
 	if err := errs.ErrorOrNil(); err != nil {
 		return fmt.Errorf("failed to add some files to watcher: %w", err)
 	}
+	// dynamic samples are optional
+	for _, file := range []string{s.params.SpamDynamicFile, s.params.HamDynamicFile} {
+		if file == "" {
+			continue
+		}
+		if err := addToWatcher(file); err != nil {
+			log.Printf("[DEBUG] dynamic samples file not watched: %v", err)
+		}
+	}
 	<-done
 	return nil
 }
 
+// ownChanges returns true if all changed files are dynamic samples files, not changed since the last write by the bot
+func (s *SpamFilter) ownChanges(changed map[string]bool) bool {
+	if len(changed) == 0 {
+		return false
+	}
+	for file := range changed {
+		isDynamic := file == s.params.SpamDynamicFile || file == s.params.HamDynamicFile
+		if !isDynamic || !ownWrites.own(file) {
+			return false
+		}
+	}
+	return true
+}
+
 // ReloadSamples reloads samples and stop-words
 func (s *SpamFilter) ReloadSamples() (err error) {
 	log.Printf("[DEBUG] reloading samples")
@@ -270,6 +314,9 @@ func (s *SpamFilter) ReloadSamples() (err error) {
 
 	log.Printf("[INFO] loaded samples - spam: %d, ham: %d, excluded tokens: %d, stop-words: %d",
 		lr.SpamSamples, lr.HamSamples, lr.ExcludedTokens, ls.StopWords)
+	for _, e := range ls.InvalidStopWords {
+		log.Printf("[WARN] %s", e)
+	}
 
 	return nil
 }
@@ -307,33 +354,47 @@ func (s *SpamFilter) DynamicSamples() (spam, ham []string, err error) {
 	return spam, ham, errs.ErrorOrNil()
 }
 
-// RemoveDynamicSpamSample removes a sample from the spam dynamic samples file and reloads samples after this
+// RemoveDynamicSpamSample removes a sample from the spam dynamic samples file and unlearns it by detector.
+// Samples are reloaded if the detector can't unlearn the sample.
 func (s *SpamFilter) RemoveDynamicSpamSample(sample string) (int, error) {
 	log.Printf("[DEBUG] remove dynamic spam sample: %q", sample)
 	count, err := s.removeDynamicSample(sample, s.params.SpamDynamicFile)
 	if err != nil {
 		return 0, fmt.Errorf("failed to remove dynamic spam sample: %w", err)
 	}
-	if err := s.ReloadSamples(); err != nil {
+	if err := s.unlearnDynamicSample(sample, count, s.RemoveSpam); err != nil {
 		return 0, fmt.Errorf("failed to reload samples after removing dynamic spam sample: %w", err)
 	}
 	return count, nil
 }
 
-// RemoveDynamicHamSample removes a sample from the ham dynamic samples file and reloads samples after this
+// RemoveDynamicHamSample removes a sample from the ham dynamic samples file and unlearns it by detector.
+// Samples are reloaded if the detector can't unlearn the sample.
 func (s *SpamFilter) RemoveDynamicHamSample(sample string) (int, error) {
 	log.Printf("[DEBUG] remove dynamic ham sample: %q", sample)
 	count, err := s.removeDynamicSample(sample, s.params.HamDynamicFile)
 	if err != nil {
 		return 0, fmt.Errorf("failed to remove dynamic ham sample: %w", err)
 	}
-	if err := s.ReloadSamples(); err != nil {
+	if err := s.unlearnDynamicSample(sample, count, s.RemoveHam); err != nil {
 		return 0, fmt.Errorf("failed to reload samples after removing dynamic ham sample: %w", err)
 	}
 	return count, nil
 }
 
-// removeDynamicSample removes a sample from the spam dynamic samples file and reloads samples after this
+// unlearnDynamicSample calls remove function for each removed copy of the sample. This is much cheaper than retraining
+// on all samples, but if unlearning fails, the state may be inconsistent, and samples are reloaded from files.
+func (s *SpamFilter) unlearnDynamicSample(sample string, count int, remove func(msg string) error) error {
+	for i := 0; i < count; i++ {
+		if err := remove(sample); err != nil {
+			log.Printf("[WARN] failed to unlearn sample %q, reloading samples: %v", sample, err)
+			return s.ReloadSamples()
+		}
+	}
+	return nil
+}
+
+// removeDynamicSample removes all copies of a sample from the dynamic samples file, returns the number of removed copies
 func (s *SpamFilter) removeDynamicSample(msg, fileName string) (int, error) {
 	spamDynamicReader, err := os.Open(fileName) //nolint:gosec // file name is not user input
 	if err != nil {
@@ -397,6 +458,7 @@ func (s *SpamFilter) removeDynamicSample(msg, fileName string) (int, error) {
 	if err := s.fileReplace(spamDynamicWriter.Name(), fileName, fileInfo.Mode()); err != nil {
 		return 0, fmt.Errorf("failed to replace the original spam dynamic file with the temporary file: %w", err)
 	}
+	ownWrites.mark(fileName)
 	log.Printf("[DEBUG] removed %d samples from %s", count, fileName)
 	return count, nil
 }
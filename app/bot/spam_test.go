@@ -24,7 +24,7 @@ func TestSpamFilter_OnMessage(t *testing.T) {
 	defer cancel()
 
 	det := &mocks.DetectorMock{
-		CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
+		CheckCtxFunc: func(_ context.Context, req spamcheck.Request) (bool, []spamcheck.Response) {
 			if req.Msg == "spam" {
 				return true, []spamcheck.Response{{Name: "something", Spam: true, Details: "some spam"}}
 			}
@@ -35,19 +35,20 @@ func TestSpamFilter_OnMessage(t *testing.T) {
 	t.Run("spam detected", func(t *testing.T) {
 		det.ResetCalls()
 		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry"})
-		resp := s.OnMessage(Message{Text: "spam", From: User{ID: 1, Username: "john"}, Image: &Image{FileID: "123"}})
+		resp := s.OnMessage(ctx, Message{Text: "spam", From: User{ID: 1, Username: "john"}, Image: &Image{FileID: "123", FileUniqueID: "u123"}})
 		assert.Equal(t, Response{Text: `detected: "john" (1)`, Send: true, BanInterval: PermanentBanDuration,
 			User: User{ID: 1, Username: "john"}, DeleteReplyTo: true,
 			CheckResults: []spamcheck.Response{{Name: "something", Spam: true, Details: "some spam"}}}, resp)
-		assert.Equal(t, 1, len(det.CheckCalls()))
-		assert.Equal(t, spamcheck.Request{Msg: "spam", UserID: "1", UserName: "john", Meta: spamcheck.MetaData{Images: 1, Links: 0}},
-			det.CheckCalls()[0].Request)
+		assert.Equal(t, 1, len(det.CheckCtxCalls()))
+		assert.Equal(t, spamcheck.Request{Msg: "spam", UserID: "1", UserName: "john",
+			Meta: spamcheck.MetaData{Images: 1, Links: 0, ImageID: "123", ImageUniqueID: "u123"}}, det.CheckCtxCalls()[0].Request)
+		assert.Equal(t, ctx, det.CheckCtxCalls()[0].Ctx, "caller's context passed to detector")
 		t.Logf("resp: %+v", resp)
 	})
 
 	t.Run("spam detected, dry", func(t *testing.T) {
 		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry", Dry: true})
-		resp := s.OnMessage(Message{Text: "spam", From: User{ID: 1, Username: "john"}})
+		resp := s.OnMessage(ctx, Message{Text: "spam", From: User{ID: 1, Username: "john"}})
 		assert.Equal(t, `detected dry: "john" (1)`, resp.Text)
 		assert.True(t, resp.Send)
 		assert.Equal(t, []spamcheck.Response{{Name: "something", Spam: true, Details: "some spam"}}, resp.CheckResults)
@@ -55,7 +56,7 @@ func TestSpamFilter_OnMessage(t *testing.T) {
 
 	t.Run("ham detected", func(t *testing.T) {
 		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry"})
-		resp := s.OnMessage(Message{Text: "good", From: User{ID: 1, Username: "john"}})
+		resp := s.OnMessage(ctx, Message{Text: "good", From: User{ID: 1, Username: "john"}})
 		assert.Equal(t, Response{CheckResults: []spamcheck.Response{{Name: "already approved", Spam: false, Details: "some ham"}}}, resp)
 	})
 
@@ -245,6 +246,76 @@ func TestSpamFilter_watch(t *testing.T) {
 	assert.Equal(t, 1, len(mockDetector.LoadStopWordsCalls()))
 }
 
+func TestSpamFilter_NoWatch(t *testing.T) {
+	mockDetector := &mocks.DetectorMock{
+		LoadSamplesFunc: func(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
+		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
+	}
+
+	tmpDir := t.TempDir()
+	spamSamplesFile := filepath.Join(tmpDir, "spam_samples.txt")
+	hamSamplesFile := filepath.Join(tmpDir, "ham_samples.txt")
+	require.NoError(t, os.WriteFile(spamSamplesFile, []byte("spam"), 0o600))
+	require.NoError(t, os.WriteFile(hamSamplesFile, []byte("ham"), 0o600))
+
+	sf := NewSpamFilter(context.Background(), mockDetector, SpamConfig{SpamSamplesFile: spamSamplesFile,
+		HamSamplesFile: hamSamplesFile, WatchDelay: time.Millisecond * 10, NoWatch: true})
+	require.NoError(t, sf.ReloadSamples())
+	assert.Equal(t, 1, len(mockDetector.LoadSamplesCalls()))
+
+	require.NoError(t, os.WriteFile(spamSamplesFile, []byte("spam message"), 0o600))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, len(mockDetector.LoadSamplesCalls()), "not reloaded on file change")
+}
+
+func TestSpamFilter_watchDynamic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockDetector := &mocks.DetectorMock{
+		LoadSamplesFunc: func(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
+		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
+	}
+
+	tmpDir := t.TempDir()
+	params := SpamConfig{
+		ExcludedTokensFile: filepath.Join(tmpDir, "excluded_tokens.txt"),
+		SpamSamplesFile:    filepath.Join(tmpDir, "spam_samples.txt"),
+		HamSamplesFile:     filepath.Join(tmpDir, "ham_samples.txt"),
+		StopWordsFile:      filepath.Join(tmpDir, "stop_words.txt"),
+		SpamDynamicFile:    filepath.Join(tmpDir, "spam_dynamic.txt"),
+		HamDynamicFile:     filepath.Join(tmpDir, "ham_dynamic.txt"), // not exists, not watched
+		WatchDelay:         time.Millisecond * 50,
+	}
+	for _, file := range []string{params.ExcludedTokensFile, params.SpamSamplesFile, params.HamSamplesFile,
+		params.StopWordsFile, params.SpamDynamicFile} {
+		require.NoError(t, os.WriteFile(file, nil, 0o600))
+	}
+
+	NewSpamFilter(ctx, mockDetector, params)
+	time.Sleep(200 * time.Millisecond) // let it start
+
+	require.NoError(t, NewSampleUpdater(params.SpamDynamicFile).Append("spam message"))
+	time.Sleep(200 * time.Millisecond)
+	assert.Empty(t, mockDetector.LoadSamplesCalls(), "not reloaded on change by bot")
+
+	fh, err := os.OpenFile(params.SpamDynamicFile, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = fh.WriteString("another spam\n")
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+	time.Sleep(200 * time.Millisecond)
+	assert.Len(t, mockDetector.LoadSamplesCalls(), 1, "reloaded on external change")
+}
+
 func TestSpamFilter_WatchMultipleUpdates(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -469,6 +540,8 @@ func TestSpamFilter_RemoveDynamicSample(t *testing.T) {
 		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
 			return tgspam.LoadResult{}, nil
 		},
+		RemoveSpamFunc: func(msg string) error { return nil },
+		RemoveHamFunc:  func(msg string) error { return nil },
 	}
 
 	prep := func() (res *SpamFilter, teardown func()) {
@@ -512,6 +585,7 @@ func TestSpamFilter_RemoveDynamicSample(t *testing.T) {
 				HamSamplesFile:     hamSamplesFile,
 				StopWordsFile:      stopWordsFile,
 				ExcludedTokensFile: excludedTokensFile,
+				WatchDelay:         time.Millisecond * 50,
 			}), func() {
 				os.RemoveAll(tmpDir)
 				os.Remove(spamFile.Name())
@@ -530,10 +604,23 @@ func TestSpamFilter_RemoveDynamicSample(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, []string{"spam2", "spam3", "spam3"}, spam)
 		assert.Equal(t, []string{"ham1", "ham2"}, ham)
+		require.Len(t, mockDirector.RemoveSpamCalls(), 1)
+		assert.Equal(t, "spam1", mockDirector.RemoveSpamCalls()[0].Msg)
+		time.Sleep(200 * time.Millisecond) // let the watcher handle the change
+		assert.Empty(t, mockDirector.LoadSamplesCalls(), "samples should not be reloaded on own change")
+
+		// change of the dynamic file not made by bot should reload samples
+		fh, err := os.OpenFile(sf.params.SpamDynamicFile, os.O_APPEND|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+		_, err = fh.WriteString("spam4\n")
+		require.NoError(t, err)
+		require.NoError(t, fh.Close())
+		time.Sleep(200 * time.Millisecond)
 		assert.True(t, len(mockDirector.LoadSamplesCalls()) >= 1, "LoadSamples should be called at least once")
 	})
 
 	t.Run("remove multi from spam", func(t *testing.T) {
+		mockDirector.ResetCalls()
 		sf, teardown := prep()
 		defer teardown()
 
@@ -544,9 +631,11 @@ func TestSpamFilter_RemoveDynamicSample(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, []string{"spam1", "spam2"}, spam)
 		assert.Equal(t, []string{"ham1", "ham2"}, ham)
+		assert.Len(t, mockDirector.RemoveSpamCalls(), 2, "each copy of the sample should be unlearned")
 	})
 
 	t.Run("remove from ham", func(t *testing.T) {
+		mockDirector.ResetCalls()
 		sf, teardown := prep()
 		defer teardown()
 
@@ -557,6 +646,22 @@ func TestSpamFilter_RemoveDynamicSample(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, []string{"spam1", "spam2", "spam3", "spam3"}, spam)
 		assert.Equal(t, []string{"ham1"}, ham)
+		require.Len(t, mockDirector.RemoveHamCalls(), 1)
+		assert.Equal(t, "ham2", mockDirector.RemoveHamCalls()[0].Msg)
+		assert.Empty(t, mockDirector.LoadSamplesCalls(), "samples should not be reloaded")
+	})
+
+	t.Run("remove from ham, unlearn failed", func(t *testing.T) {
+		mockDirector.ResetCalls()
+		mockDirector.RemoveHamFunc = func(msg string) error { return assert.AnError }
+		defer func() { mockDirector.RemoveHamFunc = func(msg string) error { return nil } }()
+		sf, teardown := prep()
+		defer teardown()
+
+		count, err := sf.RemoveDynamicHamSample("ham2")
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		assert.Len(t, mockDirector.LoadSamplesCalls(), 1, "samples should be reloaded")
 	})
 
 	t.Run("remove from ham, not found", func(t *testing.T) {
@@ -581,6 +686,7 @@ func TestSpamFilter_RemoveDynamicSampleReal(t *testing.T) {
 		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
 			return tgspam.LoadResult{}, nil
 		},
+		RemoveSpamFunc: func(msg string) error { return nil },
 	}
 
 	// make a temp file from testdata/spam.txt
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/lib/tgspam"
+)
+
+// evalOptions are options of "eval" command, evaluating spam detection with the current options on labeled messages
+type evalOptions struct {
+	SpamFile string `long:"spam" description:"file with spam messages, one per line"`
+	HamFile  string `long:"ham" description:"file with ham messages, one per line"`
+	JSONL    string `long:"jsonl" description:"jsonl file with messages, {\"text\": \"...\", \"label\": \"spam|ham\"} per line"`
+	Folds    int    `long:"cv" description:"k-fold cross-validation on spam and ham samples, number of folds"`
+}
+
+// runEval evaluates the detector made with the current options and prints the report to the writer.
+// With cross-validation, the detector is trained and evaluated on spam and ham samples split to folds.
+// Otherwise, the detector is trained on all the samples, including dynamic ones, and evaluated on the labeled messages
+// from the spam/ham files or jsonl file.
+func runEval(ctx context.Context, opts options, wr io.Writer) error {
+	if opts.Eval.Folds > 0 {
+		rep, err := crossValidate(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("can't cross-validate, %w", err)
+		}
+		fmt.Fprintf(wr, "%d-fold cross-validation on %s and %s\n", opts.Eval.Folds, samplesSpamFile, samplesHamFile)
+		return printEvalReport(wr, rep)
+	}
+
+	msgs, err := loadLabeledMessages(opts.Eval)
+	if err != nil {
+		return fmt.Errorf("can't load labeled messages, %w", err)
+	}
+	if len(msgs) == 0 {
+		return errors.New("no labeled messages to evaluate")
+	}
+
+	detector, err := makeTrainedEvalDetector(ctx, opts)
+	if err != nil {
+		return err
+	}
+	rep, err := tgspam.Evaluate(ctx, detector, msgs)
+	if err != nil {
+		return fmt.Errorf("can't evaluate, %w", err)
+	}
+	fmt.Fprintf(wr, "evaluation on %d labeled messages\n", len(msgs))
+	return printEvalReport(wr, rep)
+}
+
+// crossValidate runs k-fold cross-validation on spam and ham samples files. For each fold, the detector
+// is made with the current options, stop-words and excluded tokens, and trained on the rest of the samples.
+func crossValidate(ctx context.Context, opts options) (tgspam.EvalReport, error) {
+	spam, err := readLines(filepath.Join(opts.Files.SamplesDataPath, samplesSpamFile))
+	if err != nil {
+		return tgspam.EvalReport{}, err
+	}
+	ham, err := readLines(filepath.Join(opts.Files.SamplesDataPath, samplesHamFile))
+	if err != nil {
+		return tgspam.EvalReport{}, err
+	}
+	// stop-words and excluded tokens are optional
+	stopWords, _ := os.ReadFile(filepath.Join(opts.Files.SamplesDataPath, stopWordsFile))
+	excluded, _ := os.ReadFile(filepath.Join(opts.Files.SamplesDataPath, excludeTokensFile))
+
+	train := func(spam, ham []string) (*tgspam.Detector, error) {
+		detector := makeEvalDetector(opts)
+		if _, err := detector.LoadStopWords(bytes.NewReader(stopWords)); err != nil {
+			return nil, fmt.Errorf("can't load stop-words, %w", err)
+		}
+		_, err := detector.LoadSamples(bytes.NewReader(excluded),
+			[]io.Reader{strings.NewReader(strings.Join(spam, "\n"))}, []io.Reader{strings.NewReader(strings.Join(ham, "\n"))})
+		if err != nil {
+			return nil, fmt.Errorf("can't load samples, %w", err)
+		}
+		return detector, nil
+	}
+	return tgspam.CrossValidate(ctx, opts.Eval.Folds, spam, ham, train)
+}
+
+// makeEvalDetector makes a detector with the current options for evaluation. CAS check is disabled,
+// as evaluated messages have no real users, and the snapshot is not used, as evaluation detectors
+// are trained on different samples. OpenAI and vision checks are disabled as well, as they would make
+// a paid call for each message, and for each fold of cross-validation, outside the daily budget of the bot.
+func makeEvalDetector(opts options) *tgspam.Detector {
+	opts.Files.Snapshot = false
+	detector := makeDetector(opts)
+	detector.SetCheckEnabled("cas", false)
+	detector.SetCheckEnabled("openai", false)
+	detector.SetCheckEnabled("vision", false)
+	return detector
+}
+
+// makeTrainedEvalDetector makes a detector for evaluation, trained on all the samples, including dynamic ones,
+// and with stop-words loaded, the same way as for the bot. Samples files are loaded once, without watching them.
+func makeTrainedEvalDetector(ctx context.Context, opts options) (*tgspam.Detector, error) {
+	detector := makeEvalDetector(opts)
+	params := makeSpamBotConfig(opts)
+	params.NoWatch = true
+	if err := bot.NewSpamFilter(ctx, detector, params).ReloadSamples(); err != nil {
+		return nil, fmt.Errorf("can't load samples, %w", err)
+	}
+	return detector, nil
+}
+
+// loadLabeledMessages loads messages from spam and ham files, and from jsonl file with "text" and "label" fields
+func loadLabeledMessages(opts evalOptions) (res []tgspam.LabeledMessage, err error) {
+	if opts.SpamFile == "" && opts.HamFile == "" && opts.JSONL == "" {
+		return nil, errors.New("no labeled messages, set spam and ham files or jsonl file")
+	}
+
+	for _, f := range []struct {
+		name string
+		spam bool
+	}{{opts.SpamFile, true}, {opts.HamFile, false}} {
+		if f.name == "" {
+			continue
+		}
+		lines, err := readLines(f.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			res = append(res, tgspam.LabeledMessage{Msg: line, Spam: f.spam})
+		}
+	}
+
+	if opts.JSONL == "" {
+		return res, nil
+	}
+	fh, err := os.Open(opts.JSONL)
+	if err != nil {
+		return nil, fmt.Errorf("can't open %s, %w", opts.JSONL, err)
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var rec struct {
+			Text  string `json:"text"`
+			Label string `json:"label"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("can't parse %s:%d, %w", opts.JSONL, n, err)
+		}
+		switch strings.ToLower(rec.Label) {
+		case "spam":
+			res = append(res, tgspam.LabeledMessage{Msg: rec.Text, Spam: true})
+		case "ham":
+			res = append(res, tgspam.LabeledMessage{Msg: rec.Text, Spam: false})
+		default:
+			return nil, fmt.Errorf("unknown label %q in %s:%d, should be spam or ham", rec.Label, opts.JSONL, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read %s, %w", opts.JSONL, err)
+	}
+	return res, nil
+}
+
+// readLines reads non-empty trimmed lines of the file
+func readLines(fileName string) ([]string, error) {
+	data, err := os.ReadFile(fileName) //nolint:gosec // file name from cli options
+	if err != nil {
+		return nil, fmt.Errorf("can't read %s, %w", fileName, err)
+	}
+	res := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			res = append(res, line)
+		}
+	}
+	return res, nil
+}
+
+// printEvalReport prints precision, recall and f1 with the confusion matrix, total and per check name
+func printEvalReport(wr io.Writer, rep tgspam.EvalReport) error {
+	tw := tabwriter.NewWriter(wr, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "check\tprecision\trecall\tf1\ttp\tfp\ttn\tfn\t")
+	line := func(name string, c tgspam.Confusion) {
+		fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t%d\t%d\t%d\t%d\t\n", name, c.Precision(), c.Recall(), c.F1(), c.TP, c.FP, c.TN, c.FN)
+	}
+	line("total", rep.Total)
+
+	names := make([]string, 0, len(rep.Checks))
+	for name := range rep.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line(name, rep.Checks[name])
+	}
+	return tw.Flush()
+}
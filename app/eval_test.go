@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/tgspam"
+)
+
+func Test_runEval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tmpDir := t.TempDir()
+	spam := "win free iphone now\nlottery prize win today\nfree crypto prize here\nearn money fast online\nfree money win big\n"
+	ham := "hello world and everyone\nhow are you doing today\nhave a good day friends\nsee you tomorrow at work\n" +
+		"good morning all of you\nnice weather today here\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesSpamFile), []byte(spam), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesHamFile), []byte(ham), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, stopWordsFile), []byte("в личку"), 0o600))
+
+	var opts options
+	opts.Files.SamplesDataPath = tmpDir
+	opts.Files.DynamicDataPath = tmpDir
+	opts.Files.Snapshot = true
+	opts.SimilarityThreshold = 0.5
+	opts.MinSpamProbability = 50
+	opts.MaxEmoji = -1
+	opts.Meta.LinksLimit = -1
+	opts.CAS.API = "http://127.0.0.1:1"        // should not be called
+	opts.OpenAI.BaseURL = "http://127.0.0.1:1" // should not be called
+	opts.FirstMessagesCount = 1                // required for openai check
+
+	t.Run("cross-validation", func(t *testing.T) {
+		opts := opts
+		opts.Eval.Folds = 3
+		buf := bytes.Buffer{}
+		require.NoError(t, runEval(ctx, opts, &buf))
+		t.Log(buf.String())
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 6)
+		assert.Equal(t, "3-fold cross-validation on spam-samples.txt and ham-samples.txt", lines[0])
+		assert.Equal(t, []string{"check", "precision", "recall", "f1", "tp", "fp", "tn", "fn"}, strings.Fields(lines[1]))
+		assert.Equal(t, "total", strings.Fields(lines[2])[0])
+		assert.Equal(t, "classifier", strings.Fields(lines[3])[0])
+		assert.Equal(t, "similarity", strings.Fields(lines[4])[0])
+		assert.Equal(t, "stopword", strings.Fields(lines[5])[0])
+		assert.NotContains(t, buf.String(), "cas")
+		assert.NotContains(t, buf.String(), "openai")
+		_, err := os.Stat(filepath.Join(tmpDir, snapshotFile))
+		assert.True(t, os.IsNotExist(err), "snapshot not saved")
+	})
+
+	t.Run("labeled messages", func(t *testing.T) {
+		opts := opts
+		opts.Eval.JSONL = filepath.Join(tmpDir, "eval.jsonl")
+		require.NoError(t, os.WriteFile(opts.Eval.JSONL, []byte(`{"text":"пишите в личку", "label":"spam"}`+"\n"+
+			`{"text":"отвечу в личку", "label":"ham"}`+"\n"+`{"text":"hello world", "label":"HAM"}`+"\n"), 0o600))
+		buf := bytes.Buffer{}
+		require.NoError(t, runEval(ctx, opts, &buf))
+		t.Log(buf.String())
+		assert.Contains(t, buf.String(), "evaluation on 3 labeled messages\n")
+		assert.Contains(t, buf.String(), "stopword      0.500   1.000  0.667   1   1   1   0")
+		assert.NotContains(t, buf.String(), "openai")
+		_, err := os.Stat(filepath.Join(tmpDir, snapshotFile))
+		assert.True(t, os.IsNotExist(err), "snapshot not saved")
+	})
+
+	t.Run("no labeled messages", func(t *testing.T) {
+		err := runEval(ctx, opts, &bytes.Buffer{})
+		assert.EqualError(t, err, "can't load labeled messages, no labeled messages, set spam and ham files or jsonl file")
+	})
+
+	t.Run("not enough samples for cv", func(t *testing.T) {
+		opts := opts
+		opts.Eval.Folds = 10
+		err := runEval(ctx, opts, &bytes.Buffer{})
+		assert.EqualError(t, err, "can't cross-validate, not enough samples for 10 folds, spam: 5, ham: 6")
+	})
+}
+
+func Test_loadLabeledMessages(t *testing.T) {
+	tmpDir := t.TempDir()
+	spamFile, hamFile, jsonlFile := filepath.Join(tmpDir, "spam.txt"), filepath.Join(tmpDir, "ham.txt"), filepath.Join(tmpDir, "d.jsonl")
+	require.NoError(t, os.WriteFile(spamFile, []byte("spam 1\n\n  spam 2  \n"), 0o600))
+	require.NoError(t, os.WriteFile(hamFile, []byte("ham 1\n"), 0o600))
+	require.NoError(t, os.WriteFile(jsonlFile, []byte(`{"text":"spam 3","label":"spam"}`+"\n\n"+`{"text":"ham 2","label":"ham"}`), 0o600))
+
+	t.Run("files", func(t *testing.T) {
+		res, err := loadLabeledMessages(evalOptions{SpamFile: spamFile, HamFile: hamFile})
+		require.NoError(t, err)
+		assert.Equal(t, []tgspam.LabeledMessage{{Msg: "spam 1", Spam: true}, {Msg: "spam 2", Spam: true},
+			{Msg: "ham 1", Spam: false}}, res)
+	})
+
+	t.Run("files and jsonl", func(t *testing.T) {
+		res, err := loadLabeledMessages(evalOptions{SpamFile: spamFile, JSONL: jsonlFile})
+		require.NoError(t, err)
+		assert.Equal(t, []tgspam.LabeledMessage{{Msg: "spam 1", Spam: true}, {Msg: "spam 2", Spam: true},
+			{Msg: "spam 3", Spam: true}, {Msg: "ham 2", Spam: false}}, res)
+	})
+
+	t.Run("bad label", func(t *testing.T) {
+		f := filepath.Join(tmpDir, "bad-label.jsonl")
+		require.NoError(t, os.WriteFile(f, []byte(`{"text":"spam 3","label":"spam"}`+"\n"+`{"text":"blah","label":"maybe"}`), 0o600))
+		_, err := loadLabeledMessages(evalOptions{JSONL: f})
+		assert.EqualError(t, err, `unknown label "maybe" in `+f+`:2, should be spam or ham`)
+	})
+
+	t.Run("bad json", func(t *testing.T) {
+		f := filepath.Join(tmpDir, "bad.jsonl")
+		require.NoError(t, os.WriteFile(f, []byte(`{"text":"spam 3"`), 0o600))
+		_, err := loadLabeledMessages(evalOptions{JSONL: f})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can't parse "+f+":1")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := loadLabeledMessages(evalOptions{HamFile: filepath.Join(tmpDir, "nope.txt")})
+		assert.Error(t, err)
+	})
+}
+
+func Test_printEvalReport(t *testing.T) {
+	rep := tgspam.EvalReport{
+		Total: tgspam.Confusion{TP: 6, FP: 2, TN: 10, FN: 3},
+		Checks: map[string]tgspam.Confusion{
+			"stopword":   {TP: 1, FP: 0, TN: 12, FN: 8},
+			"classifier": {TP: 5, FP: 2, TN: 10, FN: 4},
+		},
+	}
+	buf := bytes.Buffer{}
+	require.NoError(t, printEvalReport(&buf, rep))
+	exp := `       check  precision  recall     f1  tp  fp  tn  fn
+       total      0.750   0.667  0.706   6   2  10   3
+  classifier      0.714   0.556  0.625   5   2  10   4
+    stopword      1.000   0.111  0.200   1   0  12   8
+`
+	assert.Equal(t, exp, buf.String())
+}
@@ -1,6 +1,7 @@
 package events
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -14,6 +15,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 
 	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/lib/spamcheck"
 )
 
 // admin is a helper to handle all admin-group related stuff, created by listener
@@ -35,14 +37,17 @@ const (
 	confirmationPrefix = "?"
 	banPrefix          = "+"
 	infoPrefix         = "!"
+	removeSamplePrefix = "#"
 )
 
-// ReportBan a ban message to admin chat with a button to unban the user
-func (a *admin) ReportBan(banUserStr string, msg *bot.Message) {
+// ReportBan a ban message to admin chat with a button to unban the user, and a button to remove
+// the dynamic spam sample matched by the checks, if any
+func (a *admin) ReportBan(banUserStr string, msg *bot.Message, checks []spamcheck.Response) {
 	log.Printf("[DEBUG] report to admin chat, ban msgsData for %s, group: %d", banUserStr, a.adminChatID)
 	text := strings.ReplaceAll(escapeMarkDownV1Text(msg.Text), "\n", " ")
 	forwardMsg := fmt.Sprintf("**permanently banned [%s](tg://user?id=%d)**\n\n%s\n\n", banUserStr, msg.From.ID, text)
-	if err := a.sendWithUnbanMarkup(forwardMsg, "change ban", msg.From, msg.ID, a.adminChatID); err != nil {
+	_, hasDynamicSample := dynamicSample(checks)
+	if err := a.sendWithUnbanMarkup(forwardMsg, "change ban", msg.From, msg.ID, a.adminChatID, hasDynamicSample); err != nil {
 		log.Printf("[WARN] failed to send admin message, %v", err)
 	}
 }
@@ -50,7 +55,7 @@ func (a *admin) ReportBan(banUserStr string, msg *bot.Message) {
 // MsgHandler handles messages received on admin chat. this is usually forwarded spam failed
 // to be detected by the bot. we need to update spam filter with this message and ban the user.
 // the user will be baned even in training mode, but not in the dry mode.
-func (a *admin) MsgHandler(update tbapi.Update) error {
+func (a *admin) MsgHandler(ctx context.Context, update tbapi.Update) error {
 	shrink := func(inp string, max int) string {
 		if utf8.RuneCountInString(inp) <= max {
 			return inp
@@ -96,7 +101,7 @@ func (a *admin) MsgHandler(update tbapi.Update) error {
 
 	// make a message with spam info and send to admin chat
 	spamInfo := []string{}
-	resp := a.bot.OnMessage(bot.Message{Text: update.Message.Text, From: bot.User{ID: info.UserID}})
+	resp := a.bot.OnMessage(ctx, bot.Message{Text: update.Message.Text, From: bot.User{ID: info.UserID}})
 	spamInfoText := "**can't get spam info**"
 	for _, check := range resp.CheckResults {
 		spamInfo = append(spamInfo, "- "+escapeMarkDownV1Text(check.String()))
@@ -138,14 +143,14 @@ func (a *admin) MsgHandler(update tbapi.Update) error {
 }
 
 // DirectSpamReport handles messages replayed with "/spam" or "spam" by admin
-func (a *admin) DirectSpamReport(update tbapi.Update) error {
-	return a.directReport(update, true)
+func (a *admin) DirectSpamReport(ctx context.Context, update tbapi.Update) error {
+	return a.directReport(ctx, update, true)
 }
 
 // DirectBanReport handles messages replayed with "/ban" or "ban" by admin. doing all the same as DirectSpamReport
 // but without updating spam samples
-func (a *admin) DirectBanReport(update tbapi.Update) error {
-	return a.directReport(update, false)
+func (a *admin) DirectBanReport(ctx context.Context, update tbapi.Update) error {
+	return a.directReport(ctx, update, false)
 }
 
 // DirectWarnReport handles messages replayed with "/warn" or "warn" by admin.
@@ -192,7 +197,7 @@ func (a *admin) DirectWarnReport(update tbapi.Update) error {
 }
 
 // directReport handles messages replayed with "/spam" or "spam", or "/ban" or "ban" by admin
-func (a *admin) directReport(update tbapi.Update, updateSamples bool) error {
+func (a *admin) directReport(ctx context.Context, update tbapi.Update, updateSamples bool) error {
 	log.Printf("[DEBUG] direct ban by admin %q: msg id: %d, from: %q",
 		update.Message.From.UserName, update.Message.ReplyToMessage.MessageID, update.Message.ReplyToMessage.From.UserName)
 
@@ -222,7 +227,7 @@ func (a *admin) directReport(update tbapi.Update, updateSamples bool) error {
 
 	// make a message with spam info and send to admin chat
 	spamInfo := []string{}
-	resp := a.bot.OnMessage(bot.Message{Text: msgTxt, From: bot.User{ID: origMsg.From.ID}})
+	resp := a.bot.OnMessage(ctx, bot.Message{Text: msgTxt, From: bot.User{ID: origMsg.From.ID}})
 	spamInfoText := "**can't get spam info**"
 	for _, check := range resp.CheckResults {
 		spamInfo = append(spamInfo, "- "+escapeMarkDownV1Text(check.String()))
@@ -310,6 +315,15 @@ func (a *admin) InlineCallbackHandler(query *tbapi.CallbackQuery) error {
 		return nil
 	}
 
+	// if callback msgsData starts with "#", we should remove the nearest dynamic spam sample reported by the similarity check
+	if strings.HasPrefix(callbackData, removeSamplePrefix) {
+		if err := a.callbackRemoveSample(query); err != nil {
+			return fmt.Errorf("failed to remove spam sample: %w", err)
+		}
+		log.Printf("[DEBUG] spam sample removed, chatID: %d, userID: %s, orig: %q", chatID, callbackData, query.Message.Text)
+		return nil
+	}
+
 	// no prefix, callback msgsData here is userID, we should unban the user
 	log.Printf("[DEBUG] unban action activated, chatID: %d, userID: %s, orig: %q", chatID, callbackData, query.Message.Text)
 	if err := a.callbackUnbanConfirmed(query); err != nil {
@@ -481,18 +495,20 @@ func (a *admin) callbackShowInfo(query *tbapi.CallbackQuery) error {
 	callbackData := query.Data
 	spamInfoText := "**can't get spam info**"
 	spamInfo := []string{}
-	userID, _, err := a.parseCallbackData(callbackData)
+	userID, msgID, err := a.parseCallbackData(callbackData)
 	if err != nil {
 		spamInfo = append(spamInfo, fmt.Sprintf("**failed to parse userID from %q: %v**", callbackData[1:], err))
 	}
 
 	// collect spam detection details
+	hasDynamicSample := false
 	if userID != 0 {
 		info, found := a.locator.Spam(userID)
 		if found {
 			for _, check := range info.Checks {
 				spamInfo = append(spamInfo, "- "+escapeMarkDownV1Text(check.String()))
 			}
+			_, hasDynamicSample = dynamicSample(info.Checks)
 		}
 		if len(spamInfo) > 0 {
 			spamInfoText = strings.Join(spamInfo, "\n")
@@ -505,6 +521,9 @@ func (a *admin) callbackShowInfo(query *tbapi.CallbackQuery) error {
 		confirmationKeyboard = query.Message.ReplyMarkup.InlineKeyboard
 		confirmationKeyboard[0] = confirmationKeyboard[0][:1] // remove second button (info)
 	}
+	if hasDynamicSample && !hasRemoveSampleButton(confirmationKeyboard) {
+		confirmationKeyboard = append(confirmationKeyboard, removeSampleRow(userID, msgID))
+	}
 	editMsg := tbapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, updText)
 	editMsg.ReplyMarkup = &tbapi.InlineKeyboardMarkup{InlineKeyboard: confirmationKeyboard}
 	editMsg.ParseMode = tbapi.ModeMarkdown
@@ -514,6 +533,80 @@ func (a *admin) callbackShowInfo(query *tbapi.CallbackQuery) error {
 	return nil
 }
 
+// callbackRemoveSample handles the callback when admin asks to remove the dynamic spam sample
+// matched by the similarity check. It removes the sample, updates the message text and drops the button.
+// callback data: #userID:msgID
+func (a *admin) callbackRemoveSample(query *tbapi.CallbackQuery) error {
+	userID, _, err := a.parseCallbackData(query.Data)
+	if err != nil {
+		return fmt.Errorf("failed to parse callback data %q: %w", query.Data, err)
+	}
+
+	info, found := a.locator.Spam(userID)
+	if !found {
+		return fmt.Errorf("spam info for user %d not found", userID)
+	}
+	sample, ok := dynamicSample(info.Checks)
+	if !ok {
+		return fmt.Errorf("no dynamic spam sample for user %d", userID)
+	}
+	count, err := a.bot.RemoveDynamicSpamSample(sample.Text)
+	if err != nil {
+		return fmt.Errorf("failed to remove spam sample %q: %w", sample.Text, err)
+	}
+	log.Printf("[INFO] dynamic spam sample %q removed by %s, count: %d", sample.Text, query.From.UserName, count)
+
+	// keep all the buttons but the one to remove sample
+	keyboard := [][]tbapi.InlineKeyboardButton{}
+	if query.Message.ReplyMarkup != nil {
+		for _, row := range query.Message.ReplyMarkup.InlineKeyboard {
+			if isRemoveSampleRow(row) {
+				continue
+			}
+			keyboard = append(keyboard, row)
+		}
+	}
+	updText := query.Message.Text + fmt.Sprintf("\n\n_spam sample removed by %s_", query.From.UserName)
+	editMsg := tbapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, updText)
+	editMsg.ReplyMarkup = &tbapi.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+	if err := send(editMsg, a.tbAPI); err != nil {
+		return fmt.Errorf("failed to edit message, chatID:%d, msgID:%d, %w", query.Message.Chat.ID, query.Message.MessageID, err)
+	}
+	return nil
+}
+
+// removeSampleRow returns the keyboard row with the button to remove the dynamic spam sample
+func removeSampleRow(userID int64, msgID int) []tbapi.InlineKeyboardButton {
+	// #userID:msgID to remove the dynamic spam sample matched by the similarity check
+	return tbapi.NewInlineKeyboardRow(
+		tbapi.NewInlineKeyboardButtonData("✂ remove sample", fmt.Sprintf("%s%d:%d", removeSamplePrefix, userID, msgID)))
+}
+
+// isRemoveSampleRow checks if the keyboard row is the one with the button to remove the dynamic spam sample
+func isRemoveSampleRow(row []tbapi.InlineKeyboardButton) bool {
+	return len(row) > 0 && row[0].CallbackData != nil && strings.HasPrefix(*row[0].CallbackData, removeSamplePrefix)
+}
+
+// hasRemoveSampleButton checks if the keyboard has the button to remove the dynamic spam sample already
+func hasRemoveSampleButton(keyboard [][]tbapi.InlineKeyboardButton) bool {
+	for _, row := range keyboard {
+		if isRemoveSampleRow(row) {
+			return true
+		}
+	}
+	return false
+}
+
+// dynamicSample returns the nearest spam sample reported by a check, if it is a dynamic one and can be removed
+func dynamicSample(checks []spamcheck.Response) (spamcheck.Sample, bool) {
+	for _, check := range checks {
+		if check.Sample != nil && check.Sample.Dynamic {
+			return *check.Sample, true
+		}
+	}
+	return spamcheck.Sample{}, false
+}
+
 // deleteAndBan deletes the message and bans the user
 func (a *admin) deleteAndBan(query *tbapi.CallbackQuery, userID int64, msgID int) error {
 	errs := new(multierror.Error)
@@ -590,14 +683,15 @@ func (a *admin) getCleanMessage(msg string) (string, error) {
 
 // sendWithUnbanMarkup sends a message to admin chat and adds buttons to ui.
 // text is message with details and action it for the button label to unban, which is user id prefixed with "?" for confirmation;
-// the second button is to show info about the spam analysis.
-func (a *admin) sendWithUnbanMarkup(text, action string, user bot.User, msgID int, chatID int64) error {
+// the second button is to show info about the spam analysis. With removeSample, the button to remove the dynamic spam sample
+// is added in a separate row.
+func (a *admin) sendWithUnbanMarkup(text, action string, user bot.User, msgID int, chatID int64, removeSample bool) error {
 	log.Printf("[DEBUG] action response %q: user %+v, msgID:%d, text: %q", action, user, msgID, strings.ReplaceAll(text, "\n", "\\n"))
 	tbMsg := tbapi.NewMessage(chatID, text)
 	tbMsg.ParseMode = tbapi.ModeMarkdown
 	tbMsg.DisableWebPagePreview = true
 
-	tbMsg.ReplyMarkup = tbapi.NewInlineKeyboardMarkup(
+	keyboard := tbapi.NewInlineKeyboardMarkup(
 		tbapi.NewInlineKeyboardRow(
 			// ?userID to request confirmation
 			tbapi.NewInlineKeyboardButtonData("⛔︎ "+action, fmt.Sprintf("%s%d:%d", confirmationPrefix, user.ID, msgID)),
@@ -605,6 +699,10 @@ func (a *admin) sendWithUnbanMarkup(text, action string, user bot.User, msgID in
 			tbapi.NewInlineKeyboardButtonData("️⚑ info", fmt.Sprintf("%s%d:%d", infoPrefix, user.ID, msgID)),
 		),
 	)
+	if removeSample {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, removeSampleRow(user.ID, msgID))
+	}
+	tbMsg.ReplyMarkup = keyboard
 
 	if _, err := a.tbAPI.Send(tbMsg); err != nil {
 		return fmt.Errorf("can't send message to telegram %q: %w", text, err)
@@ -619,7 +717,7 @@ func (a *admin) parseCallbackData(data string) (userID int64, msgID int, err err
 	}
 
 	// remove prefix if present from the parsed data
-	if data[:1] == confirmationPrefix || data[:1] == banPrefix || data[:1] == infoPrefix {
+	if data[:1] == confirmationPrefix || data[:1] == banPrefix || data[:1] == infoPrefix || data[:1] == removeSamplePrefix {
 		data = data[1:]
 	}
 
@@ -9,6 +9,7 @@ import (
 
 	"github.com/umputun/tg-spam/app/bot"
 	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/lib/spamcheck"
 )
 
 func TestAdmin_reportBan(t *testing.T) {
@@ -30,7 +31,7 @@ func TestAdmin_reportBan(t *testing.T) {
 		Text: "Test\n\n_message_",
 	}
 
-	adm.ReportBan("testUser", msg)
+	adm.ReportBan("testUser", msg, nil)
 
 	require.Equal(t, 1, len(mockAPI.SendCalls()))
 	t.Logf("sent text: %+v", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
@@ -40,6 +41,31 @@ func TestAdmin_reportBan(t *testing.T) {
 	assert.NotNil(t, mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup)
 	assert.Equal(t, "⛔︎ change ban",
 		mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup.(tbapi.InlineKeyboardMarkup).InlineKeyboard[0][0].Text)
+	assert.Len(t, mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup.(tbapi.InlineKeyboardMarkup).InlineKeyboard, 1,
+		"no remove sample button without dynamic sample")
+
+	t.Run("with dynamic sample", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		msg.ID = 789
+		adm.ReportBan("testUser", msg, []spamcheck.Response{{Name: "similarity", Spam: true, Details: "0.90/0.50",
+			Sample: &spamcheck.Sample{Text: "buy crypto now", Source: "spam_dynamic.txt", Dynamic: true}}})
+		require.Equal(t, 1, len(mockAPI.SendCalls()))
+		kb := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup.(tbapi.InlineKeyboardMarkup).InlineKeyboard
+		require.Len(t, kb, 2)
+		assert.Len(t, kb[0], 2, "unban and info buttons")
+		require.Len(t, kb[1], 1)
+		assert.Equal(t, "✂ remove sample", kb[1][0].Text)
+		assert.Equal(t, "#456:789", *kb[1][0].CallbackData)
+	})
+
+	t.Run("with static sample", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		adm.ReportBan("testUser", msg, []spamcheck.Response{{Name: "similarity", Spam: true, Details: "0.90/0.50",
+			Sample: &spamcheck.Sample{Text: "buy crypto now", Source: "spam-samples.txt"}}})
+		require.Equal(t, 1, len(mockAPI.SendCalls()))
+		kb := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup.(tbapi.InlineKeyboardMarkup).InlineKeyboard
+		assert.Len(t, kb, 1, "static sample can't be removed")
+	})
 }
 
 func TestAdmin_getCleanMessage(t *testing.T) {
@@ -133,6 +159,8 @@ func TestAdmin_parseCallbackData(t *testing.T) {
 		{"valid prefix+ with valid data", "+12345:678", 12345, 678, false},
 		{"valid prefix! with valid data", "!12345:678", 12345, 678, false},
 		{"valid prefix? with valid data", "?12345:678", 12345, 678, false},
+		{"valid prefix# with valid data", "#12345:678", 12345, 678, false},
+		{"valid prefix# with negative userID", "#-12345:678", -12345, 678, false},
 	}
 
 	for _, tt := range tests {
@@ -1,6 +1,7 @@
 package events
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -51,12 +52,13 @@ type Locator interface {
 
 // Bot is an interface for bot events.
 type Bot interface {
-	OnMessage(msg bot.Message) (response bot.Response)
+	OnMessage(ctx context.Context, msg bot.Message) (response bot.Response)
 	UpdateSpam(msg string) error
 	UpdateHam(msg string) error
 	AddApprovedUser(id int64, name string) error
 	RemoveApprovedUser(id int64) error
 	IsApprovedUser(userID int64) bool
+	RemoveDynamicSpamSample(sample string) (int, error)
 }
 
 func escapeMarkDownV1Text(text string) string {
@@ -262,11 +264,12 @@ func transform(msg *tbapi.Message) *bot.Message {
 		sizes := msg.Photo
 		lastSize := sizes[len(sizes)-1]
 		message.Image = &bot.Image{
-			FileID:   lastSize.FileID,
-			Width:    lastSize.Width,
-			Height:   lastSize.Height,
-			Caption:  msg.Caption,
-			Entities: transformEntities(msg.CaptionEntities),
+			FileID:       lastSize.FileID,
+			FileUniqueID: lastSize.FileUniqueID,
+			Width:        lastSize.Width,
+			Height:       lastSize.Height,
+			Caption:      msg.Caption,
+			Entities:     transformEntities(msg.CaptionEntities),
 		}
 		if msg.Text == "" {
 			message.Text = msg.Caption
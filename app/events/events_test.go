@@ -123,10 +123,11 @@ func TestTelegramListener_transformPhoto(t *testing.T) {
 			Text: "caption",
 			Sent: time.Unix(1578627415, 0),
 			Image: &bot.Image{
-				FileID:  "AgADAgADFKwxG8r0qUiQByxwp9Gi4s1qwQ8ABAEAAwIAA3kAA5K9AgABFgQ",
-				Width:   1280,
-				Height:  597,
-				Caption: "caption",
+				FileID:       "AgADAgADFKwxG8r0qUiQByxwp9Gi4s1qwQ8ABAEAAwIAA3kAA5K9AgABFgQ",
+				FileUniqueID: "AQADkr0CAAE",
+				Width:        1280,
+				Height:       597,
+				Caption:      "caption",
 				Entities: &[]bot.Entity{
 					{
 						Type:   "bold",
@@ -153,10 +154,11 @@ func TestTelegramListener_transformPhoto(t *testing.T) {
 						FileSize: 30240,
 					},
 					{
-						FileID:   "AgADAgADFKwxG8r0qUiQByxwp9Gi4s1qwQ8ABAEAAwIAA3kAA5K9AgABFgQ",
-						Width:    1280,
-						Height:   597,
-						FileSize: 55267,
+						FileID:       "AgADAgADFKwxG8r0qUiQByxwp9Gi4s1qwQ8ABAEAAwIAA3kAA5K9AgABFgQ",
+						FileUniqueID: "AQADkr0CAAE",
+						Width:        1280,
+						Height:       597,
+						FileSize:     55267,
 					},
 				},
 				Caption: "caption",
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+//go:generate moq --out mocks/file_api.go --pkg mocks --with-resets --skip-ensure . FileAPI
+
+// FileAPI is an interface for telegram bot API to get files, satisfied by tbapi.BotAPI
+type FileAPI interface {
+	GetFile(config tbapi.FileConfig) (tbapi.File, error)
+}
+
+// ImageLoader loads images of telegram messages by file id, implements tgspam.ImageLoader
+type ImageLoader struct {
+	API     FileAPI
+	Token   string       // telegram bot token, used in the file download url
+	Client  *http.Client // http client to download files
+	MaxSize int64        // max size of the image in bytes, unlimited if 0
+}
+
+// LoadImage gets the file info, checks the size reported by telegram, and downloads the file within the size limit.
+// Returns the data and the detected mime type, the file must be an image.
+func (l *ImageLoader) LoadImage(ctx context.Context, fileID string) (data []byte, mimeType string, err error) {
+	file, err := l.API.GetFile(tbapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, "", fmt.Errorf("can't get file %s: %w", fileID, err)
+	}
+	if l.MaxSize > 0 && int64(file.FileSize) > l.MaxSize {
+		return nil, "", fmt.Errorf("file size %d exceeds limit %d", file.FileSize, l.MaxSize)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.Link(l.Token), http.NoBody)
+	if err != nil {
+		return nil, "", fmt.Errorf("can't make request: %w", err)
+	}
+	resp, err := l.Client.Do(req)
+	if err != nil {
+		// error may contain the url with the token
+		return nil, "", fmt.Errorf("can't download file %s: %s", fileID, strings.ReplaceAll(err.Error(), l.Token, "****"))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("can't download file %s, status %d", fileID, resp.StatusCode)
+	}
+
+	body := io.Reader(resp.Body)
+	if l.MaxSize > 0 {
+		body = io.LimitReader(resp.Body, l.MaxSize+1) // size reported by telegram is optional, limit the download too
+	}
+	if data, err = io.ReadAll(body); err != nil {
+		return nil, "", fmt.Errorf("can't read file %s: %w", fileID, err)
+	}
+	if l.MaxSize > 0 && int64(len(data)) > l.MaxSize {
+		return nil, "", fmt.Errorf("file size exceeds limit %d", l.MaxSize)
+	}
+	if mimeType = http.DetectContentType(data); !strings.HasPrefix(mimeType, "image/") {
+		return nil, "", fmt.Errorf("file %s is not an image, %s", fileID, mimeType)
+	}
+	return data, mimeType, nil
+}
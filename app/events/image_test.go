@@ -0,0 +1,106 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/events/mocks"
+)
+
+func TestImageLoader_LoadImage(t *testing.T) {
+	pngData := bytes.Buffer{}
+	require.NoError(t, png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 10, 10))))
+
+	var lastPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastPath = r.URL.Path
+		switch r.URL.Path {
+		case "/file/bottoken/photos/image.png", "/file/bottoken/photos/large.png":
+			_, _ = w.Write(pngData.Bytes())
+		case "/file/bottoken/docs/text.txt":
+			_, _ = w.Write([]byte("some text, not an image"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	tsURL, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	// file links are always at api.telegram.org, redirect them to the test server
+	client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme, r.URL.Host = tsURL.Scheme, tsURL.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	apiMock := &mocks.FileAPIMock{
+		GetFileFunc: func(config tbapi.FileConfig) (tbapi.File, error) {
+			switch config.FileID {
+			case "image":
+				return tbapi.File{FileID: "image", FilePath: "photos/image.png", FileSize: pngData.Len()}, nil
+			case "large":
+				return tbapi.File{FileID: "large", FilePath: "photos/large.png"}, nil // no size reported
+			case "huge":
+				return tbapi.File{FileID: "huge", FilePath: "photos/huge.png", FileSize: 10 * 1024 * 1024}, nil
+			case "text":
+				return tbapi.File{FileID: "text", FilePath: "docs/text.txt"}, nil
+			case "missing":
+				return tbapi.File{FileID: "missing", FilePath: "photos/missing.png"}, nil
+			}
+			return tbapi.File{}, errors.New("file not found")
+		},
+	}
+	l := &ImageLoader{API: apiMock, Token: "token", Client: client, MaxSize: int64(pngData.Len())}
+
+	t.Run("image", func(t *testing.T) {
+		data, mimeType, err := l.LoadImage(context.Background(), "image")
+		require.NoError(t, err)
+		assert.Equal(t, pngData.Bytes(), data)
+		assert.Equal(t, "image/png", mimeType)
+		assert.Equal(t, "/file/bottoken/photos/image.png", lastPath)
+		assert.Equal(t, "image", apiMock.GetFileCalls()[0].Config.FileID)
+	})
+
+	t.Run("too large by reported size", func(t *testing.T) {
+		lastPath = ""
+		_, _, err := l.LoadImage(context.Background(), "huge")
+		require.EqualError(t, err, fmt.Sprintf("file size 10485760 exceeds limit %d", pngData.Len()))
+		assert.Empty(t, lastPath, "not downloaded")
+	})
+
+	t.Run("too large by downloaded size", func(t *testing.T) {
+		small := &ImageLoader{API: apiMock, Token: "token", Client: client, MaxSize: 10}
+		_, _, err := small.LoadImage(context.Background(), "large")
+		require.EqualError(t, err, "file size exceeds limit 10")
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		_, _, err := l.LoadImage(context.Background(), "text")
+		require.EqualError(t, err, "file text is not an image, text/plain; charset=utf-8")
+	})
+
+	t.Run("download failed", func(t *testing.T) {
+		_, _, err := l.LoadImage(context.Background(), "missing")
+		require.EqualError(t, err, "can't download file missing, status 404")
+	})
+
+	t.Run("get file failed", func(t *testing.T) {
+		_, _, err := l.LoadImage(context.Background(), "unknown")
+		require.EqualError(t, err, "can't get file unknown: file not found")
+	})
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
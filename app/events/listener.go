@@ -126,7 +126,7 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 				if l.DisableAdminSpamForward {
 					continue
 				}
-				if err := l.adminHandler.MsgHandler(update); err != nil {
+				if err := l.adminHandler.MsgHandler(ctx, update); err != nil {
 					log.Printf("[WARN] failed to process admin chat message: %v", err)
 					_ = l.sendBotResponse(bot.Response{Send: true, Text: "error: " + err.Error()}, l.adminChatID)
 				}
@@ -154,14 +154,14 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 			if update.Message.ReplyToMessage != nil && l.SuperUsers.IsSuper(update.Message.From.UserName) {
 				if strings.EqualFold(update.Message.Text, "/spam") || strings.EqualFold(update.Message.Text, "spam") {
 					log.Printf("[DEBUG] superuser %s reported spam", update.Message.From.UserName)
-					if err := l.adminHandler.DirectSpamReport(update); err != nil {
+					if err := l.adminHandler.DirectSpamReport(ctx, update); err != nil {
 						log.Printf("[WARN] failed to process direct spam report: %v", err)
 					}
 					continue
 				}
 				if strings.EqualFold(update.Message.Text, "/ban") || strings.EqualFold(update.Message.Text, "ban") {
 					log.Printf("[DEBUG] superuser %s requested ban", update.Message.From.UserName)
-					if err := l.adminHandler.DirectBanReport(update); err != nil {
+					if err := l.adminHandler.DirectBanReport(ctx, update); err != nil {
 						log.Printf("[WARN] failed to process direct ban request: %v", err)
 					}
 					continue
@@ -175,13 +175,13 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 				}
 			}
 
-			if err := l.procEvents(update); err != nil {
+			if err := l.procEvents(ctx, update); err != nil {
 				log.Printf("[WARN] failed to process update: %v", err)
 				continue
 			}
 
 		case <-time.After(l.IdleDuration): // hit bots on idle timeout
-			resp := l.Bot.OnMessage(bot.Message{Text: "idle"})
+			resp := l.Bot.OnMessage(ctx, bot.Message{Text: "idle"})
 			if err := l.sendBotResponse(resp, l.chatID); err != nil {
 				log.Printf("[WARN] failed to respond on idle, %v", err)
 			}
@@ -189,7 +189,7 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 	}
 }
 
-func (l *TelegramListener) procEvents(update tbapi.Update) error {
+func (l *TelegramListener) procEvents(ctx context.Context, update tbapi.Update) error {
 	msgJSON, errJSON := json.Marshal(update.Message)
 	if errJSON != nil {
 		return fmt.Errorf("failed to marshal update.Message to json: %w", errJSON)
@@ -212,7 +212,7 @@ func (l *TelegramListener) procEvents(update tbapi.Update) error {
 	if err := l.Locator.AddMessage(msg.Text, fromChat, msg.From.ID, msg.From.Username, msg.ID); err != nil {
 		log.Printf("[WARN] failed to add message to locator: %v", err)
 	}
-	resp := l.Bot.OnMessage(*msg)
+	resp := l.Bot.OnMessage(ctx, *msg)
 
 	if !resp.Send { // not spam
 		return nil
@@ -238,7 +238,7 @@ func (l *TelegramListener) procEvents(update tbapi.Update) error {
 
 		if l.SuperUsers.IsSuper(msg.From.Username) {
 			if l.TrainingMode {
-				l.adminHandler.ReportBan(banUserStr, msg)
+				l.adminHandler.ReportBan(banUserStr, msg, resp.CheckResults)
 			}
 			log.Printf("[DEBUG] superuser %s requested ban, ignored", banUserStr)
 			return nil
@@ -249,7 +249,7 @@ func (l *TelegramListener) procEvents(update tbapi.Update) error {
 		if err := banUserOrChannel(banReq); err != nil {
 			errs = multierror.Append(errs, fmt.Errorf("failed to ban %s: %w", banUserStr, err))
 		} else if l.adminChatID != 0 && msg.From.ID != 0 {
-			l.adminHandler.ReportBan(banUserStr, msg)
+			l.adminHandler.ReportBan(banUserStr, msg, resp.CheckResults)
 		}
 	}
 
@@ -38,7 +38,7 @@ func TestTelegramListener_Do(t *testing.T) {
 			}, nil
 		},
 	}
-	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+	b := &mocks.BotMock{OnMessageFunc: func(_ context.Context, msg bot.Message) bot.Response {
 		t.Logf("on-message: %+v", msg)
 		if msg.Text == "text 123" && msg.From.Username == "user" {
 			return bot.Response{Send: true, Text: "bot's answer"}
@@ -105,7 +105,7 @@ func TestTelegramListener_DoWithBotBan(t *testing.T) {
 			return nil, nil
 		},
 	}
-	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+	b := &mocks.BotMock{OnMessageFunc: func(_ context.Context, msg bot.Message) bot.Response {
 		t.Logf("on-message: %+v", msg)
 		if msg.Text == "text 123" && msg.From.Username == "user" {
 			return bot.Response{Send: true, Text: "bot's answer", BanInterval: 2 * time.Minute,
@@ -250,7 +250,7 @@ func TestTelegramListener_DoWithBotSoftBan(t *testing.T) {
 			return nil, nil
 		},
 	}
-	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+	b := &mocks.BotMock{OnMessageFunc: func(_ context.Context, msg bot.Message) bot.Response {
 		t.Logf("on-message: %+v", msg)
 		if msg.Text == "text 123" && msg.From.Username == "user" {
 			return bot.Response{Send: true, Text: "bot's answer", BanInterval: 2 * time.Minute,
@@ -326,7 +326,7 @@ func TestTelegramListener_DoWithTraining(t *testing.T) {
 			return nil, nil
 		},
 	}
-	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+	b := &mocks.BotMock{OnMessageFunc: func(_ context.Context, msg bot.Message) bot.Response {
 		t.Logf("on-message: %+v", msg)
 		return bot.Response{DeleteReplyTo: true, ReplyTo: msg.ID, ChannelID: msg.ChatID, BanInterval: time.Hour,
 			Send: true, Text: "bot's answer", User: bot.User{Username: "user", ID: 1, DisplayName: "First Last"}}
@@ -391,7 +391,7 @@ func TestTelegramListener_DoDeleteMessages(t *testing.T) {
 			return nil, nil
 		},
 	}
-	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+	b := &mocks.BotMock{OnMessageFunc: func(_ context.Context, msg bot.Message) bot.Response {
 		t.Logf("on-message: %+v", msg)
 		if msg.Text == "text 123" && msg.From.Username == "user" {
 			return bot.Response{DeleteReplyTo: true, ReplyTo: msg.ID, ChannelID: msg.ChatID, BanInterval: time.Hour,
@@ -461,7 +461,7 @@ func TestTelegramListener_DoWithForwarded(t *testing.T) {
 		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) { return nil, nil },
 	}
 	b := &mocks.BotMock{
-		OnMessageFunc: func(msg bot.Message) bot.Response {
+		OnMessageFunc: func(_ context.Context, msg bot.Message) bot.Response {
 			t.Logf("on-message: %+v", msg)
 			if msg.Text == "text 123" && msg.From.Username == "user" {
 				return bot.Response{Send: true, Text: "bot's answer"}
@@ -551,7 +551,7 @@ func TestTelegramListener_DoWithDirectSpamReport(t *testing.T) {
 		RemoveApprovedUserFunc: func(id int64) error {
 			return nil
 		},
-		OnMessageFunc: func(msg bot.Message) bot.Response {
+		OnMessageFunc: func(_ context.Context, msg bot.Message) bot.Response {
 			t.Logf("on-message: %+v", msg)
 			if msg.Text == "text 123" && msg.From.Username == "user" {
 				return bot.Response{Send: true, Text: "bot's answer"}
@@ -643,7 +643,7 @@ func TestTelegramListener_DoWithDirectWarnReport(t *testing.T) {
 		RemoveApprovedUserFunc: func(id int64) error {
 			return nil
 		},
-		OnMessageFunc: func(msg bot.Message) bot.Response {
+		OnMessageFunc: func(_ context.Context, msg bot.Message) bot.Response {
 			t.Logf("on-message: %+v", msg)
 			if msg.Text == "text 123" && msg.From.Username == "user" {
 				return bot.Response{Send: true, Text: "bot's answer"}
@@ -1218,6 +1218,115 @@ func TestTelegramListener_DoWithAdminShowInfo(t *testing.T) {
 	require.Equal(t, 0, len(b.AddApprovedUserCalls()))
 }
 
+func TestTelegramListener_DoWithAdminShowInfoAndRemoveSample(t *testing.T) {
+	mockLogger := &mocks.SpamLoggerMock{}
+	mockAPI := &mocks.TbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{}, nil
+		},
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) { return nil, nil },
+	}
+	b := &mocks.BotMock{
+		RemoveDynamicSpamSampleFunc: func(sample string) (int, error) { return 1, nil },
+	}
+
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	l := TelegramListener{
+		SpamLogger: mockLogger,
+		TbAPI:      mockAPI,
+		Bot:        b,
+		SuperUsers: SuperUsers{"admin"},
+		Group:      "gr",
+		Locator:    locator,
+		AdminGroup: "123",
+	}
+
+	err := l.Locator.AddSpam(999, []spamcheck.Response{{Name: "rule1", Spam: true, Details: "details1"},
+		{Name: "similarity", Spam: true, Details: "0.90/0.50",
+			Sample: &spamcheck.Sample{Text: "buy crypto now", Source: "spam_dynamic.txt", Dynamic: true}}})
+	require.NoError(t, err)
+
+	query := &tbapi.CallbackQuery{
+		Data: "!999:987654", // ! means we show info
+		Message: &tbapi.Message{
+			MessageID: 987654,
+			Chat:      &tbapi.Chat{ID: 123},
+			Text:      "unban user blah\n\nthis was the spam",
+			From:      &tbapi.User{UserName: "user", ID: 999},
+			ReplyMarkup: &tbapi.InlineKeyboardMarkup{InlineKeyboard: [][]tbapi.InlineKeyboardButton{
+				tbapi.NewInlineKeyboardRow(tbapi.NewInlineKeyboardButtonData("unban", "?999:987654"),
+					tbapi.NewInlineKeyboardButtonData("info", "!999:987654")),
+			}},
+		},
+		From: &tbapi.User{UserName: "admin", ID: 1000},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
+	defer cancel()
+	updChan := make(chan tbapi.Update, 1)
+	updChan <- tbapi.Update{CallbackQuery: query}
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err = l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Equal(t, 1, len(mockAPI.SendCalls()))
+	editMsg := mockAPI.SendCalls()[0].C.(tbapi.EditMessageTextConfig)
+	assert.Contains(t, editMsg.Text, `nearest sample: "buy crypto now" (dynamic spam\_dynamic.txt)`)
+	kb := editMsg.ReplyMarkup.InlineKeyboard
+	require.Equal(t, 2, len(kb))
+	assert.Equal(t, 1, len(kb[0]), "info button removed")
+	require.Equal(t, 1, len(kb[1]))
+	assert.Equal(t, "#999:987654", *kb[1][0].CallbackData)
+	assert.Equal(t, 0, len(b.RemoveDynamicSpamSampleCalls()))
+
+	// press remove sample button
+	query.Data = *kb[1][0].CallbackData
+	query.Message.ReplyMarkup = editMsg.ReplyMarkup
+	updChan = make(chan tbapi.Update, 1)
+	updChan <- tbapi.Update{CallbackQuery: query}
+	close(updChan)
+
+	err = l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Equal(t, 1, len(b.RemoveDynamicSpamSampleCalls()))
+	assert.Equal(t, "buy crypto now", b.RemoveDynamicSpamSampleCalls()[0].Sample)
+	require.Equal(t, 2, len(mockAPI.SendCalls()))
+	editMsg = mockAPI.SendCalls()[1].C.(tbapi.EditMessageTextConfig)
+	assert.Contains(t, editMsg.Text, "_spam sample removed by admin_")
+	assert.Equal(t, [][]tbapi.InlineKeyboardButton{kb[0]}, editMsg.ReplyMarkup.InlineKeyboard, "remove sample button dropped")
+	assert.Equal(t, 0, len(b.UpdateSpamCalls()))
+	assert.Equal(t, 0, len(b.UpdateHamCalls()))
+
+	// press info button on the ban report with remove sample button already
+	query.Data = "!999:987654"
+	query.Message.ReplyMarkup = &tbapi.InlineKeyboardMarkup{InlineKeyboard: [][]tbapi.InlineKeyboardButton{
+		tbapi.NewInlineKeyboardRow(tbapi.NewInlineKeyboardButtonData("unban", "?999:987654"),
+			tbapi.NewInlineKeyboardButtonData("info", "!999:987654")),
+		tbapi.NewInlineKeyboardRow(tbapi.NewInlineKeyboardButtonData("✂ remove sample", "#999:987654")),
+	}}
+	updChan = make(chan tbapi.Update, 1)
+	updChan <- tbapi.Update{CallbackQuery: query}
+	close(updChan)
+
+	err = l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Equal(t, 3, len(mockAPI.SendCalls()))
+	editMsg = mockAPI.SendCalls()[2].C.(tbapi.EditMessageTextConfig)
+	kb = editMsg.ReplyMarkup.InlineKeyboard
+	require.Equal(t, 2, len(kb), "remove sample button not duplicated")
+	assert.Equal(t, 1, len(kb[0]), "info button removed")
+	assert.Equal(t, "#999:987654", *kb[1][0].CallbackData)
+}
+
 func TestTelegramListener_isChatAllowed(t *testing.T) {
 	testCases := []struct {
 		name       string
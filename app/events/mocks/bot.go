@@ -4,6 +4,7 @@
 package mocks
 
 import (
+	"context"
 	"github.com/umputun/tg-spam/app/bot"
 	"sync"
 )
@@ -20,12 +21,15 @@ import (
 //			IsApprovedUserFunc: func(userID int64) bool {
 //				panic("mock out the IsApprovedUser method")
 //			},
-//			OnMessageFunc: func(msg bot.Message) bot.Response {
+//			OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
 //				panic("mock out the OnMessage method")
 //			},
 //			RemoveApprovedUserFunc: func(id int64) error {
 //				panic("mock out the RemoveApprovedUser method")
 //			},
+//			RemoveDynamicSpamSampleFunc: func(sample string) (int, error) {
+//				panic("mock out the RemoveDynamicSpamSample method")
+//			},
 //			UpdateHamFunc: func(msg string) error {
 //				panic("mock out the UpdateHam method")
 //			},
@@ -46,11 +50,14 @@ type BotMock struct {
 	IsApprovedUserFunc func(userID int64) bool
 
 	// OnMessageFunc mocks the OnMessage method.
-	OnMessageFunc func(msg bot.Message) bot.Response
+	OnMessageFunc func(ctx context.Context, msg bot.Message) bot.Response
 
 	// RemoveApprovedUserFunc mocks the RemoveApprovedUser method.
 	RemoveApprovedUserFunc func(id int64) error
 
+	// RemoveDynamicSpamSampleFunc mocks the RemoveDynamicSpamSample method.
+	RemoveDynamicSpamSampleFunc func(sample string) (int, error)
+
 	// UpdateHamFunc mocks the UpdateHam method.
 	UpdateHamFunc func(msg string) error
 
@@ -73,6 +80,8 @@ type BotMock struct {
 		}
 		// OnMessage holds details about calls to the OnMessage method.
 		OnMessage []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
 			// Msg is the msg argument value.
 			Msg bot.Message
 		}
@@ -81,6 +90,11 @@ type BotMock struct {
 			// ID is the id argument value.
 			ID int64
 		}
+		// RemoveDynamicSpamSample holds details about calls to the RemoveDynamicSpamSample method.
+		RemoveDynamicSpamSample []struct {
+			// Sample is the sample argument value.
+			Sample string
+		}
 		// UpdateHam holds details about calls to the UpdateHam method.
 		UpdateHam []struct {
 			// Msg is the msg argument value.
@@ -92,12 +106,13 @@ type BotMock struct {
 			Msg string
 		}
 	}
-	lockAddApprovedUser    sync.RWMutex
-	lockIsApprovedUser     sync.RWMutex
-	lockOnMessage          sync.RWMutex
-	lockRemoveApprovedUser sync.RWMutex
-	lockUpdateHam          sync.RWMutex
-	lockUpdateSpam         sync.RWMutex
+	lockAddApprovedUser         sync.RWMutex
+	lockIsApprovedUser          sync.RWMutex
+	lockOnMessage               sync.RWMutex
+	lockRemoveApprovedUser      sync.RWMutex
+	lockRemoveDynamicSpamSample sync.RWMutex
+	lockUpdateHam               sync.RWMutex
+	lockUpdateSpam              sync.RWMutex
 }
 
 // AddApprovedUser calls AddApprovedUserFunc.
@@ -183,19 +198,21 @@ func (mock *BotMock) ResetIsApprovedUserCalls() {
 }
 
 // OnMessage calls OnMessageFunc.
-func (mock *BotMock) OnMessage(msg bot.Message) bot.Response {
+func (mock *BotMock) OnMessage(ctx context.Context, msg bot.Message) bot.Response {
 	if mock.OnMessageFunc == nil {
 		panic("BotMock.OnMessageFunc: method is nil but Bot.OnMessage was just called")
 	}
 	callInfo := struct {
+		Ctx context.Context
 		Msg bot.Message
 	}{
+		Ctx: ctx,
 		Msg: msg,
 	}
 	mock.lockOnMessage.Lock()
 	mock.calls.OnMessage = append(mock.calls.OnMessage, callInfo)
 	mock.lockOnMessage.Unlock()
-	return mock.OnMessageFunc(msg)
+	return mock.OnMessageFunc(ctx, msg)
 }
 
 // OnMessageCalls gets all the calls that were made to OnMessage.
@@ -203,9 +220,11 @@ func (mock *BotMock) OnMessage(msg bot.Message) bot.Response {
 //
 //	len(mockedBot.OnMessageCalls())
 func (mock *BotMock) OnMessageCalls() []struct {
+	Ctx context.Context
 	Msg bot.Message
 } {
 	var calls []struct {
+		Ctx context.Context
 		Msg bot.Message
 	}
 	mock.lockOnMessage.RLock()
@@ -260,6 +279,45 @@ func (mock *BotMock) ResetRemoveApprovedUserCalls() {
 	mock.lockRemoveApprovedUser.Unlock()
 }
 
+// RemoveDynamicSpamSample calls RemoveDynamicSpamSampleFunc.
+func (mock *BotMock) RemoveDynamicSpamSample(sample string) (int, error) {
+	if mock.RemoveDynamicSpamSampleFunc == nil {
+		panic("BotMock.RemoveDynamicSpamSampleFunc: method is nil but Bot.RemoveDynamicSpamSample was just called")
+	}
+	callInfo := struct {
+		Sample string
+	}{
+		Sample: sample,
+	}
+	mock.lockRemoveDynamicSpamSample.Lock()
+	mock.calls.RemoveDynamicSpamSample = append(mock.calls.RemoveDynamicSpamSample, callInfo)
+	mock.lockRemoveDynamicSpamSample.Unlock()
+	return mock.RemoveDynamicSpamSampleFunc(sample)
+}
+
+// RemoveDynamicSpamSampleCalls gets all the calls that were made to RemoveDynamicSpamSample.
+// Check the length with:
+//
+//	len(mockedBot.RemoveDynamicSpamSampleCalls())
+func (mock *BotMock) RemoveDynamicSpamSampleCalls() []struct {
+	Sample string
+} {
+	var calls []struct {
+		Sample string
+	}
+	mock.lockRemoveDynamicSpamSample.RLock()
+	calls = mock.calls.RemoveDynamicSpamSample
+	mock.lockRemoveDynamicSpamSample.RUnlock()
+	return calls
+}
+
+// ResetRemoveDynamicSpamSampleCalls reset all the calls that were made to RemoveDynamicSpamSample.
+func (mock *BotMock) ResetRemoveDynamicSpamSampleCalls() {
+	mock.lockRemoveDynamicSpamSample.Lock()
+	mock.calls.RemoveDynamicSpamSample = nil
+	mock.lockRemoveDynamicSpamSample.Unlock()
+}
+
 // UpdateHam calls UpdateHamFunc.
 func (mock *BotMock) UpdateHam(msg string) error {
 	if mock.UpdateHamFunc == nil {
@@ -356,6 +414,10 @@ func (mock *BotMock) ResetCalls() {
 	mock.calls.RemoveApprovedUser = nil
 	mock.lockRemoveApprovedUser.Unlock()
 
+	mock.lockRemoveDynamicSpamSample.Lock()
+	mock.calls.RemoveDynamicSpamSample = nil
+	mock.lockRemoveDynamicSpamSample.Unlock()
+
 	mock.lockUpdateHam.Lock()
 	mock.calls.UpdateHam = nil
 	mock.lockUpdateHam.Unlock()
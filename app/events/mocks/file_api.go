@@ -0,0 +1,85 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"sync"
+)
+
+// FileAPIMock is a mock implementation of events.FileAPI.
+//
+//	func TestSomethingThatUsesFileAPI(t *testing.T) {
+//
+//		// make and configure a mocked events.FileAPI
+//		mockedFileAPI := &FileAPIMock{
+//			GetFileFunc: func(config tbapi.FileConfig) (tbapi.File, error) {
+//				panic("mock out the GetFile method")
+//			},
+//		}
+//
+//		// use mockedFileAPI in code that requires events.FileAPI
+//		// and then make assertions.
+//
+//	}
+type FileAPIMock struct {
+	// GetFileFunc mocks the GetFile method.
+	GetFileFunc func(config tbapi.FileConfig) (tbapi.File, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// GetFile holds details about calls to the GetFile method.
+		GetFile []struct {
+			// Config is the config argument value.
+			Config tbapi.FileConfig
+		}
+	}
+	lockGetFile sync.RWMutex
+}
+
+// GetFile calls GetFileFunc.
+func (mock *FileAPIMock) GetFile(config tbapi.FileConfig) (tbapi.File, error) {
+	if mock.GetFileFunc == nil {
+		panic("FileAPIMock.GetFileFunc: method is nil but FileAPI.GetFile was just called")
+	}
+	callInfo := struct {
+		Config tbapi.FileConfig
+	}{
+		Config: config,
+	}
+	mock.lockGetFile.Lock()
+	mock.calls.GetFile = append(mock.calls.GetFile, callInfo)
+	mock.lockGetFile.Unlock()
+	return mock.GetFileFunc(config)
+}
+
+// GetFileCalls gets all the calls that were made to GetFile.
+// Check the length with:
+//
+//	len(mockedFileAPI.GetFileCalls())
+func (mock *FileAPIMock) GetFileCalls() []struct {
+	Config tbapi.FileConfig
+} {
+	var calls []struct {
+		Config tbapi.FileConfig
+	}
+	mock.lockGetFile.RLock()
+	calls = mock.calls.GetFile
+	mock.lockGetFile.RUnlock()
+	return calls
+}
+
+// ResetGetFileCalls reset all the calls that were made to GetFile.
+func (mock *FileAPIMock) ResetGetFileCalls() {
+	mock.lockGetFile.Lock()
+	mock.calls.GetFile = nil
+	mock.lockGetFile.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *FileAPIMock) ResetCalls() {
+	mock.lockGetFile.Lock()
+	mock.calls.GetFile = nil
+	mock.lockGetFile.Unlock()
+}
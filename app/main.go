@@ -60,8 +60,15 @@ type options struct {
 	NoSpamReply bool              `long:"no-spam-reply" env:"NO_SPAM_REPLY" description:"do not reply to spam messages"`
 
 	CAS struct {
-		API     string        `long:"api" env:"API" default:"https://api.cas.chat" description:"CAS API"`
-		Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"5s" description:"CAS timeout"`
+		API          string        `long:"api" env:"API" default:"https://api.cas.chat" description:"CAS API"`
+		Timeout      time.Duration `long:"timeout" env:"TIMEOUT" default:"5s" description:"CAS timeout"`
+		CacheTTL     time.Duration `long:"cache-ttl" env:"CACHE_TTL" description:"CAS cache TTL for spam results, disabled if 0"`
+		CacheNegTTL  time.Duration `long:"cache-neg-ttl" env:"CACHE_NEG_TTL" description:"CAS cache TTL for not spam results, disabled if 0"`
+		CacheSize    int           `long:"cache-size" env:"CACHE_SIZE" default:"10000" description:"max number of cached CAS results"`
+		CachePersist bool          `long:"cache-persist" env:"CACHE_PERSIST" description:"persist CAS cache in the data db"`
+		Mirror       bool          `long:"mirror" env:"MIRROR" description:"enable local CAS mirror imported from CAS export"`
+		MirrorSource string        `long:"mirror-source" env:"MIRROR_SOURCE" default:"https://api.cas.chat/export.csv" description:"CAS export url or file"`
+		MirrorSync   time.Duration `long:"mirror-sync" env:"MIRROR_SYNC" default:"1h" description:"CAS mirror sync interval"`
 	} `group:"cas" namespace:"cas" env-namespace:"CAS"`
 
 	Meta struct {
@@ -71,25 +78,69 @@ type options struct {
 	} `group:"meta" namespace:"meta" env-namespace:"META"`
 
 	OpenAI struct {
-		Token                            string `long:"token" env:"TOKEN" description:"openai token, disabled if not set"`
-		Veto                             bool   `long:"veto" env:"VETO" description:"veto mode, confirm detected spam"`
-		Prompt                           string `long:"prompt" env:"PROMPT" default:"" description:"openai system prompt, if empty uses builtin default"`
-		Model                            string `long:"model" env:"MODEL" default:"gpt-4" description:"openai model"`
-		MaxTokensResponse                int    `long:"max-tokens-response" env:"MAX_TOKENS_RESPONSE" default:"1024" description:"openai max tokens in response"`
-		MaxTokensRequestMaxTokensRequest int    `long:"max-tokens-request" env:"MAX_TOKENS_REQUEST" default:"2048" description:"openai max tokens in request"`
-		MaxSymbolsRequest                int    `long:"max-symbols-request" env:"MAX_SYMBOLS_REQUEST" default:"16000" description:"openai max symbols in request, failback if tokenizer failed"`
+		Token                            string            `long:"token" env:"TOKEN" description:"openai token, disabled if not set and no base url"`
+		Provider                         string            `long:"provider" env:"PROVIDER" choice:"openai" choice:"anthropic" default:"openai" description:"llm api, openai chat completions or anthropic messages"`
+		BaseURL                          string            `long:"base-url" env:"BASE_URL" description:"base url of openai-compatible api, enables openai check without token"`
+		Org                              string            `long:"org" env:"ORG" description:"openai organization id"`
+		Headers                          map[string]string `long:"header" env:"HEADER" env-delim:"," description:"extra http header for openai api, name:value"`
+		Veto                             bool              `long:"veto" env:"VETO" description:"veto mode, confirm detected spam"`
+		GrayZone                         bool              `long:"gray-zone" env:"GRAY_ZONE" description:"call openai only for uncertain classifier or similarity results, spam checked only with veto"`
+		GrayMinProb                      float64           `long:"gray-min-prob" env:"GRAY_MIN_PROB" default:"30" description:"gray zone lower bound of classifier spam probability, in percents"`
+		GrayMaxProb                      float64           `long:"gray-max-prob" env:"GRAY_MAX_PROB" default:"80" description:"gray zone upper bound of classifier spam probability, 0 to ignore probability"`
+		GrayMinSim                       float64           `long:"gray-min-sim" env:"GRAY_MIN_SIM" default:"0.3" description:"gray zone lower bound of similarity"`
+		GrayMaxSim                       float64           `long:"gray-max-sim" env:"GRAY_MAX_SIM" default:"0.6" description:"gray zone upper bound of similarity, 0 to ignore similarity"`
+		Structured                       bool              `long:"structured" env:"STRUCTURED" description:"ask for structured json response, json mode or tool use"`
+		Prompt                           string            `long:"prompt" env:"PROMPT" default:"" description:"openai system prompt, if empty uses builtin default"`
+		FewShot                          int               `long:"few-shot" env:"FEW_SHOT" default:"0" description:"number of the nearest spam and ham samples added to openai prompt as examples"`
+		PromptContext                    bool              `long:"prompt-context" env:"PROMPT_CONTEXT" description:"add results of other checks and user metadata to openai prompt"`
+		PromptTemplate                   string            `long:"prompt-template" env:"PROMPT_TEMPLATE" description:"file with go template of openai prompt, builtin default if not set"`
+		Model                            string            `long:"model" env:"MODEL" default:"gpt-4" description:"openai model"`
+		MaxTokensResponse                int               `long:"max-tokens-response" env:"MAX_TOKENS_RESPONSE" default:"1024" description:"openai max tokens in response"`
+		MaxTokensRequestMaxTokensRequest int               `long:"max-tokens-request" env:"MAX_TOKENS_REQUEST" default:"2048" description:"openai max tokens in request"`
+		MaxSymbolsRequest                int               `long:"max-symbols-request" env:"MAX_SYMBOLS_REQUEST" default:"16000" description:"openai max symbols in request, failback if tokenizer failed"`
+		Timeout                          time.Duration     `long:"timeout" env:"TIMEOUT" default:"30s" description:"openai check timeout"`
+		CacheTTL                         time.Duration     `long:"cache-ttl" env:"CACHE_TTL" default:"1h" description:"ttl of cached openai responses by message text, 0 to disable"`
+		CacheSize                        int               `long:"cache-size" env:"CACHE_SIZE" default:"1000" description:"max number of cached openai responses"`
+		RPM                              int               `long:"rpm" env:"RPM" default:"0" description:"max openai requests per minute, 0 for unlimited"`
+		DailyTokens                      int               `long:"daily-tokens" env:"DAILY_TOKENS" default:"0" description:"daily budget of openai tokens, 0 for unlimited"`
+		DailyCost                        float64           `long:"daily-cost" env:"DAILY_COST" default:"0" description:"daily budget of openai cost, 0 for unlimited"`
+		InputPrice                       float64           `long:"input-price" env:"INPUT_PRICE" default:"0" description:"price of 1M input tokens, for the daily cost"`
+		OutputPrice                      float64           `long:"output-price" env:"OUTPUT_PRICE" default:"0" description:"price of 1M output tokens, for the daily cost"`
 	} `group:"openai" namespace:"openai" env-namespace:"OPENAI"`
 
+	Vision struct {
+		Enabled   bool          `long:"enabled" env:"ENABLED" description:"check images with vision model, uses openai provider and token"`
+		Model     string        `long:"model" env:"MODEL" default:"gpt-4o" description:"vision model"`
+		Prompt    string        `long:"prompt" env:"PROMPT" default:"" description:"vision system prompt, if empty uses builtin default"`
+		Detail    string        `long:"detail" env:"DETAIL" choice:"low" choice:"high" choice:"auto" default:"low" description:"image detail, low is cheaper"`
+		MaxSizeKB int           `long:"max-size" env:"MAX_SIZE" default:"5120" description:"max image size to check, in KB"`
+		Timeout   time.Duration `long:"timeout" env:"TIMEOUT" default:"30s" description:"vision check timeout, including image download"`
+	} `group:"vision" namespace:"vision" env-namespace:"VISION"`
+
+	Score struct {
+		Threshold float64            `long:"threshold" env:"THRESHOLD" default:"0" description:"total score threshold, enables weighted scoring if set"`
+		Weights   map[string]float64 `long:"weight" env:"WEIGHT" env-delim:"," description:"weight of a check for scoring, name:weight"`
+	} `group:"score" namespace:"score" env-namespace:"SCORE"`
+
+	Tokenizer struct {
+		Mode      string `long:"mode" env:"MODE" choice:"words" choice:"char-ngrams" choice:"word-bigrams" default:"words" description:"tokenization strategy"`
+		NgramSize int    `long:"ngram-size" env:"NGRAM_SIZE" default:"3" description:"size of character n-grams for char-ngrams mode"`
+	} `group:"tokenizer" namespace:"tokenizer" env-namespace:"TOKENIZER"`
+
 	Files struct {
 		SamplesDataPath string        `long:"samples" env:"SAMPLES" default:"data" description:"samples data path"`
 		DynamicDataPath string        `long:"dynamic" env:"DYNAMIC" default:"data" description:"dynamic data path"`
 		WatchInterval   time.Duration `long:"watch-interval" env:"WATCH_INTERVAL" default:"5s" description:"watch interval for dynamic files"`
+		Snapshot        bool          `long:"snapshot" env:"SNAPSHOT" description:"save trained state snapshot in dynamic data path to speed up loading"`
 	} `group:"files" namespace:"files" env-namespace:"FILES"`
 
 	SimilarityThreshold float64 `long:"similarity-threshold" env:"SIMILARITY_THRESHOLD" default:"0.5" description:"spam threshold"`
+	SimilarityTFIDF     bool    `long:"similarity-tfidf" env:"SIMILARITY_TFIDF" description:"use tf-idf weights for similarity check"`
 	MinMsgLen           int     `long:"min-msg-len" env:"MIN_MSG_LEN" default:"50" description:"min message length to check"`
 	MaxEmoji            int     `long:"max-emoji" env:"MAX_EMOJI" default:"2" description:"max emoji count in message, -1 to disable check"`
+	ObfuscationRatio    float64 `long:"obfuscation-ratio" env:"OBFUSCATION_RATIO" default:"0" description:"obfuscated words ratio to mark message as spam, 0 to disable check"`
 	MinSpamProbability  float64 `long:"min-probability" env:"MIN_PROBABILITY" default:"50" description:"min spam probability percent to ban"`
+	TopTokens           int     `long:"top-tokens" env:"TOP_TOKENS" default:"5" description:"number of top contributing tokens to report for classifier, 0 to disable"`
 
 	ParanoidMode       bool `long:"paranoid" env:"PARANOID" description:"paranoid mode, check all messages"`
 	FirstMessagesCount int  `long:"first-messages-count" env:"FIRST_MESSAGES_COUNT" default:"1" description:"number of first messages to check"`
@@ -110,6 +161,9 @@ type options struct {
 	Training bool `long:"training" env:"TRAINING" description:"training mode, passive spam detection only"`
 	SoftBan  bool `long:"soft-ban" env:"SOFT_BAN" description:"soft ban mode, restrict user actions but not ban"`
 
+	Eval evalOptions `command:"eval" description:"evaluate spam detection with the current options on labeled messages"`
+	Tune tuneOptions `command:"tune" description:"tune detection thresholds on labeled messages"`
+
 	Dry   bool `long:"dry" env:"DRY" description:"dry mode, no bans"`
 	Dbg   bool `long:"dbg" env:"DEBUG" description:"debug mode"`
 	TGDbg bool `long:"tg-dbg" env:"TG_DEBUG" description:"telegram debug mode"`
@@ -124,6 +178,7 @@ const (
 	dynamicSpamFile   = "spam-dynamic.txt"
 	dynamicHamFile    = "ham-dynamic.txt"
 	dataFile          = "tg-spam.db"
+	snapshotFile      = "tg-spam.snapshot"
 )
 
 var revision = "local"
@@ -141,6 +196,9 @@ func main() {
 	}
 
 	masked := []string{opts.Telegram.Token, opts.OpenAI.Token}
+	for _, v := range opts.OpenAI.Headers { // headers may carry api keys of openai-compatible servers
+		masked = append(masked, v)
+	}
 	if opts.Server.AuthPasswd != "auto" && opts.Server.AuthPasswd != "" { // auto passwd should not be masked as we print it
 		masked = append(masked, opts.Server.AuthPasswd)
 	}
@@ -163,6 +221,18 @@ func main() {
 	opts.Files.DynamicDataPath = expandPath(opts.Files.DynamicDataPath)
 	opts.Files.SamplesDataPath = expandPath(opts.Files.SamplesDataPath)
 
+	if p.Active != nil {
+		run := runEval
+		if p.Active.Name == "tune" {
+			run = runTune
+		}
+		if err := run(ctx, opts, os.Stdout); err != nil {
+			log.Printf("[ERROR] %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := execute(ctx, opts); err != nil {
 		log.Printf("[ERROR] %v", err)
 		os.Exit(1)
@@ -188,6 +258,18 @@ func execute(ctx context.Context, opts options) error {
 		return fmt.Errorf("can't make dynamic dir, %w", err)
 	}
 
+	if opts.Vision.Enabled && opts.OpenAI.Token == "" && opts.OpenAI.BaseURL == "" {
+		return errors.New("vision check requires openai token or base url")
+	}
+
+	if _, err := loadOpenAIPromptTemplate(opts); err != nil {
+		return fmt.Errorf("can't load openai prompt template, %w", err)
+	}
+
+	if err := validateLLMOptions(opts); err != nil {
+		return fmt.Errorf("invalid openai options, %w", err)
+	}
+
 	// make detector with all sample files loaded
 	detector := makeDetector(opts)
 
@@ -210,6 +292,35 @@ func execute(ctx context.Context, opts options) error {
 	}
 	log.Printf("[DEBUG] approved users from: %s, loaded: %d", dataFile, count)
 
+	if opts.CAS.CachePersist {
+		casCacheStore, ccErr := storage.NewCasCache(dataDB, opts.CAS.CacheSize)
+		if ccErr != nil {
+			return fmt.Errorf("can't make cas cache store, %w", ccErr)
+		}
+		count, err = detector.WithCasCacheStorage(casCacheStore)
+		if err != nil {
+			return fmt.Errorf("can't load cas cache, %w", err)
+		}
+		log.Printf("[DEBUG] cas cache from: %s, loaded: %d", dataFile, count)
+	}
+
+	if opts.OpenAI.Token != "" || opts.OpenAI.BaseURL != "" {
+		llmUsageStore, luErr := storage.NewLLMUsage(dataDB)
+		if luErr != nil {
+			return fmt.Errorf("can't make llm usage store, %w", luErr)
+		}
+		if err = detector.WithLLMUsageStorage(llmUsageStore); err != nil {
+			return fmt.Errorf("can't load llm usage, %w", err)
+		}
+	}
+
+	if opts.CAS.Mirror {
+		// mirror syncs in background goroutine
+		if err := activateCasMirror(ctx, opts, detector, dataDB); err != nil {
+			return fmt.Errorf("can't activate cas mirror, %w", err)
+		}
+	}
+
 	// make spam bot
 	spamBot, err := makeSpamBot(ctx, opts, detector)
 	if err != nil {
@@ -243,6 +354,10 @@ func execute(ctx context.Context, opts options) error {
 	}
 	tbAPI.Debug = opts.TGDbg
 
+	if opts.Vision.Enabled {
+		activateVision(opts, detector, tbAPI)
+	}
+
 	// make spam logger writer
 	loggerWr, err := makeSpamLogWriter(opts)
 	if err != nil {
@@ -350,31 +465,53 @@ func activateServer(ctx context.Context, opts options, sf *bot.SpamFilter, loc *
 		LoggerEnabled:           opts.Logger.Enabled,
 		SuperUsers:              opts.SuperUsers,
 		NoSpamReply:             opts.NoSpamReply,
-		CasEnabled:              opts.CAS.API != "",
+		CasEnabled:              opts.CAS.API != "" || opts.CAS.Mirror,
+		CasMirrorEnabled:        opts.CAS.Mirror,
+		CasMirrorSource:         opts.CAS.MirrorSource,
 		MetaEnabled:             opts.Meta.ImageOnly || opts.Meta.LinksLimit >= 0 || opts.Meta.LinksOnly,
 		MetaLinksLimit:          opts.Meta.LinksLimit,
 		MetaLinksOnly:           opts.Meta.LinksOnly,
 		MetaImageOnly:           opts.Meta.ImageOnly,
-		OpenAIEnabled:           opts.OpenAI.Token != "",
+		OpenAIEnabled:           opts.OpenAI.Token != "" || opts.OpenAI.BaseURL != "",
+		OpenAIGrayZone:          openAIGrayZone(opts),
 		SamplesDataPath:         opts.Files.SamplesDataPath,
 		DynamicDataPath:         opts.Files.DynamicDataPath,
 		WatchIntervalSecs:       int(opts.Files.WatchInterval.Seconds()),
 		SimilarityThreshold:     opts.SimilarityThreshold,
+		SimilarityTFIDF:         opts.SimilarityTFIDF,
 		MinMsgLen:               opts.MinMsgLen,
 		MaxEmoji:                opts.MaxEmoji,
+		ObfuscationRatio:        opts.ObfuscationRatio,
+		Tokenization:            opts.Tokenizer.Mode,
+		NgramSize:               opts.Tokenizer.NgramSize,
 		MinSpamProbability:      opts.MinSpamProbability,
+		ClassifierTopTokens:     opts.TopTokens,
 		ParanoidMode:            opts.ParanoidMode,
 		FirstMessagesCount:      opts.FirstMessagesCount,
 		StartupMessageEnabled:   opts.Message.Startup != "",
 		TrainingEnabled:         opts.Training,
+		ScoreThreshold:          opts.Score.Threshold,
+		CheckWeights:            opts.Score.Weights,
+	}
+
+	var casMirror webapi.CasMirror
+	if opts.CAS.Mirror {
+		if casMirror, err = storage.NewCasMirror(dataDB); err != nil {
+			return fmt.Errorf("can't make cas mirror store, %w", err)
+		}
 	}
 
+	llmStats, _ := sf.Detector.(webapi.LLMStats) // nil if the detector doesn't report stats
+
 	srv := webapi.Server{Config: webapi.Config{
 		ListenAddr:   opts.Server.ListenAddr,
 		Detector:     sf.Detector,
 		SpamFilter:   sf,
 		Locator:      loc,
 		DetectedSpam: detectedSpamStore,
+		CasMirror:    casMirror,
+		Tuner:        detectorTuner{opts: opts},
+		LLMStats:     llmStats,
 		AuthPasswd:   authPassswd,
 		Version:      revision,
 		Dbg:          opts.Dbg,
@@ -389,19 +526,70 @@ func activateServer(ctx context.Context, opts options, sf *bot.SpamFilter, loc *
 	return nil
 }
 
+// activateCasMirror makes local CAS mirror, sets it to the detector and starts background sync of the mirror
+// with CAS export. The first sync performed right away, and the next ones with the sync interval.
+func activateCasMirror(ctx context.Context, opts options, detector *tgspam.Detector, dataDB *sqlx.DB) error {
+	if opts.CAS.MirrorSync <= 0 {
+		return fmt.Errorf("invalid cas mirror sync interval %v", opts.CAS.MirrorSync)
+	}
+	mirror, err := storage.NewCasMirror(dataDB)
+	if err != nil {
+		return fmt.Errorf("can't make cas mirror store, %w", err)
+	}
+	detector.WithCasMirror(mirror)
+	log.Printf("[INFO] cas mirror enabled, source: %s, sync interval: %v", opts.CAS.MirrorSource, opts.CAS.MirrorSync)
+
+	client := &http.Client{Timeout: 10 * time.Minute} // export is large, download can take a while
+	go func() {
+		ticker := time.NewTicker(opts.CAS.MirrorSync)
+		defer ticker.Stop()
+		for {
+			info, err := mirror.Sync(ctx, client, opts.CAS.MirrorSource)
+			if err != nil {
+				log.Printf("[WARN] can't sync cas mirror, %v", err)
+			}
+			if err == nil && info.Unchanged {
+				log.Printf("[DEBUG] cas mirror is up to date, total: %d", info.Total)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
 // makeDetector creates spam detector with all checkers and updaters
 // it loads samples and dynamic files
 func makeDetector(opts options) *tgspam.Detector {
 	detectorConfig := tgspam.Config{
-		MaxAllowedEmoji:     opts.MaxEmoji,
-		MinMsgLen:           opts.MinMsgLen,
-		SimilarityThreshold: opts.SimilarityThreshold,
-		MinSpamProbability:  opts.MinSpamProbability,
-		CasAPI:              opts.CAS.API,
-		HTTPClient:          &http.Client{Timeout: opts.CAS.Timeout},
-		FirstMessageOnly:    !opts.ParanoidMode,
-		FirstMessagesCount:  opts.FirstMessagesCount,
-		OpenAIVeto:          opts.OpenAI.Veto,
+		MaxAllowedEmoji:      opts.MaxEmoji,
+		ObfuscationThreshold: opts.ObfuscationRatio,
+		Tokenization:         opts.Tokenizer.Mode,
+		NgramSize:            opts.Tokenizer.NgramSize,
+		MinMsgLen:            opts.MinMsgLen,
+		SimilarityThreshold:  opts.SimilarityThreshold,
+		SimilarityTFIDF:      opts.SimilarityTFIDF,
+		MinSpamProbability:   opts.MinSpamProbability,
+		ClassifierTopTokens:  opts.TopTokens,
+		CasAPI:               opts.CAS.API,
+		HTTPClient:           &http.Client{Timeout: opts.CAS.Timeout},
+		CasCacheTTL:          opts.CAS.CacheTTL,
+		CasCacheNegativeTTL:  opts.CAS.CacheNegTTL,
+		CasCacheSize:         opts.CAS.CacheSize,
+		FirstMessageOnly:     !opts.ParanoidMode,
+		FirstMessagesCount:   opts.FirstMessagesCount,
+		OpenAIVeto:           opts.OpenAI.Veto,
+		OpenAIGrayZone:       openAIGrayZone(opts),
+		ScoreThreshold:       opts.Score.Threshold,
+		CheckWeights:         opts.Score.Weights,
+		CheckTimeouts:        map[string]time.Duration{"cas": opts.CAS.Timeout, "openai": opts.OpenAI.Timeout, "vision": opts.Vision.Timeout},
+	}
+
+	if opts.Files.Snapshot {
+		detectorConfig.SnapshotFile = filepath.Join(opts.Files.DynamicDataPath, snapshotFile)
 	}
 
 	// FirstMessagesCount and ParanoidMode are mutually exclusive.
@@ -417,33 +605,46 @@ func makeDetector(opts options) *tgspam.Detector {
 	detector := tgspam.NewDetector(detectorConfig)
 	log.Printf("[DEBUG] detector config: %+v", detectorConfig)
 
-	if opts.OpenAI.Token != "" {
-		log.Printf("[WARN] openai enabled")
+	if opts.OpenAI.Token != "" || opts.OpenAI.BaseURL != "" {
+		log.Printf("[WARN] openai enabled, provider: %s, base url: %q", opts.OpenAI.Provider, opts.OpenAI.BaseURL)
 		openAIConfig := tgspam.OpenAIConfig{
 			SystemPrompt:      opts.OpenAI.Prompt,
 			Model:             opts.OpenAI.Model,
 			MaxTokensResponse: opts.OpenAI.MaxTokensResponse,
 			MaxTokensRequest:  opts.OpenAI.MaxTokensRequestMaxTokensRequest,
 			MaxSymbolsRequest: opts.OpenAI.MaxSymbolsRequest,
+			StructuredOutput:  opts.OpenAI.Structured,
+			FewShotSamples:    opts.OpenAI.FewShot,
+			PromptContext:     opts.OpenAI.PromptContext,
+			CacheTTL:          opts.OpenAI.CacheTTL,
+			CacheSize:         opts.OpenAI.CacheSize,
+			RequestsPerMinute: opts.OpenAI.RPM,
+			DailyTokens:       opts.OpenAI.DailyTokens,
+			DailyCost:         opts.OpenAI.DailyCost,
+			InputTokenPrice:   opts.OpenAI.InputPrice,
+			OutputTokenPrice:  opts.OpenAI.OutputPrice,
+		}
+		tmpl, err := loadOpenAIPromptTemplate(opts)
+		if err != nil {
+			log.Printf("[WARN] can't load openai prompt template, default used: %v", err)
 		}
+		openAIConfig.PromptTemplate = tmpl
 		log.Printf("[DEBUG] openai  config: %+v", openAIConfig)
-		detector.WithOpenAIChecker(openai.NewClient(opts.OpenAI.Token), openAIConfig)
+		detector.WithLLMChecker(makeLLMProvider(opts), openAIConfig)
 	}
 
-	metaChecks := []tgspam.MetaCheck{}
 	if opts.Meta.ImageOnly {
 		log.Printf("[INFO] image only check enabled")
-		metaChecks = append(metaChecks, tgspam.ImagesCheck())
+		detector.WithMetaCheck("images", tgspam.ImagesCheck())
 	}
 	if opts.Meta.LinksLimit >= 0 {
 		log.Printf("[INFO] links check enabled, limit: %d", opts.Meta.LinksLimit)
-		metaChecks = append(metaChecks, tgspam.LinksCheck(opts.Meta.LinksLimit))
+		detector.WithMetaCheck("links", tgspam.LinksCheck(opts.Meta.LinksLimit))
 	}
 	if opts.Meta.LinksOnly {
 		log.Printf("[INFO] links only check enabled")
-		metaChecks = append(metaChecks, tgspam.LinkOnlyCheck())
+		detector.WithMetaCheck("link-only", tgspam.LinkOnlyCheck())
 	}
-	detector.WithMetaChecks(metaChecks...)
 
 	dynSpamFile := filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile)
 	detector.WithSpamUpdater(bot.NewSampleUpdater(dynSpamFile))
@@ -456,8 +657,130 @@ func makeDetector(opts options) *tgspam.Detector {
 	return detector
 }
 
+// openAIGrayZone returns the gray zone of openai check from options
+func openAIGrayZone(opts options) tgspam.GrayZone {
+	return tgspam.GrayZone{Enabled: opts.OpenAI.GrayZone, MinProbability: opts.OpenAI.GrayMinProb,
+		MaxProbability: opts.OpenAI.GrayMaxProb, MinSimilarity: opts.OpenAI.GrayMinSim, MaxSimilarity: opts.OpenAI.GrayMaxSim}
+}
+
+// activateVision registers the vision check of message images, downloaded with telegram bot api.
+// The check uses the same provider, base url and token as openai check.
+func activateVision(opts options, detector *tgspam.Detector, api events.FileAPI) {
+	loader := &events.ImageLoader{API: api, Token: opts.Telegram.Token, Client: &http.Client{Timeout: opts.Vision.Timeout},
+		MaxSize: int64(opts.Vision.MaxSizeKB) * 1024}
+	config := tgspam.VisionConfig{Model: opts.Vision.Model, SystemPrompt: opts.Vision.Prompt, Detail: opts.Vision.Detail,
+		StructuredOutput: opts.OpenAI.Structured}
+	log.Printf("[INFO] vision check enabled, model: %s, detail: %s, max size: %dKB", config.Model, config.Detail,
+		opts.Vision.MaxSizeKB)
+	detector.WithVisionChecker(makeLLMProvider(opts), loader, config)
+}
+
+// loadOpenAIPromptTemplate reads and validates the template of openai prompt from the file, empty if not set
+func loadOpenAIPromptTemplate(opts options) (string, error) {
+	if opts.OpenAI.PromptTemplate == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(opts.OpenAI.PromptTemplate) //nolint:gosec // file name from cli options
+	if err != nil {
+		return "", fmt.Errorf("can't read %s, %w", opts.OpenAI.PromptTemplate, err)
+	}
+	if err := tgspam.ValidateLLMPromptTemplate(string(data)); err != nil {
+		return "", fmt.Errorf("invalid template in %s, %w", opts.OpenAI.PromptTemplate, err)
+	}
+	return string(data), nil
+}
+
+// validateLLMOptions checks the options of llm provider which would fail on each request or be ignored silently.
+// OpenAI json mode of structured output rejects requests without "json" word in the system prompt, and the model
+// and organization options have openai defaults and meaning, not applicable to anthropic.
+func validateLLMOptions(opts options) error {
+	if opts.OpenAI.Token == "" && opts.OpenAI.BaseURL == "" {
+		return nil // no llm checks
+	}
+	if opts.OpenAI.Provider == "anthropic" {
+		if strings.HasPrefix(strings.ToLower(opts.OpenAI.Model), "gpt-") {
+			return fmt.Errorf("model %q is not supported by anthropic provider, set anthropic model", opts.OpenAI.Model)
+		}
+		if opts.Vision.Enabled && strings.HasPrefix(strings.ToLower(opts.Vision.Model), "gpt-") {
+			return fmt.Errorf("vision model %q is not supported by anthropic provider, set anthropic model", opts.Vision.Model)
+		}
+		if opts.OpenAI.Org != "" {
+			return errors.New("organization id is not supported by anthropic provider")
+		}
+		return nil
+	}
+	if !opts.OpenAI.Structured {
+		return nil
+	}
+	if opts.OpenAI.Prompt != "" && !strings.Contains(strings.ToLower(opts.OpenAI.Prompt), "json") {
+		return errors.New(`structured output requires "json" word in the prompt`)
+	}
+	if opts.Vision.Enabled && opts.Vision.Prompt != "" && !strings.Contains(strings.ToLower(opts.Vision.Prompt), "json") {
+		return errors.New(`structured output requires "json" word in the vision prompt`)
+	}
+	return nil
+}
+
+// makeLLMProvider makes a language model provider for the openai check, with the api selected by the provider option.
+// The base url, token and extra headers are used by any provider.
+func makeLLMProvider(opts options) tgspam.LLMProvider {
+	if opts.OpenAI.Provider == "anthropic" {
+		client := &http.Client{Transport: &headersTransport{headers: opts.OpenAI.Headers, next: http.DefaultTransport}}
+		return tgspam.NewAnthropicProvider(client, tgspam.AnthropicConfig{Token: opts.OpenAI.Token, BaseURL: opts.OpenAI.BaseURL})
+	}
+	return tgspam.NewOpenAIProvider(makeOpenAIClient(opts))
+}
+
+// makeOpenAIClient makes a client for openai api or any openai-compatible server (ollama, vllm, localai, etc.) at the base url.
+// The token is optional, as local servers usually don't check it, and no authorization header is sent without it.
+// Extra headers are set on each request, and override the ones set by the client, e.g. authorization.
+func makeOpenAIClient(opts options) *openai.Client {
+	config := openai.DefaultConfig(opts.OpenAI.Token)
+	config.BaseURL = openAIBaseURL(opts)
+	config.OrgID = opts.OpenAI.Org
+	if len(opts.OpenAI.Headers) > 0 {
+		config.HTTPClient = &http.Client{Transport: &headersTransport{headers: opts.OpenAI.Headers, next: http.DefaultTransport}}
+	}
+	return openai.NewClientWithConfig(config)
+}
+
+// openAIBaseURL returns the base url of openai api from options, or the default one
+func openAIBaseURL(opts options) string {
+	if opts.OpenAI.BaseURL == "" {
+		return openai.DefaultConfig("").BaseURL
+	}
+	return strings.TrimSuffix(opts.OpenAI.BaseURL, "/")
+}
+
+// headersTransport is a http.RoundTripper setting extra headers on each request
+type headersTransport struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+// RoundTrip sets the headers on a copy of the request and passes it to the next transport
+func (t *headersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.next.RoundTrip(req)
+}
+
 func makeSpamBot(ctx context.Context, opts options, detector *tgspam.Detector) (*bot.SpamFilter, error) {
-	spamBotParams := bot.SpamConfig{
+	spamBotParams := makeSpamBotConfig(opts)
+	spamBot := bot.NewSpamFilter(ctx, detector, spamBotParams)
+	log.Printf("[DEBUG] spam bot config: %+v", spamBotParams)
+
+	if err := spamBot.ReloadSamples(); err != nil {
+		return nil, fmt.Errorf("can't relaod samples, %w", err)
+	}
+	return spamBot, nil
+}
+
+// makeSpamBotConfig makes spam bot config with samples files and messages from options
+func makeSpamBotConfig(opts options) bot.SpamConfig {
+	return bot.SpamConfig{
 		SpamSamplesFile:    filepath.Join(opts.Files.SamplesDataPath, samplesSpamFile),
 		HamSamplesFile:     filepath.Join(opts.Files.SamplesDataPath, samplesHamFile),
 		StopWordsFile:      filepath.Join(opts.Files.SamplesDataPath, stopWordsFile),
@@ -469,13 +792,6 @@ func makeSpamBot(ctx context.Context, opts options, detector *tgspam.Detector) (
 		SpamDryMsg:         opts.Message.Dry,
 		Dry:                opts.Dry,
 	}
-	spamBot := bot.NewSpamFilter(ctx, detector, spamBotParams)
-	log.Printf("[DEBUG] spam bot config: %+v", spamBotParams)
-
-	if err := spamBot.ReloadSamples(); err != nil {
-		return nil, fmt.Errorf("can't relaod samples, %w", err)
-	}
-	return spamBot, nil
 }
 
 // expandPath expands ~ to home dir and makes the absolute path
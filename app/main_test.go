@@ -6,19 +6,24 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
 	"github.com/umputun/tg-spam/app/storage"
 	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam"
 )
 
 func TestMakeSpamLogger(t *testing.T) {
@@ -169,6 +174,223 @@ func Test_makeDetector(t *testing.T) {
 		assert.Equal(t, 0, res.FirstMessagesCount)
 		assert.Equal(t, false, res.FirstMessageOnly)
 	})
+
+	t.Run("with openai gray zone", func(t *testing.T) {
+		var opts options
+		opts.OpenAI.Token = "123"
+		opts.OpenAI.GrayZone = true
+		opts.OpenAI.GrayMinProb, opts.OpenAI.GrayMaxProb = 30, 80
+		opts.OpenAI.GrayMinSim, opts.OpenAI.GrayMaxSim = 0.3, 0.6
+		res := makeDetector(opts)
+		assert.Equal(t, tgspam.GrayZone{Enabled: true, MinProbability: 30, MaxProbability: 80, MinSimilarity: 0.3,
+			MaxSimilarity: 0.6}, res.OpenAIGrayZone)
+	})
+}
+
+func Test_makeOpenAIClient(t *testing.T) {
+	var reqs []*http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqs = append(reqs, r)
+		if r.URL.Path != "/v1/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp := openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{
+			Role: openai.ChatMessageRoleAssistant, Content: `{"spam": true, "reason":"bad text", "confidence":90}`}}}}
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer ts.Close()
+	req := openai.ChatCompletionRequest{Model: "llama3", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+
+	t.Run("local server without token", func(t *testing.T) {
+		reqs = nil
+		var opts options
+		opts.OpenAI.BaseURL = ts.URL + "/v1/"
+		resp, err := makeOpenAIClient(opts).CreateChatCompletion(context.Background(), req)
+		require.NoError(t, err)
+		require.Len(t, resp.Choices, 1)
+		require.Len(t, reqs, 1)
+		assert.Equal(t, "/v1/chat/completions", reqs[0].URL.Path)
+		assert.Empty(t, reqs[0].Header.Get("Authorization"))
+		assert.Empty(t, reqs[0].Header.Get("OpenAI-Organization"))
+	})
+
+	t.Run("token, org and headers", func(t *testing.T) {
+		reqs = nil
+		var opts options
+		opts.OpenAI.BaseURL = ts.URL + "/v1"
+		opts.OpenAI.Token = "secret"
+		opts.OpenAI.Org = "org-123"
+		opts.OpenAI.Headers = map[string]string{"X-Api-Key": "key", "Authorization": "Token other"}
+		_, err := makeOpenAIClient(opts).CreateChatCompletion(context.Background(), req)
+		require.NoError(t, err)
+		require.Len(t, reqs, 1)
+		assert.Equal(t, "org-123", reqs[0].Header.Get("OpenAI-Organization"))
+		assert.Equal(t, "key", reqs[0].Header.Get("X-Api-Key"))
+		assert.Equal(t, "Token other", reqs[0].Header.Get("Authorization"), "header overrides authorization")
+	})
+
+	t.Run("detector with local server", func(t *testing.T) {
+		reqs = nil
+		var opts options
+		opts.OpenAI.BaseURL = ts.URL + "/v1"
+		opts.OpenAI.Model = "llama3"
+		opts.OpenAI.MaxTokensResponse = 100
+		opts.OpenAI.Timeout = time.Second
+		opts.MaxEmoji = -1
+		opts.Meta.LinksLimit = -1
+		detector := makeDetector(opts)
+		spam, cr := detector.Check(spamcheck.Request{Msg: "some message", UserID: "1"})
+		assert.True(t, spam)
+		require.NotEmpty(t, cr)
+		last := cr[len(cr)-1]
+		assert.Equal(t, "openai", last.Name)
+		assert.Equal(t, "bad text, confidence: 90%", last.Details)
+		require.Len(t, reqs, 1)
+		assert.Empty(t, reqs[0].Header.Get("Authorization"))
+	})
+
+	t.Run("default base url", func(t *testing.T) {
+		var opts options
+		assert.Equal(t, "https://api.openai.com/v1", openAIBaseURL(opts))
+		opts.OpenAI.BaseURL = "http://localhost:11434/v1/"
+		assert.Equal(t, "http://localhost:11434/v1", openAIBaseURL(opts))
+	})
+}
+
+func Test_activateVision(t *testing.T) {
+	var opts options
+	opts.OpenAI.BaseURL = "http://localhost:1"
+	opts.Vision.Model = "vision-model"
+	opts.Vision.MaxSizeKB = 100
+	detector := tgspam.NewDetector(tgspam.Config{MaxAllowedEmoji: -1})
+	apiMock := &mocks.FileAPIMock{
+		GetFileFunc: func(config tbapi.FileConfig) (tbapi.File, error) {
+			return tbapi.File{FileID: config.FileID, FileSize: 200 * 1024}, nil
+		},
+	}
+	activateVision(opts, detector, apiMock)
+
+	_, cr := detector.Check(spamcheck.Request{UserID: "1", Meta: spamcheck.MetaData{Images: 1, ImageID: "file1"}})
+	require.Len(t, cr, 1)
+	assert.Equal(t, spamcheck.Response{Name: "vision", Spam: false,
+		Details: "can't load image: file size 204800 exceeds limit 102400"}, cr[0])
+	require.Len(t, apiMock.GetFileCalls(), 1)
+	assert.Equal(t, "file1", apiMock.GetFileCalls()[0].Config.FileID)
+}
+
+func Test_loadOpenAIPromptTemplate(t *testing.T) {
+	dir := t.TempDir()
+	valid, invalid := filepath.Join(dir, "valid.tmpl"), filepath.Join(dir, "invalid.tmpl")
+	require.NoError(t, os.WriteFile(valid, []byte("{{range .SpamExamples}}{{.}}\n{{end}}{{.Message}}"), 0o600))
+	require.NoError(t, os.WriteFile(invalid, []byte("{{.Unknown}}"), 0o600))
+
+	var opts options
+	res, err := loadOpenAIPromptTemplate(opts)
+	require.NoError(t, err)
+	assert.Empty(t, res, "not set")
+
+	opts.OpenAI.PromptTemplate = valid
+	res, err = loadOpenAIPromptTemplate(opts)
+	require.NoError(t, err)
+	assert.Equal(t, "{{range .SpamExamples}}{{.}}\n{{end}}{{.Message}}", res)
+
+	opts.OpenAI.PromptTemplate = invalid
+	_, err = loadOpenAIPromptTemplate(opts)
+	assert.ErrorContains(t, err, "invalid template in "+invalid)
+
+	opts.OpenAI.PromptTemplate = filepath.Join(dir, "missing.tmpl")
+	_, err = loadOpenAIPromptTemplate(opts)
+	assert.ErrorContains(t, err, "can't read")
+}
+
+func Test_validateLLMOptions(t *testing.T) {
+	tbl := []struct {
+		name   string
+		modify func(o *options)
+		err    string
+	}{
+		{name: "no llm checks", modify: func(o *options) { o.OpenAI.Token = ""; o.OpenAI.Provider = "anthropic" }},
+		{name: "openai defaults"},
+		{name: "structured with default prompt", modify: func(o *options) { o.OpenAI.Structured = true }},
+		{name: "structured with json prompt", modify: func(o *options) { o.OpenAI.Structured = true; o.OpenAI.Prompt = "return JSON" }},
+		{name: "structured without json in prompt", modify: func(o *options) { o.OpenAI.Structured = true; o.OpenAI.Prompt = "is it spam?" },
+			err: `structured output requires "json" word in the prompt`},
+		{name: "structured without json in vision prompt", modify: func(o *options) {
+			o.OpenAI.Structured, o.Vision.Enabled, o.Vision.Prompt = true, true, "is it spam?"
+		}, err: `structured output requires "json" word in the vision prompt`},
+		{name: "not structured without json in prompt", modify: func(o *options) { o.OpenAI.Prompt = "is it spam?" }},
+		{name: "anthropic", modify: func(o *options) { o.OpenAI.Provider, o.OpenAI.Model = "anthropic", "claude-test" }},
+		{name: "anthropic structured without json in prompt", modify: func(o *options) {
+			o.OpenAI.Provider, o.OpenAI.Model, o.OpenAI.Structured, o.OpenAI.Prompt = "anthropic", "claude-test", true, "is it spam?"
+		}},
+		{name: "anthropic with gpt model", modify: func(o *options) { o.OpenAI.Provider = "anthropic" },
+			err: `model "gpt-4" is not supported by anthropic provider`},
+		{name: "anthropic with gpt vision model", modify: func(o *options) {
+			o.OpenAI.Provider, o.OpenAI.Model, o.Vision.Enabled = "anthropic", "claude-test", true
+		}, err: `vision model "gpt-4o" is not supported by anthropic provider`},
+		{name: "anthropic with org", modify: func(o *options) {
+			o.OpenAI.Provider, o.OpenAI.Model, o.OpenAI.Org = "anthropic", "claude-test", "org"
+		}, err: "organization id is not supported by anthropic provider"},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts options
+			opts.OpenAI.Token, opts.OpenAI.Provider, opts.OpenAI.Model, opts.Vision.Model = "token", "openai", "gpt-4", "gpt-4o"
+			if tt.modify != nil {
+				tt.modify(&opts)
+			}
+			err := validateLLMOptions(opts)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func Test_makeLLMProvider(t *testing.T) {
+	var reqs []*http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqs = append(reqs, r)
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"content":[{"type":"tool_use","input":{"spam":true,"reason":"scam","confidence":80}}]}`))
+		require.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	t.Run("openai", func(t *testing.T) {
+		var opts options
+		opts.OpenAI.Provider = "openai"
+		assert.IsType(t, &tgspam.OpenAIProvider{}, makeLLMProvider(opts))
+	})
+
+	t.Run("anthropic with detector", func(t *testing.T) {
+		var opts options
+		opts.OpenAI.Provider = "anthropic"
+		opts.OpenAI.BaseURL = ts.URL
+		opts.OpenAI.Token = "secret"
+		opts.OpenAI.Headers = map[string]string{"X-Extra": "val"}
+		opts.OpenAI.Model = "claude-test"
+		opts.OpenAI.Structured = true
+		opts.OpenAI.Timeout = time.Second
+		opts.MaxEmoji = -1
+		opts.Meta.LinksLimit = -1
+		assert.IsType(t, &tgspam.AnthropicProvider{}, makeLLMProvider(opts))
+
+		detector := makeDetector(opts)
+		spam, cr := detector.Check(spamcheck.Request{Msg: "some message", UserID: "1"})
+		assert.True(t, spam)
+		require.NotEmpty(t, cr)
+		assert.Equal(t, spamcheck.Response{Name: "openai", Spam: true, Score: 0.8, Details: "scam, confidence: 80%"}, cr[len(cr)-1])
+		require.Len(t, reqs, 1)
+		assert.Equal(t, "/v1/messages", reqs[0].URL.Path)
+		assert.Equal(t, "secret", reqs[0].Header.Get("x-api-key"))
+		assert.Equal(t, "val", reqs[0].Header.Get("X-Extra"))
+	})
 }
 
 func Test_makeSpamBot(t *testing.T) {
@@ -232,6 +454,41 @@ func Test_activateServerOnly(t *testing.T) {
 	<-done
 }
 
+func Test_activateCasMirror(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1) // in-memory db is per connection
+
+	exportFile := filepath.Join(t.TempDir(), "export.csv")
+	require.NoError(t, os.WriteFile(exportFile, []byte("user_id,offenses,time_added\n12345,1,2024-01-01\n"), 0o600))
+
+	var opts options
+	opts.CAS.Mirror = true
+	opts.CAS.MirrorSource = exportFile
+	opts.CAS.MirrorSync = time.Hour
+	opts.MaxEmoji = -1
+	opts.Meta.LinksLimit = -1
+	detector := makeDetector(opts)
+
+	opts.CAS.MirrorSync = 0
+	assert.Error(t, activateCasMirror(ctx, opts, detector, db), "invalid sync interval")
+
+	opts.CAS.MirrorSync = time.Hour
+	require.NoError(t, activateCasMirror(ctx, opts, detector, db))
+	assert.Eventually(t, func() bool {
+		spam, _ := detector.Check(spamcheck.Request{UserID: "12345"})
+		return spam
+	}, time.Second, 10*time.Millisecond)
+
+	spam, cr := detector.Check(spamcheck.Request{UserID: "67890"})
+	assert.False(t, spam)
+	assert.Equal(t, []spamcheck.Response{{Name: "cas", Details: "not found (local mirror)"}}, cr)
+}
+
 func Test_checkVolumeMount(t *testing.T) {
 	prepEnvAndFileSystem := func(opts *options, envValue string, dynamicDataPath string, notMountedExists bool) func() {
 		os.Setenv("TGSPAM_IN_DOCKER", envValue)
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/umputun/tg-spam/lib/tgspam"
+)
+
+// CasCache is a persistent storage for cached CAS lookup results
+type CasCache struct {
+	db      *sqlx.DB
+	maxSize int // max number of stored results, unlimited if 0
+}
+
+// casCacheInfo represents a cached CAS lookup result in the db
+type casCacheInfo struct {
+	UserID  string    `db:"user_id"`
+	Spam    bool      `db:"spam"`
+	Details string    `db:"details"`
+	Expires time.Time `db:"expires"`
+}
+
+// NewCasCache creates a new CasCache storage keeping up to maxSize results, unlimited if 0.
+// It should match the size of the in-memory cache, as the stored results are loaded to it.
+func NewCasCache(db *sqlx.DB, maxSize int) (*CasCache, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS cas_cache (
+		user_id TEXT PRIMARY KEY,
+		spam BOOLEAN DEFAULT 0,
+		details TEXT,
+		expires DATETIME
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cas_cache table: %w", err)
+	}
+	if _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_cas_cache_expires ON cas_cache(expires)`); err != nil {
+		return nil, fmt.Errorf("failed to create index on expires: %w", err)
+	}
+	return &CasCache{db: db, maxSize: maxSize}, nil
+}
+
+// Read removes expired entries and returns all the remaining ones
+func (c *CasCache) Read() ([]tgspam.CasCacheEntry, error) {
+	if err := c.prune(); err != nil {
+		return nil, err
+	}
+	entries := []casCacheInfo{}
+	if err := c.db.Select(&entries, "SELECT user_id, spam, details, expires FROM cas_cache"); err != nil {
+		return nil, fmt.Errorf("failed to get cas cache entries: %w", err)
+	}
+	res := make([]tgspam.CasCacheEntry, len(entries))
+	for i, e := range entries {
+		res[i] = tgspam.CasCacheEntry{UserID: e.UserID, Spam: e.Spam, Details: e.Details, Expires: e.Expires}
+	}
+	log.Printf("[DEBUG] read %d cas cache entries", len(res))
+	return res, nil
+}
+
+// Write adds or replaces the cached result for the user, and removes expired and excess entries
+func (c *CasCache) Write(e tgspam.CasCacheEntry) error {
+	query := "INSERT OR REPLACE INTO cas_cache (user_id, spam, details, expires) VALUES (?, ?, ?, ?)"
+	if _, err := c.db.Exec(query, e.UserID, e.Spam, e.Details, e.Expires); err != nil {
+		return fmt.Errorf("failed to write cas cache entry for %s: %w", e.UserID, err)
+	}
+	return c.prune()
+}
+
+// prune removes expired entries, and the entries expiring first if the number of entries exceeds maxSize
+func (c *CasCache) prune() error {
+	if _, err := c.db.Exec("DELETE FROM cas_cache WHERE expires < ?", time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired cas cache entries: %w", err)
+	}
+	if c.maxSize <= 0 {
+		return nil
+	}
+	query := "DELETE FROM cas_cache WHERE user_id NOT IN (SELECT user_id FROM cas_cache ORDER BY expires DESC LIMIT ?)"
+	if _, err := c.db.Exec(query, c.maxSize); err != nil {
+		return fmt.Errorf("failed to delete excess cas cache entries: %w", err)
+	}
+	return nil
+}
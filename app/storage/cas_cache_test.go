@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/tgspam"
+)
+
+func TestCasCache_NewCasCache(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = NewCasCache(db, 0)
+	require.NoError(t, err)
+
+	var exists int
+	err = db.Get(&exists, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='cas_cache'")
+	require.NoError(t, err)
+	assert.Equal(t, 1, exists)
+
+	_, err = NewCasCache(db, 0) // table already exists
+	require.NoError(t, err)
+}
+
+func TestCasCache_ReadWrite(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	c, err := NewCasCache(db, 0)
+	require.NoError(t, err)
+
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, c.Write(tgspam.CasCacheEntry{UserID: "1", Spam: true, Details: "spammer", Expires: expires}))
+	require.NoError(t, c.Write(tgspam.CasCacheEntry{UserID: "2", Spam: false, Details: "old", Expires: expires}))
+	require.NoError(t, c.Write(tgspam.CasCacheEntry{UserID: "2", Spam: false, Details: "not found", Expires: expires}))
+	require.NoError(t, c.Write(tgspam.CasCacheEntry{UserID: "3", Spam: true, Details: "expired", Expires: time.Now().Add(-time.Minute)}))
+
+	res, err := c.Read()
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	byID := map[string]tgspam.CasCacheEntry{}
+	for _, e := range res {
+		byID[e.UserID] = e
+	}
+	assert.Equal(t, "spammer", byID["1"].Details)
+	assert.True(t, byID["1"].Spam)
+	assert.True(t, expires.Equal(byID["1"].Expires))
+	assert.Equal(t, "not found", byID["2"].Details)
+	assert.False(t, byID["2"].Spam)
+
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM cas_cache"))
+	assert.Equal(t, 2, count, "expired entry removed")
+}
+
+func TestCasCache_WritePrune(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	c, err := NewCasCache(db, 2)
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, c.Write(tgspam.CasCacheEntry{UserID: "1", Details: "expired", Expires: now.Add(-time.Minute)}))
+	require.NoError(t, c.Write(tgspam.CasCacheEntry{UserID: "2", Details: "first", Expires: now.Add(time.Hour)}))
+	require.NoError(t, c.Write(tgspam.CasCacheEntry{UserID: "3", Details: "last", Expires: now.Add(3 * time.Hour)}))
+	require.NoError(t, c.Write(tgspam.CasCacheEntry{UserID: "4", Details: "middle", Expires: now.Add(2 * time.Hour)}))
+
+	ids := []string{}
+	require.NoError(t, db.Select(&ids, "SELECT user_id FROM cas_cache ORDER BY user_id"))
+	assert.Equal(t, []string{"3", "4"}, ids, "expired and the first expiring entries removed on write")
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// casMirrorBatchSize is the number of user ids imported in a single transaction,
+// to avoid locking the db for the whole import
+const casMirrorBatchSize = 10000
+
+// CasMirror is a local mirror of CAS banned users, imported from CAS export csv
+type CasMirror struct {
+	db *sqlx.DB
+}
+
+// CasSyncInfo represents metadata of the last CAS mirror sync
+type CasSyncInfo struct {
+	Source       string    `db:"source" json:"source"`               // url or file of CAS export
+	Timestamp    time.Time `db:"timestamp" json:"timestamp"`         // time of the last successful sync
+	Total        int       `db:"total" json:"total"`                 // total number of banned users in the mirror
+	Added        int       `db:"added" json:"added"`                 // number of users added by the last sync
+	Removed      int       `db:"removed" json:"removed"`             // number of users removed by the last sync
+	ETag         string    `db:"etag" json:"-"`                      // etag of the last downloaded export
+	LastModified string    `db:"last_modified" json:"-"`             // last-modified of the last downloaded export
+	Unchanged    bool      `db:"unchanged" json:"unchanged"`         // true if the export was not changed since the previous sync
+	Duration     string    `db:"duration" json:"duration,omitempty"` // duration of the last sync
+}
+
+// NewCasMirror creates a new CasMirror storage
+func NewCasMirror(db *sqlx.DB) (*CasMirror, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS cas_mirror (
+		user_id INTEGER PRIMARY KEY,
+		sync_id INTEGER
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cas_mirror table: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS cas_mirror_sync (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		source TEXT,
+		timestamp DATETIME,
+		total INTEGER,
+		added INTEGER,
+		removed INTEGER,
+		etag TEXT,
+		last_modified TEXT,
+		unchanged BOOLEAN DEFAULT 0,
+		duration TEXT
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cas_mirror_sync table: %w", err)
+	}
+	return &CasMirror{db: db}, nil
+}
+
+// IsBanned checks if the user is in the mirror
+func (m *CasMirror) IsBanned(ctx context.Context, userID string) (bool, error) {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid user id %q: %w", userID, err)
+	}
+	var exists bool
+	if err := m.db.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM cas_mirror WHERE user_id = ?)", id); err != nil {
+		return false, fmt.Errorf("failed to check user %d in cas mirror: %w", id, err)
+	}
+	return exists, nil
+}
+
+// LastSync returns metadata of the last sync, empty if never synced
+func (m *CasMirror) LastSync() (CasSyncInfo, error) {
+	var res CasSyncInfo
+	err := m.db.Get(&res, `SELECT source, timestamp, total, added, removed, etag, last_modified, unchanged, duration
+		FROM cas_mirror_sync WHERE id = 1`)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CasSyncInfo{}, nil
+		}
+		return CasSyncInfo{}, fmt.Errorf("failed to get cas mirror sync info: %w", err)
+	}
+	return res, nil
+}
+
+// Sync downloads CAS export from the source and imports it. Source can be url or local file.
+// For url, the request is conditional, based on etag and last-modified of the previous sync from the same source,
+// and the import is skipped if the export is not modified.
+func (m *CasMirror) Sync(ctx context.Context, client *http.Client, source string) (CasSyncInfo, error) {
+	st := time.Now()
+	prev, err := m.LastSync()
+	if err != nil {
+		return CasSyncInfo{}, err
+	}
+
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		fh, err := os.Open(source) //nolint:gosec // source is set by admin
+		if err != nil {
+			return CasSyncInfo{}, fmt.Errorf("failed to open cas export %s: %w", source, err)
+		}
+		defer fh.Close()
+		return m.Import(ctx, fh, CasSyncInfo{Source: source}, st)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, http.NoBody)
+	if err != nil {
+		return CasSyncInfo{}, fmt.Errorf("failed to make request %s: %w", source, err)
+	}
+	if prev.Source == source {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return CasSyncInfo{}, fmt.Errorf("failed to download cas export %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		info := prev
+		info.Timestamp, info.Added, info.Removed, info.Unchanged = time.Now(), 0, 0, true
+		info.Duration = time.Since(st).Round(time.Millisecond).String()
+		if err := m.saveSyncInfo(info); err != nil {
+			return CasSyncInfo{}, err
+		}
+		return info, nil
+	case http.StatusOK:
+	default:
+		return CasSyncInfo{}, fmt.Errorf("failed to download cas export %s, status %s", source, resp.Status)
+	}
+
+	info := CasSyncInfo{Source: source, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	return m.Import(ctx, resp.Body, info, st)
+}
+
+// Import reads CAS export csv and updates the mirror. The first column is user id, lines with non-numeric id
+// (like header) are skipped. The import is incremental: existing users kept, new ones added, and users missing
+// in the export are removed. Sync info saved with the counters. Started time is used to report the sync duration.
+func (m *CasMirror) Import(ctx context.Context, r io.Reader, info CasSyncInfo, started time.Time) (CasSyncInfo, error) {
+	var before int
+	if err := m.db.GetContext(ctx, &before, "SELECT COUNT(*) FROM cas_mirror"); err != nil {
+		return CasSyncInfo{}, fmt.Errorf("failed to count cas mirror: %w", err)
+	}
+
+	syncID := time.Now().UnixNano()
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+
+	ids := make([]int64, 0, casMirrorBatchSize)
+	imported := 0
+	for {
+		rec, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return CasSyncInfo{}, fmt.Errorf("failed to read cas export: %w", err)
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(rec[0]), 10, 64)
+		if err != nil {
+			continue // header or malformed line
+		}
+		if ids = append(ids, id); len(ids) >= casMirrorBatchSize {
+			if err := m.upsert(ctx, ids, syncID); err != nil {
+				return CasSyncInfo{}, err
+			}
+			imported += len(ids)
+			ids = ids[:0]
+		}
+	}
+	if err := m.upsert(ctx, ids, syncID); err != nil {
+		return CasSyncInfo{}, err
+	}
+	imported += len(ids)
+	if imported == 0 {
+		// don't wipe the mirror with empty or broken export
+		return CasSyncInfo{}, errors.New("no user ids found in cas export")
+	}
+
+	res, err := m.db.ExecContext(ctx, "DELETE FROM cas_mirror WHERE sync_id <> ?", syncID)
+	if err != nil {
+		return CasSyncInfo{}, fmt.Errorf("failed to remove stale users from cas mirror: %w", err)
+	}
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return CasSyncInfo{}, fmt.Errorf("failed to get number of removed users: %w", err)
+	}
+	if err := m.db.GetContext(ctx, &info.Total, "SELECT COUNT(*) FROM cas_mirror"); err != nil {
+		return CasSyncInfo{}, fmt.Errorf("failed to count cas mirror: %w", err)
+	}
+
+	info.Timestamp = time.Now()
+	info.Removed = int(removed)
+	info.Added = info.Total - (before - info.Removed)
+	info.Duration = time.Since(started).Round(time.Millisecond).String()
+	if err := m.saveSyncInfo(info); err != nil {
+		return CasSyncInfo{}, err
+	}
+	log.Printf("[INFO] cas mirror synced from %s, total: %d, added: %d, removed: %d, duration: %s",
+		info.Source, info.Total, info.Added, info.Removed, info.Duration)
+	return info, nil
+}
+
+// upsert adds user ids to the mirror or marks existing ones with the sync id, in a single transaction
+func (m *CasMirror) upsert(ctx context.Context, ids []int64, syncID int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // rollback after commit is a no-op
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO cas_mirror (user_id, sync_id) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET sync_id = excluded.sync_id`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, id := range ids {
+		if _, err := stmt.ExecContext(ctx, id, syncID); err != nil {
+			return fmt.Errorf("failed to add user %d to cas mirror: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// saveSyncInfo replaces sync metadata with the given one
+func (m *CasMirror) saveSyncInfo(info CasSyncInfo) error {
+	_, err := m.db.NamedExec(`INSERT OR REPLACE INTO cas_mirror_sync
+		(id, source, timestamp, total, added, removed, etag, last_modified, unchanged, duration)
+		VALUES (1, :source, :timestamp, :total, :added, :removed, :etag, :last_modified, :unchanged, :duration)`, info)
+	if err != nil {
+		return fmt.Errorf("failed to save cas mirror sync info: %w", err)
+	}
+	return nil
+}
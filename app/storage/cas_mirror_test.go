@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCasMirror_Import(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewCasMirror(db)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	info, err := m.LastSync()
+	require.NoError(t, err)
+	assert.Equal(t, CasSyncInfo{}, info, "never synced")
+
+	export := "user_id,offenses,time_added\n1,1,2024-01-01\n2,3,2024-01-02\n3,1,2024-01-03\n"
+	info, err = m.Import(ctx, strings.NewReader(export), CasSyncInfo{Source: "test"}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 3, info.Total)
+	assert.Equal(t, 3, info.Added)
+	assert.Equal(t, 0, info.Removed)
+
+	banned, err := m.IsBanned(ctx, "2")
+	require.NoError(t, err)
+	assert.True(t, banned)
+	banned, err = m.IsBanned(ctx, "4")
+	require.NoError(t, err)
+	assert.False(t, banned)
+	_, err = m.IsBanned(ctx, "bad")
+	assert.Error(t, err)
+
+	// incremental update, 1 removed, 4 and 5 added
+	export = "user_id,offenses,time_added\n2,3,2024-01-02\n3,1,2024-01-03\n4,1,2024-01-04\n5,1,2024-01-05\n"
+	info, err = m.Import(ctx, strings.NewReader(export), CasSyncInfo{Source: "test"}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 4, info.Total)
+	assert.Equal(t, 2, info.Added)
+	assert.Equal(t, 1, info.Removed)
+	banned, err = m.IsBanned(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, banned)
+	banned, err = m.IsBanned(ctx, "5")
+	require.NoError(t, err)
+	assert.True(t, banned)
+
+	last, err := m.LastSync()
+	require.NoError(t, err)
+	assert.Equal(t, "test", last.Source)
+	assert.Equal(t, 4, last.Total)
+	assert.Equal(t, 2, last.Added)
+	assert.WithinDuration(t, time.Now(), last.Timestamp, time.Minute)
+
+	// empty export doesn't wipe the mirror
+	_, err = m.Import(ctx, strings.NewReader("user_id,offenses,time_added\n"), CasSyncInfo{Source: "test"}, time.Now())
+	assert.EqualError(t, err, "no user ids found in cas export")
+	banned, err = m.IsBanned(ctx, "5")
+	require.NoError(t, err)
+	assert.True(t, banned)
+}
+
+func TestCasMirror_Sync(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := NewCasMirror(db)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("user_id,offenses,time_added\n10,1,2024-01-01\n20,1,2024-01-01\n"))
+	}))
+	defer ts.Close()
+
+	info, err := m.Sync(ctx, ts.Client(), ts.URL+"/export.csv")
+	require.NoError(t, err)
+	assert.Equal(t, 2, info.Total)
+	assert.Equal(t, 2, info.Added)
+	assert.False(t, info.Unchanged)
+	assert.Equal(t, `"v1"`, info.ETag)
+
+	info, err = m.Sync(ctx, ts.Client(), ts.URL+"/export.csv")
+	require.NoError(t, err)
+	assert.True(t, info.Unchanged)
+	assert.Equal(t, 2, info.Total)
+	assert.Equal(t, 0, info.Added)
+	assert.Equal(t, 2, requests)
+
+	last, err := m.LastSync()
+	require.NoError(t, err)
+	assert.True(t, last.Unchanged)
+
+	t.Run("from file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "export.csv")
+		require.NoError(t, os.WriteFile(file, []byte("30\n"), 0o600))
+		info, err := m.Sync(ctx, ts.Client(), file)
+		require.NoError(t, err)
+		assert.Equal(t, CasSyncInfo{Source: file, Total: 1, Added: 1, Removed: 2, Timestamp: info.Timestamp,
+			Duration: info.Duration}, info)
+	})
+
+	t.Run("bad status", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer ts.Close()
+		_, err := m.Sync(ctx, ts.Client(), ts.URL)
+		assert.ErrorContains(t, err, "status 502 Bad Gateway")
+	})
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/umputun/tg-spam/lib/tgspam"
+)
+
+// LLMUsage is a persistent storage for daily usage of the language model
+type LLMUsage struct {
+	db *sqlx.DB
+}
+
+// llmUsageInfo represents the usage for a day in the db
+type llmUsageInfo struct {
+	Day          string  `db:"day"`
+	Requests     int     `db:"requests"`
+	InputTokens  int     `db:"input_tokens"`
+	OutputTokens int     `db:"output_tokens"`
+	Cost         float64 `db:"cost"`
+}
+
+// NewLLMUsage creates a new LLMUsage storage
+func NewLLMUsage(db *sqlx.DB) (*LLMUsage, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS llm_usage (
+		day TEXT PRIMARY KEY,
+		requests INTEGER DEFAULT 0,
+		input_tokens INTEGER DEFAULT 0,
+		output_tokens INTEGER DEFAULT 0,
+		cost REAL DEFAULT 0
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create llm_usage table: %w", err)
+	}
+	return &LLMUsage{db: db}, nil
+}
+
+// Read returns the usage for the day, empty usage if not found
+func (u *LLMUsage) Read(day string) (tgspam.LLMUsage, error) {
+	var rec llmUsageInfo
+	err := u.db.Get(&rec, "SELECT day, requests, input_tokens, output_tokens, cost FROM llm_usage WHERE day = ?", day)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tgspam.LLMUsage{Day: day}, nil
+	}
+	if err != nil {
+		return tgspam.LLMUsage{}, fmt.Errorf("failed to get llm usage for %s: %w", day, err)
+	}
+	return tgspam.LLMUsage{Day: rec.Day, Requests: rec.Requests, InputTokens: rec.InputTokens,
+		OutputTokens: rec.OutputTokens, Cost: rec.Cost}, nil
+}
+
+// Write adds or replaces the usage for the day
+func (u *LLMUsage) Write(rec tgspam.LLMUsage) error {
+	query := "INSERT OR REPLACE INTO llm_usage (day, requests, input_tokens, output_tokens, cost) VALUES (?, ?, ?, ?, ?)"
+	if _, err := u.db.Exec(query, rec.Day, rec.Requests, rec.InputTokens, rec.OutputTokens, rec.Cost); err != nil {
+		return fmt.Errorf("failed to write llm usage for %s: %w", rec.Day, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/tgspam"
+)
+
+func TestLLMUsage_NewLLMUsage(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = NewLLMUsage(db)
+	require.NoError(t, err)
+
+	var exists int
+	err = db.Get(&exists, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='llm_usage'")
+	require.NoError(t, err)
+	assert.Equal(t, 1, exists)
+
+	_, err = NewLLMUsage(db) // table already exists
+	require.NoError(t, err)
+}
+
+func TestLLMUsage_ReadWrite(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	u, err := NewLLMUsage(db)
+	require.NoError(t, err)
+
+	res, err := u.Read("2024-01-02")
+	require.NoError(t, err)
+	assert.Equal(t, tgspam.LLMUsage{Day: "2024-01-02"}, res, "empty if not found")
+
+	require.NoError(t, u.Write(tgspam.LLMUsage{Day: "2024-01-02", Requests: 1, InputTokens: 100, OutputTokens: 10, Cost: 0.001}))
+	require.NoError(t, u.Write(tgspam.LLMUsage{Day: "2024-01-02", Requests: 2, InputTokens: 200, OutputTokens: 20, Cost: 0.002}))
+	require.NoError(t, u.Write(tgspam.LLMUsage{Day: "2024-01-03", Requests: 5}))
+
+	res, err = u.Read("2024-01-02")
+	require.NoError(t, err)
+	assert.Equal(t, tgspam.LLMUsage{Day: "2024-01-02", Requests: 2, InputTokens: 200, OutputTokens: 20, Cost: 0.002}, res)
+
+	res, err = u.Read("2024-01-03")
+	require.NoError(t, err)
+	assert.Equal(t, 5, res.Requests)
+
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM llm_usage"))
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/umputun/tg-spam/lib/tgspam"
+)
+
+// tuneOptions are options of "tune" command, sweeping detector thresholds over labeled messages
+type tuneOptions struct {
+	SpamFile    string    `long:"spam" description:"file with spam messages, one per line"`
+	HamFile     string    `long:"ham" description:"file with ham messages, one per line"`
+	JSONL       string    `long:"jsonl" description:"jsonl file with messages, {\"text\": \"...\", \"label\": \"spam|ham\"} per line"`
+	Similarity  []float64 `long:"try-similarity" description:"similarity thresholds to try, default grid if not set"`
+	Probability []float64 `long:"try-probability" description:"min spam probabilities to try, default grid if not set"`
+	Emoji       []int     `long:"try-emoji" description:"max emoji counts to try, default grid if not set"`
+	MsgLen      []int     `long:"try-msg-len" description:"min message lengths to try, default grid if not set"`
+}
+
+// runTune sweeps the detector thresholds over the labeled messages, and prints the pareto front of false-positive
+// and false-negative rates with the recommended flags. The detector is made with the current options and trained
+// on all the samples, the same way as for eval command.
+func runTune(ctx context.Context, opts options, wr io.Writer) error {
+	msgs, err := loadLabeledMessages(evalOptions{SpamFile: opts.Tune.SpamFile, HamFile: opts.Tune.HamFile, JSONL: opts.Tune.JSONL})
+	if err != nil {
+		return fmt.Errorf("can't load labeled messages, %w", err)
+	}
+
+	grid := tgspam.TuneGrid{SimilarityThreshold: opts.Tune.Similarity, MinSpamProbability: opts.Tune.Probability,
+		MaxAllowedEmoji: opts.Tune.Emoji, MinMsgLen: opts.Tune.MsgLen}
+	rep, err := detectorTuner{opts: opts}.Tune(ctx, msgs, grid.WithDefaults())
+	if err != nil {
+		return fmt.Errorf("can't tune, %w", err)
+	}
+
+	fmt.Fprintf(wr, "tuned on %d labeled messages, evaluated %d combinations\n", len(msgs), rep.Evaluated)
+	fmt.Fprintln(wr, "pareto front of false-positive and false-negative rates:")
+	tw := tabwriter.NewWriter(wr, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "similarity\tprobability\temoji\tmsg len\tfpr\tfnr\tprecision\trecall\tf1\t")
+	for _, p := range rep.Front {
+		fmt.Fprintf(tw, "%.2f\t%.0f\t%d\t%d\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t\n", p.SimilarityThreshold, p.MinSpamProbability,
+			p.MaxAllowedEmoji, p.MinMsgLen, p.FalsePositiveRate, p.FalseNegativeRate, p.Precision(), p.Recall(), p.F1())
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("can't write report, %w", err)
+	}
+	fmt.Fprintf(wr, "recommended (best f1): %s\n", tuneFlags(rep.Recommended))
+	return nil
+}
+
+// detectorTuner tunes parameters of a detector made with the current options and trained on all the samples,
+// implements webapi.Tuner. A new detector is made for each call, so the running bot is not affected.
+type detectorTuner struct {
+	opts options
+}
+
+// Tune makes and trains the detector, and sweeps its parameters over the grid
+func (t detectorTuner) Tune(ctx context.Context, msgs []tgspam.LabeledMessage, grid tgspam.TuneGrid) (tgspam.TuneReport, error) {
+	detector, err := makeTrainedEvalDetector(ctx, t.opts)
+	if err != nil {
+		return tgspam.TuneReport{}, err
+	}
+	return tgspam.Tune(ctx, detector, msgs, grid)
+}
+
+// tuneFlags returns command line flags for the parameters of the point
+func tuneFlags(p tgspam.TunePoint) string {
+	return fmt.Sprintf("--similarity-threshold=%g --min-probability=%g --max-emoji=%d --min-msg-len=%d",
+		p.SimilarityThreshold, p.MinSpamProbability, p.MaxAllowedEmoji, p.MinMsgLen)
+}
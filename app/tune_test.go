@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/tgspam"
+)
+
+func Test_runTune(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tmpDir := t.TempDir()
+	spam := "win free iphone now\nlottery prize win today\nfree crypto prize here\nearn money fast online\nfree money win big\n"
+	ham := "hello world and everyone\nhow are you doing today\nhave a good day friends\nsee you tomorrow at work\n" +
+		"good morning all of you\nnice weather today here\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesSpamFile), []byte(spam), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesHamFile), []byte(ham), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, stopWordsFile), []byte("в личку"), 0o600))
+	jsonl := `{"text": "win free crypto prize", "label": "spam"}
+{"text": "пишите в личку", "label": "spam"}
+{"text": "hello, how are you", "label": "ham"}
+{"text": "good day at work", "label": "ham"}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "tune.jsonl"), []byte(jsonl), 0o600))
+
+	var opts options
+	opts.Files.SamplesDataPath = tmpDir
+	opts.Files.DynamicDataPath = tmpDir
+	opts.SimilarityThreshold = 0.5
+	opts.MinSpamProbability = 50
+	opts.MaxEmoji = -1
+	opts.Meta.LinksLimit = -1
+	opts.CAS.API = "http://127.0.0.1:1" // should not be called
+
+	t.Run("custom grid", func(t *testing.T) {
+		opts := opts
+		opts.Tune.JSONL = filepath.Join(tmpDir, "tune.jsonl")
+		opts.Tune.Similarity = []float64{0.3, 0.6}
+		opts.Tune.Probability = []float64{60}
+		opts.Tune.Emoji = []int{-1}
+		opts.Tune.MsgLen = []int{0, 100}
+		buf := bytes.Buffer{}
+		require.NoError(t, runTune(ctx, opts, &buf))
+		t.Log(buf.String())
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.GreaterOrEqual(t, len(lines), 5)
+		assert.Equal(t, "tuned on 4 labeled messages, evaluated 4 combinations", lines[0])
+		assert.Equal(t, []string{"similarity", "probability", "emoji", "msg", "len", "fpr", "fnr", "precision", "recall", "f1"},
+			strings.Fields(lines[2]))
+		assert.Regexp(t, `^recommended \(best f1\): --similarity-threshold=0\.[36] --min-probability=60 --max-emoji=-1 --min-msg-len=0$`,
+			lines[len(lines)-1])
+	})
+
+	t.Run("default grid", func(t *testing.T) {
+		opts := opts
+		opts.Tune.JSONL = filepath.Join(tmpDir, "tune.jsonl")
+		buf := bytes.Buffer{}
+		require.NoError(t, runTune(ctx, opts, &buf))
+		g := tgspam.DefaultTuneGrid()
+		n := len(g.SimilarityThreshold) * len(g.MinSpamProbability) * len(g.MaxAllowedEmoji) * len(g.MinMsgLen)
+		assert.Contains(t, buf.String(), "evaluated "+strconv.Itoa(n)+" combinations")
+	})
+
+	t.Run("no labeled messages", func(t *testing.T) {
+		err := runTune(ctx, opts, &bytes.Buffer{})
+		assert.ErrorContains(t, err, "no labeled messages")
+	})
+
+	t.Run("spam only", func(t *testing.T) {
+		opts := opts
+		opts.Tune.SpamFile = filepath.Join(tmpDir, samplesSpamFile)
+		err := runTune(ctx, opts, &bytes.Buffer{})
+		assert.EqualError(t, err, "can't tune, both spam and ham messages required for tuning")
+	})
+}
+
+func Test_detectorTuner(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesSpamFile), []byte("win free iphone now\nfree crypto prize"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesHamFile), []byte("hello world\nhave a good day"), 0o600))
+
+	var opts options
+	opts.Files.SamplesDataPath = tmpDir
+	opts.Files.DynamicDataPath = tmpDir
+	opts.SimilarityThreshold = 0.5
+	opts.MinSpamProbability = 50
+	opts.MaxEmoji = -1
+	opts.Meta.LinksLimit = -1
+
+	tuner := detectorTuner{opts: opts}
+	msgs := []tgspam.LabeledMessage{{Msg: "free iphone", Spam: true}, {Msg: "good day", Spam: false}}
+	rep, err := tuner.Tune(context.Background(), msgs, tgspam.TuneGrid{SimilarityThreshold: []float64{0.4, 0.8}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, rep.Evaluated, "current values for parameters without grid values")
+	require.NotEmpty(t, rep.Front)
+	assert.Equal(t, 50.0, rep.Recommended.MinSpamProbability)
+	assert.Equal(t, -1, rep.Recommended.MaxAllowedEmoji)
+
+	_, err = detectorTuner{opts: options{}}.Tune(context.Background(), msgs, tgspam.TuneGrid{})
+	assert.Error(t, err, "no samples")
+}
@@ -0,0 +1,78 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"github.com/umputun/tg-spam/app/storage"
+	"sync"
+)
+
+// CasMirrorMock is a mock implementation of webapi.CasMirror.
+//
+//	func TestSomethingThatUsesCasMirror(t *testing.T) {
+//
+//		// make and configure a mocked webapi.CasMirror
+//		mockedCasMirror := &CasMirrorMock{
+//			LastSyncFunc: func() (storage.CasSyncInfo, error) {
+//				panic("mock out the LastSync method")
+//			},
+//		}
+//
+//		// use mockedCasMirror in code that requires webapi.CasMirror
+//		// and then make assertions.
+//
+//	}
+type CasMirrorMock struct {
+	// LastSyncFunc mocks the LastSync method.
+	LastSyncFunc func() (storage.CasSyncInfo, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// LastSync holds details about calls to the LastSync method.
+		LastSync []struct {
+		}
+	}
+	lockLastSync sync.RWMutex
+}
+
+// LastSync calls LastSyncFunc.
+func (mock *CasMirrorMock) LastSync() (storage.CasSyncInfo, error) {
+	if mock.LastSyncFunc == nil {
+		panic("CasMirrorMock.LastSyncFunc: method is nil but CasMirror.LastSync was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockLastSync.Lock()
+	mock.calls.LastSync = append(mock.calls.LastSync, callInfo)
+	mock.lockLastSync.Unlock()
+	return mock.LastSyncFunc()
+}
+
+// LastSyncCalls gets all the calls that were made to LastSync.
+// Check the length with:
+//
+//	len(mockedCasMirror.LastSyncCalls())
+func (mock *CasMirrorMock) LastSyncCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockLastSync.RLock()
+	calls = mock.calls.LastSync
+	mock.lockLastSync.RUnlock()
+	return calls
+}
+
+// ResetLastSyncCalls reset all the calls that were made to LastSync.
+func (mock *CasMirrorMock) ResetLastSyncCalls() {
+	mock.lockLastSync.Lock()
+	mock.calls.LastSync = nil
+	mock.lockLastSync.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *CasMirrorMock) ResetCalls() {
+	mock.lockLastSync.Lock()
+	mock.calls.LastSync = nil
+	mock.lockLastSync.Unlock()
+}
@@ -4,6 +4,7 @@
 package mocks
 
 import (
+	"context"
 	"github.com/umputun/tg-spam/lib/approved"
 	"github.com/umputun/tg-spam/lib/spamcheck"
 	"sync"
@@ -21,8 +22,11 @@ import (
 //			ApprovedUsersFunc: func() []approved.UserInfo {
 //				panic("mock out the ApprovedUsers method")
 //			},
-//			CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
-//				panic("mock out the Check method")
+//			CheckCtxFunc: func(ctx context.Context, req spamcheck.Request) (bool, []spamcheck.Response) {
+//				panic("mock out the CheckCtx method")
+//			},
+//			NormalizeFunc: func(msg string) string {
+//				panic("mock out the Normalize method")
 //			},
 //			RemoveApprovedUserFunc: func(id string) error {
 //				panic("mock out the RemoveApprovedUser method")
@@ -40,8 +44,11 @@ type DetectorMock struct {
 	// ApprovedUsersFunc mocks the ApprovedUsers method.
 	ApprovedUsersFunc func() []approved.UserInfo
 
-	// CheckFunc mocks the Check method.
-	CheckFunc func(req spamcheck.Request) (bool, []spamcheck.Response)
+	// CheckCtxFunc mocks the CheckCtx method.
+	CheckCtxFunc func(ctx context.Context, req spamcheck.Request) (bool, []spamcheck.Response)
+
+	// NormalizeFunc mocks the Normalize method.
+	NormalizeFunc func(msg string) string
 
 	// RemoveApprovedUserFunc mocks the RemoveApprovedUser method.
 	RemoveApprovedUserFunc func(id string) error
@@ -56,11 +63,18 @@ type DetectorMock struct {
 		// ApprovedUsers holds details about calls to the ApprovedUsers method.
 		ApprovedUsers []struct {
 		}
-		// Check holds details about calls to the Check method.
-		Check []struct {
+		// CheckCtx holds details about calls to the CheckCtx method.
+		CheckCtx []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
 			// Req is the req argument value.
 			Req spamcheck.Request
 		}
+		// Normalize holds details about calls to the Normalize method.
+		Normalize []struct {
+			// Msg is the msg argument value.
+			Msg string
+		}
 		// RemoveApprovedUser holds details about calls to the RemoveApprovedUser method.
 		RemoveApprovedUser []struct {
 			// ID is the id argument value.
@@ -69,7 +83,8 @@ type DetectorMock struct {
 	}
 	lockAddApprovedUser    sync.RWMutex
 	lockApprovedUsers      sync.RWMutex
-	lockCheck              sync.RWMutex
+	lockCheckCtx           sync.RWMutex
+	lockNormalize          sync.RWMutex
 	lockRemoveApprovedUser sync.RWMutex
 }
 
@@ -146,43 +161,86 @@ func (mock *DetectorMock) ResetApprovedUsersCalls() {
 	mock.lockApprovedUsers.Unlock()
 }
 
-// Check calls CheckFunc.
-func (mock *DetectorMock) Check(req spamcheck.Request) (bool, []spamcheck.Response) {
-	if mock.CheckFunc == nil {
-		panic("DetectorMock.CheckFunc: method is nil but Detector.Check was just called")
+// CheckCtx calls CheckCtxFunc.
+func (mock *DetectorMock) CheckCtx(ctx context.Context, req spamcheck.Request) (bool, []spamcheck.Response) {
+	if mock.CheckCtxFunc == nil {
+		panic("DetectorMock.CheckCtxFunc: method is nil but Detector.CheckCtx was just called")
 	}
 	callInfo := struct {
+		Ctx context.Context
 		Req spamcheck.Request
 	}{
+		Ctx: ctx,
 		Req: req,
 	}
-	mock.lockCheck.Lock()
-	mock.calls.Check = append(mock.calls.Check, callInfo)
-	mock.lockCheck.Unlock()
-	return mock.CheckFunc(req)
+	mock.lockCheckCtx.Lock()
+	mock.calls.CheckCtx = append(mock.calls.CheckCtx, callInfo)
+	mock.lockCheckCtx.Unlock()
+	return mock.CheckCtxFunc(ctx, req)
 }
 
-// CheckCalls gets all the calls that were made to Check.
+// CheckCtxCalls gets all the calls that were made to CheckCtx.
 // Check the length with:
 //
-//	len(mockedDetector.CheckCalls())
-func (mock *DetectorMock) CheckCalls() []struct {
+//	len(mockedDetector.CheckCtxCalls())
+func (mock *DetectorMock) CheckCtxCalls() []struct {
+	Ctx context.Context
 	Req spamcheck.Request
 } {
 	var calls []struct {
+		Ctx context.Context
 		Req spamcheck.Request
 	}
-	mock.lockCheck.RLock()
-	calls = mock.calls.Check
-	mock.lockCheck.RUnlock()
+	mock.lockCheckCtx.RLock()
+	calls = mock.calls.CheckCtx
+	mock.lockCheckCtx.RUnlock()
+	return calls
+}
+
+// ResetCheckCtxCalls reset all the calls that were made to CheckCtx.
+func (mock *DetectorMock) ResetCheckCtxCalls() {
+	mock.lockCheckCtx.Lock()
+	mock.calls.CheckCtx = nil
+	mock.lockCheckCtx.Unlock()
+}
+
+// Normalize calls NormalizeFunc.
+func (mock *DetectorMock) Normalize(msg string) string {
+	if mock.NormalizeFunc == nil {
+		panic("DetectorMock.NormalizeFunc: method is nil but Detector.Normalize was just called")
+	}
+	callInfo := struct {
+		Msg string
+	}{
+		Msg: msg,
+	}
+	mock.lockNormalize.Lock()
+	mock.calls.Normalize = append(mock.calls.Normalize, callInfo)
+	mock.lockNormalize.Unlock()
+	return mock.NormalizeFunc(msg)
+}
+
+// NormalizeCalls gets all the calls that were made to Normalize.
+// Check the length with:
+//
+//	len(mockedDetector.NormalizeCalls())
+func (mock *DetectorMock) NormalizeCalls() []struct {
+	Msg string
+} {
+	var calls []struct {
+		Msg string
+	}
+	mock.lockNormalize.RLock()
+	calls = mock.calls.Normalize
+	mock.lockNormalize.RUnlock()
 	return calls
 }
 
-// ResetCheckCalls reset all the calls that were made to Check.
-func (mock *DetectorMock) ResetCheckCalls() {
-	mock.lockCheck.Lock()
-	mock.calls.Check = nil
-	mock.lockCheck.Unlock()
+// ResetNormalizeCalls reset all the calls that were made to Normalize.
+func (mock *DetectorMock) ResetNormalizeCalls() {
+	mock.lockNormalize.Lock()
+	mock.calls.Normalize = nil
+	mock.lockNormalize.Unlock()
 }
 
 // RemoveApprovedUser calls RemoveApprovedUserFunc.
@@ -234,9 +292,13 @@ func (mock *DetectorMock) ResetCalls() {
 	mock.calls.ApprovedUsers = nil
 	mock.lockApprovedUsers.Unlock()
 
-	mock.lockCheck.Lock()
-	mock.calls.Check = nil
-	mock.lockCheck.Unlock()
+	mock.lockCheckCtx.Lock()
+	mock.calls.CheckCtx = nil
+	mock.lockCheckCtx.Unlock()
+
+	mock.lockNormalize.Lock()
+	mock.calls.Normalize = nil
+	mock.lockNormalize.Unlock()
 
 	mock.lockRemoveApprovedUser.Lock()
 	mock.calls.RemoveApprovedUser = nil
@@ -0,0 +1,78 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"github.com/umputun/tg-spam/lib/tgspam"
+	"sync"
+)
+
+// LLMStatsMock is a mock implementation of webapi.LLMStats.
+//
+//	func TestSomethingThatUsesLLMStats(t *testing.T) {
+//
+//		// make and configure a mocked webapi.LLMStats
+//		mockedLLMStats := &LLMStatsMock{
+//			LLMStatsFunc: func() tgspam.LLMStats {
+//				panic("mock out the LLMStats method")
+//			},
+//		}
+//
+//		// use mockedLLMStats in code that requires webapi.LLMStats
+//		// and then make assertions.
+//
+//	}
+type LLMStatsMock struct {
+	// LLMStatsFunc mocks the LLMStats method.
+	LLMStatsFunc func() tgspam.LLMStats
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// LLMStats holds details about calls to the LLMStats method.
+		LLMStats []struct {
+		}
+	}
+	lockLLMStats sync.RWMutex
+}
+
+// LLMStats calls LLMStatsFunc.
+func (mock *LLMStatsMock) LLMStats() tgspam.LLMStats {
+	if mock.LLMStatsFunc == nil {
+		panic("LLMStatsMock.LLMStatsFunc: method is nil but LLMStats.LLMStats was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockLLMStats.Lock()
+	mock.calls.LLMStats = append(mock.calls.LLMStats, callInfo)
+	mock.lockLLMStats.Unlock()
+	return mock.LLMStatsFunc()
+}
+
+// LLMStatsCalls gets all the calls that were made to LLMStats.
+// Check the length with:
+//
+//	len(mockedLLMStats.LLMStatsCalls())
+func (mock *LLMStatsMock) LLMStatsCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockLLMStats.RLock()
+	calls = mock.calls.LLMStats
+	mock.lockLLMStats.RUnlock()
+	return calls
+}
+
+// ResetLLMStatsCalls reset all the calls that were made to LLMStats.
+func (mock *LLMStatsMock) ResetLLMStatsCalls() {
+	mock.lockLLMStats.Lock()
+	mock.calls.LLMStats = nil
+	mock.lockLLMStats.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *LLMStatsMock) ResetCalls() {
+	mock.lockLLMStats.Lock()
+	mock.calls.LLMStats = nil
+	mock.lockLLMStats.Unlock()
+}
@@ -0,0 +1,98 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"context"
+	"github.com/umputun/tg-spam/lib/tgspam"
+	"sync"
+)
+
+// TunerMock is a mock implementation of webapi.Tuner.
+//
+//	func TestSomethingThatUsesTuner(t *testing.T) {
+//
+//		// make and configure a mocked webapi.Tuner
+//		mockedTuner := &TunerMock{
+//			TuneFunc: func(ctx context.Context, msgs []tgspam.LabeledMessage, grid tgspam.TuneGrid) (tgspam.TuneReport, error) {
+//				panic("mock out the Tune method")
+//			},
+//		}
+//
+//		// use mockedTuner in code that requires webapi.Tuner
+//		// and then make assertions.
+//
+//	}
+type TunerMock struct {
+	// TuneFunc mocks the Tune method.
+	TuneFunc func(ctx context.Context, msgs []tgspam.LabeledMessage, grid tgspam.TuneGrid) (tgspam.TuneReport, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Tune holds details about calls to the Tune method.
+		Tune []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Msgs is the msgs argument value.
+			Msgs []tgspam.LabeledMessage
+			// Grid is the grid argument value.
+			Grid tgspam.TuneGrid
+		}
+	}
+	lockTune sync.RWMutex
+}
+
+// Tune calls TuneFunc.
+func (mock *TunerMock) Tune(ctx context.Context, msgs []tgspam.LabeledMessage, grid tgspam.TuneGrid) (tgspam.TuneReport, error) {
+	if mock.TuneFunc == nil {
+		panic("TunerMock.TuneFunc: method is nil but Tuner.Tune was just called")
+	}
+	callInfo := struct {
+		Ctx  context.Context
+		Msgs []tgspam.LabeledMessage
+		Grid tgspam.TuneGrid
+	}{
+		Ctx:  ctx,
+		Msgs: msgs,
+		Grid: grid,
+	}
+	mock.lockTune.Lock()
+	mock.calls.Tune = append(mock.calls.Tune, callInfo)
+	mock.lockTune.Unlock()
+	return mock.TuneFunc(ctx, msgs, grid)
+}
+
+// TuneCalls gets all the calls that were made to Tune.
+// Check the length with:
+//
+//	len(mockedTuner.TuneCalls())
+func (mock *TunerMock) TuneCalls() []struct {
+	Ctx  context.Context
+	Msgs []tgspam.LabeledMessage
+	Grid tgspam.TuneGrid
+} {
+	var calls []struct {
+		Ctx  context.Context
+		Msgs []tgspam.LabeledMessage
+		Grid tgspam.TuneGrid
+	}
+	mock.lockTune.RLock()
+	calls = mock.calls.Tune
+	mock.lockTune.RUnlock()
+	return calls
+}
+
+// ResetTuneCalls reset all the calls that were made to Tune.
+func (mock *TunerMock) ResetTuneCalls() {
+	mock.lockTune.Lock()
+	mock.calls.Tune = nil
+	mock.lockTune.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *TunerMock) ResetCalls() {
+	mock.lockTune.Lock()
+	mock.calls.Tune = nil
+	mock.lockTune.Unlock()
+}
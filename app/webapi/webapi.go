@@ -15,6 +15,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/didip/tollbooth/v7"
@@ -27,12 +28,16 @@ import (
 	"github.com/umputun/tg-spam/app/storage"
 	"github.com/umputun/tg-spam/lib/approved"
 	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam"
 )
 
 //go:generate moq --out mocks/detector.go --pkg mocks --with-resets --skip-ensure . Detector
 //go:generate moq --out mocks/spam_filter.go --pkg mocks --with-resets --skip-ensure . SpamFilter
 //go:generate moq --out mocks/locator.go --pkg mocks --with-resets --skip-ensure . Locator
 //go:generate moq --out mocks/detected_spam.go --pkg mocks --with-resets --skip-ensure . DetectedSpam
+//go:generate moq --out mocks/cas_mirror.go --pkg mocks --with-resets --skip-ensure . CasMirror
+//go:generate moq --out mocks/tuner.go --pkg mocks --with-resets --skip-ensure . Tuner
+//go:generate moq --out mocks/llm_stats.go --pkg mocks --with-resets --skip-ensure . LLMStats
 
 //go:embed assets/* assets/components/*
 var templateFS embed.FS
@@ -41,6 +46,7 @@ var tmpl = template.Must(template.ParseFS(templateFS, "assets/*.html", "assets/c
 // Server is a web API server.
 type Server struct {
 	Config
+	tuneLock sync.Mutex // allows a single tuning at a time, as it trains a new detector
 }
 
 // Config defines  server parameters
@@ -50,6 +56,9 @@ type Config struct {
 	Detector     Detector     // spam detector
 	SpamFilter   SpamFilter   // spam filter (bot)
 	DetectedSpam DetectedSpam // detected spam accessor
+	CasMirror    CasMirror    // local CAS mirror, optional
+	Tuner        Tuner        // detector parameters tuner, optional
+	LLMStats     LLMStats     // counters of openai check calls, optional
 	Locator      Locator      // locator for user info
 	AuthPasswd   string       // basic auth password for user "tg-spam"
 	Dbg          bool         // debug mode
@@ -58,34 +67,47 @@ type Config struct {
 
 // Settings contains all application settings
 type Settings struct {
-	PrimaryGroup            string   `json:"primary_group"`
-	AdminGroup              string   `json:"admin_group"`
-	DisableAdminSpamForward bool     `json:"disable_admin_spam_forward"`
-	LoggerEnabled           bool     `json:"logger_enabled"`
-	SuperUsers              []string `json:"super_users"`
-	NoSpamReply             bool     `json:"no_spam_reply"`
-	CasEnabled              bool     `json:"cas_enabled"`
-	MetaEnabled             bool     `json:"meta_enabled"`
-	MetaLinksLimit          int      `json:"meta_links_limit"`
-	MetaLinksOnly           bool     `json:"meta_links_only"`
-	MetaImageOnly           bool     `json:"meta_image_only"`
-	OpenAIEnabled           bool     `json:"openai_enabled"`
-	SamplesDataPath         string   `json:"samples_data_path"`
-	DynamicDataPath         string   `json:"dynamic_data_path"`
-	WatchIntervalSecs       int      `json:"watch_interval_secs"`
-	SimilarityThreshold     float64  `json:"similarity_threshold"`
-	MinMsgLen               int      `json:"min_msg_len"`
-	MaxEmoji                int      `json:"max_emoji"`
-	MinSpamProbability      float64  `json:"min_spam_probability"`
-	ParanoidMode            bool     `json:"paranoid_mode"`
-	FirstMessagesCount      int      `json:"first_messages_count"`
-	StartupMessageEnabled   bool     `json:"startup_message_enabled"`
-	TrainingEnabled         bool     `json:"training_enabled"`
+	PrimaryGroup            string               `json:"primary_group"`
+	AdminGroup              string               `json:"admin_group"`
+	DisableAdminSpamForward bool                 `json:"disable_admin_spam_forward"`
+	LoggerEnabled           bool                 `json:"logger_enabled"`
+	SuperUsers              []string             `json:"super_users"`
+	NoSpamReply             bool                 `json:"no_spam_reply"`
+	CasEnabled              bool                 `json:"cas_enabled"`
+	MetaEnabled             bool                 `json:"meta_enabled"`
+	MetaLinksLimit          int                  `json:"meta_links_limit"`
+	MetaLinksOnly           bool                 `json:"meta_links_only"`
+	MetaImageOnly           bool                 `json:"meta_image_only"`
+	OpenAIEnabled           bool                 `json:"openai_enabled"`
+	OpenAIGrayZone          tgspam.GrayZone      `json:"openai_gray_zone"`
+	SamplesDataPath         string               `json:"samples_data_path"`
+	DynamicDataPath         string               `json:"dynamic_data_path"`
+	WatchIntervalSecs       int                  `json:"watch_interval_secs"`
+	SimilarityThreshold     float64              `json:"similarity_threshold"`
+	SimilarityTFIDF         bool                 `json:"similarity_tfidf"`
+	MinMsgLen               int                  `json:"min_msg_len"`
+	MaxEmoji                int                  `json:"max_emoji"`
+	ObfuscationRatio        float64              `json:"obfuscation_ratio"`
+	Tokenization            string               `json:"tokenization"`
+	NgramSize               int                  `json:"ngram_size"`
+	MinSpamProbability      float64              `json:"min_spam_probability"`
+	ClassifierTopTokens     int                  `json:"classifier_top_tokens"`
+	ParanoidMode            bool                 `json:"paranoid_mode"`
+	FirstMessagesCount      int                  `json:"first_messages_count"`
+	StartupMessageEnabled   bool                 `json:"startup_message_enabled"`
+	TrainingEnabled         bool                 `json:"training_enabled"`
+	ScoreThreshold          float64              `json:"score_threshold"`
+	CheckWeights            map[string]float64   `json:"check_weights"`
+	CasMirrorEnabled        bool                 `json:"cas_mirror_enabled"`
+	CasMirrorSource         string               `json:"cas_mirror_source"`
+	CasMirrorSync           *storage.CasSyncInfo `json:"cas_mirror_sync,omitempty"` // last sync info, set on request
+	LLMStats                *tgspam.LLMStats     `json:"llm_stats,omitempty"`       // openai check calls, set on request
 }
 
 // Detector is a spam detector interface.
 type Detector interface {
-	Check(req spamcheck.Request) (spam bool, cr []spamcheck.Response)
+	CheckCtx(ctx context.Context, req spamcheck.Request) (spam bool, cr []spamcheck.Response)
+	Normalize(msg string) string
 	ApprovedUsers() []approved.UserInfo
 	AddApprovedUser(user approved.UserInfo) error
 	RemoveApprovedUser(id string) error
@@ -113,6 +135,21 @@ type DetectedSpam interface {
 	SetAddedToSamplesFlag(id int64) error
 }
 
+// LLMStats is an interface to get the counters of openai check calls, satisfied by tgspam.Detector.
+type LLMStats interface {
+	LLMStats() tgspam.LLMStats
+}
+
+// CasMirror is a local CAS mirror interface used to get the last sync info.
+type CasMirror interface {
+	LastSync() (storage.CasSyncInfo, error)
+}
+
+// Tuner is an interface to tune detector parameters on labeled messages.
+type Tuner interface {
+	Tune(ctx context.Context, msgs []tgspam.LabeledMessage, grid tgspam.TuneGrid) (tgspam.TuneReport, error)
+}
+
 // NewServer creates a new web API server.
 func NewServer(config Config) *Server {
 	return &Server{Config: config}
@@ -188,8 +225,10 @@ func (s *Server) routes(router *chi.Mux) *chi.Mux {
 		})
 
 		authApi.Get("/settings", func(w http.ResponseWriter, _ *http.Request) {
-			rest.RenderJSON(w, s.Settings)
+			rest.RenderJSON(w, s.currentSettings())
 		})
+
+		authApi.Post("/tune", s.tuneHandler) // tune detector parameters on labeled messages
 	})
 
 	router.Group(func(webUI chi.Router) {
@@ -203,18 +242,74 @@ func (s *Server) routes(router *chi.Mux) *chi.Mux {
 		webUI.Get("/logo.png", s.logoHandler)                          // serve logo.png
 		webUI.Get("/spinner.svg", s.spinnerHandler)                    // serve spinner.svg
 		webUI.Post("/detected_spam/add", s.htmlAddDetectedSpamHandler) // add detected spam to samples
+		webUI.Post("/spam_sample/remove", s.htmlRemoveSampleHandler)   // remove dynamic spam sample reported by check
 	})
 
 	return router
 }
 
+// tuneHandler handles POST /tune request.
+// it gets labeled messages and optional grid of parameter values, and returns the pareto front of false-positive
+// and false-negative rates with the recommended parameters. Default grid values used for parameters without values.
+func (s *Server) tuneHandler(w http.ResponseWriter, r *http.Request) {
+	if s.Tuner == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		rest.RenderJSON(w, rest.JSON{"error": "tuning is not available"})
+		return
+	}
+	if !s.tuneLock.TryLock() {
+		w.WriteHeader(http.StatusConflict)
+		rest.RenderJSON(w, rest.JSON{"error": "tuning is already in progress"})
+		return
+	}
+	defer s.tuneLock.Unlock()
+
+	req := struct {
+		Messages []struct {
+			Text  string `json:"text"`
+			Label string `json:"label"`
+		} `json:"messages"`
+		Grid tgspam.TuneGrid `json:"grid"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't decode request", "details": err.Error()})
+		log.Printf("[WARN] can't decode request: %v", err)
+		return
+	}
+
+	msgs := make([]tgspam.LabeledMessage, 0, len(req.Messages))
+	for i, m := range req.Messages {
+		switch strings.ToLower(m.Label) {
+		case "spam", "ham":
+			msgs = append(msgs, tgspam.LabeledMessage{Msg: m.Text, Spam: strings.EqualFold(m.Label, "spam")})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid label",
+				"details": fmt.Sprintf("message %d has label %q, should be spam or ham", i, m.Label)})
+			return
+		}
+	}
+
+	rep, err := s.Tuner.Tune(r.Context(), msgs, req.Grid.WithDefaults())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't tune", "details": err.Error()})
+		log.Printf("[WARN] can't tune: %v", err)
+		return
+	}
+	log.Printf("[INFO] tuned on %d messages, evaluated %d combinations, recommended: %v", len(msgs), rep.Evaluated, rep.Recommended)
+	rest.RenderJSON(w, rep)
+}
+
 // checkHandler handles POST /check request.
 // it gets message text and user id from request body and returns spam status and check results.
 func (s *Server) checkHandler(w http.ResponseWriter, r *http.Request) {
 
 	type CheckResultDisplay struct {
-		Spam   bool
-		Checks []spamcheck.Response
+		Spam       bool
+		Checks     []spamcheck.Response
+		Normalized string // normalized message, set if differs from the original one
 	}
 
 	isHtmxRequest := r.Header.Get("HX-Request") == "true"
@@ -235,7 +330,7 @@ func (s *Server) checkHandler(w http.ResponseWriter, r *http.Request) {
 		req.Msg = r.FormValue("msg")
 	}
 
-	spam, cr := s.Detector.Check(req)
+	spam, cr := s.Detector.CheckCtx(r.Context(), req) // client disconnect cancels remote checks
 	if !isHtmxRequest {
 		// for API request return JSON
 		rest.RenderJSON(w, rest.JSON{"spam": spam, "checks": cr})
@@ -253,6 +348,9 @@ func (s *Server) checkHandler(w http.ResponseWriter, r *http.Request) {
 		Spam:   spam,
 		Checks: cr,
 	}
+	if normalized := s.Detector.Normalize(req.Msg); normalized != req.Msg {
+		resultDisplay.Normalized = normalized
+	}
 
 	if err := tmpl.ExecuteTemplate(w, "check_results", resultDisplay); err != nil {
 		log.Printf("[WARN] can't execute result template: %v", err)
@@ -533,12 +631,33 @@ func (s *Server) htmlAddDetectedSpamHandler(w http.ResponseWriter, r *http.Reque
 	w.WriteHeader(http.StatusOK)
 }
 
+// htmlRemoveSampleHandler removes the nearest dynamic spam sample reported by the similarity check
+func (s *Server) htmlRemoveSampleHandler(w http.ResponseWriter, r *http.Request) {
+	msg := r.FormValue("msg")
+	if msg == "" {
+		log.Printf("[WARN] bad request: empty sample")
+		w.Header().Set("HX-Retarget", "#error-message")
+		fmt.Fprint(w, "<div class='alert alert-danger'>bad request: empty sample</div>")
+		return
+	}
+
+	count, err := s.SpamFilter.RemoveDynamicSpamSample(msg)
+	if err != nil {
+		log.Printf("[WARN] failed to remove spam sample: %v", err)
+		w.Header().Set("HX-Retarget", "#error-message")
+		fmt.Fprintf(w, "<div class='alert alert-danger'>can't remove spam sample: %s</div>", template.HTMLEscapeString(err.Error()))
+		return
+	}
+	log.Printf("[INFO] removed dynamic spam sample %q, count: %d", msg, count)
+	fmt.Fprintf(w, "<span class='badge bg-secondary'>sample removed (%d)</span>", count)
+}
+
 func (s *Server) htmlSettingsHandler(w http.ResponseWriter, _ *http.Request) {
 	data := struct {
 		Settings
 		Version string
 	}{
-		Settings: s.Settings,
+		Settings: s.currentSettings(),
 		Version:  s.Version,
 	}
 
@@ -549,6 +668,25 @@ func (s *Server) htmlSettingsHandler(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+// currentSettings returns application settings with dynamic parts, like the last CAS mirror sync info
+func (s *Server) currentSettings() Settings {
+	res := s.Settings
+	if s.LLMStats != nil {
+		stats := s.LLMStats.LLMStats()
+		res.LLMStats = &stats
+	}
+	if s.CasMirror == nil {
+		return res
+	}
+	syncInfo, err := s.CasMirror.LastSync()
+	if err != nil {
+		log.Printf("[WARN] can't get cas mirror sync info: %v", err)
+		return res
+	}
+	res.CasMirrorSync = &syncInfo
+	return res
+}
+
 // stylesHandler handles GET /styles.css request. It returns styles.css file.
 func (s *Server) stylesHandler(w http.ResponseWriter, _ *http.Request) {
 	body, err := templateFS.ReadFile("assets/styles.css")
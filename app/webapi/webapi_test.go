@@ -21,6 +21,7 @@ import (
 	"github.com/umputun/tg-spam/app/webapi/mocks"
 	"github.com/umputun/tg-spam/lib/approved"
 	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam"
 )
 
 func TestServer_Run(t *testing.T) {
@@ -57,7 +58,7 @@ func TestServer_RunAuth(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	mockDetector := &mocks.DetectorMock{
-		CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
+		CheckCtxFunc: func(_ context.Context, req spamcheck.Request) (bool, []spamcheck.Response) {
 			return false, []spamcheck.Response{{Details: "not spam"}}
 		},
 	}
@@ -125,7 +126,7 @@ func TestServer_RunAuth(t *testing.T) {
 
 func TestServer_routes(t *testing.T) {
 	detectorMock := &mocks.DetectorMock{
-		CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
+		CheckCtxFunc: func(_ context.Context, req spamcheck.Request) (bool, []spamcheck.Response) {
 			return false, []spamcheck.Response{{Details: "not spam"}}
 		},
 		ApprovedUsersFunc: func() []approved.UserInfo {
@@ -168,9 +169,9 @@ func TestServer_routes(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 		assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
-		assert.Equal(t, 1, len(detectorMock.CheckCalls()))
-		assert.Equal(t, "spam example", detectorMock.CheckCalls()[0].Req.Msg)
-		assert.Equal(t, "user123", detectorMock.CheckCalls()[0].Req.UserID)
+		assert.Equal(t, 1, len(detectorMock.CheckCtxCalls()))
+		assert.Equal(t, "spam example", detectorMock.CheckCtxCalls()[0].Req.Msg)
+		assert.Equal(t, "user123", detectorMock.CheckCtxCalls()[0].Req.UserID)
 	})
 
 	t.Run("update spam", func(t *testing.T) {
@@ -339,7 +340,7 @@ func TestServer_routes(t *testing.T) {
 
 func TestServer_checkHandler(t *testing.T) {
 	mockDetector := &mocks.DetectorMock{
-		CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
+		CheckCtxFunc: func(_ context.Context, req spamcheck.Request) (bool, []spamcheck.Response) {
 			if req.Msg == "spam example" {
 				return true, []spamcheck.Response{{Spam: true, Name: "test", Details: "this was spam"}}
 			}
@@ -417,6 +418,108 @@ func TestServer_checkHandler(t *testing.T) {
 
 }
 
+func TestServer_tuneHandler(t *testing.T) {
+	tunerMock := &mocks.TunerMock{
+		TuneFunc: func(ctx context.Context, msgs []tgspam.LabeledMessage, grid tgspam.TuneGrid) (tgspam.TuneReport, error) {
+			if len(msgs) > 0 && msgs[0].Msg == "fail" {
+				return tgspam.TuneReport{}, errors.New("tune error")
+			}
+			p := tgspam.TunePoint{SimilarityThreshold: 0.5, MinSpamProbability: 60, MaxAllowedEmoji: 2, MinMsgLen: 10,
+				Confusion: tgspam.Confusion{TP: 1, TN: 1}}
+			return tgspam.TuneReport{Evaluated: 42, Front: []tgspam.TunePoint{p}, Recommended: p}, nil
+		},
+	}
+	server := NewServer(Config{Tuner: tunerMock})
+
+	t.Run("tuned", func(t *testing.T) {
+		tunerMock.ResetCalls()
+		body := `{"messages": [{"text": "free usdt", "label": "Spam"}, {"text": "hello", "label": "ham"}],
+			"grid": {"similarity_threshold": [0.4, 0.5]}}`
+		req := httptest.NewRequest("POST", "/tune", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.tuneHandler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var rep tgspam.TuneReport
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rep))
+		assert.Equal(t, 42, rep.Evaluated)
+		assert.Equal(t, 60.0, rep.Recommended.MinSpamProbability)
+		assert.Equal(t, 1, rep.Recommended.TP)
+		assert.Contains(t, rr.Body.String(), `"fpr":0`)
+
+		require.Len(t, tunerMock.TuneCalls(), 1)
+		assert.Equal(t, []tgspam.LabeledMessage{{Msg: "free usdt", Spam: true}, {Msg: "hello", Spam: false}},
+			tunerMock.TuneCalls()[0].Msgs)
+		grid := tunerMock.TuneCalls()[0].Grid
+		assert.Equal(t, []float64{0.4, 0.5}, grid.SimilarityThreshold)
+		assert.Equal(t, tgspam.DefaultTuneGrid().MinMsgLen, grid.MinMsgLen, "default values for parameters without values")
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/tune", strings.NewReader("bad json"))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.tuneHandler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "can't decode request")
+	})
+
+	t.Run("invalid label", func(t *testing.T) {
+		tunerMock.ResetCalls()
+		body := `{"messages": [{"text": "free usdt", "label": "junk"}]}`
+		req := httptest.NewRequest("POST", "/tune", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.tuneHandler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `message 0 has label \"junk\", should be spam or ham`)
+		assert.Empty(t, tunerMock.TuneCalls())
+	})
+
+	t.Run("tuner error", func(t *testing.T) {
+		body := `{"messages": [{"text": "fail", "label": "spam"}]}`
+		req := httptest.NewRequest("POST", "/tune", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.tuneHandler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Body.String(), "tune error")
+	})
+
+	t.Run("concurrent tuning rejected", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		blockingMock := &mocks.TunerMock{
+			TuneFunc: func(context.Context, []tgspam.LabeledMessage, tgspam.TuneGrid) (tgspam.TuneReport, error) {
+				close(started)
+				<-release
+				return tgspam.TuneReport{}, nil
+			},
+		}
+		srv := NewServer(Config{Tuner: blockingMock})
+		done := make(chan int)
+		go func() {
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(srv.tuneHandler).ServeHTTP(rr, httptest.NewRequest("POST", "/tune", strings.NewReader(`{}`)))
+			done <- rr.Code
+		}()
+		<-started
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(srv.tuneHandler).ServeHTTP(rr, httptest.NewRequest("POST", "/tune", strings.NewReader(`{}`)))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "tuning is already in progress")
+
+		close(release)
+		assert.Equal(t, http.StatusOK, <-done)
+		assert.Len(t, blockingMock.TuneCalls(), 1)
+	})
+
+	t.Run("no tuner", func(t *testing.T) {
+		srv := NewServer(Config{})
+		req := httptest.NewRequest("POST", "/tune", strings.NewReader(`{"messages": []}`))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(srv.tuneHandler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	})
+}
+
 func TestServer_updateSampleHandler(t *testing.T) {
 	spamFilterMock := &mocks.SpamFilterMock{
 		UpdateSpamFunc: func(msg string) error {
@@ -774,6 +877,50 @@ func TestServer_htmlAddDetectedSpamHandler(t *testing.T) {
 	assert.Equal(t, "blah", sf.UpdateSpamCalls()[0].Msg)
 }
 
+func TestServer_htmlRemoveSampleHandler(t *testing.T) {
+	sf := &mocks.SpamFilterMock{
+		RemoveDynamicSpamSampleFunc: func(sample string) (int, error) {
+			if sample == "unknown" {
+				return 0, errors.New("sample not found")
+			}
+			return 1, nil
+		},
+	}
+	server := NewServer(Config{SpamFilter: sf})
+	handler := http.HandlerFunc(server.htmlRemoveSampleHandler)
+
+	t.Run("removed", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/spam_sample/remove?msg=blah", http.NoBody)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "<span class='badge bg-secondary'>sample removed (1)</span>", rr.Body.String())
+		require.Equal(t, 1, len(sf.RemoveDynamicSpamSampleCalls()))
+		assert.Equal(t, "blah", sf.RemoveDynamicSpamSampleCalls()[0].Sample)
+	})
+
+	t.Run("remove failed", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/spam_sample/remove?msg=unknown", http.NoBody)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, "#error-message", rr.Header().Get("HX-Retarget"))
+		assert.Contains(t, rr.Body.String(), "can't remove spam sample: sample not found")
+	})
+
+	t.Run("empty sample", func(t *testing.T) {
+		sf.ResetCalls()
+		req, err := http.NewRequest("POST", "/spam_sample/remove", http.NoBody)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, "#error-message", rr.Header().Get("HX-Retarget"))
+		assert.Contains(t, rr.Body.String(), "bad request")
+		assert.Equal(t, 0, len(sf.RemoveDynamicSpamSampleCalls()))
+	})
+}
+
 func TestServer_GenerateRandomPassword(t *testing.T) {
 	res1, err := GenerateRandomPassword(32)
 	require.NoError(t, err)
@@ -790,9 +937,18 @@ func TestServer_GenerateRandomPassword(t *testing.T) {
 
 func TestServer_checkHandler_HTMX(t *testing.T) {
 	mockDetector := &mocks.DetectorMock{
-		CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
-			return req.Msg == "spam example", []spamcheck.Response{{Spam: req.Msg == "spam example", Name: "test", Details: "result details"}}
+		CheckCtxFunc: func(_ context.Context, req spamcheck.Request) (bool, []spamcheck.Response) {
+			if req.Msg == "classified spam" {
+				return true, []spamcheck.Response{{Spam: true, Name: "classifier", Details: "probability of spam: 90.00%",
+					Score: 0.9, Tokens: []spamcheck.TokenWeight{{Token: "classified", Weight: 1.5}, {Token: "hello", Weight: -0.25}}}}
+			}
+			if req.Msg == "similar spam" {
+				return true, []spamcheck.Response{{Spam: true, Name: "similarity", Details: "0.80/0.50",
+					Sample: &spamcheck.Sample{Text: "similar spam sample", Source: "spam_dynamic.txt", Dynamic: true}}}
+			}
+			return req.Msg == "spam example", []spamcheck.Response{{Spam: req.Msg == "spam example", Name: "test", Details: "result details", Score: 0.75}}
 		},
+		NormalizeFunc: func(msg string) string { return strings.ReplaceAll(msg, "𝐬𝐩𝐚𝐦", "spam") },
 		RemoveApprovedUserFunc: func(id string) error {
 			return nil
 		},
@@ -821,15 +977,69 @@ func TestServer_checkHandler_HTMX(t *testing.T) {
 		// check if the response contains expected HTML snippet
 		assert.Contains(t, rr.Body.String(), "strong>Result:</strong> Spam detected", "response should contain spam result")
 		assert.Contains(t, rr.Body.String(), "result details")
+		assert.Contains(t, rr.Body.String(), "(score: 0.75)")
+		assert.NotContains(t, rr.Body.String(), "normalized:", "normalized message should be shown only if differs")
 
-		assert.Equal(t, 1, len(mockDetector.CheckCalls()))
-		assert.Equal(t, "spam example", mockDetector.CheckCalls()[0].Req.Msg)
-		assert.Equal(t, "user123", mockDetector.CheckCalls()[0].Req.UserID)
+		assert.Equal(t, 1, len(mockDetector.CheckCtxCalls()))
+		assert.Equal(t, "spam example", mockDetector.CheckCtxCalls()[0].Req.Msg)
+		assert.Equal(t, "user123", mockDetector.CheckCtxCalls()[0].Req.UserID)
 
 		// check if id cleaned
 		assert.Equal(t, 1, len(mockDetector.RemoveApprovedUserCalls()))
 		assert.Equal(t, "user123", mockDetector.RemoveApprovedUserCalls()[0].ID)
 	})
+
+	t.Run("HTMX request with normalized message", func(t *testing.T) {
+		form := url.Values{}
+		form.Set("msg", "𝐬𝐩𝐚𝐦 example")
+		form.Set("user_id", "user123")
+		req, err := http.NewRequest("POST", "/check", strings.NewReader(form.Encode()))
+		require.NoError(t, err)
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("HX-Request", "true") // Simulating HTMX request
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.checkHandler)
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "handler returned wrong status code")
+		assert.Contains(t, rr.Body.String(), "<strong>normalized:</strong> spam example")
+	})
+
+	t.Run("HTMX request with classifier tokens", func(t *testing.T) {
+		form := url.Values{}
+		form.Set("msg", "classified spam")
+		form.Set("user_id", "user123")
+		req, err := http.NewRequest("POST", "/check", strings.NewReader(form.Encode()))
+		require.NoError(t, err)
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("HX-Request", "true") // Simulating HTMX request
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.checkHandler)
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "handler returned wrong status code")
+		body := rr.Body.String()
+		assert.Contains(t, body, `<span class="badge bg-danger">classified &#43;1.50</span>`) // "+" escaped by html/template
+		assert.Contains(t, body, `<span class="badge bg-success">hello -0.25</span>`)
+	})
+
+	t.Run("HTMX request with nearest sample", func(t *testing.T) {
+		form := url.Values{}
+		form.Set("msg", "similar spam")
+		form.Set("user_id", "user123")
+		req, err := http.NewRequest("POST", "/check", strings.NewReader(form.Encode()))
+		require.NoError(t, err)
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("HX-Request", "true") // Simulating HTMX request
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.checkHandler)
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "handler returned wrong status code")
+		body := rr.Body.String()
+		assert.Contains(t, body, `nearest sample (dynamic spam_dynamic.txt): <span title="similar spam sample">similar spam sample</span>`)
+		assert.Contains(t, body, `hx-post="/spam_sample/remove" name="msg" value="similar spam sample"`)
+	})
 }
 
 func TestServer_htmlSpamCheckHandler(t *testing.T) {
@@ -905,6 +1115,63 @@ func TestServer_htmlSettingsHandler(t *testing.T) {
 	assert.Contains(t, body, "<title>Settings - TG-Spam</title>", "template should contain the correct title")
 	assert.Contains(t, body, "<tr><th>Super Users</th><td>user1<br>user2<br></td></tr>", "template should contain supers list")
 	assert.Contains(t, body, "<tr><th>Min Message Length</th><td>150</td></tr>")
+	assert.Contains(t, body, "<tr><th>CAS Mirror Enabled</th><td>false</td></tr>")
+	assert.NotContains(t, body, "CAS Mirror Last Sync")
+
+	t.Run("with cas mirror", func(t *testing.T) {
+		mirror := &mocks.CasMirrorMock{LastSyncFunc: func() (storage.CasSyncInfo, error) {
+			return storage.CasSyncInfo{Source: "https://api.cas.chat/export.csv", Total: 100, Added: 10, Removed: 5,
+				Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, nil
+		}}
+		server := NewServer(Config{Version: "1.0", CasMirror: mirror,
+			Settings: Settings{CasMirrorEnabled: true, CasMirrorSource: "https://api.cas.chat/export.csv"}})
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/settings", http.NoBody)
+		require.NoError(t, err)
+		http.HandlerFunc(server.htmlSettingsHandler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		body := rr.Body.String()
+		assert.Contains(t, body, "<tr><th>CAS Mirror Source</th><td>https://api.cas.chat/export.csv</td></tr>")
+		assert.Contains(t, body, "<tr><th>CAS Mirror Last Sync</th><td>2024-01-02 03:04:05, total: 100, added: 10, removed: 5</td></tr>")
+		assert.Len(t, mirror.LastSyncCalls(), 1)
+	})
+
+	t.Run("with openai gray zone and stats", func(t *testing.T) {
+		stats := &mocks.LLMStatsMock{LLMStatsFunc: func() tgspam.LLMStats {
+			return tgspam.LLMStats{Calls: 12, Skipped: 30, Cached: 5, Limited: 2,
+				Usage:       tgspam.LLMUsage{Day: "2024-01-02", Requests: 12, InputTokens: 1000, OutputTokens: 200, Cost: 0.0045},
+				DailyTokens: 10000}
+		}}
+		server := NewServer(Config{Version: "1.0", LLMStats: stats, Settings: Settings{OpenAIEnabled: true,
+			OpenAIGrayZone: tgspam.GrayZone{Enabled: true, MinProbability: 30, MaxProbability: 80, MinSimilarity: 0.3, MaxSimilarity: 0.6}}})
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/settings", http.NoBody)
+		require.NoError(t, err)
+		http.HandlerFunc(server.htmlSettingsHandler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		body := rr.Body.String()
+		assert.Contains(t, body, "<tr><th>OpenAI Gray Zone</th><td>probability 30-80%, similarity 0.30-0.60</td></tr>")
+		assert.Contains(t, body, "<tr><th>OpenAI Calls</th><td>calls: 12, saved by gray zone: 30, cached: 5, limited: 2</td></tr>")
+		assert.Contains(t, body, "<tr><th>OpenAI Usage Today</th><td>requests: 12, tokens: 1200 of 10000, cost: 0.0045</td></tr>")
+		assert.Len(t, stats.LLMStatsCalls(), 1)
+
+		settings := server.currentSettings()
+		require.NotNil(t, settings.LLMStats)
+		assert.Equal(t, tgspam.LLMUsage{Day: "2024-01-02", Requests: 12, InputTokens: 1000, OutputTokens: 200, Cost: 0.0045},
+			settings.LLMStats.Usage)
+		assert.Equal(t, int64(12), settings.LLMStats.Calls)
+	})
+
+	t.Run("openai without gray zone", func(t *testing.T) {
+		server := NewServer(Config{Version: "1.0", Settings: Settings{OpenAIEnabled: true}})
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/settings", http.NoBody)
+		require.NoError(t, err)
+		http.HandlerFunc(server.htmlSettingsHandler).ServeHTTP(rr, req)
+		body := rr.Body.String()
+		assert.Contains(t, body, "<tr><th>OpenAI Gray Zone</th><td>disabled</td></tr>")
+		assert.Contains(t, body, "<tr><th>OpenAI Calls</th><td>unknown</td></tr>")
+	})
 }
 
 func TestServer_stylesHandler(t *testing.T) {
@@ -17,6 +17,7 @@ require (
 	github.com/sashabaranov/go-openai v1.23.1
 	github.com/stretchr/testify v1.9.0
 	github.com/umputun/go-flags v1.5.1
+	golang.org/x/text v0.14.0
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 	modernc.org/sqlite v1.29.9
 )
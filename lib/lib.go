@@ -15,21 +15,51 @@
 //     "hello world"
 //     "some phrase", "another phrase"
 //
+//     Besides plain phrases matched as a substring, a line can have a rule with a prefix: "re:" for a
+//     case-insensitive regular expression, "word:" for a whole word or phrase and "glob:" for a glob pattern
+//     of whole words, like "glob:earn* fast". Rules should be on their own lines. Invalid rules are skipped
+//     and reported in LoadResult.InvalidStopWords. Plain phrases are matched in a single pass by Aho-Corasick
+//     automaton, and the check reports all the matched phrases and rules.
+//
 //   - LoadSamples: This method loads samples of spam and ham (non-spam) messages. It also
 //     accepts a reader for a list of excluded tokens, often comprising words too common to aid
 //     in spam detection. The loaded samples are utilized to train the spam detectors, which include
-//     one based on the Naive Bayes algorithm and another on Cosine Similarity.
+//     one based on the Naive Bayes algorithm and another on Cosine Similarity. If Config.SnapshotFile is set,
+//     the trained state is saved to this file and restored from it on the next load with the same inputs.
+//
+// Samples, stop words and checked messages are normalized the same way before tokenization and matching:
+// invisible characters removed, styled letters converted to plain ones (NFKC) and homoglyphs from another script
+// replaced by the letters of the word's dominant script, or by latin letters if scripts are mixed in equal parts.
+// Words of a single script are kept as is.
+// Then obfuscated words, like "m o n e y" or "m0n3y", are reverted if Config.ObfuscationThreshold is set.
+// Detector.Normalize returns the normalized and de-obfuscated form of a message.
 //
 // Additionally, Config provides configuration options:
 //
 //   - Config.MaxAllowedEmoji specifies the maximum number of emojis permissible in a message.
 //     Messages exceeding this count are marked as spam. A negative value deactivates emoji detection.
 //
+//   - Config.ObfuscationThreshold defines the ratio of obfuscated words, like "m o n e y" or "m0n3y", to mark the message
+//     as spam. If set, obfuscated words are reverted for other checks as well. Zero value deactivates both.
+//
+//   - Config.SimilarityTFIDF enables TF-IDF weighting of tokens in the similarity check, with IDF calculated from
+//     all the loaded spam and ham samples, to reduce the impact of common words.
+//
+//     The similarity check of a spam message reports the nearest spam sample in spamcheck.Response.Sample, with
+//     its source and a flag of a dynamic sample, which can be removed with Detector.RemoveSpam.
+//
+//   - Config.Tokenization sets the way to split messages and samples to tokens for the similarity and classifier
+//     checks: words (TokenizeWords, default), character n-grams of Config.NgramSize (TokenizeCharNgrams) or word
+//     bigrams (TokenizeWordBigrams).
+//
 //   - Config.MinMsgLen defines the minimum message length for spam checks. Messages shorter
 //     than this threshold are ignored. A negative value or zero deactivates this check.
 //
 //   - Config.MinSpamProbability defines minimum spam probability to consider a message spam with classifier, if 0 - ignored
 //
+//   - Config.ClassifierTopTokens sets the number of tokens contributed most to the classifier verdict, reported in
+//     spamcheck.Response.Tokens with their log-likelihood ratio of spam to ham. Not reported if 0.
+//
 //   - Config.FirstMessageOnly specifies whether only the first message from a given userID should
 //     be checked.
 //
@@ -41,10 +71,45 @@
 //   - Config.HTTPClient specifies the HTTP client to use for CAS API checks. This interface is satisfied
 //     by the standard library's http.Client type.
 //
+//   - Config.CasCacheTTL and Config.CasCacheNegativeTTL enable the in-memory cache of CAS results, with separate TTLs
+//     for spam and not spam results. Config.CasCacheSize limits the number of cached results. The cache can be
+//     persisted with Detector.WithCasCacheStorage. A local mirror of CAS banned users can be set with
+//     Detector.WithCasMirror, in this case CAS API is used as a fallback only.
+//
 // Other important methods are Detector.UpdateSpam and Detector.UpdateHam, which are used to update the
 // spam and ham samples on the fly. Those methods are thread-safe and can be called concurrently.
 // To call them Detector.WithSpamUpdater and Detector.WithHamUpdater methods should be used first to provide
-// user-defined structs that implement the SampleUpdater interface.
+// user-defined structs that implement the SampleUpdater interface. Detector.RemoveSpam and Detector.RemoveHam
+// revert them, unlearning a single sample without retraining on all the samples.
+//
+// All the checks performed by Detector implement the Checker interface. Custom checks can be registered with
+// Detector.WithChecker, using the order to place them before, after or between the built-in checks (see Order* constants).
+// Any check, built-in or custom, can be turned off by name with Detector.SetCheckEnabled. Checks making network calls
+// should implement RemoteChecker (see NewRemoteChecker), such checks run concurrently, and the results of all the checks
+// are reported in the order of the checks.
+//
+// Detector.CheckCtx is a context-aware version of Detector.Check. The context is passed to each check, including
+// remote CAS and OpenAI calls, and Config.CheckTimeouts limits the time of a check by name. A check reached
+// its timeout reports "timeout" instead of blocking the caller.
+//
+// The "openai" check asks a language model for a verdict. Detector.WithOpenAIChecker sets it with OpenAI API client,
+// and Detector.WithLLMChecker with any LLMProvider, e.g. OpenAIProvider or AnthropicProvider for Anthropic Messages API.
+// With Config.OpenAIGrayZone the check is called only for uncertain classifier or similarity results, and
+// Detector.LLMStats reports the number of calls made and saved. Responses are cached by message text for
+// OpenAIConfig.CacheTTL, and OpenAIConfig limits the requests per minute and the daily tokens or cost. A check skipped
+// by these limits doesn't change the verdict. Detector.WithLLMUsageStorage keeps the daily usage between restarts.
+// With OpenAIConfig.FewShotSamples and OpenAIConfig.PromptContext, the prompt includes the nearest spam and ham samples
+// as examples, the results of other checks and the user metadata, rendered by OpenAIConfig.PromptTemplate with
+// LLMPromptData and kept within OpenAIConfig.MaxTokensRequest.
+//
+// Detector.WithVisionChecker adds the "vision" check, asking a vision-capable model about the image of the message.
+// The image is loaded by ImageLoader with spamcheck.MetaData.ImageID, e.g. telegram file id. Vision calls share
+// the cache, the limits and the usage stats (Detector.LLMStats) with the openai check.
+//
+// Detection quality can be measured offline: Evaluate checks messages with known labels (LabeledMessage) and reports
+// precision, recall and F1 in a confusion matrix for the verdict and for each check, and CrossValidate runs k-fold
+// cross-validation on spam and ham samples with detectors made by the caller for each fold. Tune sweeps the main
+// thresholds over a TuneGrid and returns the pareto front of false-positive and false-negative rates.
 //
 // The user can also add (lib.AddApprovedUsers) and remove (lib.RemoveApprovedUsers) users to/from the list of approved user ids.
 package lib
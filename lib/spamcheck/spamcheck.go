@@ -1,6 +1,9 @@
 package spamcheck
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Request is a request to check a message for spam.
 type Request struct {
@@ -14,6 +17,9 @@ type Request struct {
 type MetaData struct {
 	Images int `json:"images"` // number of images in the message
 	Links  int `json:"links"`  // number of links in the message
+
+	ImageID       string `json:"image_id,omitempty"`        // id of the image in the message, e.g. telegram file id, for vision check
+	ImageUniqueID string `json:"image_unique_id,omitempty"` // unique id of the image, e.g. telegram file unique id, for vision cache
 }
 
 func (r *Request) String() string {
@@ -23,9 +29,54 @@ func (r *Request) String() string {
 
 // Response is a result of spam check.
 type Response struct {
-	Name    string `json:"name"`    // name of the check
-	Spam    bool   `json:"spam"`    // true if spam
-	Details string `json:"details"` // details of the check
+	Name    string  `json:"name"`            // name of the check
+	Spam    bool    `json:"spam"`            // true if spam
+	Details string  `json:"details"`         // details of the check
+	Score   float64 `json:"score,omitempty"` // spam score of the check, 0.0 - 1.0, used for weighted scoring
+
+	Tokens []TokenWeight `json:"tokens,omitempty"` // tokens contributed most to the verdict, reported by classifier
+	Sample *Sample       `json:"sample,omitempty"` // the nearest spam sample, reported by similarity check
+}
+
+// Sample is a spam sample the message matched, with the source of the sample.
+type Sample struct {
+	Text    string `json:"text"`              // text of the sample
+	Source  string `json:"source,omitempty"`  // name of the samples file, empty if unknown
+	Dynamic bool   `json:"dynamic,omitempty"` // true for dynamic samples, i.e. added on the fly and not from the static file
+}
+
+// samplePreviewLen is the max length of the sample preview, in runes
+const samplePreviewLen = 64
+
+// Preview returns the beginning of the sample text, shortened to samplePreviewLen runes
+func (s Sample) Preview() string {
+	runes := []rune(s.Text)
+	if len(runes) <= samplePreviewLen {
+		return s.Text
+	}
+	return string(runes[:samplePreviewLen]) + "..."
+}
+
+func (s Sample) String() string {
+	kind := "static"
+	if s.Dynamic {
+		kind = "dynamic"
+	}
+	if s.Source != "" {
+		kind += " " + s.Source
+	}
+	return fmt.Sprintf("%q (%s)", s.Preview(), kind)
+}
+
+// TokenWeight is a token contributing to the classifier verdict, with the log-likelihood ratio of spam to ham
+// for the token. Positive weight pushes the verdict toward spam, negative toward ham.
+type TokenWeight struct {
+	Token  string  `json:"token"`
+	Weight float64 `json:"weight"`
+}
+
+func (t TokenWeight) String() string {
+	return fmt.Sprintf("%s(%+.2f)", t.Token, t.Weight)
 }
 
 func (r *Response) String() string {
@@ -33,5 +84,16 @@ func (r *Response) String() string {
 	if r.Spam {
 		spamOrHam = "spam"
 	}
-	return fmt.Sprintf("%s: %s, %s", r.Name, spamOrHam, r.Details)
+	res := fmt.Sprintf("%s: %s, %s", r.Name, spamOrHam, r.Details)
+	if len(r.Tokens) > 0 {
+		tokens := make([]string, len(r.Tokens))
+		for i, t := range r.Tokens {
+			tokens[i] = t.String()
+		}
+		res += ", tokens: " + strings.Join(tokens, " ")
+	}
+	if r.Sample != nil {
+		res += ", nearest sample: " + r.Sample.String()
+	}
+	return res
 }
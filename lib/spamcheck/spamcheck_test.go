@@ -1,6 +1,7 @@
 package spamcheck
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,6 +31,48 @@ func TestResponse_String(t *testing.T) {
 			},
 			expected: "name2: ham, details",
 		},
+		{
+			name: "test with score, not shown",
+			input: &Response{
+				Name:    "name3",
+				Spam:    true,
+				Details: "details",
+				Score:   0.756,
+			},
+			expected: "name3: spam, details",
+		},
+		{
+			name: "test with tokens",
+			input: &Response{
+				Name:    "classifier",
+				Spam:    true,
+				Details: "probability of spam: 95.00%",
+				Score:   0.95,
+				Tokens:  []TokenWeight{{Token: "money", Weight: 2.345}, {Token: "hello", Weight: -0.5}},
+			},
+			expected: "classifier: spam, probability of spam: 95.00%, tokens: money(+2.35) hello(-0.50)",
+		},
+		{
+			name: "test with sample",
+			input: &Response{
+				Name:    "similarity",
+				Spam:    true,
+				Details: "0.80/0.50",
+				Score:   0.8,
+				Sample:  &Sample{Text: "earn money online", Source: "spam-dynamic.txt", Dynamic: true},
+			},
+			expected: `similarity: spam, 0.80/0.50, nearest sample: "earn money online" (dynamic spam-dynamic.txt)`,
+		},
+		{
+			name: "test with static sample, no source",
+			input: &Response{
+				Name:    "similarity",
+				Spam:    true,
+				Details: "0.80/0.50",
+				Sample:  &Sample{Text: "earn money online"},
+			},
+			expected: `similarity: spam, 0.80/0.50, nearest sample: "earn money online" (static)`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -48,17 +91,17 @@ func TestRequestString(t *testing.T) {
 	}{
 		{
 			name:     "Normal message",
-			request:  Request{"Hello, world!", "123", "Alice", MetaData{2, 1}},
+			request:  Request{"Hello, world!", "123", "Alice", MetaData{Images: 2, Links: 1}},
 			expected: `msg:"Hello, world!", user:"Alice", id:123, images:2, links:1`,
 		},
 		{
 			name:     "Spam message",
-			request:  Request{"Spam message", "456", "Bob", MetaData{0, 3}},
+			request:  Request{"Spam message", "456", "Bob", MetaData{Images: 0, Links: 3}},
 			expected: `msg:"Spam message", user:"Bob", id:456, images:0, links:3`,
 		},
 		{
 			name:     "Empty fields",
-			request:  Request{"", "", "", MetaData{0, 0}},
+			request:  Request{"", "", "", MetaData{Images: 0, Links: 0}},
 			expected: `msg:"", user:"", id:, images:0, links:0`,
 		},
 	}
@@ -69,3 +112,10 @@ func TestRequestString(t *testing.T) {
 		})
 	}
 }
+
+func TestSample_Preview(t *testing.T) {
+	assert.Equal(t, "short sample", Sample{Text: "short sample"}.Preview())
+	long := strings.Repeat("я", samplePreviewLen+1)
+	assert.Equal(t, strings.Repeat("я", samplePreviewLen)+"...", Sample{Text: long}.Preview())
+	assert.Equal(t, long[:len(long)-2], Sample{Text: long[:len(long)-2]}.Preview(), "exactly max length")
+}
@@ -0,0 +1,89 @@
+package tgspam
+
+// ahoCorasick is a multi-pattern matcher, finding all the patterns in a text in a single pass over the text,
+// regardless of the number of patterns. Patterns are matched as bytes, so the text and patterns should be
+// in the same form, i.e. canonical and lowercased. Immutable after creation, safe for concurrent use.
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+// acNode is a state of the automaton, i.e. a prefix of one or more patterns
+type acNode struct {
+	next map[byte]int // transitions by the next byte of a pattern
+	fail int          // state of the longest proper suffix of this prefix, being a prefix of some pattern
+	out  []int        // ids of patterns ending in this state, including ones reachable by fail links
+}
+
+// newAhoCorasick builds the automaton for the patterns, pattern id is its index in the slice.
+// Empty patterns are ignored, duplicated patterns are matched by the id of the first one.
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{next: map[byte]int{}}}}
+
+	// build the trie of patterns
+	for id, p := range patterns {
+		if p == "" {
+			continue
+		}
+		state := 0
+		for i := 0; i < len(p); i++ {
+			nxt, ok := ac.nodes[state].next[p[i]]
+			if !ok {
+				ac.nodes = append(ac.nodes, acNode{next: map[byte]int{}})
+				nxt = len(ac.nodes) - 1
+				ac.nodes[state].next[p[i]] = nxt
+			}
+			state = nxt
+		}
+		if len(ac.nodes[state].out) == 0 {
+			ac.nodes[state].out = []int{id}
+		}
+	}
+
+	// set fail links breadth-first, so the fail state of a node is always set before the node itself
+	queue := make([]int, 0, len(ac.nodes))
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child) // fail links of the root children point to the root
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for b, child := range ac.nodes[state].next {
+			queue = append(queue, child)
+			fail := ac.nodes[state].fail
+			for fail > 0 && !ac.has(fail, b) {
+				fail = ac.nodes[fail].fail
+			}
+			if nxt, ok := ac.nodes[fail].next[b]; ok && nxt != child {
+				ac.nodes[child].fail = nxt
+			}
+			ac.nodes[child].out = append(ac.nodes[child].out, ac.nodes[ac.nodes[child].fail].out...)
+		}
+	}
+	return ac
+}
+
+// has checks if the state has a transition by the byte
+func (ac *ahoCorasick) has(state int, b byte) bool {
+	_, ok := ac.nodes[state].next[b]
+	return ok
+}
+
+// match returns ids of all the patterns found in the text, each id once, in the order of the first occurrence
+func (ac *ahoCorasick) match(text string) []int {
+	var res []int
+	seen := map[int]bool{}
+	state := 0
+	for i := 0; i < len(text); i++ {
+		for state > 0 && !ac.has(state, text[i]) {
+			state = ac.nodes[state].fail
+		}
+		state = ac.nodes[state].next[text[i]] // zero (root) if there is no transition from the root
+		for _, id := range ac.nodes[state].out {
+			if !seen[id] {
+				seen[id] = true
+				res = append(res, id)
+			}
+		}
+	}
+	return res
+}
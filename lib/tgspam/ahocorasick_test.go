@@ -0,0 +1,90 @@
+package tgspam
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestAhoCorasick_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		text     string
+		expected []int
+	}{
+		{name: "no patterns", patterns: nil, text: "hello world", expected: nil},
+		{name: "empty text", patterns: []string{"he"}, text: "", expected: nil},
+		{name: "single match", patterns: []string{"world"}, text: "hello world", expected: []int{0}},
+		{name: "no match", patterns: []string{"worlds"}, text: "hello world", expected: nil},
+		{name: "classic", patterns: []string{"he", "she", "his", "hers"}, text: "ushers", expected: []int{1, 0, 3}},
+		{name: "overlapped", patterns: []string{"abcd", "bc", "c"}, text: "xabcx", expected: []int{1, 2}},
+		{name: "nested by fail links", patterns: []string{"a", "aa", "aaa"}, text: "aaa", expected: []int{0, 1, 2}},
+		{name: "repeated reported once", patterns: []string{"ab"}, text: "ab ab ab", expected: []int{0}},
+		{name: "duplicated pattern", patterns: []string{"ab", "ab"}, text: "xab", expected: []int{0}},
+		{name: "empty pattern ignored", patterns: []string{"", "b"}, text: "ab", expected: []int{1}},
+		{name: "cyrillic", patterns: []string{"в личку", "личк"}, text: "пишите в личку", expected: []int{1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ac := newAhoCorasick(tt.patterns)
+			assert.Equal(t, tt.expected, ac.match(tt.text))
+		})
+	}
+}
+
+func TestAhoCorasick_MatchSameAsContains(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42)) //nolint:gosec // deterministic test data
+	randomString := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abc "[rnd.Intn(4)] // small alphabet to get many overlaps
+		}
+		return string(b)
+	}
+
+	patterns := make([]string, 300)
+	for i := range patterns {
+		patterns[i] = randomString(1 + rnd.Intn(6))
+	}
+	ac := newAhoCorasick(patterns)
+
+	for i := 0; i < 200; i++ {
+		text := randomString(rnd.Intn(40))
+		expected := []int{}
+		seen := map[string]bool{}
+		for id, p := range patterns {
+			if !seen[p] && strings.Contains(text, p) {
+				expected = append(expected, id)
+			}
+			seen[p] = true
+		}
+		res := ac.match(text)
+		assert.ElementsMatch(t, expected, res, "text %q", text)
+	}
+}
+
+func TestDetector_CheckStopWordsAllMatches(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1})
+	lr, err := d.LoadStopWords(bytes.NewBufferString("в личку\nвсем привет\nзаработок\nword:usdt"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, lr.StopWords)
+
+	spam, cr := d.Check(spamcheck.Request{Msg: "Всем привет! Заработок в USDT, пишите в личку"})
+	assert.True(t, spam)
+	require.Len(t, cr, 1)
+	assert.Equal(t, spamcheck.Response{Name: "stopword", Spam: true, Score: 1,
+		Details: "всем привет, заработок, в личку, word:usdt"}, cr[0])
+
+	spam, cr = d.Check(spamcheck.Request{Msg: "hello there"})
+	assert.False(t, spam)
+	require.Len(t, cr, 1)
+	assert.Equal(t, "not found", cr[0].Details)
+}
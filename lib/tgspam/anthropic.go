@@ -0,0 +1,173 @@
+package tgspam
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultAnthropicBaseURL = "https://api.anthropic.com"
+	defaultAnthropicVersion = "2023-06-01"
+	anthropicVerdictTool    = "spam_verdict"
+)
+
+// AnthropicConfig contains parameters for AnthropicProvider
+type AnthropicConfig struct {
+	Token   string // api key, sent in x-api-key header if set
+	BaseURL string // base url of the api, without /v1/messages, https://api.anthropic.com if empty
+	Version string // anthropic-version header, 2023-06-01 if empty
+}
+
+// AnthropicProvider is LLMProvider for Anthropic Messages API and compatible servers
+type AnthropicProvider struct {
+	client HTTPClient
+	config AnthropicConfig
+}
+
+type anthropicRequest struct {
+	Model      string             `json:"model"`
+	MaxTokens  int                `json:"max_tokens"`
+	System     string             `json:"system,omitempty"`
+	Messages   []anthropicMessage `json:"messages"`
+	Tools      []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice *anthropicChoice   `json:"tool_choice,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"` // text, or a list of anthropicContent for the message with image
+}
+
+type anthropicContent struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewAnthropicProvider makes a provider with the http client and config
+func NewAnthropicProvider(client HTTPClient, config AnthropicConfig) *AnthropicProvider {
+	if config.BaseURL == "" {
+		config.BaseURL = defaultAnthropicBaseURL
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	if config.Version == "" {
+		config.Version = defaultAnthropicVersion
+	}
+	return &AnthropicProvider{client: client, config: config}
+}
+
+// Complete sends the system prompt and the message to messages API, and returns the text of the response.
+// The image, if any, is sent as a base64 image block before the message text.
+// With the schema in the request, the model is forced to call a tool with this input schema, and the tool input
+// is returned as the content.
+func (p *AnthropicProvider) Complete(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	areq := anthropicRequest{Model: req.Model, MaxTokens: req.MaxTokens, System: req.SystemPrompt,
+		Messages: []anthropicMessage{{Role: "user", Content: req.Message}}}
+	if req.Image != nil {
+		areq.Messages[0].Content = []anthropicContent{
+			{Type: "image", Source: &anthropicImageSource{Type: "base64", MediaType: req.Image.MimeType,
+				Data: base64.StdEncoding.EncodeToString(req.Image.Data)}},
+			{Type: "text", Text: req.Message},
+		}
+	}
+	if req.Schema != nil {
+		areq.Tools = []anthropicTool{{Name: anthropicVerdictTool, Description: "report the verdict for the message",
+			InputSchema: req.Schema}}
+		areq.ToolChoice = &anthropicChoice{Type: "tool", Name: anthropicVerdictTool}
+	}
+	body, err := json.Marshal(areq)
+	if err != nil {
+		return LLMResponse{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.BaseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return LLMResponse{}, fmt.Errorf("failed to make request: %w", err)
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set("anthropic-version", p.config.Version)
+	if p.config.Token != "" {
+		hreq.Header.Set("x-api-key", p.config.Token)
+	}
+
+	resp, err := p.client.Do(hreq)
+	if err != nil {
+		return LLMResponse{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return LLMResponse{}, fmt.Errorf("failed to read response: %w", err)
+	}
+	var aresp anthropicResponse
+	if err := json.Unmarshal(data, &aresp); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return LLMResponse{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return LLMResponse{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if aresp.Error != nil {
+			return LLMResponse{}, fmt.Errorf("unexpected status %d, %s: %s", resp.StatusCode, aresp.Error.Type, aresp.Error.Message)
+		}
+		return LLMResponse{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	res := LLMResponse{InputTokens: aresp.Usage.InputTokens, OutputTokens: aresp.Usage.OutputTokens}
+	texts := []string{}
+	for _, c := range aresp.Content {
+		switch c.Type {
+		case "tool_use":
+			res.Content = string(c.Input)
+			return res, nil
+		case "text":
+			texts = append(texts, c.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return LLMResponse{}, errors.New("no content in response")
+	}
+	res.Content = strings.Join(texts, "\n")
+	return res, nil
+}
@@ -0,0 +1,141 @@
+package tgspam
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestAnthropicProvider_Complete(t *testing.T) {
+	var (
+		lastReq  *http.Request
+		lastBody anthropicRequest
+		status   = http.StatusOK
+		respBody string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastReq = r
+		lastBody = anthropicRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&lastBody))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(respBody))
+	}))
+	defer ts.Close()
+
+	req := LLMRequest{Model: "claude-test", SystemPrompt: "system prompt", Message: "some text", MaxTokens: 100}
+
+	t.Run("text response", func(t *testing.T) {
+		status = http.StatusOK
+		respBody = `{"content":[{"type":"text","text":"{\"spam\": true, \"reason\":\"bad\", \"confidence\":90}"}],
+			"usage":{"input_tokens":25,"output_tokens":12}}`
+		p := NewAnthropicProvider(ts.Client(), AnthropicConfig{BaseURL: ts.URL + "/", Token: "secret"})
+		resp, err := p.Complete(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, LLMResponse{Content: `{"spam": true, "reason":"bad", "confidence":90}`, InputTokens: 25, OutputTokens: 12}, resp)
+
+		assert.Equal(t, http.MethodPost, lastReq.Method)
+		assert.Equal(t, "/v1/messages", lastReq.URL.Path)
+		assert.Equal(t, "secret", lastReq.Header.Get("x-api-key"))
+		assert.Equal(t, "2023-06-01", lastReq.Header.Get("anthropic-version"))
+		assert.Equal(t, "application/json", lastReq.Header.Get("Content-Type"))
+		assert.Equal(t, anthropicRequest{Model: "claude-test", MaxTokens: 100, System: "system prompt",
+			Messages: []anthropicMessage{{Role: "user", Content: "some text"}}}, lastBody)
+	})
+
+	t.Run("with image", func(t *testing.T) {
+		status = http.StatusOK
+		respBody = `{"content":[{"type":"text","text":"{\"spam\": true}"}]}`
+		p := NewAnthropicProvider(ts.Client(), AnthropicConfig{BaseURL: ts.URL})
+		ireq := req
+		ireq.Image = &LLMImage{Data: []byte("image data"), MimeType: "image/png"}
+		_, err := p.Complete(context.Background(), ireq)
+		require.NoError(t, err)
+		require.Len(t, lastBody.Messages, 1)
+		assert.Equal(t, []any{
+			map[string]any{"type": "image", "source": map[string]any{"type": "base64", "media_type": "image/png",
+				"data": "aW1hZ2UgZGF0YQ=="}},
+			map[string]any{"type": "text", "text": "some text"},
+		}, lastBody.Messages[0].Content)
+	})
+
+	t.Run("structured output with tool", func(t *testing.T) {
+		status = http.StatusOK
+		respBody = `{"content":[{"type":"text","text":"let me check"},
+			{"type":"tool_use","name":"spam_verdict","input":{"spam":false,"reason":"ok","confidence":80}}]}`
+		p := NewAnthropicProvider(ts.Client(), AnthropicConfig{BaseURL: ts.URL, Version: "2024-01-01"})
+		sreq := req
+		sreq.Schema = llmVerdictSchema()
+		resp, err := p.Complete(context.Background(), sreq)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"spam":false,"reason":"ok","confidence":80}`, resp.Content)
+
+		assert.Empty(t, lastReq.Header.Get("x-api-key"), "no token")
+		assert.Equal(t, "2024-01-01", lastReq.Header.Get("anthropic-version"))
+		require.Len(t, lastBody.Tools, 1)
+		assert.Equal(t, "spam_verdict", lastBody.Tools[0].Name)
+		assert.Equal(t, "object", lastBody.Tools[0].InputSchema["type"])
+		assert.Equal(t, &anthropicChoice{Type: "tool", Name: "spam_verdict"}, lastBody.ToolChoice)
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		status = http.StatusUnauthorized
+		respBody = `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`
+		p := NewAnthropicProvider(ts.Client(), AnthropicConfig{BaseURL: ts.URL})
+		_, err := p.Complete(context.Background(), req)
+		assert.EqualError(t, err, "unexpected status 401, authentication_error: invalid x-api-key")
+	})
+
+	t.Run("error without json", func(t *testing.T) {
+		status = http.StatusBadGateway
+		respBody = `bad gateway`
+		p := NewAnthropicProvider(ts.Client(), AnthropicConfig{BaseURL: ts.URL})
+		_, err := p.Complete(context.Background(), req)
+		assert.EqualError(t, err, "unexpected status 502")
+	})
+
+	t.Run("bad json", func(t *testing.T) {
+		status = http.StatusOK
+		respBody = `bad json`
+		p := NewAnthropicProvider(ts.Client(), AnthropicConfig{BaseURL: ts.URL})
+		_, err := p.Complete(context.Background(), req)
+		assert.ErrorContains(t, err, "failed to unmarshal response")
+	})
+
+	t.Run("no content", func(t *testing.T) {
+		status = http.StatusOK
+		respBody = `{"content":[]}`
+		p := NewAnthropicProvider(ts.Client(), AnthropicConfig{BaseURL: ts.URL})
+		_, err := p.Complete(context.Background(), req)
+		assert.EqualError(t, err, "no content in response")
+	})
+
+	t.Run("default base url", func(t *testing.T) {
+		p := NewAnthropicProvider(ts.Client(), AnthropicConfig{})
+		assert.Equal(t, "https://api.anthropic.com", p.config.BaseURL)
+		assert.Equal(t, "2023-06-01", p.config.Version)
+	})
+}
+
+func TestDetector_CheckWithAnthropicProvider(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"` +
+			"```json\\n{\\\"spam\\\": true, \\\"reason\\\":\\\"job scam\\\", \\\"confidence\\\":85}\\n```" + `"}]}`))
+	}))
+	defer ts.Close()
+
+	d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true})
+	d.WithLLMChecker(NewAnthropicProvider(ts.Client(), AnthropicConfig{BaseURL: ts.URL}), OpenAIConfig{Model: "claude-test"})
+	spam, cr := d.Check(spamcheck.Request{Msg: "easy job, good money", UserID: "1"})
+	assert.True(t, spam)
+	require.NotEmpty(t, cr)
+	assert.Equal(t, spamcheck.Response{Name: "openai", Spam: true, Score: 0.85, Details: "job scam, confidence: 85%"}, cr[len(cr)-1])
+}
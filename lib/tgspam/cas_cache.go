@@ -0,0 +1,100 @@
+package tgspam
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CasCacheStorage is an interface for CAS cache persistent storage.
+type CasCacheStorage interface {
+	Read() ([]CasCacheEntry, error) // read all non-expired entries from storage
+	Write(e CasCacheEntry) error    // write (add or replace) entry to storage
+}
+
+// CasCacheEntry is a cached result of CAS lookup for a user.
+type CasCacheEntry struct {
+	UserID  string    // user id
+	Spam    bool      // true if user reported by CAS as spammer
+	Details string    // details of CAS response
+	Expires time.Time // time when the entry expires
+}
+
+// casCache is a bounded in-memory LRU cache of CAS lookup results with TTL, thread-safe.
+// Spam (positive) and not-spam (negative) results have separate TTLs, the result is not cached if TTL is 0.
+type casCache struct {
+	posTTL  time.Duration
+	negTTL  time.Duration
+	maxSize int
+
+	lock  sync.Mutex
+	items map[string]*list.Element // user id to element of lru list
+	lru   *list.List               // most recently used at the front, elements are CasCacheEntry
+}
+
+// newCasCache makes a cache with the given TTLs and max size
+func newCasCache(posTTL, negTTL time.Duration, maxSize int) *casCache {
+	return &casCache{posTTL: posTTL, negTTL: negTTL, maxSize: maxSize, items: make(map[string]*list.Element), lru: list.New()}
+}
+
+// get returns cached entry for the user id, if found and not expired
+func (c *casCache) get(userID string) (CasCacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.items[userID]
+	if !ok {
+		return CasCacheEntry{}, false
+	}
+	entry := elem.Value.(CasCacheEntry)
+	if time.Now().After(entry.Expires) {
+		c.lru.Remove(elem)
+		delete(c.items, userID)
+		return CasCacheEntry{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// put adds lookup result to the cache, with expiration set by TTL for the result.
+// Returns the entry added and false if the result is not cacheable, i.e. TTL for the result is 0.
+func (c *casCache) put(userID string, spam bool, details string) (CasCacheEntry, bool) {
+	ttl := c.negTTL
+	if spam {
+		ttl = c.posTTL
+	}
+	if ttl <= 0 {
+		return CasCacheEntry{}, false
+	}
+	entry := CasCacheEntry{UserID: userID, Spam: spam, Details: details, Expires: time.Now().Add(ttl)}
+	c.add(entry)
+	return entry, true
+}
+
+// add adds entry to the cache, replacing existing one for the same user and evicting the least recently used entry
+// if the cache is full. Expired entries ignored.
+func (c *casCache) add(entry CasCacheEntry) {
+	if time.Now().After(entry.Expires) {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.items[entry.UserID]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[entry.UserID] = c.lru.PushFront(entry)
+	for c.maxSize > 0 && c.lru.Len() > c.maxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(CasCacheEntry).UserID)
+	}
+}
+
+// size returns the number of entries in the cache, including expired ones not evicted yet
+func (c *casCache) size() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lru.Len()
+}
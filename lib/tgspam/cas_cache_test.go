@@ -0,0 +1,69 @@
+package tgspam
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCasCache(t *testing.T) {
+	t.Run("separate ttl for spam and not spam", func(t *testing.T) {
+		c := newCasCache(time.Hour, 50*time.Millisecond, 0)
+		e, ok := c.put("1", true, "spam")
+		require.True(t, ok)
+		assert.Equal(t, "1", e.UserID)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), e.Expires, time.Second)
+		_, ok = c.put("2", false, "not found")
+		require.True(t, ok)
+
+		e, ok = c.get("1")
+		require.True(t, ok)
+		assert.Equal(t, CasCacheEntry{UserID: "1", Spam: true, Details: "spam", Expires: e.Expires}, e)
+		_, ok = c.get("2")
+		assert.True(t, ok)
+
+		time.Sleep(60 * time.Millisecond)
+		_, ok = c.get("1")
+		assert.True(t, ok)
+		_, ok = c.get("2")
+		assert.False(t, ok, "negative result expired")
+		assert.Equal(t, 1, c.size())
+	})
+
+	t.Run("zero ttl disables caching of the result", func(t *testing.T) {
+		c := newCasCache(time.Hour, 0, 0)
+		_, ok := c.put("1", false, "not found")
+		assert.False(t, ok)
+		_, ok = c.get("1")
+		assert.False(t, ok)
+	})
+
+	t.Run("bounded, least recently used evicted", func(t *testing.T) {
+		c := newCasCache(time.Hour, time.Hour, 2)
+		c.put("1", false, "d1")
+		c.put("2", false, "d2")
+		_, ok := c.get("1") // makes "1" recently used
+		require.True(t, ok)
+		c.put("3", false, "d3")
+		assert.Equal(t, 2, c.size())
+		_, ok = c.get("2")
+		assert.False(t, ok, "evicted")
+		_, ok = c.get("1")
+		assert.True(t, ok)
+		_, ok = c.get("3")
+		assert.True(t, ok)
+	})
+
+	t.Run("add replaces and skips expired", func(t *testing.T) {
+		c := newCasCache(time.Hour, time.Hour, 0)
+		c.add(CasCacheEntry{UserID: "1", Details: "old", Expires: time.Now().Add(time.Hour)})
+		c.add(CasCacheEntry{UserID: "1", Details: "new", Expires: time.Now().Add(time.Hour)})
+		c.add(CasCacheEntry{UserID: "2", Details: "expired", Expires: time.Now().Add(-time.Minute)})
+		assert.Equal(t, 1, c.size())
+		e, ok := c.get("1")
+		require.True(t, ok)
+		assert.Equal(t, "new", e.Details)
+	})
+}
@@ -0,0 +1,88 @@
+package tgspam
+
+import (
+	"context"
+	"sort"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// Checker is a single spam check performed by Detector.
+// All the built-in checks are implemented as Checker, and custom checks can be added with Detector.WithChecker.
+// The only exception is "openai" check: it depends on the results of all other checks, to decide if it is needed
+// and to build the prompt, so Detector performs it after the checkers. It can be disabled by name as any Checker.
+type Checker interface {
+	Name() string                                                        // name of the check, used for enable flags and timeouts
+	Check(ctx context.Context, req spamcheck.Request) spamcheck.Response // check the request and return the result
+}
+
+// RemoteChecker is a Checker making network calls, like CAS lookup. Detector runs remote checks concurrently,
+// with each other and with the local checks, and merges all the results in the order of the checks.
+type RemoteChecker interface {
+	Checker
+	Remote() bool // true if the check is remote and can run concurrently
+}
+
+// order of the built-in checks. Custom checks can be placed before, after or between them.
+const (
+	OrderStopWords   = 100
+	OrderEmoji       = 200
+	OrderObfuscation = 250
+	OrderMeta        = 300
+	OrderCAS         = 400
+	OrderVision      = 450 // before OrderMsgLen, as image messages often have short or no text
+	OrderMsgLen      = 500 // checks with a higher order are skipped for messages shorter than Config.MinMsgLen
+	OrderSimilarity  = 600
+	OrderClassifier  = 700
+)
+
+// NewChecker makes a Checker with the given name from a check function.
+// Remote checks should respect the context, it is canceled when the check timeout is reached.
+func NewChecker(name string, fn func(ctx context.Context, req spamcheck.Request) spamcheck.Response) Checker {
+	return &funcChecker{name: name, fn: fn}
+}
+
+// NewRemoteChecker makes a RemoteChecker with the given name from a check function.
+// The function is called concurrently with other checks and should respect the context.
+func NewRemoteChecker(name string, fn func(ctx context.Context, req spamcheck.Request) spamcheck.Response) RemoteChecker {
+	return &funcChecker{name: name, fn: fn, remote: true}
+}
+
+// funcChecker is an adapter to use a function as a Checker
+type funcChecker struct {
+	name   string
+	fn     func(ctx context.Context, req spamcheck.Request) spamcheck.Response
+	remote bool
+}
+
+// Name returns the name of the check
+func (c *funcChecker) Name() string { return c.name }
+
+// Remote returns true if the check is remote
+func (c *funcChecker) Remote() bool { return c.remote }
+
+// Check calls the check function
+func (c *funcChecker) Check(ctx context.Context, req spamcheck.Request) spamcheck.Response {
+	return c.fn(ctx, req)
+}
+
+// registeredChecker is a Checker registered with the Detector
+type registeredChecker struct {
+	Checker
+	order  int
+	ready  func(req spamcheck.Request) bool // optional, skips the check if required data not loaded, not configured or not in the request
+	remote bool                             // remote checks run concurrently
+}
+
+// checkers is a list of registered checkers, kept sorted by order
+type checkers []registeredChecker
+
+// add registers a checker and keeps the list sorted by order.
+// Checkers with the same order are kept in the order of registration.
+func (cs checkers) add(c Checker, order int, ready func(req spamcheck.Request) bool) checkers {
+	rc, ok := c.(RemoteChecker)
+	remote := ok && rc.Remote()
+	res := append(cs, registeredChecker{Checker: c, order: order, ready: ready, remote: remote})
+	sort.SliceStable(res, func(i, j int) bool { return res[i].order < res[j].order })
+	return res
+}
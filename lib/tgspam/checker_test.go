@@ -0,0 +1,54 @@
+package tgspam
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestNewChecker(t *testing.T) {
+	c := NewChecker("custom", func(_ context.Context, req spamcheck.Request) spamcheck.Response {
+		return spamcheck.Response{Name: "custom", Spam: req.Msg == "spam", Details: req.Msg}
+	})
+	assert.Equal(t, "custom", c.Name())
+	assert.Equal(t, spamcheck.Response{Name: "custom", Spam: true, Details: "spam"}, c.Check(context.Background(), spamcheck.Request{Msg: "spam"}))
+	assert.Equal(t, spamcheck.Response{Name: "custom", Spam: false, Details: "ham"}, c.Check(context.Background(), spamcheck.Request{Msg: "ham"}))
+}
+
+func TestNewRemoteChecker(t *testing.T) {
+	c := NewRemoteChecker("remote", func(_ context.Context, req spamcheck.Request) spamcheck.Response {
+		return spamcheck.Response{Name: "remote", Spam: req.Msg == "spam"}
+	})
+	assert.Equal(t, "remote", c.Name())
+	assert.True(t, c.Remote())
+	assert.Equal(t, spamcheck.Response{Name: "remote", Spam: true}, c.Check(context.Background(), spamcheck.Request{Msg: "spam"}))
+
+	var cs checkers
+	cs = cs.add(c, 100, nil)
+	cs = cs.add(NewChecker("local", nil), 200, nil)
+	assert.True(t, cs[0].remote)
+	assert.False(t, cs[1].remote)
+}
+
+func TestCheckers_add(t *testing.T) {
+	mk := func(name string) Checker {
+		return NewChecker(name, func(context.Context, spamcheck.Request) spamcheck.Response { return spamcheck.Response{Name: name} })
+	}
+	var cs checkers
+	cs = cs.add(mk("c3"), 300, nil)
+	cs = cs.add(mk("c1"), 100, nil)
+	cs = cs.add(mk("c2-1"), 200, nil)
+	cs = cs.add(mk("c2-2"), 200, nil)
+	cs = cs.add(mk("c0"), 0, nil)
+
+	require.Len(t, cs, 5)
+	names := []string{}
+	for _, c := range cs {
+		names = append(names, c.Name())
+	}
+	assert.Equal(t, []string{"c0", "c1", "c2-1", "c2-2", "c3"}, names)
+}
@@ -1,6 +1,9 @@
 package tgspam
 
-import "math"
+import (
+	"fmt"
+	"math"
+)
 
 // based on the code from https://github.com/RadhiFadlillah/go-bayesian/blob/master/classifier.go
 
@@ -59,6 +62,57 @@ func (c *classifier) learn(docs ...document) {
 		}
 	}
 
+	c.updatePriors()
+}
+
+// unlearn reverts the learning of the documents, so the classifier state is the same as if the documents were never learned.
+// Returns an error without changing the state if any of the documents was not learned.
+func (c *classifier) unlearn(docs ...document) error {
+	// check all the documents first, to avoid partial unlearning
+	nDocs := make(map[spamClass]int)
+	nTokens := make(map[string]map[spamClass]int)
+	for _, doc := range docs {
+		nDocs[doc.spamClass]++
+		if c.nDocumentByClass[doc.spamClass] < nDocs[doc.spamClass] {
+			return fmt.Errorf("no %s documents to unlearn", doc.spamClass)
+		}
+		for _, token := range c.removeDuplicate(doc.tokens...) {
+			if _, exist := nTokens[token]; !exist {
+				nTokens[token] = make(map[spamClass]int)
+			}
+			nTokens[token][doc.spamClass]++
+			if c.learningResults[token][doc.spamClass] < nTokens[token][doc.spamClass] {
+				return fmt.Errorf("token %q not learned as %s", token, doc.spamClass)
+			}
+		}
+	}
+
+	c.nAllDocument -= len(docs)
+	for _, doc := range docs {
+		if c.nDocumentByClass[doc.spamClass]--; c.nDocumentByClass[doc.spamClass] == 0 {
+			delete(c.nDocumentByClass, doc.spamClass)
+			delete(c.priorProbabilities, doc.spamClass)
+		}
+		for _, token := range c.removeDuplicate(doc.tokens...) {
+			if c.nFrequencyByClass[doc.spamClass]--; c.nFrequencyByClass[doc.spamClass] == 0 {
+				delete(c.nFrequencyByClass, doc.spamClass)
+			}
+			// remove tokens not used anymore, as the vocabulary size is used in classification
+			if c.learningResults[token][doc.spamClass]--; c.learningResults[token][doc.spamClass] == 0 {
+				delete(c.learningResults[token], doc.spamClass)
+			}
+			if len(c.learningResults[token]) == 0 {
+				delete(c.learningResults, token)
+			}
+		}
+	}
+
+	c.updatePriors()
+	return nil
+}
+
+// updatePriors calculates prior probabilities of the classes from the document counts
+func (c *classifier) updatePriors() {
 	for class, nDocument := range c.nDocumentByClass {
 		c.priorProbabilities[class] = math.Log(float64(nDocument) / float64(c.nAllDocument))
 	}
@@ -110,6 +164,24 @@ func (c *classifier) classify(tokens ...string) (spamClass, float64, bool) {
 	return bestClass, highestProb, certain
 }
 
+// tokenWeights returns the contribution of each token to the classification, i.e. the log-likelihood ratio of spam
+// to ham for the token, smoothed the same way as in classify. Positive weight pushes toward spam, negative toward ham.
+// Returns nil if the classifier hasn't learned both classes.
+func (c *classifier) tokenWeights(tokens ...string) map[string]float64 {
+	freqSpam, freqHam := c.nFrequencyByClass["spam"], c.nFrequencyByClass["ham"]
+	if freqSpam == 0 || freqHam == 0 {
+		return nil
+	}
+	nVocabulary := len(c.learningResults)
+	res := make(map[string]float64)
+	for _, token := range c.removeDuplicate(tokens...) {
+		pSpam := float64(c.learningResults[token]["spam"]+1) / float64(freqSpam+nVocabulary)
+		pHam := float64(c.learningResults[token]["ham"]+1) / float64(freqHam+nVocabulary)
+		res[token] = math.Log(pSpam / pHam)
+	}
+	return res
+}
+
 func (c *classifier) removeDuplicate(tokens ...string) []string {
 	mapTokens := make(map[string]struct{})
 	newTokens := []string{}
@@ -1,9 +1,11 @@
 package tgspam
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -74,3 +76,76 @@ func TestClassifier_Classify(t *testing.T) {
 		})
 	}
 }
+
+func TestClassifier_Unlearn(t *testing.T) {
+	docs := []document{
+		newDocument(good, "tall", "handsome", "rich"),
+		newDocument(bad, "bald", "poor", "ugly"),
+		newDocument(good, "tall", "happy", "tall"),
+		newDocument(bad, "poor", "sad"),
+	}
+
+	// unlearned state should be the same as the state learned without the removed documents
+	c := newClassifier()
+	c.learn(docs...)
+	assert.NoError(t, c.unlearn(docs[2], docs[3]))
+	exp := newClassifier()
+	exp.learn(docs[0], docs[1])
+	assert.Equal(t, exp, c)
+
+	cls, prob, certain := c.classify("tall", "rich", "poor")
+	expCls, expProb, expCertain := exp.classify("tall", "rich", "poor")
+	assert.Equal(t, expCls, cls)
+	assert.InDelta(t, expProb, prob, 0.0001)
+	assert.Equal(t, expCertain, certain)
+
+	t.Run("unlearn all", func(t *testing.T) {
+		c := newClassifier()
+		c.learn(docs...)
+		assert.NoError(t, c.unlearn(docs...))
+		assert.Equal(t, newClassifier(), c)
+	})
+
+	t.Run("not learned", func(t *testing.T) {
+		c := newClassifier()
+		c.learn(docs[0])
+		assert.EqualError(t, c.unlearn(docs[1]), "no bad documents to unlearn")
+		assert.EqualError(t, c.unlearn(newDocument(good, "tall", "unknown")), `token "unknown" not learned as good`)
+		assert.EqualError(t, c.unlearn(docs[0], docs[0]), "no good documents to unlearn")
+		exp := newClassifier()
+		exp.learn(docs[0])
+		assert.Equal(t, exp, c, "state not changed on error")
+	})
+}
+
+func TestClassifier_TokenWeights(t *testing.T) {
+	c := newClassifier()
+	c.learn(
+		newDocument("spam", "free", "money", "now"),
+		newDocument("spam", "free", "prize"),
+		newDocument("ham", "hello", "friend", "now"),
+	)
+
+	weights := c.tokenWeights("free", "hello", "now", "unknown", "free")
+	require.Len(t, weights, 4)
+	assert.Greater(t, weights["free"], 0.0, "spam token")
+	assert.Less(t, weights["hello"], 0.0, "ham token")
+	assert.Greater(t, weights["free"], weights["now"], "token in both classes is less spammy")
+	assert.InDelta(t, math.Log(float64(3+6)/float64(5+6)), weights["unknown"], 0.0001, "unknown token, only class sizes differ")
+
+	// sum of weights with priors is the log-odds of spam, i.e. matches the classification probability
+	tokens := []string{"free", "hello", "now"}
+	logOdds := c.priorProbabilities["spam"] - c.priorProbabilities["ham"]
+	for _, w := range c.tokenWeights(tokens...) {
+		logOdds += w
+	}
+	cls, prob, _ := c.classify(tokens...)
+	assert.Equal(t, spamClass("spam"), cls)
+	assert.InDelta(t, 100/(1+math.Exp(-logOdds)), prob, 0.0001)
+
+	t.Run("single class", func(t *testing.T) {
+		c := newClassifier()
+		c.learn(newDocument("spam", "free", "money"))
+		assert.Nil(t, c.tokenWeights("free"))
+	})
+}
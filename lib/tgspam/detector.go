@@ -3,16 +3,20 @@ package tgspam
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math"
 	"net/http"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/umputun/tg-spam/lib/approved"
@@ -22,6 +26,7 @@ import (
 //go:generate moq --out mocks/sample_updater.go --pkg mocks --skip-ensure --with-resets . SampleUpdater
 //go:generate moq --out mocks/http_client.go --pkg mocks --skip-ensure --with-resets . HTTPClient
 //go:generate moq --out mocks/user_storage.go --pkg mocks --skip-ensure --with-resets . UserStorage
+//go:generate moq --out mocks/cas_mirror.go --pkg mocks --skip-ensure --with-resets . CasMirror
 
 // Detector is a spam detector, thread-safe.
 // It uses a set of checks to determine if a message is spam, and also keeps a list of approved users.
@@ -29,10 +34,15 @@ type Detector struct {
 	Config
 	classifier     classifier
 	openaiChecker  *openAIChecker
-	metaChecks     []MetaCheck
-	tokenizedSpam  []map[string]int
+	visionChecker  *visionChecker
+	checkers       checkers
+	disabledChecks map[string]bool
+	spamIndex      *spamIndex // tokenized spam samples for similarity check
+	hamIndex       *spamIndex // tokenized ham samples, for examples in openai prompt, empty without few-shot examples
 	approvedUsers  map[string]approved.UserInfo
 	stopWords      []string
+	stopMatcher    *ahoCorasick // automaton of stop words, built on loading
+	stopPatterns   []stopPattern
 	excludedTokens []string
 
 	spamSamplesUpd SampleUpdater
@@ -40,6 +50,12 @@ type Detector struct {
 
 	userStorage UserStorage
 
+	casCache        *casCache // nil if CAS cache disabled
+	casCacheStorage CasCacheStorage
+	casMirror       CasMirror // local mirror of CAS banned users, optional
+
+	llmSkipped atomic.Int64 // number of openai check calls saved by gray zone
+
 	lock sync.RWMutex
 }
 
@@ -53,7 +69,42 @@ type Config struct {
 	FirstMessagesCount  int        // number of first messages to check for spam
 	HTTPClient          HTTPClient // http client to use for requests
 	MinSpamProbability  float64    // minimum spam probability to consider a message spam with classifier, if 0 - ignored
+	ClassifierTopTokens int        // number of tokens contributed most to the classifier verdict to report, if 0 - none
 	OpenAIVeto          bool       // if true, openai will be used to veto spam messages, otherwise it will be used to veto ham messages
+	OpenAIGrayZone      GrayZone   // if enabled, openai is called only for uncertain classifier or similarity results
+
+	// SimilarityTFIDF enables TF-IDF weighting of tokens for similarity check, with IDF calculated from all the loaded
+	// spam and ham samples. Common tokens get lower weight, so they don't dominate the similarity score.
+	SimilarityTFIDF bool
+
+	// Tokenization is a strategy to split messages and samples to tokens for similarity and classifier checks,
+	// one of Tokenize* constants. Words are used if empty. NgramSize is the size of character n-grams, 3 if not set.
+	Tokenization string
+	NgramSize    int
+
+	// ObfuscationThreshold is a ratio of obfuscated words, like "m o n e y" or "m0n3y", to consider a message spam,
+	// 0.0 - 1.0. If set, obfuscated words are reverted for other checks as well. The check is disabled if 0.
+	ObfuscationThreshold float64
+
+	// scoring mode, enabled if ScoreThreshold > 0. In this mode, the message is spam if the weighted sum of check scores
+	// is greater or equal to ScoreThreshold, instead of being spam if any check says so.
+	ScoreThreshold float64            // threshold for the total weighted score
+	CheckWeights   map[string]float64 // weights of the checks by name, 1.0 if not set
+
+	// CAS lookup cache, enabled if any of TTLs set. Positive (spam) and negative (not spam) results
+	// cached separately, the result is not cached if TTL for it is 0.
+	CasCacheTTL         time.Duration // TTL for spam results
+	CasCacheNegativeTTL time.Duration // TTL for not spam results
+	CasCacheSize        int           // max number of cached results, unlimited if 0
+
+	// SnapshotFile is a file to save the trained state to, and restore it from in LoadSamples if the samples
+	// are not changed. This allows skipping the training on startup and reloads. Disabled if empty.
+	SnapshotFile string
+
+	// CheckTimeouts sets timeouts of the remote checks by name, like "cas" and "openai", no timeout if not set.
+	// A check reached the timeout reports "timeout" response and doesn't block the detector. Timeouts of local
+	// checks are ignored, as they are fast and can't be abandoned while reading the trained state.
+	CheckTimeouts map[string]time.Duration
 }
 
 // SampleUpdater is an interface for updating spam/ham samples on the fly.
@@ -69,6 +120,11 @@ type UserStorage interface {
 	Delete(id string) error             // delete approved user from storage
 }
 
+// CasMirror is an interface for a local mirror of CAS banned users, e.g. imported from CAS export.
+type CasMirror interface {
+	IsBanned(ctx context.Context, userID string) (bool, error) // check if user is in the list of banned users
+}
+
 // HTTPClient is an interface for http client, satisfied by http.Client.
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -79,17 +135,26 @@ type LoadResult struct {
 	ExcludedTokens int // number of excluded tokens
 	SpamSamples    int // number of spam samples
 	HamSamples     int // number of ham samples
-	StopWords      int // number of stop words (phrases)
+	StopWords      int // number of stop words (phrases and patterns)
+
+	InvalidStopWords []string // invalid stop-word patterns with the errors, skipped on loading
 }
 
 // NewDetector makes a new Detector with the given config.
 func NewDetector(p Config) *Detector {
 	res := &Detector{
-		Config:        p,
-		classifier:    newClassifier(),
-		approvedUsers: make(map[string]approved.UserInfo),
-		tokenizedSpam: []map[string]int{},
+		Config:         p,
+		classifier:     newClassifier(),
+		approvedUsers:  make(map[string]approved.UserInfo),
+		spamIndex:      newSpamIndex(),
+		hamIndex:       newSpamIndex(),
+		stopMatcher:    newAhoCorasick(nil),
+		disabledChecks: make(map[string]bool),
 	}
+	if p.CasCacheTTL > 0 || p.CasCacheNegativeTTL > 0 {
+		res.casCache = newCasCache(p.CasCacheTTL, p.CasCacheNegativeTTL, p.CasCacheSize)
+	}
+	res.registerBuiltinCheckers()
 	// if FirstMessagesCount is set, FirstMessageOnly enforced to true.
 	// this is to avoid confusion when FirstMessagesCount is set but FirstMessageOnly is false.
 	// the reason for the redundant FirstMessageOnly flag is to avoid breaking api compatibility.
@@ -100,17 +165,17 @@ func NewDetector(p Config) *Detector {
 }
 
 // Check checks if a given message is spam. Returns true if spam and also returns a list of check results.
+// It is the same as CheckCtx with a background context.
 func (d *Detector) Check(req spamcheck.Request) (spam bool, cr []spamcheck.Response) {
+	return d.CheckCtx(context.Background(), req)
+}
 
-	isSpamDetected := func(cr []spamcheck.Response) bool {
-		for _, r := range cr {
-			if r.Spam {
-				return true
-			}
-		}
-		return false
-	}
-
+// CheckCtx checks if a given message is spam. Returns true if spam and also returns a list of check results.
+// All the registered checkers are performed, and the results are collected in the order of the checks.
+// Remote checks (like CAS) run concurrently, other checks are performed sequentially. OpenAI check, if enabled,
+// performed last, as it depends on the result of other checks.
+// The context is passed to each check, and remote checks are limited by their timeouts from Config.CheckTimeouts, if set.
+func (d *Detector) CheckCtx(ctx context.Context, req spamcheck.Request) (spam bool, cr []spamcheck.Response) {
 	d.lock.RLock()
 	defer d.lock.RUnlock()
 
@@ -119,59 +184,46 @@ func (d *Detector) Check(req spamcheck.Request) (spam bool, cr []spamcheck.Respo
 		return false, []spamcheck.Response{{Name: "pre-approved", Spam: false, Details: "user already approved"}}
 	}
 
-	// all the checks are performed sequentially, so we can collect all the results
+	active, tooShort := d.activeCheckers(req)
+	cr = d.runCheckers(ctx, active, req)
 
-	// check for stop words if any stop words are loaded
-	if len(d.stopWords) > 0 {
-		cr = append(cr, d.isStopWord(req.Msg))
-	}
-
-	// check for emojis if max allowed emojis is set
-	if d.MaxAllowedEmoji >= 0 {
-		cr = append(cr, d.isManyEmojis(req.Msg))
-	}
-
-	// check for spam with meta-checks
-	for _, mc := range d.metaChecks {
-		cr = append(cr, mc(req))
-	}
-
-	// check for spam with CAS API if CAS API URL is set
-	if d.CasAPI != "" {
-		cr = append(cr, d.isCasSpam(req.UserID))
-	}
-
-	// check for message length exceed the minimum size, if min message length is set.
-	// the check is done after first simple checks, because stop words and emojis can be triggered by short messages as well.
-	if len([]rune(req.Msg)) < d.MinMsgLen {
+	if tooShort {
 		cr = append(cr, spamcheck.Response{Name: "message length", Spam: false, Details: "too short"})
-		if isSpamDetected(cr) {
-			return true, cr // spam from the checks above
-		}
-		return false, cr
-	}
-
-	// check for spam similarity if a similarity threshold is set and spam samples are loaded
-	if d.SimilarityThreshold > 0 && len(d.tokenizedSpam) > 0 {
-		cr = append(cr, d.isSpamSimilarityHigh(req.Msg))
-	}
-
-	// check for spam with classifier if classifier is loaded
-	if d.classifier.nAllDocument > 0 {
-		cr = append(cr, d.isSpamClassified(req.Msg))
+		return d.verdict(cr) // spam from the checks above
 	}
 
-	spamDetected := isSpamDetected(cr)
+	spamDetected, cr := d.verdict(cr)
 
 	// we hit openai in two cases:
 	//  - all other checks passed (ham result) and OpenAIVeto is false. In this case, openai primary used to improve false negative rate
 	//  - one of the checks failed (spam result) and OpenAIVeto is true. In this case, openai primary used to improve false positive rate
+	// with the gray zone enabled, openai is called only for uncertain results of classifier or similarity, for ham and for
+	// spam with OpenAIVeto, and the confident results are kept without the call. It may turn spam to ham only with OpenAIVeto.
 	// FirstMessageOnly or FirstMessagesCount has to be set to use openai, because it's slow and expensive to run on all messages
-	if d.openaiChecker != nil && (d.FirstMessageOnly || d.FirstMessagesCount > 0) {
-		if !spamDetected && !d.OpenAIVeto || spamDetected && d.OpenAIVeto {
-			spam, details := d.openaiChecker.check(req.Msg)
-			cr = append(cr, details)
-			spamDetected = spam
+	if d.openaiChecker != nil && !d.disabledChecks["openai"] && (d.FirstMessageOnly || d.FirstMessagesCount > 0) {
+		switch {
+		case d.OpenAIGrayZone.Enabled:
+			uncertain, confidentSpam, values := d.OpenAIGrayZone.uncertain(cr)
+			if skip := d.grayZoneSkip(uncertain, confidentSpam, spamDetected); skip != "" {
+				if !spamDetected && !d.OpenAIVeto || spamDetected && d.OpenAIVeto {
+					d.llmSkipped.Add(1) // count only the calls made without the gray zone
+				}
+				cr = append(cr, spamcheck.Response{Name: "openai", Spam: false,
+					Details: fmt.Sprintf("skipped, %s gray zone %s: %s", skip, d.OpenAIGrayZone, values)})
+				break
+			}
+			resp, performed := d.checkOpenAI(ctx, req, cr)
+			resp.Details += fmt.Sprintf("; gray zone %s: %s", d.OpenAIGrayZone, values)
+			cr = append(cr, resp)
+			if performed {
+				spamDetected = resp.Spam // spam is checked only with veto, so openai may turn it to ham
+			}
+		case !spamDetected && !d.OpenAIVeto || spamDetected && d.OpenAIVeto:
+			resp, performed := d.checkOpenAI(ctx, req, cr)
+			cr = append(cr, resp)
+			if performed {
+				spamDetected = resp.Spam
+			}
 		}
 	}
 
@@ -190,21 +242,259 @@ func (d *Detector) Check(req spamcheck.Request) (spam bool, cr []spamcheck.Respo
 	return false, cr
 }
 
+// grayZoneSkip returns the reason to skip openai check in the gray zone mode, empty if the check should be performed.
+// Confident spam is kept regardless of veto, and spam in the gray zone is checked only with veto, as openai can't change it
+// otherwise.
+func (d *Detector) grayZoneSkip(uncertain, confidentSpam, spamDetected bool) string {
+	switch {
+	case confidentSpam:
+		return "confident spam result outside"
+	case !uncertain:
+		return "confident result outside"
+	case spamDetected && !d.OpenAIVeto:
+		return "spam without veto in"
+	}
+	return ""
+}
+
+// checkOpenAI performs openai check, or takes the cached response for the same message. Returns false if the check
+// is skipped by the rate limit or the daily budget, so its result should not change the verdict.
+func (d *Detector) checkOpenAI(ctx context.Context, req spamcheck.Request, cr []spamcheck.Response) (spamcheck.Response, bool) {
+	if resp, ok := d.openaiChecker.cached(req.Msg); ok {
+		return resp, true
+	}
+	if reason := d.openaiChecker.limits.reserve(); reason != "" {
+		return spamcheck.Response{Name: "openai", Spam: false, Details: "skipped, " + reason}, false
+	}
+	data := d.llmPromptData(req, cr)
+	return d.runCheck(ctx, "openai", func(ctx context.Context) spamcheck.Response {
+		_, details := d.openaiChecker.check(ctx, data)
+		return details
+	}), true
+}
+
+// llmPromptData returns the data for openai prompt: the message with the nearest spam and ham samples, if
+// OpenAIConfig.FewShotSamples set, and the results of other checks with the user metadata, if OpenAIConfig.PromptContext
+// set. Should be called under the lock.
+func (d *Detector) llmPromptData(req spamcheck.Request, cr []spamcheck.Response) LLMPromptData {
+	params := d.openaiChecker.params
+	data := LLMPromptData{Message: req.Msg}
+	if params.FewShotSamples > 0 {
+		tokenized := d.tokenize(req.Msg)
+		for _, id := range d.spamIndex.nearestK(tokenized, params.FewShotSamples, d.tokenWeight, d.similarity) {
+			data.SpamExamples = append(data.SpamExamples, d.spamIndex.refs[id].Text)
+		}
+		for _, id := range d.hamIndex.nearestK(tokenized, params.FewShotSamples, d.tokenWeight, d.similarity) {
+			data.HamExamples = append(data.HamExamples, d.hamIndex.refs[id].Text)
+		}
+	}
+	if params.PromptContext {
+		data.Context = true
+		data.Checks = append([]spamcheck.Response{}, cr...)
+		data.User = LLMPromptUser{FirstMessage: d.approvedUsers[req.UserID].Count == 0, HasUsername: req.UserName != "",
+			Images: req.Meta.Images, Links: req.Meta.Links}
+	}
+	return data
+}
+
+// fewShot returns true if openai check adds the nearest samples to the prompt, and ham samples index is needed
+func (d *Detector) fewShot() bool {
+	return d.openaiChecker != nil && d.openaiChecker.params.FewShotSamples > 0
+}
+
+// activeCheckers returns the enabled checks ready to perform for the request.
+// Checks with order above OrderMsgLen are skipped for messages shorter than MinMsgLen, and tooShort is set,
+// because stop words, emojis and others can be triggered by short messages as well.
+func (d *Detector) activeCheckers(req spamcheck.Request) (active []registeredChecker, tooShort bool) {
+	tooShort = len([]rune(req.Msg)) < d.MinMsgLen
+	active = make([]registeredChecker, 0, len(d.checkers))
+	for _, c := range d.checkers {
+		if tooShort && c.order > OrderMsgLen {
+			break
+		}
+		if d.disabledChecks[c.Name()] || (c.ready != nil && !c.ready(req)) {
+			continue
+		}
+		active = append(active, c)
+	}
+	return active, tooShort
+}
+
+// runCheckers performs the given checks and returns the results in the order of the checks.
+// Remote checks started concurrently first, and local checks performed sequentially while remote ones are in progress.
+func (d *Detector) runCheckers(ctx context.Context, active []registeredChecker, req spamcheck.Request) []spamcheck.Response {
+	results := make([]spamcheck.Response, len(active))
+	var wg sync.WaitGroup
+	for i, c := range active {
+		if !c.remote {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = d.runCheck(ctx, c.Name(), func(ctx context.Context) spamcheck.Response { return c.Check(ctx, req) })
+		}()
+	}
+	for i, c := range active {
+		if c.remote {
+			continue
+		}
+		// local checks are called directly, without the timeout, as an abandoned check would keep reading
+		// the trained state after the lock is released
+		results[i] = c.Check(ctx, req)
+	}
+	wg.Wait()
+
+	for i := range results {
+		results[i] = withDefaultScore(results[i])
+	}
+	return results
+}
+
+// withDefaultScore sets the full score for spam responses of checks without score reported
+func withDefaultScore(resp spamcheck.Response) spamcheck.Response {
+	if resp.Spam && resp.Score == 0 {
+		resp.Score = 1
+	}
+	return resp
+}
+
+// runCheck runs a remote check function with the timeout set for the check name in Config.CheckTimeouts.
+// Without the timeout the check is called directly. With the timeout, the check runs in a separate goroutine,
+// and the "timeout" response returned as soon as the context is done, even if the check ignores the context.
+// The abandoned check may finish after CheckCtx returned and released the lock, so it should not access
+// the trained state of the detector, only remote checks are allowed here.
+func (d *Detector) runCheck(ctx context.Context, name string, fn func(ctx context.Context) spamcheck.Response) spamcheck.Response {
+	timeout := d.CheckTimeouts[name]
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	respCh := make(chan spamcheck.Response, 1) // buffered to let the abandoned check finish without blocking
+	go func() { respCh <- fn(ctx) }()
+
+	select {
+	case resp := <-respCh:
+		return resp
+	case <-ctx.Done():
+		details := "timeout"
+		if errors.Is(ctx.Err(), context.Canceled) {
+			details = "canceled"
+		}
+		return spamcheck.Response{Name: name, Spam: false, Details: details}
+	}
+}
+
+// verdict decides if the message is spam based on the check results.
+// By default, any check with spam result makes the message spam. In scoring mode (ScoreThreshold > 0),
+// the weighted sum of the check scores is compared to the threshold, and the "score" response
+// with the total is added to the results.
+func (d *Detector) verdict(cr []spamcheck.Response) (spam bool, res []spamcheck.Response) {
+	if d.ScoreThreshold <= 0 {
+		for _, r := range cr {
+			if r.Spam {
+				return true, cr
+			}
+		}
+		return false, cr
+	}
+
+	total := 0.0
+	for _, r := range cr {
+		weight, ok := d.CheckWeights[r.Name]
+		if !ok {
+			weight = 1.0
+		}
+		total += r.Score * weight
+	}
+	spam = total >= d.ScoreThreshold
+	return spam, append(cr, spamcheck.Response{Name: "score", Spam: spam, Score: total,
+		Details: fmt.Sprintf("%0.2f/%0.2f", total, d.ScoreThreshold)})
+}
+
 // Reset resets spam samples/classifier, excluded tokens, stop words and approved users.
 func (d *Detector) Reset() {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
-	d.tokenizedSpam = []map[string]int{}
+	d.spamIndex, d.hamIndex = newSpamIndex(), newSpamIndex()
 	d.excludedTokens = []string{}
 	d.classifier.reset()
 	d.approvedUsers = make(map[string]approved.UserInfo)
 	d.stopWords = []string{}
+	d.stopMatcher = newAhoCorasick(nil)
+	d.stopPatterns = []stopPattern{}
 }
 
-// WithOpenAIChecker sets an openAIChecker for spam checking.
+// WithOpenAIChecker sets an openAIChecker for spam checking with OpenAI API client.
 func (d *Detector) WithOpenAIChecker(client openAIClient, config OpenAIConfig) {
-	d.openaiChecker = newOpenAIChecker(client, config)
+	var provider LLMProvider
+	if client != nil {
+		provider = NewOpenAIProvider(client)
+	}
+	d.WithLLMChecker(provider, config)
+}
+
+// WithLLMChecker sets an openAIChecker for spam checking with any language model provider.
+// With OpenAIConfig.FewShotSamples it should be set before loading samples, as ham samples are indexed only for it.
+func (d *Detector) WithLLMChecker(provider LLMProvider, config OpenAIConfig) {
+	d.openaiChecker = newOpenAIChecker(provider, config)
+}
+
+// WithVisionChecker registers the "vision" check of message images with a vision-capable language model.
+// Images are loaded by the loader with spamcheck.MetaData.ImageID, messages without image are not checked.
+// The check is remote, and it is performed for messages of any length, as image messages often have no text.
+// It shares the rate limit, the daily budget, the usage stats and the cache with openai check, so it should be set
+// after WithLLMChecker or WithOpenAIChecker. Without openai check, the vision calls are counted but not limited.
+func (d *Detector) WithVisionChecker(provider LLMProvider, loader ImageLoader, config VisionConfig) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	limits, cache := &llmLimits{}, (*llmCache)(nil)
+	if d.openaiChecker != nil {
+		limits, cache = d.openaiChecker.limits, d.openaiChecker.cache
+	}
+	d.visionChecker = newVisionChecker(provider, loader, config, limits, cache)
+	d.checkers = d.checkers.add(NewRemoteChecker("vision", d.visionChecker.check), OrderVision,
+		func(req spamcheck.Request) bool { return req.Meta.ImageID != "" })
+}
+
+// llmLimits returns the limits of language model calls, of openai check or vision check if only it is set,
+// nil if none of them is set
+func (d *Detector) llmLimits() *llmLimits {
+	switch {
+	case d.openaiChecker != nil:
+		return d.openaiChecker.limits
+	case d.visionChecker != nil:
+		return d.visionChecker.limits
+	}
+	return nil
+}
+
+// LLMStats returns the counters of openai and vision check calls, including the ones saved by the gray zone,
+// and the usage for the current day.
+func (d *Detector) LLMStats() LLMStats {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	res := LLMStats{}
+	if limits := d.llmLimits(); limits != nil {
+		res = limits.stats()
+	}
+	res.Skipped = d.llmSkipped.Load()
+	return res
+}
+
+// WithLLMUsageStorage sets a LLMUsageStorage for the daily usage of openai and vision checks and loads the usage for
+// the current day from it. Does nothing if none of them is set.
+func (d *Detector) WithLLMUsageStorage(storage LLMUsageStorage) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	limits := d.llmLimits()
+	if limits == nil {
+		return nil
+	}
+	return limits.setStorage(storage)
 }
 
 // WithUserStorage sets a UserStorage for approved users and loads approved users from it.
@@ -224,9 +514,99 @@ func (d *Detector) WithUserStorage(storage UserStorage) (count int, err error) {
 	return len(users), nil
 }
 
-// WithMetaChecks sets a list of meta-checkers.
+// WithCasCacheStorage sets a CasCacheStorage for CAS lookup cache and loads cached results from it.
+// Does nothing if CAS cache disabled.
+func (d *Detector) WithCasCacheStorage(storage CasCacheStorage) (count int, err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.casCache == nil {
+		return 0, nil
+	}
+	d.casCacheStorage = storage
+	entries, err := storage.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cas cache from storage: %w", err)
+	}
+	for _, e := range entries {
+		d.casCache.add(e)
+	}
+	return d.casCache.size(), nil
+}
+
+// WithCasMirror sets a local mirror of CAS banned users. CAS check looks for the user in the mirror first,
+// and falls back to CAS API (if Config.CasAPI set) if the user is not found in the mirror or the mirror failed.
+// With the mirror set, CAS check is active even if Config.CasAPI is empty.
+func (d *Detector) WithCasMirror(m CasMirror) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.casMirror = m
+}
+
+// WithMetaChecks sets a list of meta-checkers. Each meta-check is registered as a Checker named "meta" with OrderMeta,
+// see WithMetaCheck to register it under its own name.
 func (d *Detector) WithMetaChecks(mc ...MetaCheck) {
-	d.metaChecks = append(d.metaChecks, mc...)
+	for _, m := range mc {
+		d.WithMetaCheck("meta", m)
+	}
+}
+
+// WithMetaCheck registers a meta-check as a Checker with OrderMeta and the given name, used to disable the check,
+// set its weight and timeout. The name should be the same as the name in the check responses, like "links".
+func (d *Detector) WithMetaCheck(name string, m MetaCheck) {
+	d.WithChecker(NewChecker(name, func(_ context.Context, req spamcheck.Request) spamcheck.Response { return m(req) }), OrderMeta)
+}
+
+// WithChecker registers a custom Checker. The order defines the position of the check in the list of checks,
+// see Order* constants for the order of the built-in checks. Checkers with the same order performed in the order of registration.
+func (d *Detector) WithChecker(c Checker, order int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.checkers = d.checkers.add(c, order, nil)
+}
+
+// SetCheckEnabled enables or disables all the checks with the given name, both built-in and custom ones.
+// All checks are enabled by default.
+func (d *Detector) SetCheckEnabled(name string, enabled bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if enabled {
+		delete(d.disabledChecks, name)
+		return
+	}
+	d.disabledChecks[name] = true
+}
+
+// registerBuiltinCheckers registers all the built-in checks, each one active only if configured and has the data loaded
+func (d *Detector) registerBuiltinCheckers() {
+	// check for stop words if any stop words are loaded
+	d.checkers = d.checkers.add(NewChecker("stopword", func(_ context.Context, req spamcheck.Request) spamcheck.Response {
+		return d.isStopWord(req.Msg)
+	}), OrderStopWords, func(spamcheck.Request) bool { return len(d.stopWords) > 0 || len(d.stopPatterns) > 0 })
+
+	// check for emojis if max allowed emojis is set
+	d.checkers = d.checkers.add(NewChecker("emoji", func(_ context.Context, req spamcheck.Request) spamcheck.Response {
+		return d.isManyEmojis(req.Msg)
+	}), OrderEmoji, func(spamcheck.Request) bool { return d.MaxAllowedEmoji >= 0 })
+
+	// check for obfuscated words if obfuscation threshold is set
+	d.checkers = d.checkers.add(NewChecker("obfuscation", func(_ context.Context, req spamcheck.Request) spamcheck.Response {
+		return d.isObfuscated(req.Msg)
+	}), OrderObfuscation, func(spamcheck.Request) bool { return d.ObfuscationThreshold > 0 })
+
+	// check for spam with CAS API if CAS API URL is set or local CAS mirror is set, remote check
+	d.checkers = d.checkers.add(NewRemoteChecker("cas", func(ctx context.Context, req spamcheck.Request) spamcheck.Response {
+		return d.isCasSpam(ctx, req.UserID)
+	}), OrderCAS, func(spamcheck.Request) bool { return d.CasAPI != "" || d.casMirror != nil })
+
+	// check for spam similarity if a similarity threshold is set and spam samples are loaded
+	d.checkers = d.checkers.add(NewChecker("similarity", func(_ context.Context, req spamcheck.Request) spamcheck.Response {
+		return d.isSpamSimilarityHigh(req.Msg)
+	}), OrderSimilarity, func(spamcheck.Request) bool { return d.SimilarityThreshold > 0 && d.spamIndex.size() > 0 })
+
+	// check for spam with classifier if classifier is loaded
+	d.checkers = d.checkers.add(NewChecker("classifier", func(_ context.Context, req spamcheck.Request) spamcheck.Response {
+		return d.isSpamClassified(req.Msg)
+	}), OrderClassifier, func(spamcheck.Request) bool { return d.classifier.nAllDocument > 0 })
 }
 
 // WithSpamUpdater sets a SampleUpdater for spam samples.
@@ -299,38 +679,102 @@ func (d *Detector) RemoveApprovedUser(id string) error {
 
 // LoadSamples loads spam samples from a reader and updates the classifier.
 // Reset spam, ham samples/classifier, and excluded tokens.
+// If Config.SnapshotFile is set, the trained state restored from the snapshot if the inputs are not changed,
+// otherwise the snapshot is updated after the training.
 func (d *Detector) LoadSamples(exclReader io.Reader, spamReaders, hamReaders []io.Reader) (LoadResult, error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
-	d.tokenizedSpam = []map[string]int{}
+	// sources of spam samples should be taken from the original readers, before reading them to memory
+	spamSources := make([]spamcheck.Sample, len(spamReaders))
+	for i, r := range spamReaders {
+		spamSources[i] = d.sampleSource(r)
+	}
+
+	if d.SnapshotFile == "" {
+		return d.loadSamples(exclReader, spamReaders, hamReaders, spamSources), nil
+	}
+
+	// read all the inputs to calculate the hash, and use in-memory copies for the training
+	excl, err := readAll(exclReader)
+	if err != nil {
+		return LoadResult{}, fmt.Errorf("failed to read excluded tokens: %w", err)
+	}
+	spam, err := readAll(spamReaders...)
+	if err != nil {
+		return LoadResult{}, fmt.Errorf("failed to read spam samples: %w", err)
+	}
+	ham, err := readAll(hamReaders...)
+	if err != nil {
+		return LoadResult{}, fmt.Errorf("failed to read ham samples: %w", err)
+	}
+	training := d.tokenizationID()
+	if d.fewShot() {
+		training += "+ham-index" // ham samples are kept only for few-shot examples
+	}
+	hash := samplesHash(training, excl[0], spam, ham, spamSources)
+
+	lr, ok, err := d.restoreSnapshot(hash)
+	if err != nil {
+		log.Printf("[WARN] failed to restore snapshot from %s, retrain: %v", d.SnapshotFile, err)
+	}
+	if ok {
+		log.Printf("[DEBUG] trained state restored from snapshot %s", d.SnapshotFile)
+		return lr, nil
+	}
+
+	toReaders := func(data [][]byte) []io.Reader {
+		res := make([]io.Reader, len(data))
+		for i, b := range data {
+			res[i] = bytes.NewReader(b)
+		}
+		return res
+	}
+	lr = d.loadSamples(bytes.NewReader(excl[0]), toReaders(spam), toReaders(ham), spamSources)
+	if err := d.saveSnapshot(hash, lr); err != nil {
+		log.Printf("[WARN] failed to save snapshot to %s: %v", d.SnapshotFile, err)
+	}
+	return lr, nil
+}
+
+// loadSamples resets the trained state and trains it with the given samples. Spam sources are the sources
+// of samples from the spam readers, by the reader index. Should be called under the lock.
+func (d *Detector) loadSamples(exclReader io.Reader, spamReaders, hamReaders []io.Reader, spamSources []spamcheck.Sample) LoadResult {
+	d.spamIndex, d.hamIndex = newSpamIndex(), newSpamIndex()
 	d.excludedTokens = []string{}
 	d.classifier.reset()
 
 	// excluded tokens should be loaded before spam samples to exclude them from spam tokenization
 	for t := range d.tokenChan(exclReader) {
-		d.excludedTokens = append(d.excludedTokens, strings.ToLower(t))
+		d.excludedTokens = append(d.excludedTokens, strings.ToLower(d.canonical(t)))
 	}
 	lr := LoadResult{ExcludedTokens: len(d.excludedTokens)}
 
 	// load spam samples and update the classifier with them
 	docs := []document{}
-	for token := range d.tokenChan(spamReaders...) {
-		tokenizedSpam := d.tokenize(token)
-		d.tokenizedSpam = append(d.tokenizedSpam, tokenizedSpam) // add to list of samples
-		tokens := make([]string, 0, len(tokenizedSpam))
-		for token := range tokenizedSpam {
-			tokens = append(tokens, token)
+	for i, r := range spamReaders {
+		for token := range d.tokenChan(r) {
+			tokenizedSpam := d.tokenize(token)
+			ref := spamSources[i]
+			ref.Text = token
+			d.spamIndex.add(tokenizedSpam, ref) // add to index of samples
+			tokens := make([]string, 0, len(tokenizedSpam))
+			for token := range tokenizedSpam {
+				tokens = append(tokens, token)
+			}
+			docs = append(docs, newDocument("spam", tokens...))
+			lr.SpamSamples++
 		}
-		docs = append(docs, newDocument("spam", tokens...))
-		lr.SpamSamples++
 	}
 
 	// load ham samples and update the classifier with them
 	for token := range d.tokenChan(hamReaders...) {
-		tokenizedSpam := d.tokenize(token)
-		tokens := make([]string, 0, len(tokenizedSpam))
-		for token := range tokenizedSpam {
+		tokenizedHam := d.tokenize(token)
+		if d.fewShot() {
+			d.hamIndex.add(tokenizedHam, spamcheck.Sample{Text: token})
+		}
+		tokens := make([]string, 0, len(tokenizedHam))
+		for token := range tokenizedHam {
 			tokens = append(tokens, token)
 		}
 		docs = append(docs, document{spamClass: "ham", tokens: tokens})
@@ -338,19 +782,32 @@ func (d *Detector) LoadSamples(exclReader io.Reader, spamReaders, hamReaders []i
 	}
 
 	d.classifier.learn(docs...)
-	return lr, nil
+	return lr
 }
 
 // LoadStopWords loads stop words from a reader. Reset stop words list before loading.
+// Stop word can be a plain phrase, or a rule with prefix: "re:" for regular expression, "word:" for whole words
+// and "glob:" for glob pattern of words. Invalid rules are skipped and reported in LoadResult.InvalidStopWords.
 func (d *Detector) LoadStopWords(readers ...io.Reader) (LoadResult, error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
-	d.stopWords = []string{}
+	d.stopWords, d.stopPatterns = []string{}, []stopPattern{}
+	lr := LoadResult{}
 	for t := range d.tokenChan(readers...) {
-		d.stopWords = append(d.stopWords, strings.ToLower(t))
+		phrase, pattern, err := d.parseStopWord(t)
+		switch {
+		case err != nil:
+			lr.InvalidStopWords = append(lr.InvalidStopWords, err.Error())
+		case pattern != nil:
+			d.stopPatterns = append(d.stopPatterns, *pattern)
+		default:
+			d.stopWords = append(d.stopWords, phrase)
+		}
 	}
-	return LoadResult{StopWords: len(d.stopWords)}, nil
+	d.stopMatcher = newAhoCorasick(d.stopWords)
+	lr.StopWords = len(d.stopWords) + len(d.stopPatterns)
+	return lr, nil
 }
 
 // UpdateSpam appends a message to the spam samples file and updates the classifier
@@ -374,7 +831,7 @@ func (d *Detector) updateSample(msg string, upd SampleUpdater, sc spamClass) err
 		return fmt.Errorf("can't update %s samples: %w", sc, err)
 	}
 
-	// load samples and update the classifier with them
+	// load samples and update the classifier and spam samples with them, the same way as LoadSamples does
 	docs := []document{}
 	for token := range d.tokenChan(bytes.NewBufferString(msg)) {
 		tokenizedSample := d.tokenize(token)
@@ -383,11 +840,84 @@ func (d *Detector) updateSample(msg string, upd SampleUpdater, sc spamClass) err
 			tokens = append(tokens, token)
 		}
 		docs = append(docs, document{spamClass: sc, tokens: tokens})
+		ref := spamcheck.Sample{Text: token, Dynamic: true}
+		if sc != "spam" {
+			if d.fewShot() {
+				d.hamIndex.add(tokenizedSample, ref)
+			}
+			continue
+		}
+		if name := fileName(upd); name != "" {
+			ref.Source = filepath.Base(name)
+		}
+		d.spamIndex.add(tokenizedSample, ref)
 	}
 	d.classifier.learn(docs...)
 	return nil
 }
 
+// RemoveSpam removes a spam sample from the trained state, reverting UpdateSpam or loading of the sample.
+// It doesn't change samples storage, the caller is responsible to remove the sample from it.
+func (d *Detector) RemoveSpam(msg string) error { return d.removeSample(msg, "spam") }
+
+// RemoveHam removes a ham sample from the trained state, reverting UpdateHam or loading of the sample.
+// It doesn't change samples storage, the caller is responsible to remove the sample from it.
+func (d *Detector) RemoveHam(msg string) error { return d.removeSample(msg, "ham") }
+
+// removeSample unlearns the sample in the classifier and removes it from the spam samples used for similarity check,
+// or from the ham samples.
+// The cost is proportional to the size of the sample, not to the size of all samples.
+func (d *Detector) removeSample(msg string, sc spamClass) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	docs := []document{}
+	tokenized := []map[string]int{}
+	for token := range d.tokenChan(bytes.NewBufferString(msg)) {
+		tokenizedSample := d.tokenize(token)
+		tokens := make([]string, 0, len(tokenizedSample))
+		for token := range tokenizedSample {
+			tokens = append(tokens, token)
+		}
+		docs = append(docs, document{spamClass: sc, tokens: tokens})
+		tokenized = append(tokenized, tokenizedSample)
+	}
+
+	if err := d.classifier.unlearn(docs...); err != nil {
+		return fmt.Errorf("can't remove %s sample: %w", sc, err)
+	}
+
+	// remove a matching sample for each document
+	index := d.spamIndex
+	if sc != "spam" {
+		index = d.hamIndex
+	}
+	for _, ts := range tokenized {
+		index.remove(ts)
+	}
+	return nil
+}
+
+// sampleSource returns the source of spam samples loaded from the reader, without the text. The source is
+// the base name of the file for readers with a name, like *os.File. Samples are dynamic if the reader is
+// the same file as used by the spam samples updater.
+func (d *Detector) sampleSource(r io.Reader) spamcheck.Sample {
+	name := fileName(r)
+	if name == "" {
+		return spamcheck.Sample{}
+	}
+	return spamcheck.Sample{Source: filepath.Base(name), Dynamic: name == fileName(d.spamSamplesUpd)}
+}
+
+// fileName returns the file name of readers and updaters with a name, like *os.File, empty otherwise
+func fileName(v any) string {
+	named, ok := v.(interface{ Name() string })
+	if !ok || named.Name() == "" {
+		return ""
+	}
+	return filepath.Clean(named.Name())
+}
+
 // tokenChan parses readers and returns a channel of tokens.
 // A line per-token or comma-separated "tokens" supported
 func (d *Detector) tokenChan(readers ...io.Reader) <-chan string {
@@ -427,9 +957,9 @@ func (d *Detector) tokenChan(readers ...io.Reader) <-chan string {
 	return resCh
 }
 
-// tokenize takes a string and returns a map where the keys are unique words (tokens)
-// and the values are the frequencies of those words in the string.
-// exclude tokens representing common words.
+// tokenize takes a string and returns a map where the keys are unique tokens and the values are the frequencies
+// of those tokens in the string. Tokens are words, character n-grams or word bigrams, see Config.Tokenization.
+// The string is normalized and de-obfuscated first, and words representing common words are excluded.
 func (d *Detector) tokenize(inp string) map[string]int {
 	isExcludedToken := func(token string) bool {
 		for _, w := range d.excludedTokens {
@@ -440,9 +970,8 @@ func (d *Detector) tokenize(inp string) map[string]int {
 		return false
 	}
 
-	tokenFrequency := make(map[string]int)
-	tokens := strings.Fields(inp)
-	for _, token := range tokens {
+	words := []string{}
+	for _, token := range strings.Fields(d.canonical(inp)) {
 		if isExcludedToken(token) {
 			continue
 		}
@@ -452,27 +981,37 @@ func (d *Detector) tokenize(inp string) map[string]int {
 		if len([]rune(token)) < 3 {
 			continue
 		}
-		tokenFrequency[strings.ToLower(token)]++
+		words = append(words, token)
+	}
+
+	switch d.Tokenization {
+	case TokenizeCharNgrams:
+		return charNgrams(words, d.ngramSize())
+	case TokenizeWordBigrams:
+		return wordBigrams(words)
+	default:
+		return wordTokens(words)
 	}
-	return tokenFrequency
 }
 
-// isSpam checks if a given message is similar to any of the known bad messages
+// isSpamSimilarityHigh checks if a given message is similar to any of the known bad messages.
+// The score is the similarity to the nearest spam sample, found with the index of samples.
 func (d *Detector) isSpamSimilarityHigh(msg string) spamcheck.Response {
 	// check for spam similarity
 	tokenizedMessage := d.tokenize(msg)
-	maxSimilarity := 0.0
-	for _, spam := range d.tokenizedSpam {
-		similarity := d.cosineSimilarity(tokenizedMessage, spam)
-		if similarity > maxSimilarity {
-			maxSimilarity = similarity
-		}
-		if similarity >= d.SimilarityThreshold {
-			return spamcheck.Response{Spam: true, Name: "similarity",
-				Details: fmt.Sprintf("%0.2f/%0.2f", maxSimilarity, d.SimilarityThreshold)}
-		}
+	id, maxSimilarity := d.spamIndex.nearest(tokenizedMessage, d.tokenWeight, d.similarity)
+	return d.similarityResponse(id, maxSimilarity)
+}
+
+// similarityResponse makes the similarity check response for the nearest spam sample id and the similarity to it
+func (d *Detector) similarityResponse(id int, maxSimilarity float64) spamcheck.Response {
+	resp := spamcheck.Response{Spam: maxSimilarity >= d.SimilarityThreshold, Name: "similarity", Score: maxSimilarity,
+		Details: fmt.Sprintf("%0.2f/%0.2f", maxSimilarity, d.SimilarityThreshold)}
+	if resp.Spam && id >= 0 {
+		sample := d.spamIndex.refs[id]
+		resp.Sample = &sample // report the nearest sample for spam, to find the bad samples causing false positives
 	}
-	return spamcheck.Response{Spam: false, Name: "similarity", Details: fmt.Sprintf("%0.2f/%0.2f", maxSimilarity, d.SimilarityThreshold)}
+	return resp
 }
 
 // cosineSimilarity calculates the cosine similarity between two token frequency maps.
@@ -500,20 +1039,70 @@ func (d *Detector) cosineSimilarity(a, b map[string]int) float64 {
 	return float64(dotProduct) / (math.Sqrt(float64(normA)) * math.Sqrt(float64(normB)))
 }
 
-// isCasSpam checks if a given user ID is a spammer with CAS API.
-func (d *Detector) isCasSpam(msgID string) spamcheck.Response {
+// isCasSpam checks if a given user ID is a spammer with local CAS mirror, if set, and CAS API.
+// If CAS cache enabled, the cached result of CAS API is used, and the response details report cache hit or miss.
+func (d *Detector) isCasSpam(ctx context.Context, msgID string) spamcheck.Response {
 	if _, err := strconv.ParseInt(msgID, 10, 64); err != nil {
 		return spamcheck.Response{Spam: false, Name: "cas", Details: fmt.Sprintf("invalid user id %q", msgID)}
 	}
-	reqURL := fmt.Sprintf("%s/check?user_id=%s", d.CasAPI, msgID)
-	req, err := http.NewRequest("GET", reqURL, http.NoBody)
+
+	if d.casMirror != nil {
+		banned, err := d.casMirror.IsBanned(ctx, msgID)
+		switch {
+		case err != nil && d.CasAPI == "":
+			return d.casResponse(false, fmt.Sprintf("failed to check local mirror: %v", err))
+		case err != nil:
+			log.Printf("[WARN] failed to check %s in cas mirror, fallback to cas api: %v", msgID, err)
+		case banned:
+			return d.casResponse(true, "banned (local mirror)")
+		case d.CasAPI == "":
+			return d.casResponse(false, "not found (local mirror)")
+		}
+	}
+
+	if d.casCache == nil {
+		spam, details, _ := d.casRequest(ctx, msgID)
+		return d.casResponse(spam, details)
+	}
+
+	if entry, ok := d.casCache.get(msgID); ok {
+		return d.casResponse(entry.Spam, entry.Details+" (cache hit)")
+	}
+
+	spam, details, err := d.casRequest(ctx, msgID)
+	if err != nil {
+		return d.casResponse(spam, details) // errors are not cached
+	}
+	if entry, ok := d.casCache.put(msgID, spam, details); ok && d.casCacheStorage != nil {
+		if err := d.casCacheStorage.Write(entry); err != nil {
+			log.Printf("[WARN] failed to write cas cache entry for %s: %v", msgID, err)
+		}
+	}
+	return d.casResponse(spam, details+" (cache miss)")
+}
+
+// casResponse makes a response for CAS check
+func (d *Detector) casResponse(spam bool, details string) spamcheck.Response {
+	if spam {
+		return spamcheck.Response{Name: "cas", Spam: true, Score: 1, Details: details}
+	}
+	return spamcheck.Response{Name: "cas", Spam: false, Details: details}
+}
+
+// casRequest makes a request to CAS API for the given user ID and returns the result with details.
+// In case of error, the details describe the error, and the error returned as well.
+func (d *Detector) casRequest(ctx context.Context, userID string) (spam bool, details string, err error) {
+	reqURL := fmt.Sprintf("%s/check?user_id=%s", d.CasAPI, userID)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, http.NoBody)
 	if err != nil {
-		return spamcheck.Response{Spam: false, Name: "cas", Details: fmt.Sprintf("failed to make request %s: %v", reqURL, err)}
+		err = fmt.Errorf("failed to make request %s: %w", reqURL, err)
+		return false, err.Error(), err
 	}
 
 	resp, err := d.HTTPClient.Do(req)
 	if err != nil {
-		return spamcheck.Response{Spam: false, Name: "cas", Details: fmt.Sprintf("ffailed to send request %s: %v", reqURL, err)}
+		err = fmt.Errorf("failed to send request %s: %w", reqURL, err)
+		return false, err.Error(), err
 	}
 	defer resp.Body.Close()
 
@@ -523,7 +1112,8 @@ func (d *Detector) isCasSpam(msgID string) spamcheck.Response {
 	}{}
 
 	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-		return spamcheck.Response{Spam: false, Name: "cas", Details: fmt.Sprintf("failed to parse response from %s: %v", reqURL, err)}
+		err = fmt.Errorf("failed to parse response from %s: %w", reqURL, err)
+		return false, err.Error(), err
 	}
 	respData.Description = strings.ToLower(respData.Description)
 	respData.Description = strings.TrimSuffix(respData.Description, ".")
@@ -533,13 +1123,12 @@ func (d *Detector) isCasSpam(msgID string) spamcheck.Response {
 		if respData.Description == "" {
 			respData.Description = "spam detected"
 		}
-		return spamcheck.Response{Name: "cas", Spam: true, Details: respData.Description}
+		return true, respData.Description, nil
 	}
-	details := respData.Description
-	if details == "" {
-		details = "not found"
+	if respData.Description == "" {
+		respData.Description = "not found"
 	}
-	return spamcheck.Response{Name: "cas", Spam: false, Details: details}
+	return false, respData.Description, nil
 }
 
 // isSpamClassified classify tokens from a document
@@ -550,24 +1139,87 @@ func (d *Detector) isSpamClassified(msg string) spamcheck.Response {
 		tokens = append(tokens, token)
 	}
 	class, prob, certain := d.classifier.classify(tokens...)
+	resp := d.classifierResponse(class, prob, certain)
+	resp.Tokens = d.topTokens(tokens)
+	return resp
+}
+
+// classifierResponse makes the classifier check response for the class and its probability
+func (d *Detector) classifierResponse(class spamClass, prob float64, certain bool) spamcheck.Response {
 	isSpam := class == "spam" && certain && (d.MinSpamProbability == 0 || prob >= d.MinSpamProbability)
-	return spamcheck.Response{Name: "classifier", Spam: isSpam,
+	score := prob / 100 // spam probability as a score
+	if class != "spam" {
+		score = 1 - score
+	}
+	return spamcheck.Response{Name: "classifier", Spam: isSpam, Score: score,
 		Details: fmt.Sprintf("probability of %s: %.2f%%", class, prob)}
 }
 
-// isStopWord checks if a given message contains any of the stop words.
+// topTokens returns up to Config.ClassifierTopTokens tokens with the largest contribution to the classifier verdict,
+// toward spam or ham, ordered by the absolute contribution. Returns nil if disabled or nothing to report.
+func (d *Detector) topTokens(tokens []string) []spamcheck.TokenWeight {
+	if d.ClassifierTopTokens <= 0 {
+		return nil
+	}
+	weights := d.classifier.tokenWeights(tokens...)
+	if len(weights) == 0 {
+		return nil
+	}
+	res := make([]spamcheck.TokenWeight, 0, len(weights))
+	for token, w := range weights {
+		res = append(res, spamcheck.TokenWeight{Token: token, Weight: w})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if wi, wj := math.Abs(res[i].Weight), math.Abs(res[j].Weight); wi != wj {
+			return wi > wj
+		}
+		return res[i].Token < res[j].Token
+	})
+	if len(res) > d.ClassifierTopTokens {
+		res = res[:d.ClassifierTopTokens]
+	}
+	return res
+}
+
+// isStopWord checks if a given message contains any of the stop words or matches any of the stop-word patterns.
+// The message is normalized and de-obfuscated the same way as stop words. All stop words are matched in a single
+// pass by the automaton, the result reports all the matched stop words and patterns.
 func (d *Detector) isStopWord(msg string) spamcheck.Response {
-	cleanMsg := cleanEmoji(strings.ToLower(msg))
-	for _, word := range d.stopWords { // stop words are already lowercased
-		if strings.Contains(cleanMsg, strings.ToLower(word)) {
-			return spamcheck.Response{Name: "stopword", Spam: true, Details: word}
+	cleanMsg := cleanEmoji(strings.ToLower(d.canonical(msg)))
+	matched := []string{}
+	for _, id := range d.stopMatcher.match(cleanMsg) { // stop words are already in canonical form and lowercased
+		matched = append(matched, d.stopWords[id])
+	}
+	rawMsg := ""
+	for _, p := range d.stopPatterns {
+		if p.re.MatchString(cleanMsg) {
+			matched = append(matched, p.rule)
+			continue
+		}
+		if !p.raw {
+			continue
+		}
+		if rawMsg == "" {
+			rawMsg = cleanEmoji(strings.ToLower(msg))
 		}
+		if p.re.MatchString(rawMsg) {
+			matched = append(matched, p.rule)
+		}
+	}
+	if len(matched) == 0 {
+		return spamcheck.Response{Name: "stopword", Spam: false, Details: "not found"}
 	}
-	return spamcheck.Response{Name: "stopword", Spam: false, Details: "not found"}
+	return spamcheck.Response{Name: "stopword", Spam: true, Score: 1, Details: strings.Join(matched, ", ")}
 }
 
 // isManyEmojis checks if a given message contains more than MaxAllowedEmoji emojis.
 func (d *Detector) isManyEmojis(msg string) spamcheck.Response {
-	count := countEmoji(msg)
-	return spamcheck.Response{Name: "emoji", Spam: count > d.MaxAllowedEmoji, Details: fmt.Sprintf("%d/%d", count, d.MaxAllowedEmoji)}
+	return d.emojiResponse(countEmoji(msg))
+}
+
+// emojiResponse makes the emoji check response for the number of emojis in a message
+func (d *Detector) emojiResponse(count int) spamcheck.Response {
+	score := math.Min(float64(count)/float64(d.MaxAllowedEmoji+1), 1) // reaches 1.0 when the limit exceeded
+	return spamcheck.Response{Name: "emoji", Spam: count > d.MaxAllowedEmoji, Score: score,
+		Details: fmt.Sprintf("%d/%d", count, d.MaxAllowedEmoji)}
 }
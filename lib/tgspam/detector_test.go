@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
@@ -118,6 +121,11 @@ func TestDetector_CheckStopWords(t *testing.T) {
 			message:  "Hello, please send me a message В ЛИЧКУ",
 			expected: true,
 		},
+		{
+			name:     "Stop word with homoglyphs and invisible chars",
+			message:  "Hello, please send me a message в лич\u200bкy", // latin y
+			expected: true,
+		},
 	}
 
 	for _, test := range tests {
@@ -246,6 +254,133 @@ func TestSpam_CheckIsCasSpam(t *testing.T) {
 	}
 }
 
+func TestSpam_CheckIsCasSpamCached(t *testing.T) {
+	mockedHTTPClient := &mocks.HTTPClientMock{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			resp := `{"ok": false, "description": "not found"}`
+			if req.URL.Query().Get("user_id") == "666" {
+				resp = `{"ok": true, "description": "spammer"}`
+			}
+			if req.URL.Query().Get("user_id") == "500" {
+				return nil, fmt.Errorf("network error")
+			}
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(resp))}, nil
+		},
+	}
+	store := &fakeCasCacheStorage{entries: []CasCacheEntry{
+		{UserID: "777", Spam: true, Details: "stored", Expires: time.Now().Add(time.Hour)},
+		{UserID: "888", Spam: true, Details: "expired", Expires: time.Now().Add(-time.Hour)},
+	}}
+
+	d := NewDetector(Config{CasAPI: "http://localhost", HTTPClient: mockedHTTPClient, MaxAllowedEmoji: -1,
+		CasCacheTTL: time.Hour, CasCacheNegativeTTL: time.Minute, CasCacheSize: 100})
+	count, err := d.WithCasCacheStorage(store)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	check := func(userID string) spamcheck.Response {
+		_, cr := d.Check(spamcheck.Request{UserID: userID})
+		require.Len(t, cr, 1)
+		return cr[0]
+	}
+
+	assert.Equal(t, spamcheck.Response{Name: "cas", Spam: true, Score: 1, Details: "spammer (cache miss)"}, check("666"))
+	assert.Equal(t, spamcheck.Response{Name: "cas", Spam: true, Score: 1, Details: "spammer (cache hit)"}, check("666"))
+	assert.Equal(t, spamcheck.Response{Name: "cas", Spam: false, Details: "not found (cache miss)"}, check("123"))
+	assert.Equal(t, spamcheck.Response{Name: "cas", Spam: false, Details: "not found (cache hit)"}, check("123"))
+	assert.Equal(t, spamcheck.Response{Name: "cas", Spam: true, Score: 1, Details: "stored (cache hit)"}, check("777"))
+	assert.Equal(t, 2, len(mockedHTTPClient.DoCalls()))
+
+	// errors not cached
+	resp := check("500")
+	assert.Contains(t, resp.Details, "network error")
+	assert.NotContains(t, resp.Details, "cache")
+	check("500")
+	assert.Equal(t, 4, len(mockedHTTPClient.DoCalls()))
+
+	require.Len(t, store.written, 2)
+	assert.Equal(t, "666", store.written[0].UserID)
+	assert.True(t, store.written[0].Spam)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), store.written[0].Expires, time.Second)
+	assert.Equal(t, "123", store.written[1].UserID)
+	assert.False(t, store.written[1].Spam)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), store.written[1].Expires, time.Second)
+
+	t.Run("cache disabled", func(t *testing.T) {
+		d := NewDetector(Config{CasAPI: "http://localhost", HTTPClient: mockedHTTPClient, MaxAllowedEmoji: -1})
+		count, err := d.WithCasCacheStorage(store)
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+		_, cr := d.Check(spamcheck.Request{UserID: "777"})
+		assert.Equal(t, []spamcheck.Response{{Name: "cas", Spam: false, Details: "not found"}}, cr)
+	})
+}
+
+func TestSpam_CheckIsCasSpamWithMirror(t *testing.T) {
+	mirror := &mocks.CasMirrorMock{
+		IsBannedFunc: func(ctx context.Context, userID string) (bool, error) {
+			if userID == "500" {
+				return false, fmt.Errorf("db error")
+			}
+			return userID == "666", nil
+		},
+	}
+	mockedHTTPClient := &mocks.HTTPClientMock{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": true, "description": "remote"}`))}, nil
+		},
+	}
+
+	t.Run("mirror only", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, HTTPClient: mockedHTTPClient})
+		d.WithCasMirror(mirror)
+		tbl := []struct {
+			userID string
+			exp    spamcheck.Response
+		}{
+			{"666", spamcheck.Response{Name: "cas", Spam: true, Score: 1, Details: "banned (local mirror)"}},
+			{"123", spamcheck.Response{Name: "cas", Spam: false, Details: "not found (local mirror)"}},
+			{"500", spamcheck.Response{Name: "cas", Spam: false, Details: "failed to check local mirror: db error"}},
+		}
+		for _, tt := range tbl {
+			spam, cr := d.Check(spamcheck.Request{UserID: tt.userID})
+			assert.Equal(t, tt.exp.Spam, spam)
+			assert.Equal(t, []spamcheck.Response{tt.exp}, cr)
+		}
+		assert.Empty(t, mockedHTTPClient.DoCalls())
+	})
+
+	t.Run("mirror with remote fallback", func(t *testing.T) {
+		mockedHTTPClient.ResetDoCalls()
+		d := NewDetector(Config{MaxAllowedEmoji: -1, CasAPI: "http://localhost", HTTPClient: mockedHTTPClient})
+		d.WithCasMirror(mirror)
+		_, cr := d.Check(spamcheck.Request{UserID: "666"})
+		assert.Equal(t, []spamcheck.Response{{Name: "cas", Spam: true, Score: 1, Details: "banned (local mirror)"}}, cr)
+		assert.Empty(t, mockedHTTPClient.DoCalls())
+
+		_, cr = d.Check(spamcheck.Request{UserID: "123"})
+		assert.Equal(t, []spamcheck.Response{{Name: "cas", Spam: true, Score: 1, Details: "remote"}}, cr)
+		assert.Len(t, mockedHTTPClient.DoCalls(), 1)
+
+		_, cr = d.Check(spamcheck.Request{UserID: "500"})
+		assert.Equal(t, []spamcheck.Response{{Name: "cas", Spam: true, Score: 1, Details: "remote"}}, cr)
+		assert.Len(t, mockedHTTPClient.DoCalls(), 2)
+	})
+}
+
+// fakeCasCacheStorage is a simple in-memory CasCacheStorage, returns all stored entries and records written ones
+type fakeCasCacheStorage struct {
+	entries []CasCacheEntry
+	written []CasCacheEntry
+}
+
+func (f *fakeCasCacheStorage) Read() ([]CasCacheEntry, error) { return f.entries, nil }
+
+func (f *fakeCasCacheStorage) Write(e CasCacheEntry) error {
+	f.written = append(f.written, e)
+	return nil
+}
+
 func TestDetector_CheckSimilarity(t *testing.T) {
 	d := NewDetector(Config{MaxAllowedEmoji: -1})
 	spamSamples := strings.NewReader("win free iPhone\nlottery prize xyz")
@@ -253,10 +388,10 @@ func TestDetector_CheckSimilarity(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, LoadResult{ExcludedTokens: 1, SpamSamples: 2}, lr)
 	d.classifier.reset() // we don't need a classifier for this test
-	assert.Len(t, d.tokenizedSpam, 2)
-	t.Logf("%+v", d.tokenizedSpam)
-	assert.Equal(t, map[string]int{"win": 1, "free": 1, "iphone": 1}, d.tokenizedSpam[0])
-	assert.Equal(t, map[string]int{"lottery": 1, "prize": 1}, d.tokenizedSpam[1])
+	assert.Len(t, d.spamIndex.samples, 2)
+	t.Logf("%+v", d.spamIndex.samples)
+	assert.Equal(t, map[string]int{"win": 1, "free": 1, "iphone": 1}, d.spamIndex.samples[0])
+	assert.Equal(t, map[string]int{"lottery": 1, "prize": 1}, d.spamIndex.samples[1])
 
 	tests := []struct {
 		name      string
@@ -290,7 +425,7 @@ func TestDetector_CheckClassificator(t *testing.T) {
 	lr, err := d.LoadSamples(strings.NewReader("xyz"), []io.Reader{spamSamples}, []io.Reader{hamsSamples})
 	require.NoError(t, err)
 	assert.Equal(t, LoadResult{ExcludedTokens: 1, SpamSamples: 2, HamSamples: 3}, lr)
-	d.tokenizedSpam = nil // we don't need tokenizedSpam samples for this test
+	d.spamIndex = newSpamIndex() // we don't need spam samples for this test
 	assert.Equal(t, 5, d.classifier.nAllDocument)
 	exp := map[string]map[spamClass]int{"win": {"spam": 1}, "free": {"spam": 1}, "iphone": {"spam": 1}, "lottery": {"spam": 1},
 		"prize": {"spam": 1}, "hello": {"ham": 1}, "world": {"ham": 1}, "how": {"ham": 1}, "are": {"ham": 1}, "you": {"ham": 1},
@@ -330,6 +465,154 @@ func TestDetector_CheckClassificator(t *testing.T) {
 		assert.Equal(t, "probability of spam: 53.36%", cr[0].Details)
 
 	})
+
+	t.Run("with top tokens", func(t *testing.T) {
+		d.ClassifierTopTokens = 3
+		defer func() { d.ClassifierTopTokens = 0 }()
+		spam, cr := d.Check(spamcheck.Request{Msg: "Win a free iPhone, how are you?"})
+		assert.True(t, spam)
+		require.Len(t, cr, 1)
+		require.Len(t, cr[0].Tokens, 3)
+		for i, tw := range cr[0].Tokens {
+			assert.Contains(t, []string{"win", "free", "iphone", "how", "are", "you"}, tw.Token)
+			assert.NotZero(t, tw.Weight)
+			if i > 0 {
+				assert.GreaterOrEqual(t, math.Abs(cr[0].Tokens[i-1].Weight), math.Abs(tw.Weight), "ordered by contribution")
+			}
+		}
+		assert.Greater(t, cr[0].Tokens[0].Weight, 0.0, "spam tokens contribute more, as spam samples are shorter")
+
+		d.ClassifierTopTokens = 0
+		_, cr = d.Check(spamcheck.Request{Msg: "Win a free iPhone, how are you?"})
+		assert.Nil(t, cr[0].Tokens)
+	})
+}
+
+func TestDetector_CheckOpenAIGrayZone(t *testing.T) {
+	newDetector := func(zone GrayZone, withSamples bool) (*Detector, *mocks.OpenAIClientMock) {
+		mockOpenAIClient := &mocks.OpenAIClientMock{
+			CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+					Message: openai.ChatCompletionMessage{Content: `{"spam": false, "reason":"good text", "confidence":90}`},
+				}}}, nil
+			},
+		}
+		d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true, SimilarityThreshold: 0.5,
+			MinSpamProbability: 50, OpenAIVeto: true, OpenAIGrayZone: zone})
+		d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4"})
+		if withSamples {
+			spam := "win free iphone now\nlottery prize win today\nfree crypto prize here\nearn money fast online"
+			ham := "hello world and everyone\nhow are you doing today\nhave a good day friends\nsee you tomorrow at work"
+			_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(spam)}, []io.Reader{strings.NewReader(ham)})
+			require.NoError(t, err)
+		}
+		return d, mockOpenAIClient
+	}
+	zone := GrayZone{Enabled: true, MinProbability: 20, MaxProbability: 80, MinSimilarity: 0.3, MaxSimilarity: 0.7}
+
+	t.Run("confident results skip openai", func(t *testing.T) {
+		d, mockOpenAIClient := newDetector(zone, true)
+
+		spam, cr := d.Check(spamcheck.Request{Msg: "win free iphone now", UserID: "1"})
+		assert.True(t, spam, "spam kept without openai")
+		require.Len(t, cr, 3)
+		assert.Equal(t, spamcheck.Response{Name: "openai", Spam: false, Details: "skipped, confident spam result outside gray zone " +
+			"probability 20-80%, similarity 0.30-0.70: similarity 1.00, probability 97.52%"}, cr[2])
+
+		spam, cr = d.Check(spamcheck.Request{Msg: "have a good day friends", UserID: "2"})
+		assert.False(t, spam)
+		require.Len(t, cr, 3)
+		assert.Equal(t, "skipped, confident result outside gray zone probability 20-80%, similarity 0.30-0.70: "+
+			"similarity 0.00, probability 6.40%", cr[2].Details)
+
+		assert.Empty(t, mockOpenAIClient.CreateChatCompletionCalls())
+		stats := d.LLMStats()
+		assert.Equal(t, int64(0), stats.Calls)
+		assert.Equal(t, int64(1), stats.Skipped, "ham is not checked with veto, no call saved")
+	})
+
+	t.Run("uncertain probability calls openai", func(t *testing.T) {
+		d, mockOpenAIClient := newDetector(GrayZone{Enabled: true, MinProbability: 90, MaxProbability: 99,
+			MinSimilarity: 0.9, MaxSimilarity: 1}, true)
+		spam, cr := d.Check(spamcheck.Request{Msg: "win free iphone now", UserID: "1"})
+		assert.False(t, spam, "openai decides with veto")
+		require.Len(t, cr, 3)
+		assert.Equal(t, spamcheck.Response{Name: "openai", Spam: false, Details: "good text, confidence: 90%; " +
+			"gray zone probability 90-99%, similarity 0.90-1.00: similarity 1.00, probability 97.52%"}, cr[2])
+		assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 1)
+
+		_, cr = d.Check(spamcheck.Request{Msg: "have a good day friends", UserID: "2"})
+		assert.Contains(t, cr[2].Details, "skipped")
+		assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 1)
+		stats := d.LLMStats()
+		assert.Equal(t, int64(1), stats.Calls)
+		assert.Equal(t, int64(0), stats.Skipped)
+	})
+
+	t.Run("uncertain spam without veto skips openai", func(t *testing.T) {
+		d, mockOpenAIClient := newDetector(GrayZone{Enabled: true, MinProbability: 90, MaxProbability: 99,
+			MinSimilarity: 0.9, MaxSimilarity: 1}, true)
+		d.OpenAIVeto = false
+		spam, cr := d.Check(spamcheck.Request{Msg: "win free iphone now", UserID: "1"})
+		assert.True(t, spam, "openai can't turn spam to ham without veto")
+		require.Len(t, cr, 3)
+		assert.Equal(t, "skipped, spam without veto in gray zone probability 90-99%, similarity 0.90-1.00: "+
+			"similarity 1.00, probability 97.52%", cr[2].Details)
+		assert.Empty(t, mockOpenAIClient.CreateChatCompletionCalls())
+		assert.Equal(t, int64(0), d.LLMStats().Skipped, "not checked without veto, no call saved")
+	})
+
+	t.Run("spam of other check skips openai", func(t *testing.T) {
+		d, mockOpenAIClient := newDetector(GrayZone{Enabled: true, MinProbability: 90, MaxProbability: 99,
+			MinSimilarity: 0.9, MaxSimilarity: 1}, true)
+		_, err := d.LoadStopWords(strings.NewReader("iphone"))
+		require.NoError(t, err)
+		spam, cr := d.Check(spamcheck.Request{Msg: "win free iphone now", UserID: "1"})
+		assert.True(t, spam, "confident spam kept with veto")
+		require.Len(t, cr, 4)
+		assert.Equal(t, "skipped, confident spam result outside gray zone probability 90-99%, similarity 0.90-1.00: "+
+			"stopword spam, similarity 1.00, probability 97.52%", cr[3].Details)
+		assert.Empty(t, mockOpenAIClient.CreateChatCompletionCalls())
+		assert.Equal(t, int64(1), d.LLMStats().Skipped, "spam is checked with veto, call saved")
+	})
+
+	t.Run("uncertain similarity calls openai, regardless of veto", func(t *testing.T) {
+		d, mockOpenAIClient := newDetector(GrayZone{Enabled: true, MinSimilarity: 0, MaxSimilarity: 0.2}, true)
+		spam, cr := d.Check(spamcheck.Request{Msg: "have a good day friends", UserID: "1"})
+		assert.False(t, spam)
+		require.Len(t, cr, 3)
+		assert.Equal(t, "good text, confidence: 90%; gray zone similarity 0.00-0.20: similarity 0.00", cr[2].Details)
+		assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 1, "called for ham with veto")
+	})
+
+	t.Run("no results calls openai", func(t *testing.T) {
+		d, _ := newDetector(zone, false)
+		spam, cr := d.Check(spamcheck.Request{Msg: "some message", UserID: "1"})
+		assert.False(t, spam)
+		require.Len(t, cr, 1)
+		assert.Equal(t, "good text, confidence: 90%; gray zone probability 20-80%, similarity 0.30-0.70: "+
+			"no classifier or similarity results", cr[0].Details)
+		stats := d.LLMStats()
+		assert.Equal(t, int64(1), stats.Calls)
+		assert.Equal(t, int64(0), stats.Skipped)
+	})
+
+	t.Run("gray zone disabled", func(t *testing.T) {
+		d, _ := newDetector(GrayZone{MinProbability: 20, MaxProbability: 80}, true)
+		_, cr := d.Check(spamcheck.Request{Msg: "win free iphone now", UserID: "1"})
+		require.Len(t, cr, 3)
+		assert.Equal(t, "good text, confidence: 90%", cr[2].Details, "veto mode")
+		stats := d.LLMStats()
+		assert.Equal(t, int64(1), stats.Calls)
+		assert.Equal(t, int64(0), stats.Skipped)
+	})
+}
+
+func TestGrayZone_String(t *testing.T) {
+	assert.Equal(t, "probability 30-80%, similarity 0.30-0.60",
+		GrayZone{MinProbability: 30, MaxProbability: 80, MinSimilarity: 0.3, MaxSimilarity: 0.6}.String())
+	assert.Equal(t, "similarity 0.30-0.60", GrayZone{MinSimilarity: 0.3, MaxSimilarity: 0.6}.String())
+	assert.Equal(t, "none", GrayZone{Enabled: true}.String())
 }
 
 func TestDetector_CheckOpenAI(t *testing.T) {
@@ -580,6 +863,275 @@ func TestDetector_CheckWithMeta(t *testing.T) {
 		assert.Equal(t, false, cr[2].Spam)
 		assert.Equal(t, "empty message", cr[2].Details)
 	})
+
+	t.Run("disabled by name", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1})
+		d.WithMetaCheck("links", LinksCheck(1))
+		d.WithMetaCheck("images", ImagesCheck())
+		d.WithMetaCheck("link-only", LinkOnlyCheck())
+		d.SetCheckEnabled("links", false)
+		spam, cr := d.Check(spamcheck.Request{Msg: "Hello, how are you? https://google.com https://google.com"})
+		assert.Equal(t, false, spam)
+		require.Len(t, cr, 2)
+		assert.Equal(t, "images", cr[0].Name)
+		assert.Equal(t, "link-only", cr[1].Name)
+
+		d.SetCheckEnabled("meta", false)
+		_, cr = d.Check(spamcheck.Request{Msg: "Hello, how are you?"})
+		assert.Len(t, cr, 2, "not registered as meta")
+	})
+
+	t.Run("registered as meta, not called on registration", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1})
+		calls := 0
+		d.WithMetaChecks(func(req spamcheck.Request) spamcheck.Response {
+			calls++
+			return spamcheck.Response{Name: "custom", Details: req.Meta.ImageID[:1]} // panics without image id
+		})
+		assert.Zero(t, calls)
+		_, cr := d.Check(spamcheck.Request{Msg: "Hello, how are you?", Meta: spamcheck.MetaData{ImageID: "file"}})
+		assert.Equal(t, []spamcheck.Response{{Name: "custom", Details: "f"}}, cr)
+		d.SetCheckEnabled("meta", false)
+		_, cr = d.Check(spamcheck.Request{Msg: "Hello, how are you?"})
+		assert.Empty(t, cr)
+	})
+}
+
+func TestDetector_CheckWithCustomCheckers(t *testing.T) {
+	custom := func(name string, spam bool) Checker {
+		return NewChecker(name, func(_ context.Context, req spamcheck.Request) spamcheck.Response {
+			return spamcheck.Response{Name: name, Spam: spam, Details: "custom " + req.Msg}
+		})
+	}
+
+	t.Run("ordered with built-in checks", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: 1})
+		_, err := d.LoadStopWords(bytes.NewBufferString("в личку"))
+		require.NoError(t, err)
+		d.WithChecker(custom("last", false), OrderClassifier+1)
+		d.WithChecker(custom("first", false), 0)
+		d.WithChecker(custom("middle", false), OrderEmoji-1)
+
+		spam, cr := d.Check(spamcheck.Request{Msg: "hello"})
+		assert.False(t, spam)
+		require.Len(t, cr, 5)
+		assert.Equal(t, "first", cr[0].Name)
+		assert.Equal(t, "custom hello", cr[0].Details)
+		assert.Equal(t, "stopword", cr[1].Name)
+		assert.Equal(t, "middle", cr[2].Name)
+		assert.Equal(t, "emoji", cr[3].Name)
+		assert.Equal(t, "last", cr[4].Name)
+	})
+
+	t.Run("custom spam check", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1})
+		d.WithChecker(custom("custom", true), OrderMeta)
+		spam, cr := d.Check(spamcheck.Request{Msg: "hello"})
+		assert.True(t, spam)
+		require.Len(t, cr, 1)
+		assert.Equal(t, spamcheck.Response{Name: "custom", Spam: true, Details: "custom hello", Score: 1}, cr[0])
+	})
+
+	t.Run("skipped after length gate for short message", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 10})
+		d.WithChecker(custom("before", false), OrderMsgLen-1)
+		d.WithChecker(custom("after", true), OrderMsgLen+1)
+
+		spam, cr := d.Check(spamcheck.Request{Msg: "short"})
+		assert.False(t, spam)
+		require.Len(t, cr, 2)
+		assert.Equal(t, "before", cr[0].Name)
+		assert.Equal(t, "message length", cr[1].Name)
+
+		spam, cr = d.Check(spamcheck.Request{Msg: "long enough message"})
+		assert.True(t, spam)
+		require.Len(t, cr, 2)
+		assert.Equal(t, "before", cr[0].Name)
+		assert.Equal(t, "after", cr[1].Name)
+	})
+
+	t.Run("enable and disable checks", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: 1})
+		d.WithChecker(custom("custom", true), OrderMeta)
+		d.SetCheckEnabled("custom", false)
+		d.SetCheckEnabled("emoji", false)
+		spam, cr := d.Check(spamcheck.Request{Msg: "hello 😁🐶🍕"})
+		assert.False(t, spam)
+		assert.Empty(t, cr)
+
+		d.SetCheckEnabled("emoji", true)
+		spam, cr = d.Check(spamcheck.Request{Msg: "hello 😁🐶🍕"})
+		assert.True(t, spam)
+		require.Len(t, cr, 1)
+		assert.Equal(t, "emoji", cr[0].Name)
+	})
+}
+
+func TestDetector_CheckWithScoring(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: 1, ScoreThreshold: 1.5, CheckWeights: map[string]float64{"emoji": 0.5}})
+	_, err := d.LoadStopWords(bytes.NewBufferString("в личку"))
+	require.NoError(t, err)
+
+	t.Run("emoji alone is not enough", func(t *testing.T) {
+		spam, cr := d.Check(spamcheck.Request{Msg: "hello 😁🐶🍕"})
+		assert.False(t, spam)
+		require.Len(t, cr, 3)
+		assert.Equal(t, spamcheck.Response{Name: "stopword", Spam: false, Details: "not found"}, cr[0])
+		assert.Equal(t, spamcheck.Response{Name: "emoji", Spam: true, Details: "3/1", Score: 1}, cr[1])
+		assert.Equal(t, spamcheck.Response{Name: "score", Spam: false, Details: "0.50/1.50", Score: 0.5}, cr[2])
+	})
+
+	t.Run("emoji and stop word", func(t *testing.T) {
+		spam, cr := d.Check(spamcheck.Request{Msg: "hello 😁🐶🍕 в личку"})
+		assert.True(t, spam)
+		require.Len(t, cr, 3)
+		assert.Equal(t, "stopword", cr[0].Name)
+		assert.Equal(t, 1.0, cr[0].Score)
+		assert.Equal(t, spamcheck.Response{Name: "score", Spam: true, Details: "1.50/1.50", Score: 1.5}, cr[2])
+	})
+
+	t.Run("partial emoji score", func(t *testing.T) {
+		spam, cr := d.Check(spamcheck.Request{Msg: "hello 😁"})
+		assert.False(t, spam)
+		require.Len(t, cr, 3)
+		assert.Equal(t, spamcheck.Response{Name: "emoji", Spam: false, Details: "1/1", Score: 0.5}, cr[1])
+		assert.Equal(t, spamcheck.Response{Name: "score", Spam: false, Details: "0.25/1.50", Score: 0.25}, cr[2])
+	})
+
+	t.Run("short message", func(t *testing.T) {
+		ds := NewDetector(Config{MaxAllowedEmoji: 1, MinMsgLen: 100, ScoreThreshold: 1})
+		spam, cr := ds.Check(spamcheck.Request{Msg: "hello 😁🐶🍕"})
+		assert.True(t, spam)
+		require.Len(t, cr, 3)
+		assert.Equal(t, "emoji", cr[0].Name)
+		assert.Equal(t, "message length", cr[1].Name)
+		assert.Equal(t, spamcheck.Response{Name: "score", Spam: true, Details: "1.00/1.00", Score: 1}, cr[2])
+	})
+}
+
+func TestDetector_CheckCtx(t *testing.T) {
+	slowCasClient := &mocks.HTTPClientMock{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done() // blocks until the request canceled
+			return nil, req.Context().Err()
+		},
+	}
+
+	t.Run("cas timeout", func(t *testing.T) {
+		d := NewDetector(Config{CasAPI: "http://localhost", HTTPClient: slowCasClient, MaxAllowedEmoji: -1,
+			CheckTimeouts: map[string]time.Duration{"cas": 10 * time.Millisecond}})
+		st := time.Now()
+		spam, cr := d.CheckCtx(context.Background(), spamcheck.Request{UserID: "123"})
+		assert.Less(t, time.Since(st), time.Second)
+		assert.False(t, spam)
+		assert.Equal(t, []spamcheck.Response{{Name: "cas", Spam: false, Details: "timeout"}}, cr)
+	})
+
+	t.Run("cas canceled by caller", func(t *testing.T) {
+		d := NewDetector(Config{CasAPI: "http://localhost", HTTPClient: slowCasClient, MaxAllowedEmoji: -1,
+			CheckTimeouts: map[string]time.Duration{"cas": time.Minute}})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		spam, cr := d.CheckCtx(ctx, spamcheck.Request{UserID: "123"})
+		assert.False(t, spam)
+		assert.Equal(t, []spamcheck.Response{{Name: "cas", Spam: false, Details: "timeout"}}, cr)
+	})
+
+	t.Run("check ignoring context", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, CheckTimeouts: map[string]time.Duration{"slow": 10 * time.Millisecond}})
+		done := make(chan struct{})
+		defer close(done)
+		d.WithChecker(NewRemoteChecker("slow", func(context.Context, spamcheck.Request) spamcheck.Response {
+			<-done
+			return spamcheck.Response{Name: "slow", Spam: true}
+		}), OrderMeta)
+		d.WithChecker(NewChecker("fast", func(context.Context, spamcheck.Request) spamcheck.Response {
+			return spamcheck.Response{Name: "fast", Spam: false, Details: "ok"}
+		}), OrderMeta)
+		spam, cr := d.CheckCtx(context.Background(), spamcheck.Request{Msg: "hello"})
+		assert.False(t, spam)
+		assert.Equal(t, []spamcheck.Response{{Name: "slow", Spam: false, Details: "timeout"},
+			{Name: "fast", Spam: false, Details: "ok"}}, cr)
+	})
+
+	t.Run("local check not limited", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, CheckTimeouts: map[string]time.Duration{"local": time.Millisecond}})
+		d.WithChecker(NewChecker("local", func(context.Context, spamcheck.Request) spamcheck.Response {
+			time.Sleep(20 * time.Millisecond)
+			return spamcheck.Response{Name: "local", Spam: false, Details: "done"}
+		}), OrderMeta)
+		_, cr := d.CheckCtx(context.Background(), spamcheck.Request{Msg: "hello"})
+		assert.Equal(t, []spamcheck.Response{{Name: "local", Spam: false, Details: "done"}}, cr)
+	})
+
+	t.Run("openai timeout", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true,
+			CheckTimeouts: map[string]time.Duration{"openai": 10 * time.Millisecond}})
+		mockOpenAIClient := &mocks.OpenAIClientMock{
+			CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				<-ctx.Done()
+				return openai.ChatCompletionResponse{}, ctx.Err()
+			},
+		}
+		d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4"})
+		spam, cr := d.CheckCtx(context.Background(), spamcheck.Request{Msg: "some message 1234"})
+		assert.False(t, spam)
+		assert.Equal(t, []spamcheck.Response{{Name: "openai", Spam: false, Details: "timeout"}}, cr)
+	})
+
+	t.Run("no timeout set, context passed to check", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1})
+		type ctxKey struct{}
+		d.WithChecker(NewChecker("custom", func(ctx context.Context, _ spamcheck.Request) spamcheck.Response {
+			return spamcheck.Response{Name: "custom", Details: ctx.Value(ctxKey{}).(string)}
+		}), OrderMeta)
+		_, cr := d.CheckCtx(context.WithValue(context.Background(), ctxKey{}, "from ctx"), spamcheck.Request{Msg: "hello"})
+		assert.Equal(t, []spamcheck.Response{{Name: "custom", Details: "from ctx"}}, cr)
+	})
+}
+
+func TestDetector_CheckWithRemoteCheckers(t *testing.T) {
+	// each remote check waits for all of them to be started, so it can pass only if they run concurrently
+	var started sync.WaitGroup
+	started.Add(3)
+	remote := func(name string, spam bool) Checker {
+		return NewRemoteChecker(name, func(ctx context.Context, _ spamcheck.Request) spamcheck.Response {
+			started.Done()
+			allStarted := make(chan struct{})
+			go func() { started.Wait(); close(allStarted) }()
+			select {
+			case <-allStarted:
+				return spamcheck.Response{Name: name, Spam: spam, Details: "concurrent"}
+			case <-ctx.Done():
+				return spamcheck.Response{Name: name, Spam: false, Details: "not concurrent"}
+			}
+		})
+	}
+
+	d := NewDetector(Config{MaxAllowedEmoji: 1, CasAPI: "http://localhost", CheckTimeouts: map[string]time.Duration{"cas": time.Second},
+		HTTPClient: &mocks.HTTPClientMock{DoFunc: func(req *http.Request) (*http.Response, error) {
+			started.Done()
+			started.Wait()
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": false}`))}, nil
+		}},
+	})
+	d.WithChecker(remote("remote1", true), OrderClassifier+1)
+	d.WithChecker(NewChecker("local", func(context.Context, spamcheck.Request) spamcheck.Response {
+		return spamcheck.Response{Name: "local", Details: "done"}
+	}), OrderMeta)
+	d.WithChecker(remote("remote2", false), 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	spam, cr := d.CheckCtx(ctx, spamcheck.Request{Msg: "hello 😁", UserID: "123"})
+	assert.True(t, spam)
+	assert.Equal(t, []spamcheck.Response{
+		{Name: "remote2", Spam: false, Details: "concurrent"},
+		{Name: "emoji", Spam: false, Details: "1/1", Score: 0.5},
+		{Name: "local", Details: "done"},
+		{Name: "cas", Spam: false, Details: "not found"},
+		{Name: "remote1", Spam: true, Details: "concurrent", Score: 1},
+	}, cr)
 }
 
 func TestDetector_UpdateSpam(t *testing.T) {
@@ -597,7 +1149,7 @@ func TestDetector_UpdateSpam(t *testing.T) {
 	lr, err := d.LoadSamples(strings.NewReader("xyz"), []io.Reader{spamSamples}, []io.Reader{hamsSamples})
 	require.NoError(t, err)
 	assert.Equal(t, LoadResult{ExcludedTokens: 1, SpamSamples: 2, HamSamples: 3}, lr)
-	d.tokenizedSpam = nil // we don't need tokenizedSpam samples for this test
+	d.spamIndex = newSpamIndex() // we don't need spam samples for this test
 	assert.Equal(t, 5, d.classifier.nAllDocument)
 	exp := map[string]map[spamClass]int{"win": {"spam": 1}, "free": {"spam": 1}, "iphone": {"spam": 1}, "lottery": {"spam": 1},
 		"prize": {"spam": 1}, "hello": {"ham": 1}, "world": {"ham": 1}, "how": {"ham": 1}, "are": {"ham": 1}, "you": {"ham": 1},
@@ -644,7 +1196,7 @@ func TestDetector_UpdateHam(t *testing.T) {
 	lr, err := d.LoadSamples(strings.NewReader("xyz"), []io.Reader{spamSamples}, []io.Reader{hamsSamples})
 	require.NoError(t, err)
 	assert.Equal(t, LoadResult{ExcludedTokens: 1, SpamSamples: 2, HamSamples: 3}, lr)
-	d.tokenizedSpam = nil // we don't need tokenizedSpam samples for this test
+	d.spamIndex = newSpamIndex() // we don't need spam samples for this test
 	assert.Equal(t, 5, d.classifier.nAllDocument)
 	exp := map[string]map[spamClass]int{"win": {"spam": 1}, "free": {"spam": 1}, "iphone": {"spam": 1}, "lottery": {"spam": 1},
 		"prize": {"spam": 1}, "hello": {"ham": 1}, "world": {"ham": 1}, "how": {"ham": 1}, "are": {"ham": 1}, "you": {"ham": 1},
@@ -676,6 +1228,49 @@ func TestDetector_UpdateHam(t *testing.T) {
 	})
 }
 
+func TestDetector_RemoveSample(t *testing.T) {
+	spamSamples := "win free iPhone\nlottery prize xyz\nwin free iPhone"
+	hamSamples := "hello world\nhow are you\nhave a good day"
+	load := func(d *Detector, spam, ham string) {
+		_, err := d.LoadSamples(strings.NewReader("xyz"), []io.Reader{strings.NewReader(spam)}, []io.Reader{strings.NewReader(ham)})
+		require.NoError(t, err)
+	}
+
+	d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+	load(d, spamSamples, hamSamples)
+	require.NoError(t, d.RemoveSpam("win free iPhone"))
+	require.NoError(t, d.RemoveHam("how are you"))
+
+	// the state is the same as loaded without removed samples
+	exp := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+	load(exp, "lottery prize xyz\nwin free iPhone", "hello world\nhave a good day")
+	assert.Equal(t, exp.classifier, d.classifier)
+	assert.ElementsMatch(t, exp.spamIndex.samples, d.spamIndex.samples)
+
+	t.Run("not learned sample", func(t *testing.T) {
+		err := d.RemoveHam("something never learned")
+		assert.ErrorContains(t, err, "can't remove ham sample")
+		assert.Equal(t, exp.classifier, d.classifier)
+	})
+
+	t.Run("remove sample added by update", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+		d.WithSpamUpdater(&mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }})
+		load(d, "lottery prize xyz", "hello world")
+		before := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+		load(before, "lottery prize xyz", "hello world")
+
+		require.NoError(t, d.UpdateSpam("totally new spam message"))
+		assert.Len(t, d.spamIndex.samples, 2)
+		spam, _ := d.Check(spamcheck.Request{Msg: "totally new spam message"})
+		assert.True(t, spam)
+
+		require.NoError(t, d.RemoveSpam("totally new spam message"))
+		assert.Equal(t, before.classifier, d.classifier)
+		assert.Equal(t, before.spamIndex.samples, d.spamIndex.samples)
+	})
+}
+
 func TestDetector_Reset(t *testing.T) {
 	d := NewDetector(Config{})
 	spamSamples := strings.NewReader("win free iPhone\nlottery prize xyz")
@@ -688,13 +1283,13 @@ func TestDetector_Reset(t *testing.T) {
 	assert.Equal(t, LoadResult{StopWords: 2}, sr)
 
 	assert.Equal(t, 5, d.classifier.nAllDocument)
-	assert.Equal(t, 2, len(d.tokenizedSpam))
+	assert.Equal(t, 2, len(d.spamIndex.samples))
 	assert.Equal(t, 1, len(d.excludedTokens))
 	assert.Equal(t, 2, len(d.stopWords))
 
 	d.Reset()
 	assert.Equal(t, 0, d.classifier.nAllDocument)
-	assert.Equal(t, 0, len(d.tokenizedSpam))
+	assert.Equal(t, 0, len(d.spamIndex.samples))
 	assert.Equal(t, 0, len(d.excludedTokens))
 	assert.Equal(t, 0, len(d.stopWords))
 }
@@ -940,6 +1535,9 @@ func TestDetector_tokenize(t *testing.T) {
 		{name: "with excluded tokens", input: "hello world the she", expected: map[string]int{"hello": 1, "world": 1}},
 		{name: "with short tokens", input: "hello world the she a or", expected: map[string]int{"hello": 1, "world": 1}},
 		{name: "with repeated tokens", input: "hello world hello world", expected: map[string]int{"hello": 2, "world": 2}},
+		{name: "with styled text", input: "𝐅𝐑𝐄𝐄 ｍｏｎｅｙ", expected: map[string]int{"free": 1, "money": 1}},
+		{name: "with homoglyphs", input: "hеllo wоrld", expected: map[string]int{"hello": 1, "world": 1}},
+		{name: "with invisible chars", input: "hel\u200blo wor\u200dld t\u00adhe", expected: map[string]int{"hello": 1, "world": 1}},
 	}
 
 	for _, tt := range tests {
@@ -989,3 +1587,132 @@ func TestDetector_tokenChanMultipleReaders(t *testing.T) {
 	}
 	assert.Equal(t, []string{"hello", "world", "something, new"}, res)
 }
+
+func TestDetector_CheckOpenAILimits(t *testing.T) {
+	newDetector := func(params OpenAIConfig) (*Detector, *mocks.OpenAIClientMock) {
+		mockOpenAIClient := &mocks.OpenAIClientMock{
+			CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				return openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{{
+						Message: openai.ChatCompletionMessage{Content: `{"spam": false, "reason":"good text", "confidence":90}`},
+					}},
+					Usage: openai.Usage{PromptTokens: 100, CompletionTokens: 20},
+				}, nil
+			},
+		}
+		d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true, OpenAIVeto: true})
+		d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4", CacheTTL: params.CacheTTL,
+			RequestsPerMinute: params.RequestsPerMinute, DailyTokens: params.DailyTokens})
+		_, err := d.LoadStopWords(bytes.NewBufferString("win free"))
+		require.NoError(t, err)
+		return d, mockOpenAIClient
+	}
+
+	t.Run("cached response", func(t *testing.T) {
+		d, mockOpenAIClient := newDetector(OpenAIConfig{CacheTTL: time.Minute})
+		spam, cr := d.Check(spamcheck.Request{Msg: "win free iphone", UserID: "1"})
+		assert.False(t, spam, "vetoed")
+		assert.Equal(t, "good text, confidence: 90%", cr[1].Details)
+
+		spam, cr = d.Check(spamcheck.Request{Msg: "win free iphone", UserID: "2"})
+		assert.False(t, spam, "vetoed by cached response")
+		assert.Equal(t, spamcheck.Response{Name: "openai", Details: "good text, confidence: 90% (cached)"}, cr[1])
+		assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 1)
+
+		stats := d.LLMStats()
+		assert.Equal(t, int64(1), stats.Calls)
+		assert.Equal(t, int64(1), stats.Cached)
+		assert.Equal(t, LLMUsage{Day: time.Now().UTC().Format("2006-01-02"), Requests: 1, InputTokens: 100,
+			OutputTokens: 20}, stats.Usage)
+	})
+
+	t.Run("cache keyed by request params", func(t *testing.T) {
+		first := newOpenAIChecker(nil, OpenAIConfig{CacheTTL: time.Minute, Model: "gpt4"})
+		same := newOpenAIChecker(nil, OpenAIConfig{CacheTTL: time.Minute, Model: "gpt4"})
+		assert.Equal(t, first.cacheKey("msg"), same.cacheKey("msg"))
+		for _, params := range []OpenAIConfig{
+			{CacheTTL: time.Minute, Model: "gpt-4o"},
+			{CacheTTL: time.Minute, Model: "gpt4", SystemPrompt: "other prompt"},
+			{CacheTTL: time.Minute, Model: "gpt4", MaxTokensResponse: 100},
+			{CacheTTL: time.Minute, Model: "gpt4", PromptTemplate: "{{.Message}}"},
+			{CacheTTL: time.Minute, Model: "gpt4", FewShotSamples: 2},
+		} {
+			assert.NotEqual(t, first.cacheKey("msg"), newOpenAIChecker(nil, params).cacheKey("msg"), "%+v", params)
+		}
+	})
+
+	t.Run("no provider releases reservation", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, OpenAIVeto: true})
+		d.WithLLMChecker(nil, OpenAIConfig{DailyTokens: 100})
+		_, err := d.LoadStopWords(bytes.NewBufferString("win free"))
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			d.Check(spamcheck.Request{Msg: "win free iphone", UserID: "1"})
+		}
+		assert.Equal(t, 0, d.openaiChecker.limits.pending)
+	})
+
+	t.Run("limited check keeps the verdict", func(t *testing.T) {
+		d, mockOpenAIClient := newDetector(OpenAIConfig{DailyTokens: 100})
+		spam, _ := d.Check(spamcheck.Request{Msg: "win free iphone", UserID: "1"})
+		assert.False(t, spam, "vetoed")
+
+		spam, cr := d.Check(spamcheck.Request{Msg: "win free iphone", UserID: "2"})
+		assert.True(t, spam, "not vetoed, openai check skipped")
+		assert.Equal(t, spamcheck.Response{Name: "openai", Details: "skipped, daily token budget exhausted, 120/100"}, cr[1])
+		assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 1)
+		assert.Equal(t, int64(1), d.LLMStats().Limited)
+	})
+
+	t.Run("usage storage", func(t *testing.T) {
+		today := time.Now().UTC().Format("2006-01-02")
+		storage := &memLLMUsage{usage: map[string]LLMUsage{today: {Day: today, Requests: 1, InputTokens: 500}}}
+		d, mockOpenAIClient := newDetector(OpenAIConfig{DailyTokens: 100})
+		require.NoError(t, d.WithLLMUsageStorage(storage))
+		spam, _ := d.Check(spamcheck.Request{Msg: "win free iphone", UserID: "1"})
+		assert.True(t, spam, "budget exhausted by stored usage")
+		assert.Empty(t, mockOpenAIClient.CreateChatCompletionCalls())
+
+		require.NoError(t, NewDetector(Config{}).WithLLMUsageStorage(storage), "no openai check")
+		assert.Equal(t, LLMStats{}, NewDetector(Config{}).LLMStats())
+	})
+}
+
+func TestDetector_CheckOpenAIPrompt(t *testing.T) {
+	mockOpenAIClient := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+				Message: openai.ChatCompletionMessage{Content: `{"spam": true, "reason":"bad text", "confidence":90}`},
+			}}}, nil
+		},
+	}
+	d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true, SimilarityThreshold: 0.9, OpenAIVeto: true})
+	d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4", FewShotSamples: 1, PromptContext: true})
+	spam := "win free iphone now\nearn money fast online"
+	ham := "hello world and everyone\nhave a good day friends"
+	_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(spam)}, []io.Reader{strings.NewReader(ham)})
+	require.NoError(t, err)
+
+	isSpam, cr := d.Check(spamcheck.Request{Msg: "win free money for friends", UserID: "1", Meta: spamcheck.MetaData{Links: 1}})
+	assert.True(t, isSpam)
+	require.Len(t, cr, 3)
+	require.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 1)
+	assert.Equal(t, "Examples of messages from this chat, classified before:\nspam: win free iphone now\n"+
+		"not spam: have a good day friends\n\nResults of other checks:\n- similarity: not spam, 0.45/0.90\n"+
+		"- classifier: spam, probability of spam: 80.00%\nUser: first message, no username, images: 0, links: 1\n\n"+
+		"Message to check:\nwin free money for friends",
+		mockOpenAIClient.CreateChatCompletionCalls()[0].ChatCompletionRequest.Messages[1].Content)
+
+	t.Run("ham samples indexed only for few-shot examples", func(t *testing.T) {
+		assert.Equal(t, 2, d.hamIndex.size())
+		noFewShot := NewDetector(Config{})
+		noFewShot.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4", PromptContext: true})
+		noFewShot.WithHamUpdater(&mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }})
+		_, err := noFewShot.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(spam)},
+			[]io.Reader{strings.NewReader(ham)})
+		require.NoError(t, err)
+		require.NoError(t, noFewShot.UpdateHam("see you tomorrow"))
+		assert.Equal(t, 0, noFewShot.hamIndex.size())
+		assert.Equal(t, 2, noFewShot.spamIndex.size())
+	})
+}
@@ -0,0 +1,167 @@
+package tgspam
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// LabeledMessage is a message with the known class, used to evaluate the detector.
+type LabeledMessage struct {
+	Msg  string
+	Spam bool
+}
+
+// Confusion is a confusion matrix of spam detection, i.e. counts of messages by the known class and the verdict.
+type Confusion struct {
+	TP int `json:"tp"` // spam detected as spam
+	FP int `json:"fp"` // ham detected as spam
+	TN int `json:"tn"` // ham detected as ham
+	FN int `json:"fn"` // spam detected as ham
+}
+
+// Precision is a share of real spam among messages detected as spam, 0 if nothing detected.
+func (c Confusion) Precision() float64 {
+	if c.TP+c.FP == 0 {
+		return 0
+	}
+	return float64(c.TP) / float64(c.TP+c.FP)
+}
+
+// Recall is a share of detected spam among all the spam messages, 0 if there is no spam.
+func (c Confusion) Recall() float64 {
+	if c.TP+c.FN == 0 {
+		return 0
+	}
+	return float64(c.TP) / float64(c.TP+c.FN)
+}
+
+// F1 is a harmonic mean of precision and recall.
+func (c Confusion) F1() float64 {
+	p, r := c.Precision(), c.Recall()
+	if p+r == 0 {
+		return 0
+	}
+	return 2 * p * r / (p + r)
+}
+
+// Total returns the number of counted messages.
+func (c Confusion) Total() int { return c.TP + c.FP + c.TN + c.FN }
+
+// String returns the metrics and counts of the matrix.
+func (c Confusion) String() string {
+	return fmt.Sprintf("precision: %.3f, recall: %.3f, f1: %.3f (tp: %d, fp: %d, tn: %d, fn: %d)",
+		c.Precision(), c.Recall(), c.F1(), c.TP, c.FP, c.TN, c.FN)
+}
+
+// add counts a message with the known class and the verdict
+func (c *Confusion) add(spam, detected bool) {
+	switch {
+	case spam && detected:
+		c.TP++
+	case spam && !detected:
+		c.FN++
+	case !spam && detected:
+		c.FP++
+	default:
+		c.TN++
+	}
+}
+
+// merge adds counts of another matrix
+func (c *Confusion) merge(other Confusion) {
+	c.TP += other.TP
+	c.FP += other.FP
+	c.TN += other.TN
+	c.FN += other.FN
+}
+
+// EvalReport is a result of the detector evaluation on labeled messages.
+type EvalReport struct {
+	Total  Confusion            // by the final verdict of the detector
+	Checks map[string]Confusion // by the results of individual checks, for messages the check was performed on
+}
+
+// merge adds counts of another report
+func (r *EvalReport) merge(other EvalReport) {
+	r.Total.merge(other.Total)
+	if r.Checks == nil {
+		r.Checks = map[string]Confusion{}
+	}
+	for name, c := range other.Checks {
+		cc := r.Checks[name]
+		cc.merge(c)
+		r.Checks[name] = cc
+	}
+}
+
+// Evaluate checks the messages with the detector and compares the results to the known classes.
+// Each message is checked as the first message of a new user, with a synthetic user id, so checks based on
+// the user id, like CAS, should be disabled by the caller. The detector records all the checked users as approved,
+// so it should be dedicated to the evaluation. Returns the context error if canceled.
+func Evaluate(ctx context.Context, d *Detector, msgs []LabeledMessage) (EvalReport, error) {
+	res := EvalReport{Checks: map[string]Confusion{}}
+	for i, m := range msgs {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		spam, cr := d.CheckCtx(ctx, spamcheck.Request{Msg: m.Msg, UserID: fmt.Sprintf("eval-%d", i)})
+		res.Total.add(m.Spam, spam)
+		for _, r := range cr {
+			c := res.Checks[r.Name]
+			c.add(m.Spam, r.Spam)
+			res.Checks[r.Name] = c
+		}
+	}
+	return res, nil
+}
+
+// CrossValidate performs k-fold cross-validation of the detector on spam and ham samples. Samples split to k folds,
+// keeping the ratio of spam and ham in each fold. For each fold, the train function makes a detector trained on
+// the samples of other folds, and the detector is evaluated on the fold. Returns the report merged for all the folds.
+func CrossValidate(ctx context.Context, k int, spam, ham []string,
+	train func(spam, ham []string) (*Detector, error)) (EvalReport, error) {
+	if k < 2 {
+		return EvalReport{}, fmt.Errorf("invalid number of folds %d, should be at least 2", k)
+	}
+	if len(spam) < k || len(ham) < k {
+		return EvalReport{}, fmt.Errorf("not enough samples for %d folds, spam: %d, ham: %d", k, len(spam), len(ham))
+	}
+
+	// split returns samples of the fold and the rest of samples, folds are interleaved
+	split := func(samples []string, fold int) (test, rest []string) {
+		for i, s := range samples {
+			if i%k == fold {
+				test = append(test, s)
+				continue
+			}
+			rest = append(rest, s)
+		}
+		return test, rest
+	}
+
+	res := EvalReport{Checks: map[string]Confusion{}}
+	for fold := 0; fold < k; fold++ {
+		testSpam, trainSpam := split(spam, fold)
+		testHam, trainHam := split(ham, fold)
+		d, err := train(trainSpam, trainHam)
+		if err != nil {
+			return EvalReport{}, fmt.Errorf("failed to train detector for fold %d: %w", fold+1, err)
+		}
+
+		msgs := make([]LabeledMessage, 0, len(testSpam)+len(testHam))
+		for _, s := range testSpam {
+			msgs = append(msgs, LabeledMessage{Msg: s, Spam: true})
+		}
+		for _, s := range testHam {
+			msgs = append(msgs, LabeledMessage{Msg: s, Spam: false})
+		}
+		rep, err := Evaluate(ctx, d, msgs)
+		if err != nil {
+			return EvalReport{}, fmt.Errorf("failed to evaluate fold %d: %w", fold+1, err)
+		}
+		res.merge(rep)
+	}
+	return res, nil
+}
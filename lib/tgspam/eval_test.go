@@ -0,0 +1,103 @@
+package tgspam
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfusion(t *testing.T) {
+	tests := []struct {
+		name              string
+		c                 Confusion
+		precision, recall float64
+		f1                float64
+	}{
+		{name: "empty", c: Confusion{}},
+		{name: "perfect", c: Confusion{TP: 5, TN: 5}, precision: 1, recall: 1, f1: 1},
+		{name: "nothing detected", c: Confusion{TN: 5, FN: 5}},
+		{name: "mixed", c: Confusion{TP: 6, FP: 2, TN: 10, FN: 3}, precision: 0.75, recall: 6.0 / 9, f1: 12.0 / 17},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.precision, tt.c.Precision(), 0.0001)
+			assert.InDelta(t, tt.recall, tt.c.Recall(), 0.0001)
+			assert.InDelta(t, tt.f1, tt.c.F1(), 0.0001)
+		})
+	}
+
+	c := Confusion{TP: 6, FP: 2, TN: 10, FN: 3}
+	assert.Equal(t, 21, c.Total())
+	assert.Equal(t, "precision: 0.750, recall: 0.667, f1: 0.706 (tp: 6, fp: 2, tn: 10, fn: 3)", c.String())
+}
+
+func TestEvaluate(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true, FirstMessagesCount: 1})
+	_, err := d.LoadStopWords(strings.NewReader("в личку"))
+	require.NoError(t, err)
+
+	msgs := []LabeledMessage{
+		{Msg: "пишите в личку", Spam: true},
+		{Msg: "заработок в интернете", Spam: true},
+		{Msg: "привет всем", Spam: false},
+		{Msg: "отвечу в личку", Spam: false},
+		{Msg: "hello world", Spam: false},
+	}
+	rep, err := Evaluate(context.Background(), d, msgs)
+	require.NoError(t, err)
+	assert.Equal(t, Confusion{TP: 1, FP: 1, TN: 2, FN: 1}, rep.Total, "all checked as first messages of new users")
+	assert.Equal(t, Confusion{TP: 1, FP: 1, TN: 2, FN: 1}, rep.Checks["stopword"])
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := Evaluate(ctx, d, msgs)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestCrossValidate(t *testing.T) {
+	spam := []string{"win free iphone", "lottery prize win", "free crypto prize", "earn money fast", "free money win"}
+	ham := []string{"hello world", "how are you", "have a good day", "see you tomorrow", "good morning all", "nice day today"}
+
+	var trained [][]string
+	train := func(spam, ham []string) (*Detector, error) {
+		trained = append(trained, spam)
+		d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+		_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{bytes.NewBufferString(strings.Join(spam, "\n"))},
+			[]io.Reader{bytes.NewBufferString(strings.Join(ham, "\n"))})
+		return d, err
+	}
+
+	rep, err := CrossValidate(context.Background(), 3, spam, ham, train)
+	require.NoError(t, err)
+	assert.Equal(t, len(spam)+len(ham), rep.Total.Total(), "each sample evaluated once")
+	assert.Equal(t, len(spam), rep.Total.TP+rep.Total.FN)
+	assert.Equal(t, len(ham), rep.Total.TN+rep.Total.FP)
+	assert.Equal(t, len(spam)+len(ham), rep.Checks["similarity"].Total())
+	assert.Equal(t, len(spam)+len(ham), rep.Checks["classifier"].Total())
+	assert.Greater(t, rep.Total.Recall(), 0.5)
+
+	require.Len(t, trained, 3)
+	assert.Equal(t, []string{"lottery prize win", "free crypto prize", "free money win"}, trained[0], "fold 1 held out")
+	for _, s := range trained {
+		assert.NotContains(t, s, "", "no empty samples")
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := CrossValidate(context.Background(), 1, spam, ham, train)
+		assert.EqualError(t, err, "invalid number of folds 1, should be at least 2")
+		_, err = CrossValidate(context.Background(), 6, spam, ham, train)
+		assert.EqualError(t, err, "not enough samples for 6 folds, spam: 5, ham: 6")
+		_, err = CrossValidate(context.Background(), 2, spam, ham, func(_, _ []string) (*Detector, error) {
+			return nil, assert.AnError
+		})
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
@@ -0,0 +1,159 @@
+package tgspam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// LLMProvider is an api of a large language model, asked by the openai check to classify a message.
+// The check is named "openai" with any provider.
+type LLMProvider interface {
+	Complete(ctx context.Context, req LLMRequest) (LLMResponse, error)
+}
+
+// LLMRequest is a request to the language model
+type LLMRequest struct {
+	Model        string
+	SystemPrompt string
+	Message      string         // user message, reduced to the request limits by the caller
+	MaxTokens    int            // hard limit for the number of tokens in the response
+	Schema       map[string]any // json schema of the response, asks for structured output if set and supported
+	Image        *LLMImage      // image sent with the message, for vision models
+}
+
+// LLMImage is an image sent to the language model with the message
+type LLMImage struct {
+	Data     []byte
+	MimeType string // media type of the image, like image/jpeg
+	Detail   string // image detail for OpenAI: low, high or auto, model default if empty
+}
+
+// LLMResponse is a raw response of the language model
+type LLMResponse struct {
+	Content      string // text of the response, expected to have json with the verdict
+	InputTokens  int    // tokens in the request, as reported by the provider
+	OutputTokens int    // tokens in the response, as reported by the provider
+}
+
+// GrayZone is an uncertainty band of classifier probability of spam and similarity to spam samples. With the gray zone
+// enabled, the openai check is called only if any of these values is inside its band, or if there are no such values.
+// Confident results are kept without the call: any value above its band or spam result of any other check, as well
+// as all values below their bands. OpenAI result may always turn ham to spam, and spam to ham only with OpenAIVeto.
+// A band with zero upper bound is not used.
+type GrayZone struct {
+	Enabled        bool    `json:"enabled"`
+	MinProbability float64 `json:"min_probability"` // lower bound of classifier probability of spam, in percents
+	MaxProbability float64 `json:"max_probability"` // upper bound of classifier probability of spam, in percents
+	MinSimilarity  float64 `json:"min_similarity"`  // lower bound of similarity to the nearest spam sample, 0.0 - 1.0
+	MaxSimilarity  float64 `json:"max_similarity"`  // upper bound of similarity to the nearest spam sample, 0.0 - 1.0
+}
+
+// String returns the bounds of the used bands
+func (g GrayZone) String() string {
+	bands := []string{}
+	if g.MaxProbability > 0 {
+		bands = append(bands, fmt.Sprintf("probability %.0f-%.0f%%", g.MinProbability, g.MaxProbability))
+	}
+	if g.MaxSimilarity > 0 {
+		bands = append(bands, fmt.Sprintf("similarity %.2f-%.2f", g.MinSimilarity, g.MaxSimilarity))
+	}
+	if len(bands) == 0 {
+		return "none"
+	}
+	return strings.Join(bands, ", ")
+}
+
+// uncertain returns true if classifier probability or similarity in the check results is inside its band, or there are
+// no such results. The second value is true for confident spam, i.e. if any value is above its band, or any other check
+// found spam. Also returns the description of the values found.
+func (g GrayZone) uncertain(cr []spamcheck.Response) (uncertain, spam bool, values string) {
+	found, inside := false, false
+	vals := []string{}
+	for _, r := range cr {
+		switch {
+		case r.Name == "classifier" && g.MaxProbability > 0:
+			prob := r.Score * 100 // classifier score is the probability of spam
+			found, inside = true, inside || (prob >= g.MinProbability && prob <= g.MaxProbability)
+			spam = spam || prob > g.MaxProbability
+			vals = append(vals, fmt.Sprintf("probability %.2f%%", prob))
+		case r.Name == "similarity" && g.MaxSimilarity > 0:
+			found, inside = true, inside || (r.Score >= g.MinSimilarity && r.Score <= g.MaxSimilarity)
+			spam = spam || r.Score > g.MaxSimilarity
+			vals = append(vals, fmt.Sprintf("similarity %.2f", r.Score))
+		case r.Spam:
+			spam = true
+			vals = append(vals, r.Name+" spam")
+		}
+	}
+	if !found {
+		if spam {
+			return true, true, strings.Join(vals, ", ")
+		}
+		return true, false, "no classifier or similarity results"
+	}
+	return inside, spam, strings.Join(vals, ", ")
+}
+
+// LLMStats is a set of counters of the openai check calls, with the usage for the current day
+type LLMStats struct {
+	Calls       int64    `json:"calls"`        // number of calls of the language model
+	Skipped     int64    `json:"skipped"`      // number of calls saved by the gray zone, made without it otherwise
+	Cached      int64    `json:"cached"`       // number of responses taken from the cache
+	Limited     int64    `json:"limited"`      // number of checks skipped by the rate limit or the daily budget
+	Usage       LLMUsage `json:"usage"`        // usage for the current day
+	DailyTokens int      `json:"daily_tokens"` // daily budget of tokens, unlimited if 0
+	DailyCost   float64  `json:"daily_cost"`   // daily budget of the cost, unlimited if 0
+}
+
+// llmVerdictSchema returns json schema of the verdict, matching openAIResponse
+func llmVerdictSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"spam":       map[string]any{"type": "boolean", "description": "true if the message is spam"},
+			"reason":     map[string]any{"type": "string", "description": "why this is spam or not"},
+			"confidence": map[string]any{"type": "integer", "minimum": 1, "maximum": 100},
+		},
+		"required": []string{"spam", "reason", "confidence"},
+	}
+}
+
+var fencedJSONRe = regexp.MustCompile("(?s)```[a-zA-Z]*\\s*(.*?)\\s*```")
+
+// parseLLMVerdict parses the verdict from the response content. The content is expected to be json, but models often
+// wrap it in markdown fences or add some text around it, so the fenced block and the outermost braces are tried too.
+// Confidence is accepted as a float and rounded. Returns the error of parsing the whole content if nothing works.
+func parseLLMVerdict(content string) (openAIResponse, error) {
+	var rec struct {
+		Spam       bool    `json:"spam"`
+		Reason     string  `json:"reason"`
+		Confidence float64 `json:"confidence"`
+	}
+	content = strings.TrimSpace(content)
+	err := json.Unmarshal([]byte(content), &rec)
+	if err != nil {
+		candidates := []string{}
+		if m := fencedJSONRe.FindStringSubmatch(content); m != nil {
+			candidates = append(candidates, m[1])
+		}
+		if start, end := strings.Index(content, "{"), strings.LastIndex(content, "}"); start >= 0 && end > start {
+			candidates = append(candidates, content[start:end+1])
+		}
+		for _, c := range candidates {
+			if json.Unmarshal([]byte(c), &rec) == nil {
+				err = nil
+				break
+			}
+		}
+	}
+	if err != nil {
+		return openAIResponse{}, fmt.Errorf("can't unmarshal response: %w", err)
+	}
+	return openAIResponse{IsSpam: rec.Spam, Reason: rec.Reason, Confidence: int(math.Round(rec.Confidence))}, nil
+}
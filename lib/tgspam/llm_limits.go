@@ -0,0 +1,231 @@
+package tgspam
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// LLMUsageStorage is an interface for persistent storage of daily usage of the language model.
+type LLMUsageStorage interface {
+	Read(day string) (LLMUsage, error) // read usage for the day, empty usage if not found
+	Write(u LLMUsage) error            // write (add or replace) usage for the day
+}
+
+// LLMUsage is a usage of the language model for a day
+type LLMUsage struct {
+	Day          string  `json:"day"`           // UTC day, as 2006-01-02
+	Requests     int     `json:"requests"`      // number of requests sent
+	InputTokens  int     `json:"input_tokens"`  // tokens in requests, as reported by the provider
+	OutputTokens int     `json:"output_tokens"` // tokens in responses, as reported by the provider
+	Cost         float64 `json:"cost"`          // cost of the tokens, by the prices from OpenAIConfig
+}
+
+// Tokens returns the total number of input and output tokens
+func (u LLMUsage) Tokens() int { return u.InputTokens + u.OutputTokens }
+
+// llmCache is a bounded in-memory LRU cache of openai check responses by message hash with TTL, thread-safe.
+type llmCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	lock  sync.Mutex
+	items map[string]*list.Element // message hash to element of lru list
+	lru   *list.List               // most recently used at the front, elements are llmCacheEntry
+}
+
+type llmCacheEntry struct {
+	key     string
+	resp    spamcheck.Response
+	expires time.Time
+}
+
+// newLLMCache makes a cache with the given TTL and max size, unlimited if 0
+func newLLMCache(ttl time.Duration, maxSize int) *llmCache {
+	return &llmCache{ttl: ttl, maxSize: maxSize, items: make(map[string]*list.Element), lru: list.New()}
+}
+
+// get returns the cached response for the message, if found and not expired
+func (c *llmCache) get(msg string) (spamcheck.Response, bool) {
+	key := llmCacheKey(msg)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return spamcheck.Response{}, false
+	}
+	entry := elem.Value.(llmCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.items, key)
+		return spamcheck.Response{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.resp, true
+}
+
+// put adds the response for the message, replacing existing one and evicting the least recently used entry if full
+func (c *llmCache) put(msg string, resp spamcheck.Response) {
+	entry := llmCacheEntry{key: llmCacheKey(msg), resp: resp, expires: time.Now().Add(c.ttl)}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.items[entry.key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[entry.key] = c.lru.PushFront(entry)
+	for c.maxSize > 0 && c.lru.Len() > c.maxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(llmCacheEntry).key)
+	}
+}
+
+// llmCacheKey returns the hash of the message, used as the cache key
+func llmCacheKey(msg string) string {
+	h := sha256.Sum256([]byte(msg))
+	return hex.EncodeToString(h[:])
+}
+
+// llmParamsHash returns the hash of the request parameters, like the model and the prompt, added to the cache keys,
+// so the responses made with other parameters are not taken from the cache
+func llmParamsHash(params ...any) string {
+	h := sha256.New()
+	for _, p := range params {
+		fmt.Fprintf(h, "%v\x00", p)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// llmLimits keeps the usage of the language model and enforces the rate limit and the daily budget, thread-safe
+type llmLimits struct {
+	params  OpenAIConfig
+	storage LLMUsageStorage // persistent storage of usage, optional
+
+	lock     sync.Mutex
+	usage    LLMUsage    // usage for the current day
+	requests []time.Time // times of the requests within the last minute, for the rate limit
+	pending  int         // number of reserved requests, not recorded yet
+	calls    int64       // number of requests sent
+	cached   int64       // number of responses taken from the cache
+	limited  int64       // number of checks skipped by the rate limit or the budget
+}
+
+// setStorage sets the storage and loads the usage for the current day from it
+func (l *llmLimits) setStorage(storage LLMUsageStorage) error {
+	day := time.Now().UTC().Format("2006-01-02")
+	usage, err := storage.Read(day)
+	if err != nil {
+		return fmt.Errorf("failed to read llm usage for %s: %w", day, err)
+	}
+	usage.Day = day
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.storage, l.usage = storage, usage
+	return nil
+}
+
+// reserve checks the rate limit and the daily budget, and counts the request if allowed. The usage of the requests
+// reserved but not recorded yet is estimated by the average usage of the day's requests, so concurrent requests can't
+// pass the budget all together. The budget is still soft, as the actual usage is known only after the request.
+// Returns the reason if the request is not allowed.
+func (l *llmLimits) reserve() (reason string) {
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.rollDay(now)
+
+	tokens, cost := l.usage.Tokens(), l.usage.Cost
+	if l.pending > 0 && l.usage.Requests > 0 {
+		tokens += l.pending * l.usage.Tokens() / l.usage.Requests
+		cost += float64(l.pending) * l.usage.Cost / float64(l.usage.Requests)
+	}
+
+	switch {
+	case l.params.DailyTokens > 0 && tokens >= l.params.DailyTokens:
+		reason = fmt.Sprintf("daily token budget exhausted, %d/%d", tokens, l.params.DailyTokens)
+	case l.params.DailyCost > 0 && cost >= l.params.DailyCost:
+		reason = fmt.Sprintf("daily cost budget exhausted, %.4f/%.4f", cost, l.params.DailyCost)
+	case l.params.RequestsPerMinute > 0:
+		recent := l.requests[:0]
+		for _, ts := range l.requests {
+			if now.Sub(ts) < time.Minute {
+				recent = append(recent, ts)
+			}
+		}
+		l.requests = recent
+		if len(l.requests) >= l.params.RequestsPerMinute {
+			reason = fmt.Sprintf("rate limit of %d requests per minute reached", l.params.RequestsPerMinute)
+			break
+		}
+		l.requests = append(l.requests, now)
+	}
+	if reason != "" {
+		l.limited++
+		return reason
+	}
+	l.pending++
+	return ""
+}
+
+// record adds the tokens of the sent request to the usage, releasing its reservation, and writes the usage to the
+// storage, if set. The storage is written under the lock, to keep the order of the writes.
+func (l *llmLimits) record(resp LLMResponse) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.rollDay(time.Now())
+	l.calls++
+	if l.pending > 0 {
+		l.pending--
+	}
+	l.usage.Requests++
+	l.usage.InputTokens += resp.InputTokens
+	l.usage.OutputTokens += resp.OutputTokens
+	l.usage.Cost += (float64(resp.InputTokens)*l.params.InputTokenPrice + float64(resp.OutputTokens)*l.params.OutputTokenPrice) / 1e6
+
+	if l.storage == nil {
+		return
+	}
+	if err := l.storage.Write(l.usage); err != nil {
+		log.Printf("[WARN] failed to write llm usage for %s: %v", l.usage.Day, err)
+	}
+}
+
+// release releases the reservation of the request not sent, e.g. skipped without the provider
+func (l *llmLimits) release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.pending > 0 {
+		l.pending--
+	}
+}
+
+// countCached counts the response taken from the cache
+func (l *llmLimits) countCached() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.cached++
+}
+
+// rollDay resets the usage if the day changed, should be called under the lock
+func (l *llmLimits) rollDay(now time.Time) {
+	if day := now.UTC().Format("2006-01-02"); l.usage.Day != day {
+		l.usage = LLMUsage{Day: day}
+	}
+}
+
+// stats returns the counters and the usage for the current day
+func (l *llmLimits) stats() LLMStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.rollDay(time.Now())
+	return LLMStats{Calls: l.calls, Cached: l.cached, Limited: l.limited, Usage: l.usage,
+		DailyTokens: l.params.DailyTokens, DailyCost: l.params.DailyCost}
+}
@@ -0,0 +1,190 @@
+package tgspam
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestLLMCache(t *testing.T) {
+	t.Run("get and put", func(t *testing.T) {
+		c := newLLMCache(time.Minute, 0)
+		_, ok := c.get("msg")
+		assert.False(t, ok)
+
+		c.put("msg", spamcheck.Response{Name: "openai", Spam: true, Details: "spam"})
+		resp, ok := c.get("msg")
+		require.True(t, ok)
+		assert.Equal(t, spamcheck.Response{Name: "openai", Spam: true, Details: "spam"}, resp)
+
+		c.put("msg", spamcheck.Response{Name: "openai", Details: "ham"})
+		resp, ok = c.get("msg")
+		require.True(t, ok)
+		assert.Equal(t, "ham", resp.Details, "replaced")
+		assert.Equal(t, 1, c.lru.Len())
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		c := newLLMCache(time.Millisecond, 0)
+		c.put("msg", spamcheck.Response{Name: "openai"})
+		time.Sleep(5 * time.Millisecond)
+		_, ok := c.get("msg")
+		assert.False(t, ok)
+		assert.Empty(t, c.items, "expired entry removed")
+	})
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		c := newLLMCache(time.Minute, 2)
+		c.put("msg1", spamcheck.Response{Details: "1"})
+		c.put("msg2", spamcheck.Response{Details: "2"})
+		_, ok := c.get("msg1") // msg1 is used, so msg2 is the oldest
+		require.True(t, ok)
+		c.put("msg3", spamcheck.Response{Details: "3"})
+
+		_, ok = c.get("msg2")
+		assert.False(t, ok)
+		_, ok = c.get("msg1")
+		assert.True(t, ok)
+		_, ok = c.get("msg3")
+		assert.True(t, ok)
+		assert.Equal(t, 2, c.lru.Len())
+	})
+}
+
+// memLLMUsage is in-memory LLMUsageStorage for tests
+type memLLMUsage struct {
+	lock     sync.Mutex
+	usage    map[string]LLMUsage
+	readErr  error
+	writeErr error
+}
+
+func (m *memLLMUsage) Read(day string) (LLMUsage, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.usage[day], m.readErr
+}
+
+func (m *memLLMUsage) Write(u LLMUsage) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.writeErr != nil {
+		return m.writeErr
+	}
+	m.usage[u.Day] = u
+	return nil
+}
+
+func TestLLMLimits(t *testing.T) {
+	today := time.Now().UTC().Format("2006-01-02")
+
+	t.Run("unlimited", func(t *testing.T) {
+		l := &llmLimits{}
+		for i := 0; i < 100; i++ {
+			assert.Empty(t, l.reserve())
+			l.record(LLMResponse{InputTokens: 100, OutputTokens: 10})
+		}
+		stats := l.stats()
+		assert.Equal(t, int64(100), stats.Calls)
+		assert.Equal(t, int64(0), stats.Limited)
+		assert.Equal(t, LLMUsage{Day: today, Requests: 100, InputTokens: 10000, OutputTokens: 1000}, stats.Usage)
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		l := &llmLimits{params: OpenAIConfig{RequestsPerMinute: 2}}
+		assert.Empty(t, l.reserve())
+		assert.Empty(t, l.reserve())
+		assert.Equal(t, "rate limit of 2 requests per minute reached", l.reserve())
+
+		l.requests[0] = time.Now().Add(-time.Minute) // the first request is out of the window
+		assert.Empty(t, l.reserve())
+		assert.Len(t, l.requests, 2)
+		assert.Equal(t, int64(1), l.stats().Limited)
+	})
+
+	t.Run("token budget", func(t *testing.T) {
+		l := &llmLimits{params: OpenAIConfig{DailyTokens: 150}}
+		assert.Empty(t, l.reserve())
+		l.record(LLMResponse{InputTokens: 100, OutputTokens: 20})
+		assert.Empty(t, l.reserve())
+		l.record(LLMResponse{InputTokens: 100, OutputTokens: 20})
+		assert.Equal(t, "daily token budget exhausted, 240/150", l.reserve())
+
+		l.usage.Day = "2020-01-01" // next day resets the usage
+		assert.Empty(t, l.reserve())
+		stats := l.stats()
+		assert.Equal(t, LLMUsage{Day: today}, stats.Usage)
+		assert.Equal(t, 150, stats.DailyTokens)
+	})
+
+	t.Run("pending requests", func(t *testing.T) {
+		l := &llmLimits{params: OpenAIConfig{DailyTokens: 250}}
+		assert.Empty(t, l.reserve())
+		l.record(LLMResponse{InputTokens: 90, OutputTokens: 10})
+		assert.Empty(t, l.reserve(), "100 used")
+		assert.Empty(t, l.reserve(), "100 used, 100 estimated for the pending request")
+		assert.Equal(t, "daily token budget exhausted, 300/250", l.reserve(), "100 used, 200 estimated for two pending")
+		l.record(LLMResponse{InputTokens: 10, OutputTokens: 10})
+		assert.Equal(t, 1, l.pending, "released by the recorded request")
+		assert.Empty(t, l.reserve(), "120 used, 60 estimated for the pending request")
+		l.release()
+		l.release()
+		assert.Equal(t, 0, l.pending, "released without recording")
+		assert.Equal(t, 2, l.stats().Usage.Requests)
+		l.release()
+		assert.Equal(t, 0, l.pending, "not released below zero")
+	})
+
+	t.Run("cost budget", func(t *testing.T) {
+		l := &llmLimits{params: OpenAIConfig{DailyCost: 0.01, InputTokenPrice: 2.5, OutputTokenPrice: 10}}
+		assert.Empty(t, l.reserve())
+		l.record(LLMResponse{InputTokens: 2000, OutputTokens: 500}) // 0.005 + 0.005
+		assert.InDelta(t, 0.01, l.stats().Usage.Cost, 1e-9)
+		assert.Equal(t, "daily cost budget exhausted, 0.0100/0.0100", l.reserve())
+	})
+
+	t.Run("storage", func(t *testing.T) {
+		storage := &memLLMUsage{usage: map[string]LLMUsage{today: {Day: today, Requests: 5, InputTokens: 90, OutputTokens: 10}}}
+		l := &llmLimits{params: OpenAIConfig{DailyTokens: 150}}
+		require.NoError(t, l.setStorage(storage))
+		assert.Equal(t, 100, l.stats().Usage.Tokens(), "loaded from storage")
+
+		l.record(LLMResponse{InputTokens: 40, OutputTokens: 10})
+		assert.Equal(t, LLMUsage{Day: today, Requests: 6, InputTokens: 130, OutputTokens: 20}, storage.usage[today])
+		assert.Equal(t, "daily token budget exhausted, 150/150", l.reserve())
+
+		storage.writeErr = errors.New("write error")
+		l.record(LLMResponse{InputTokens: 1})
+		assert.Equal(t, 7, l.stats().Usage.Requests, "counted despite write error")
+	})
+
+	t.Run("storage concurrent writes", func(t *testing.T) {
+		storage := &memLLMUsage{usage: map[string]LLMUsage{}}
+		l := &llmLimits{}
+		require.NoError(t, l.setStorage(storage))
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l.record(LLMResponse{InputTokens: 10, OutputTokens: 1})
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, LLMUsage{Day: today, Requests: 50, InputTokens: 500, OutputTokens: 50}, storage.usage[today])
+	})
+
+	t.Run("storage read error", func(t *testing.T) {
+		l := &llmLimits{}
+		err := l.setStorage(&memLLMUsage{readErr: errors.New("read error")})
+		require.EqualError(t, err, fmt.Sprintf("failed to read llm usage for %s: read error", today))
+		assert.Nil(t, l.storage)
+	})
+}
@@ -0,0 +1,187 @@
+package tgspam
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	tokenizer "github.com/sandwich-go/gpt3-encoder"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// LLMPromptData is the data of the prompt template, rendered to the user message of openai request.
+// See OpenAIConfig.PromptTemplate.
+type LLMPromptData struct {
+	Message      string               // the message to check, reduced to fit the request limits
+	SpamExamples []string             // the nearest spam samples, the most similar first
+	HamExamples  []string             // the nearest ham samples, the most similar first
+	Context      bool                 // true if the results of other checks and the user metadata are set
+	Checks       []spamcheck.Response // results of other checks
+	User         LLMPromptUser        // metadata of the message author
+}
+
+// LLMPromptUser is the metadata of the message author for the prompt
+type LLMPromptUser struct {
+	FirstMessage bool `json:"first_message"` // true if no messages of the user passed the checks before
+	HasUsername  bool `json:"has_username"`  // true if the user has a name
+	Images       int  `json:"images"`        // number of images in the message
+	Links        int  `json:"links"`         // number of links in the message
+}
+
+// defaultPromptTemplate adds the examples and the context, if any, before the message
+const defaultPromptTemplate = `
+{{- if or .SpamExamples .HamExamples}}Examples of messages from this chat, classified before:
+{{- range .SpamExamples}}
+spam: {{.}}
+{{- end}}
+{{- range .HamExamples}}
+not spam: {{.}}
+{{- end}}
+
+{{end}}
+{{- if .Context}}Results of other checks:
+{{- range .Checks}}
+- {{.Name}}: {{if .Spam}}spam{{else}}not spam{{end}}, {{.Details}}
+{{- end}}
+User: {{if .User.FirstMessage}}first message{{else}}posted before{{end}}, {{if .User.HasUsername}}has username{{else}}no username{{end}}, images: {{.User.Images}}, links: {{.User.Links}}
+
+{{end}}
+{{- if or .SpamExamples .HamExamples .Context}}Message to check:
+{{end}}{{.Message}}`
+
+// ValidateLLMPromptTemplate checks if the prompt template can be parsed and rendered with LLMPromptData.
+// Empty template is valid, the default one is used for it.
+func ValidateLLMPromptTemplate(text string) error {
+	prompt, err := newLLMPrompt(text)
+	if err != nil {
+		return err
+	}
+	data := LLMPromptData{Message: "message", SpamExamples: []string{"spam"}, HamExamples: []string{"ham"}, Context: true,
+		Checks: []spamcheck.Response{{Name: "similarity", Details: "0.10/0.50"}}, User: LLMPromptUser{FirstMessage: true}}
+	if _, err := prompt.render(data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// llmPrompt renders the user message of openai request with the template
+type llmPrompt struct {
+	tmpl *template.Template
+}
+
+// newLLMPrompt parses the template, the default one if empty
+func newLLMPrompt(text string) (*llmPrompt, error) {
+	if text == "" {
+		text = defaultPromptTemplate
+	}
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template: %w", err)
+	}
+	return &llmPrompt{tmpl: tmpl}, nil
+}
+
+// render executes the template with the data
+func (p *llmPrompt) render(data LLMPromptData) (string, error) {
+	buf := bytes.Buffer{}
+	if err := p.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// build renders the prompt within the request limits. While it doesn't fit, the least similar example is dropped,
+// from the longer list of examples, and then the check results. If the prompt doesn't fit even without them,
+// the message is reduced to the space left by the rest of the prompt. Returns error if the prompt without the message
+// doesn't fit, so the caller can send the message alone.
+func (p *llmPrompt) build(data LLMPromptData, budget *requestBudget) (string, error) {
+	for {
+		text, err := p.render(data)
+		if err != nil {
+			return "", err
+		}
+		if budget.size(text) <= budget.limit() {
+			return text, nil
+		}
+		switch {
+		case len(data.SpamExamples) > 0 && len(data.SpamExamples) >= len(data.HamExamples):
+			data.SpamExamples = data.SpamExamples[:len(data.SpamExamples)-1]
+		case len(data.HamExamples) > 0:
+			data.HamExamples = data.HamExamples[:len(data.HamExamples)-1]
+		case len(data.Checks) > 0:
+			data.Checks = nil
+		default:
+			msg := data.Message
+			data.Message = ""
+			rest, err := p.render(data)
+			if err != nil {
+				return "", err
+			}
+			restSize := budget.size(rest)
+			if restSize >= budget.limit() {
+				return "", fmt.Errorf("prompt without the message exceeds the request limit, %d/%d", restSize, budget.limit())
+			}
+			data.Message = budget.reduce(msg, restSize)
+			return p.render(data)
+		}
+	}
+}
+
+// requestBudget measures and reduces the request with tokenizer, or with symbols if tokenizer fails
+type requestBudget struct {
+	encoder    *tokenizer.Encoder // nil if tokenizer failed, symbols are used
+	maxTokens  int
+	maxSymbols int
+}
+
+// newRequestBudget makes a budget with the limits of the request in tokens and in symbols
+func newRequestBudget(maxTokens, maxSymbols int) *requestBudget {
+	res := &requestBudget{maxTokens: maxTokens, maxSymbols: maxSymbols}
+	if encoder, err := tokenizer.NewEncoder(); err == nil {
+		res.encoder = encoder
+	}
+	return res
+}
+
+// limit returns the max size of the request, in tokens or in symbols without tokenizer
+func (b *requestBudget) limit() int {
+	if b.encoder == nil {
+		return b.maxSymbols
+	}
+	return b.maxTokens
+}
+
+// size returns the size of the text, in tokens or in symbols without tokenizer.
+// Tokenizer is not used anymore after the first failure, to keep the sizes comparable.
+func (b *requestBudget) size(text string) int {
+	if b.encoder == nil {
+		return len(text)
+	}
+	tokens, err := b.encoder.Encode(text)
+	if err != nil {
+		b.encoder = nil
+		return len(text)
+	}
+	return len(tokens)
+}
+
+// reduce cuts the text to fit the request limit, with the reserved size taken by the rest of the request
+func (b *requestBudget) reduce(text string, reserved int) string {
+	limit := max(b.limit()-reserved, 1)
+	if b.encoder == nil {
+		if len(text) <= limit {
+			return text
+		}
+		return text[:limit]
+	}
+	tokens, err := b.encoder.Encode(text)
+	if err != nil {
+		b.encoder = nil
+		return b.reduce(text, 0) // reserved size is in tokens, not comparable with symbols
+	}
+	if len(tokens) <= limit {
+		return text
+	}
+	return b.encoder.Decode(tokens[:limit])
+}
@@ -0,0 +1,94 @@
+package tgspam
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestLLMPrompt_Render(t *testing.T) {
+	prompt, err := newLLMPrompt("")
+	require.NoError(t, err)
+
+	tbl := []struct {
+		name string
+		data LLMPromptData
+		exp  string
+	}{
+		{name: "message only", data: LLMPromptData{Message: "some text"}, exp: "some text"},
+		{name: "examples", data: LLMPromptData{Message: "some text", SpamExamples: []string{"spam 1", "spam 2"},
+			HamExamples: []string{"ham 1"}},
+			exp: "Examples of messages from this chat, classified before:\nspam: spam 1\nspam: spam 2\nnot spam: ham 1\n\n" +
+				"Message to check:\nsome text"},
+		{name: "context", data: LLMPromptData{Message: "some text", Context: true,
+			Checks: []spamcheck.Response{{Name: "stopword", Details: "not found"}, {Name: "similarity", Spam: true, Details: "0.80/0.50"}},
+			User:   LLMPromptUser{FirstMessage: true, Links: 2}},
+			exp: "Results of other checks:\n- stopword: not spam, not found\n- similarity: spam, 0.80/0.50\n" +
+				"User: first message, no username, images: 0, links: 2\n\nMessage to check:\nsome text"},
+		{name: "examples and context", data: LLMPromptData{Message: "some text", HamExamples: []string{"ham 1"},
+			Context: true, User: LLMPromptUser{HasUsername: true, Images: 1}},
+			exp: "Examples of messages from this chat, classified before:\nnot spam: ham 1\n\nResults of other checks:\n" +
+				"User: posted before, has username, images: 1, links: 0\n\nMessage to check:\nsome text"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := prompt.render(tt.data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, res)
+		})
+	}
+}
+
+func TestLLMPrompt_Build(t *testing.T) {
+	prompt, err := newLLMPrompt("{{range .SpamExamples}}s:{{.}} {{end}}{{range .HamExamples}}h:{{.}} {{end}}" +
+		"{{range .Checks}}c:{{.Name}} {{end}}m:{{.Message}}")
+	require.NoError(t, err)
+	data := LLMPromptData{Message: "message text", SpamExamples: []string{"spam1", "spam2"}, HamExamples: []string{"ham1"},
+		Checks: []spamcheck.Response{{Name: "check1"}}}
+
+	tbl := []struct {
+		name       string
+		maxSymbols int
+		exp        string
+	}{
+		{name: "fits", maxSymbols: 100, exp: "s:spam1 s:spam2 h:ham1 c:check1 m:message text"},
+		{name: "drops spam example", maxSymbols: 40, exp: "s:spam1 h:ham1 c:check1 m:message text"},
+		{name: "drops examples", maxSymbols: 29, exp: "c:check1 m:message text"},
+		{name: "drops checks", maxSymbols: 20, exp: "m:message text"},
+		{name: "reduces message", maxSymbols: 9, exp: "m:message"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := &requestBudget{maxSymbols: tt.maxSymbols} // without tokenizer, in symbols
+			res, err := prompt.build(data, budget)
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, res)
+		})
+	}
+
+	t.Run("with tokenizer", func(t *testing.T) {
+		budget := newRequestBudget(5, 1000)
+		require.NotNil(t, budget.encoder)
+		res, err := prompt.build(LLMPromptData{Message: strings.Repeat("word ", 100), SpamExamples: []string{"spam"}}, budget)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, budget.size(res), 5)
+		assert.True(t, strings.HasPrefix(res, "m:word"), res)
+	})
+
+	t.Run("template exceeds the limit", func(t *testing.T) {
+		budget := &requestBudget{maxSymbols: 2}
+		_, err := prompt.build(data, budget)
+		assert.EqualError(t, err, "prompt without the message exceeds the request limit, 2/2")
+	})
+}
+
+func TestValidateLLMPromptTemplate(t *testing.T) {
+	assert.NoError(t, ValidateLLMPromptTemplate(""))
+	assert.NoError(t, ValidateLLMPromptTemplate("{{.Message}}, first: {{.User.FirstMessage}}"))
+	assert.ErrorContains(t, ValidateLLMPromptTemplate("{{.Message"), "failed to parse prompt template")
+	assert.ErrorContains(t, ValidateLLMPromptTemplate("{{.Unknown}}"), "failed to render prompt template")
+}
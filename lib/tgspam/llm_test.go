@@ -0,0 +1,59 @@
+package tgspam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLLMVerdict(t *testing.T) {
+	tbl := []struct {
+		name    string
+		content string
+		res     openAIResponse
+		err     string
+	}{
+		{name: "plain json", content: `{"spam": true, "reason":"bad text", "confidence":90}`,
+			res: openAIResponse{IsSpam: true, Reason: "bad text", Confidence: 90}},
+		{name: "spaces around", content: "\n  {\"spam\": false, \"reason\":\"ok\", \"confidence\":80}\n ",
+			res: openAIResponse{IsSpam: false, Reason: "ok", Confidence: 80}},
+		{name: "fenced json", content: "```json\n{\"spam\": true, \"reason\":\"ad\", \"confidence\":95}\n```",
+			res: openAIResponse{IsSpam: true, Reason: "ad", Confidence: 95}},
+		{name: "fenced without language", content: "```\n{\"spam\": true, \"reason\":\"ad\", \"confidence\":95}\n```",
+			res: openAIResponse{IsSpam: true, Reason: "ad", Confidence: 95}},
+		{name: "text around", content: "Here is my verdict:\n{\"spam\": true, \"reason\":\"scam {link}\", \"confidence\":70}\nHope it helps.",
+			res: openAIResponse{IsSpam: true, Reason: "scam {link}", Confidence: 70}},
+		{name: "text and fence", content: "Sure!\n```json\n{\"spam\": false, \"reason\":\"chat\", \"confidence\":60}\n``` done",
+			res: openAIResponse{IsSpam: false, Reason: "chat", Confidence: 60}},
+		{name: "float confidence", content: `{"spam": true, "reason":"x", "confidence":87.6}`,
+			res: openAIResponse{IsSpam: true, Reason: "x", Confidence: 88}},
+		{name: "not json", content: "bad json",
+			err: "can't unmarshal response: invalid character 'b' looking for beginning of value"},
+		{name: "broken json in text", content: "verdict: {\"spam\": tru}",
+			err: "can't unmarshal response: invalid character 'v' looking for beginning of value"},
+		{name: "empty", content: "", err: "can't unmarshal response: unexpected end of JSON input"},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := parseLLMVerdict(tt.content)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, res)
+		})
+	}
+}
+
+func TestLLMVerdictSchema(t *testing.T) {
+	schema := llmVerdictSchema()
+	assert.Equal(t, "object", schema["type"])
+	assert.Equal(t, []string{"spam", "reason", "confidence"}, schema["required"])
+	props := schema["properties"].(map[string]any)
+	assert.Len(t, props, 3)
+	schema["type"] = "changed"
+	assert.Equal(t, "object", llmVerdictSchema()["type"], "new schema for each call")
+}
@@ -10,6 +10,9 @@ import (
 
 // MetaCheck represents a function type that takes a `spamcheck.Request` as input and returns a boolean value and a `spamcheck.Response`.
 // The boolean value indicates whether the check. It checks the message's meta.
+// Meta-checks are registered with Detector.WithMetaCheck and performed as Checker with the given name, which should be
+// the same as the name in the responses, like "links" for LinksCheck, "link-only" for LinkOnlyCheck and "images"
+// for ImagesCheck.
 type MetaCheck func(req spamcheck.Request) spamcheck.Response
 
 // LinksCheck is a function that returns a MetaCheck function that checks the number of links in the message.
@@ -0,0 +1,91 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"context"
+	"sync"
+)
+
+// CasMirrorMock is a mock implementation of tgspam.CasMirror.
+//
+//	func TestSomethingThatUsesCasMirror(t *testing.T) {
+//
+//		// make and configure a mocked tgspam.CasMirror
+//		mockedCasMirror := &CasMirrorMock{
+//			IsBannedFunc: func(ctx context.Context, userID string) (bool, error) {
+//				panic("mock out the IsBanned method")
+//			},
+//		}
+//
+//		// use mockedCasMirror in code that requires tgspam.CasMirror
+//		// and then make assertions.
+//
+//	}
+type CasMirrorMock struct {
+	// IsBannedFunc mocks the IsBanned method.
+	IsBannedFunc func(ctx context.Context, userID string) (bool, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// IsBanned holds details about calls to the IsBanned method.
+		IsBanned []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// UserID is the userID argument value.
+			UserID string
+		}
+	}
+	lockIsBanned sync.RWMutex
+}
+
+// IsBanned calls IsBannedFunc.
+func (mock *CasMirrorMock) IsBanned(ctx context.Context, userID string) (bool, error) {
+	if mock.IsBannedFunc == nil {
+		panic("CasMirrorMock.IsBannedFunc: method is nil but CasMirror.IsBanned was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		UserID string
+	}{
+		Ctx:    ctx,
+		UserID: userID,
+	}
+	mock.lockIsBanned.Lock()
+	mock.calls.IsBanned = append(mock.calls.IsBanned, callInfo)
+	mock.lockIsBanned.Unlock()
+	return mock.IsBannedFunc(ctx, userID)
+}
+
+// IsBannedCalls gets all the calls that were made to IsBanned.
+// Check the length with:
+//
+//	len(mockedCasMirror.IsBannedCalls())
+func (mock *CasMirrorMock) IsBannedCalls() []struct {
+	Ctx    context.Context
+	UserID string
+} {
+	var calls []struct {
+		Ctx    context.Context
+		UserID string
+	}
+	mock.lockIsBanned.RLock()
+	calls = mock.calls.IsBanned
+	mock.lockIsBanned.RUnlock()
+	return calls
+}
+
+// ResetIsBannedCalls reset all the calls that were made to IsBanned.
+func (mock *CasMirrorMock) ResetIsBannedCalls() {
+	mock.lockIsBanned.Lock()
+	mock.calls.IsBanned = nil
+	mock.lockIsBanned.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *CasMirrorMock) ResetCalls() {
+	mock.lockIsBanned.Lock()
+	mock.calls.IsBanned = nil
+	mock.lockIsBanned.Unlock()
+}
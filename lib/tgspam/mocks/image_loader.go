@@ -0,0 +1,91 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"context"
+	"sync"
+)
+
+// ImageLoaderMock is a mock implementation of tgspam.ImageLoader.
+//
+//	func TestSomethingThatUsesImageLoader(t *testing.T) {
+//
+//		// make and configure a mocked tgspam.ImageLoader
+//		mockedImageLoader := &ImageLoaderMock{
+//			LoadImageFunc: func(ctx context.Context, id string) ([]byte, string, error) {
+//				panic("mock out the LoadImage method")
+//			},
+//		}
+//
+//		// use mockedImageLoader in code that requires tgspam.ImageLoader
+//		// and then make assertions.
+//
+//	}
+type ImageLoaderMock struct {
+	// LoadImageFunc mocks the LoadImage method.
+	LoadImageFunc func(ctx context.Context, id string) ([]byte, string, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// LoadImage holds details about calls to the LoadImage method.
+		LoadImage []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ID is the id argument value.
+			ID string
+		}
+	}
+	lockLoadImage sync.RWMutex
+}
+
+// LoadImage calls LoadImageFunc.
+func (mock *ImageLoaderMock) LoadImage(ctx context.Context, id string) ([]byte, string, error) {
+	if mock.LoadImageFunc == nil {
+		panic("ImageLoaderMock.LoadImageFunc: method is nil but ImageLoader.LoadImage was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		ID  string
+	}{
+		Ctx: ctx,
+		ID:  id,
+	}
+	mock.lockLoadImage.Lock()
+	mock.calls.LoadImage = append(mock.calls.LoadImage, callInfo)
+	mock.lockLoadImage.Unlock()
+	return mock.LoadImageFunc(ctx, id)
+}
+
+// LoadImageCalls gets all the calls that were made to LoadImage.
+// Check the length with:
+//
+//	len(mockedImageLoader.LoadImageCalls())
+func (mock *ImageLoaderMock) LoadImageCalls() []struct {
+	Ctx context.Context
+	ID  string
+} {
+	var calls []struct {
+		Ctx context.Context
+		ID  string
+	}
+	mock.lockLoadImage.RLock()
+	calls = mock.calls.LoadImage
+	mock.lockLoadImage.RUnlock()
+	return calls
+}
+
+// ResetLoadImageCalls reset all the calls that were made to LoadImage.
+func (mock *ImageLoaderMock) ResetLoadImageCalls() {
+	mock.lockLoadImage.Lock()
+	mock.calls.LoadImage = nil
+	mock.lockLoadImage.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *ImageLoaderMock) ResetCalls() {
+	mock.lockLoadImage.Lock()
+	mock.calls.LoadImage = nil
+	mock.lockLoadImage.Unlock()
+}
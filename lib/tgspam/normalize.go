@@ -0,0 +1,173 @@
+package tgspam
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables is a set of homoglyphs, letters looking the same in latin, cyrillic and greek scripts.
+// Zero rune means the script has no such letter.
+var confusables = []struct{ latin, cyrillic, greek rune }{
+	{'a', 'а', 'α'}, {'A', 'А', 'Α'}, {'B', 'В', 'Β'}, {'c', 'с', 'ϲ'}, {'C', 'С', 'Ϲ'},
+	{'e', 'е', 0}, {'E', 'Е', 'Ε'}, {'H', 'Н', 'Η'}, {'i', 'і', 'ι'}, {'I', 'І', 'Ι'},
+	{'j', 'ј', 0}, {'k', 'к', 'κ'}, {'K', 'К', 'Κ'}, {'M', 'М', 'Μ'}, {'o', 'о', 'ο'},
+	{'O', 'О', 'Ο'}, {'p', 'р', 'ρ'}, {'P', 'Р', 'Ρ'}, {'s', 'ѕ', 0}, {'S', 'Ѕ', 0},
+	{'T', 'Т', 'Τ'}, {'x', 'х', 'χ'}, {'X', 'Х', 'Χ'}, {'y', 'у', 0}, {'Y', 'Ү', 'Υ'},
+}
+
+// script is a writing system of a letter, only scripts with homoglyphs are distinguished
+type script int
+
+const (
+	scriptOther script = iota
+	scriptLatin
+	scriptCyrillic
+	scriptGreek
+)
+
+// homoglyphs maps each confusable letter to its equivalents in all scripts, indexed by script
+var homoglyphs = func() map[rune][4]rune {
+	res := map[rune][4]rune{}
+	for _, c := range confusables {
+		eq := [4]rune{scriptLatin: c.latin, scriptCyrillic: c.cyrillic, scriptGreek: c.greek}
+		for _, r := range []rune{c.latin, c.cyrillic, c.greek} {
+			if r != 0 {
+				res[r] = eq
+			}
+		}
+	}
+	return res
+}()
+
+// Normalize returns the message in the form used for tokenization and stop-words matching. Invisible characters
+// are removed, styled letters converted to plain ones, look-alike letters of latin, cyrillic and greek scripts
+// replaced by a single form, and obfuscated words, like "m o n e y", reverted if the obfuscation check is enabled.
+func (d *Detector) Normalize(msg string) string {
+	return d.canonical(msg)
+}
+
+// normalize converts the text to the canonical form, defeating common tricks to hide spam from the checks:
+//   - invisible characters, like zero-width spaces and joiners, are removed, blank fillers replaced by spaces
+//   - NFKC normalization converts styled and compatibility letters, like mathematical bold or full-width, to plain ones
+//   - homoglyphs in a word mixing scripts are replaced by letters of the dominant script of the word, or by latin
+//     letters if no script dominates, words of a single script are kept as is
+func normalize(msg string) string {
+	msg = strings.Map(func(r rune) rune {
+		switch {
+		case isBlankFiller(r):
+			return ' '
+		case isInvisible(r):
+			return -1
+		}
+		return r
+	}, msg)
+	msg = norm.NFKC.String(msg)
+
+	// split to words, i.e. sequences of letters and marks, and fix homoglyphs in each word
+	res := strings.Builder{}
+	res.Grow(len(msg))
+	word := []rune{}
+	for _, r := range msg {
+		if unicode.IsLetter(r) || unicode.IsMark(r) {
+			word = append(word, r)
+			continue
+		}
+		res.WriteString(fixHomoglyphs(word))
+		res.WriteRune(r)
+		word = word[:0]
+	}
+	res.WriteString(fixHomoglyphs(word))
+	return res.String()
+}
+
+// fixHomoglyphs replaces homoglyphs from other scripts by the letters of the dominant script of the word,
+// i.e. latin "o" in a cyrillic word becomes cyrillic "о". If scripts are mixed in equal parts, like in "рa",
+// the word made of homoglyphs only is mapped to its latin skeleton. Words of a single script are not changed,
+// so ordinary words, like cyrillic "сок", never become latin words.
+func fixHomoglyphs(word []rune) string {
+	var counts [4]int
+	for _, r := range word {
+		counts[scriptOf(r)]++
+	}
+	dominant, scripts, tie := scriptOther, 0, false
+	for s := scriptLatin; s <= scriptGreek; s++ {
+		if counts[s] == 0 {
+			continue
+		}
+		scripts++
+		switch {
+		case dominant == scriptOther || counts[s] > counts[dominant]:
+			dominant, tie = s, false
+		case counts[s] == counts[dominant]:
+			tie = true
+		}
+	}
+	if scripts < 2 {
+		return string(word)
+	}
+	if tie {
+		if skel, ok := skeleton(word); ok {
+			return string(skel)
+		}
+	}
+	for i, r := range word {
+		if eq, ok := homoglyphs[r]; ok && eq[dominant] != 0 {
+			word[i] = eq[dominant]
+		}
+	}
+	return string(word)
+}
+
+// skeleton maps the word made of homoglyphs only to latin letters, keeping the case. Letters are looked up
+// in lower case, so the skeleton of a word doesn't depend on its case, i.e. cyrillic "В" is not a homoglyph
+// of latin "B" here, as their lower case forms differ. Returns false for words with any other letter.
+func skeleton(word []rune) ([]rune, bool) {
+	for _, r := range word {
+		if _, ok := homoglyphs[unicode.ToLower(r)]; !ok {
+			return word, false
+		}
+	}
+	for i, r := range word {
+		latin := homoglyphs[unicode.ToLower(r)][scriptLatin]
+		if unicode.IsUpper(r) {
+			latin = unicode.ToUpper(latin)
+		}
+		word[i] = latin
+	}
+	return word, true
+}
+
+// scriptOf returns the script of the letter
+func scriptOf(r rune) script {
+	switch {
+	case unicode.Is(unicode.Latin, r):
+		return scriptLatin
+	case unicode.Is(unicode.Cyrillic, r):
+		return scriptCyrillic
+	case unicode.Is(unicode.Greek, r):
+		return scriptGreek
+	default:
+		return scriptOther
+	}
+}
+
+// isInvisible checks if the rune is a format character (zero-width space, joiners, direction marks, etc.)
+// or other character rendered as nothing, like combining grapheme joiner
+func isInvisible(r rune) bool {
+	switch r {
+	case '\u034f', '\u17b4', '\u17b5':
+		return true
+	}
+	return unicode.Is(unicode.Cf, r)
+}
+
+// isBlankFiller checks if the rune is a letter rendered as an empty space, like hangul filler
+func isBlankFiller(r rune) bool {
+	switch r {
+	case '\u115f', '\u1160', '\u3164', '\uffa0':
+		return true
+	}
+	return false
+}
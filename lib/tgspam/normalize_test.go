@@ -0,0 +1,70 @@
+package tgspam
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "empty", input: "", expected: ""},
+		{name: "plain latin", input: "Hello, world!", expected: "Hello, world!"},
+		{name: "plain cyrillic", input: "Всем привет, ищу людей", expected: "Всем привет, ищу людей"},
+		{name: "mathematical bold", input: "𝐅𝐑𝐄𝐄 money", expected: "FREE money"},
+		{name: "full width", input: "ｆｒｅｅ １００＄", expected: "free 100$"},
+		{name: "zero-width chars", input: "fr\u200bee mo\u200c\u200dney\ufeff", expected: "free money"},
+		{name: "hangul filler", input: "free\u3164money", expected: "free money"},
+		{name: "cyrillic in latin word", input: "frее mоney", expected: "free money"},
+		{name: "latin in cyrillic word", input: "рабoта на дoму", expected: "работа на дому"},
+		{name: "greek in cyrillic word", input: "человеκα для удαленной рαботы", expected: "человека для удаленной работы"},
+		{name: "mixed words kept separately", input: "cash наличные", expected: "cash наличные"},
+		{name: "mixed look-alike of latin word", input: "рay now, PАY", expected: "pay now, PAY"},
+		{name: "equally mixed word of homoglyphs", input: "рa, Рa", expected: "pa, Pa"},
+		{name: "equally mixed word with other letters", input: "дaу", expected: "дау"},
+		{name: "cyrillic word of homoglyphs kept", input: "сухо в доме, курс, СОК", expected: "сухо в доме, курс, СОК"},
+		{name: "greek word of homoglyphs kept", input: "κοχ", expected: "κοχ"},
+		{name: "latin in cyrillic word of homoglyphs", input: "курc", expected: "курс"},
+		{name: "single letter kept", input: "с ним у дома", expected: "с ним у дома"},
+		{name: "emoji preserved", input: "hello 👋 world", expected: "hello 👋 world"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalize(tt.input))
+		})
+	}
+}
+
+func TestDetector_CheckNormalized(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1})
+	_, err := d.LoadStopWords(strings.NewReader("free money\nработа на дому\npay in crypto"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		msg  string
+		spam bool
+	}{
+		{msg: "get 𝐅𝐑𝐄𝐄 𝐌𝐎𝐍𝐄𝐘 now", spam: true},
+		{msg: "get fr\u200bee mоney now", spam: true}, // zero-width space and cyrillic o
+		{msg: "удαленная рабoта на дому", spam: true}, // greek alpha and latin o
+		{msg: "get money for free", spam: false},
+		{msg: "you can рay in crypto", spam: true},  // cyrillic "р" and latin "ay"
+		{msg: "you can рау in crypto", spam: false}, // all letters are cyrillic, a cyrillic word
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			spam, cr := d.Check(spamcheck.Request{Msg: tt.msg})
+			assert.Equal(t, tt.spam, spam, cr)
+		})
+	}
+	assert.Equal(t, "get FREE MONEY now", d.Normalize("get 𝐅𝐑𝐄𝐄 𝐌𝐎𝐍𝐄𝐘 now"))
+}
@@ -0,0 +1,249 @@
+package tgspam
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// minLettersRun is the minimal number of single letters separated by a punctuation, like "m.o.n.e.y",
+// to join them to a word. minSpacedRun is the same for letters separated by spaces, like "m o n e y",
+// longer to skip phrases of real one-letter words, like "а я в".
+const (
+	minLettersRun = 3
+	minSpacedRun  = 4
+)
+
+// oneLetterWords are real words of a single letter, lowercased. Runs of spaced letters with any of them
+// are not joined, as they are likely a part of the ordinary text, like "и я с ним".
+var oneLetterWords = map[rune]bool{'a': true, 'i': true, 'а': true, 'в': true, 'и': true, 'к': true, 'о': true,
+	'с': true, 'у': true, 'я': true, 'і': true, 'ж': true, 'б': true}
+
+// leetLatin and leetCyrillic map leetspeak substitutions to letters, separately for latin and cyrillic words
+var (
+	leetLatin    = map[rune]rune{'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's'}
+	leetCyrillic = map[rune]rune{'0': 'о', '3': 'з', '4': 'ч', '6': 'б', '@': 'а'}
+)
+
+// canonical returns the message in the form used for tokenization and stop-words matching, i.e. normalized,
+// and de-obfuscated if the obfuscation check is enabled with Config.ObfuscationThreshold.
+func (d *Detector) canonical(msg string) string {
+	res := normalize(msg)
+	if d.ObfuscationThreshold <= 0 {
+		return res
+	}
+	res, _, _ = deobfuscate(res)
+	return res
+}
+
+// deobfuscate reverts common tricks used to hide words from the checks:
+//   - runs of single letters, separated by the same punctuation like "m.o.n.e.y", joined to a word, as well as
+//     runs of at least minSpacedRun letters separated by spaces like "m o n e y", without real one-letter words
+//   - leetspeak substitutions in words, like "m0n3y cr1pt0", replaced by letters of the word's script
+//
+// Returns the de-obfuscated message, the number of words in it and the number of de-obfuscated words.
+// The message is expected to be normalized already.
+func deobfuscate(msg string) (res string, words, obfuscated int) {
+	fields := splitFields(msg)
+	out := strings.Builder{}
+	out.Grow(len(msg))
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if f.word == "" {
+			out.WriteString(f.sep)
+			continue
+		}
+		words++
+
+		// join run of single letters separated by spaces, separators inside the run dropped
+		if j := lettersRunEnd(fields, i); j-i >= minSpacedRun {
+			for k := i; k < j; k++ {
+				out.WriteString(fields[k].word)
+			}
+			out.WriteString(fields[j-1].sep)
+			obfuscated++
+			i = j - 1
+			continue
+		}
+
+		word, ok := joinDotted(f.word)
+		if !ok {
+			word, ok = unleet(f.word)
+		}
+		if ok {
+			obfuscated++
+		}
+		out.WriteString(word)
+		out.WriteString(f.sep)
+	}
+	return out.String(), words, obfuscated
+}
+
+// field is a word with the following separator (whitespaces). The first field may have an empty word
+// if the message starts with a separator.
+type field struct {
+	word string
+	sep  string
+}
+
+// splitFields splits the message to words and separators between them
+func splitFields(msg string) []field {
+	res := []field{}
+	start, inWord := 0, true
+	for i, r := range msg {
+		switch {
+		case unicode.IsSpace(r) && inWord:
+			res = append(res, field{word: msg[start:i]})
+			start, inWord = i, false
+		case !unicode.IsSpace(r) && !inWord:
+			res[len(res)-1].sep = msg[start:i]
+			start, inWord = i, true
+		}
+	}
+	if inWord {
+		if start < len(msg) {
+			res = append(res, field{word: msg[start:]})
+		}
+		return res
+	}
+	res[len(res)-1].sep = msg[start:]
+	return res
+}
+
+// lettersRunEnd returns the index after the last field of the run of single letters starting at i.
+// Letters in the run are separated by spaces only, a line break ends the run. The last letter
+// of the run may be followed by a punctuation, like "m o n e y!". A real one-letter word, like "я",
+// can't be a part of the run, so the run is empty if it starts with such a word.
+func lettersRunEnd(fields []field, i int) int {
+	for j := i; j < len(fields); j++ {
+		if j > i && strings.ContainsAny(fields[j-1].sep, "\r\n") {
+			return j
+		}
+		word := fields[j].word
+		if isSingleLetter(word) && !isOneLetterWord(word) {
+			continue
+		}
+		if last := strings.TrimRight(word, ".,!?:;"); j > i && isSingleLetter(last) && !isOneLetterWord(last) {
+			return j + 1
+		}
+		return j
+	}
+	return len(fields)
+}
+
+// joinDotted joins letters separated by a punctuation, like "m.o.n.e.y" or "m-o-n-e-y".
+// Returns false if the word is not in this form.
+func joinDotted(word string) (string, bool) {
+	runes := []rune(word)
+	if len(runes) < minLettersRun*2-1 || len(runes)%2 == 0 {
+		return word, false
+	}
+	sep := runes[1]
+	if !strings.ContainsRune(".-_*·", sep) {
+		return word, false
+	}
+	letters := make([]rune, 0, len(runes)/2+1)
+	for i, r := range runes {
+		if i%2 == 1 {
+			if r != sep {
+				return word, false
+			}
+			continue
+		}
+		if !unicode.IsLetter(r) {
+			return word, false
+		}
+		letters = append(letters, r)
+	}
+	return string(letters), true
+}
+
+// unleet replaces leetspeak substitutions in the word by letters. The word should have at least two letters,
+// and all other runes, except punctuation around the word, should be known substitutions for the word's script.
+// Symbols "@" and "$" are not substituted at the beginning of the word, to keep mentions and prices.
+// Words of mostly digits, and words with digits at the end only, like "win10" or "mp3", are ordinary names
+// with numbers and kept as is. Returns false if the word is not changed.
+func unleet(word string) (string, bool) {
+	core := strings.Trim(word, ".,!?:;()\"'")
+	if core == "" {
+		return word, false
+	}
+	runes := []rune(core)
+	letters, latin, cyrillic := 0, 0, 0
+	for _, r := range runes {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch scriptOf(r) {
+		case scriptLatin:
+			latin++
+		case scriptCyrillic:
+			cyrillic++
+		}
+	}
+	if letters < 2 || letters == len(runes) || letters*2 < len(runes) || isNumberSuffixed(runes) {
+		return word, false
+	}
+	leet := leetLatin
+	if cyrillic > latin {
+		leet = leetCyrillic
+	}
+
+	for i, r := range runes {
+		if unicode.IsLetter(r) {
+			continue
+		}
+		l, ok := leet[r]
+		if !ok || (i == 0 && (r == '@' || r == '$')) {
+			return word, false
+		}
+		runes[i] = l
+	}
+	return strings.Replace(word, core, string(runes), 1), true
+}
+
+// isNumberSuffixed checks if the word is letters followed by digits, like "win10"
+func isNumberSuffixed(runes []rune) bool {
+	i := len(runes)
+	for i > 0 && unicode.IsDigit(runes[i-1]) {
+		i--
+	}
+	if i == len(runes) {
+		return false
+	}
+	for _, r := range runes[:i] {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSingleLetter checks if the word is a single letter
+func isSingleLetter(word string) bool {
+	runes := []rune(word)
+	return len(runes) == 1 && unicode.IsLetter(runes[0])
+}
+
+// isOneLetterWord checks if the word is a real word of a single letter, like "a" or "я"
+func isOneLetterWord(word string) bool {
+	runes := []rune(word)
+	return len(runes) == 1 && oneLetterWords[unicode.ToLower(runes[0])]
+}
+
+// isObfuscated checks the ratio of obfuscated words in the message, see deobfuscate for the kinds of obfuscation.
+// The message is spam if the ratio is greater or equal to Config.ObfuscationThreshold.
+func (d *Detector) isObfuscated(msg string) spamcheck.Response {
+	_, words, obfuscated := deobfuscate(normalize(msg))
+	if obfuscated == 0 {
+		return spamcheck.Response{Name: "obfuscation", Spam: false, Details: "not found"}
+	}
+	ratio := float64(obfuscated) / float64(words)
+	score := math.Min(ratio/d.ObfuscationThreshold, 1) // reaches 1.0 when the threshold reached
+	return spamcheck.Response{Name: "obfuscation", Spam: ratio >= d.ObfuscationThreshold, Score: score,
+		Details: fmt.Sprintf("%d/%d words obfuscated (%.0f%%)", obfuscated, words, ratio*100)}
+}
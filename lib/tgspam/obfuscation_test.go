@@ -0,0 +1,115 @@
+package tgspam
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestDeobfuscate(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		expected   string
+		words      int
+		obfuscated int
+	}{
+		{name: "empty", input: "", expected: "", words: 0, obfuscated: 0},
+		{name: "plain", input: "hello world", expected: "hello world", words: 2, obfuscated: 0},
+		{name: "spaced letters", input: "get m o n e y now", expected: "get money now", words: 3, obfuscated: 1},
+		{name: "spaced letters with punctuation", input: "get m o n e y!", expected: "get money!", words: 2, obfuscated: 1},
+		{name: "spaced cyrillic letters", input: "ищу л ю д е й", expected: "ищу людей", words: 2, obfuscated: 1},
+		{name: "three single letters kept", input: "b c d testing", expected: "b c d testing", words: 4, obfuscated: 0},
+		{name: "one-letter words kept", input: "а я в магазин, и я с ним", expected: "а я в магазин, и я с ним", words: 8},
+		{name: "run with one-letter word kept", input: "m o n e y a b c d", expected: "money a b c d", words: 5, obfuscated: 1},
+		{name: "line break ends run", input: "a b\nc d", expected: "a b\nc d", words: 4, obfuscated: 0},
+		{name: "dotted letters", input: "m.o.n.e.y here", expected: "money here", words: 2, obfuscated: 1},
+		{name: "dashed letters", input: "c-a-s-h", expected: "cash", words: 1, obfuscated: 1},
+		{name: "leetspeak", input: "m0n3y cr1pt0 bonus", expected: "money cripto bonus", words: 3, obfuscated: 2},
+		{name: "numbered names kept", input: "win10 mp3 fr33 4k4", expected: "win10 mp3 fr33 4k4", words: 4, obfuscated: 0},
+		{name: "leetspeak with symbols", input: "easy ca$h, n0w!", expected: "easy cash, now!", words: 3, obfuscated: 2},
+		{name: "cyrillic leetspeak", input: "к се6е в к0манду", expected: "к себе в команду", words: 4, obfuscated: 2},
+		{name: "numbers kept", input: "100 usd, 5G and 2024", expected: "100 usd, 5G and 2024", words: 5, obfuscated: 0},
+		{name: "unknown substitution kept", input: "covid19 h2o", expected: "covid19 h2o", words: 2, obfuscated: 0},
+		{name: "mention and price kept", input: "@user $100 $abc", expected: "@user $100 $abc", words: 3, obfuscated: 0},
+		{name: "leading and trailing spaces", input: "  n0w  ", expected: "  now  ", words: 1, obfuscated: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, words, obfuscated := deobfuscate(tt.input)
+			assert.Equal(t, tt.expected, res)
+			assert.Equal(t, tt.words, words, "words")
+			assert.Equal(t, tt.obfuscated, obfuscated, "obfuscated")
+		})
+	}
+}
+
+func TestDetector_CheckObfuscation(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, ObfuscationThreshold: 0.5})
+
+	tests := []struct {
+		msg     string
+		spam    bool
+		score   float64
+		details string
+	}{
+		{msg: "hello world, how are you", spam: false, score: 0, details: "not found"},
+		{msg: "hello w o r l d, how are you", spam: false, score: 0.4, details: "1/5 words obfuscated (20%)"},
+		{msg: "fr3e m o n e y", spam: true, score: 1, details: "2/2 words obfuscated (100%)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			spam, cr := d.Check(spamcheck.Request{Msg: tt.msg})
+			assert.Equal(t, tt.spam, spam)
+			require.Len(t, cr, 1)
+			assert.Equal(t, "obfuscation", cr[0].Name)
+			assert.Equal(t, tt.spam, cr[0].Spam)
+			assert.InDelta(t, tt.score, cr[0].Score, 0.001)
+			assert.Equal(t, tt.details, cr[0].Details)
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1})
+		spam, cr := d.Check(spamcheck.Request{Msg: "fr3e m o n e y"})
+		assert.False(t, spam)
+		assert.Empty(t, cr)
+		assert.Equal(t, "fr3e m o n e y", d.Normalize("fr3e m o n e y"), "not de-obfuscated")
+	})
+}
+
+func TestDetector_CheckDeobfuscated(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5, ObfuscationThreshold: 1})
+	_, err := d.LoadStopWords(bytes.NewBufferString("free money"))
+	require.NoError(t, err)
+	_, err = d.LoadSamples(strings.NewReader(""),
+		[]io.Reader{strings.NewReader("easy crypto income from home\nwin a free iphone today")},
+		[]io.Reader{strings.NewReader("hello everyone\nwhat time is the meeting")})
+	require.NoError(t, err)
+
+	t.Run("stop word", func(t *testing.T) {
+		spam, cr := d.Check(spamcheck.Request{Msg: "get fr3e m o n e y"})
+		assert.True(t, spam)
+		assert.Equal(t, "stopword", cr[0].Name)
+		assert.True(t, cr[0].Spam)
+	})
+
+	t.Run("similarity and classifier", func(t *testing.T) {
+		spam, cr := d.Check(spamcheck.Request{Msg: "w1n a fr3e 1ph0ne t0day"})
+		assert.True(t, spam)
+		require.Len(t, cr, 4)
+		assert.Equal(t, "similarity", cr[2].Name)
+		assert.True(t, cr[2].Spam, cr[2].Details)
+		assert.Equal(t, "classifier", cr[3].Name)
+		assert.True(t, cr[3].Spam, cr[3].Details)
+	})
+
+	assert.Equal(t, "get free money", d.Normalize("get fr3e m o n e y"))
+}
@@ -2,11 +2,13 @@ package tgspam
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
 	"strings"
+	"time"
 
-	tokenizer "github.com/sandwich-go/gpt3-encoder"
 	"github.com/sashabaranov/go-openai"
 
 	"github.com/umputun/tg-spam/lib/spamcheck"
@@ -14,10 +16,14 @@ import (
 
 //go:generate moq --out mocks/openai_client.go --pkg mocks --skip-ensure . openAIClient:OpenAIClientMock
 
-// openAIChecker is a wrapper for OpenAI API to check if a text is spam
+// openAIChecker asks a language model to check if a text is spam. Named after OpenAI API, it works with any LLMProvider.
 type openAIChecker struct {
-	client openAIClient
-	params OpenAIConfig
+	provider LLMProvider
+	params   OpenAIConfig
+	prompt   *llmPrompt // nil if the message is sent as is
+	cache    *llmCache  // nil if disabled
+	cacheID  string     // hash of the request parameters, prefix of the cache keys
+	limits   *llmLimits
 }
 
 // OpenAIConfig contains parameters for openAIChecker
@@ -29,6 +35,24 @@ type OpenAIConfig struct {
 	MaxSymbolsRequest int // Fallback: Max request length in symbols, if tokenizer was failed
 	Model             string
 	SystemPrompt      string
+	// StructuredOutput asks the provider for a response matching the verdict json schema, if supported.
+	// OpenAI provider uses json mode for it, which requires "json" word in the system prompt.
+	StructuredOutput bool
+
+	// The message can be sent with the context, rendered with PromptTemplate, text/template with LLMPromptData.
+	// The default template is used if empty. The message is sent as is if none of these is set.
+	// The whole rendered prompt is kept within MaxTokensRequest, dropping the examples and the checks if needed.
+	FewShotSamples int    // number of the nearest spam and ham samples added to the prompt as examples, each, ham indexed only if set
+	PromptContext  bool   // add the results of other checks and the user metadata to the prompt
+	PromptTemplate string // template of the prompt, see LLMPromptData
+
+	CacheTTL          time.Duration // TTL of cached responses by message text and request params, no cache if 0
+	CacheSize         int           // max number of cached responses, unlimited if 0
+	RequestsPerMinute int           // rate limit of requests, unlimited if 0
+	DailyTokens       int           // daily budget of input and output tokens, unlimited if 0
+	DailyCost         float64       // daily budget of the cost, by token prices, unlimited if 0
+	InputTokenPrice   float64       // price of 1M input tokens, for the cost budget
+	OutputTokenPrice  float64       // price of 1M output tokens, for the cost budget
 }
 
 type openAIClient interface {
@@ -43,8 +67,8 @@ type openAIResponse struct {
 	Confidence int    `json:"confidence"`
 }
 
-// newOpenAIChecker makes a bot for ChatGPT
-func newOpenAIChecker(client openAIClient, params OpenAIConfig) *openAIChecker {
+// newOpenAIChecker makes a checker for the language model provider
+func newOpenAIChecker(provider LLMProvider, params OpenAIConfig) *openAIChecker {
 	if params.SystemPrompt == "" {
 		params.SystemPrompt = defaultPrompt
 	}
@@ -60,79 +84,136 @@ func newOpenAIChecker(client openAIClient, params OpenAIConfig) *openAIChecker {
 	if params.Model == "" {
 		params.Model = "gpt-4"
 	}
-	return &openAIChecker{client: client, params: params}
+	res := &openAIChecker{provider: provider, params: params, limits: &llmLimits{params: params}}
+	if params.FewShotSamples > 0 || params.PromptContext || params.PromptTemplate != "" {
+		prompt, err := newLLMPrompt(params.PromptTemplate)
+		if err != nil {
+			log.Printf("[WARN] invalid openai prompt template, default used: %v", err)
+			prompt, _ = newLLMPrompt("")
+		}
+		res.prompt = prompt
+	}
+	if params.CacheTTL > 0 {
+		res.cache = newLLMCache(params.CacheTTL, params.CacheSize)
+		res.cacheID = llmParamsHash(params.Model, params.SystemPrompt, params.MaxTokensResponse, params.MaxTokensRequest,
+			params.MaxSymbolsRequest, params.StructuredOutput, params.FewShotSamples, params.PromptContext, params.PromptTemplate)
+	}
+	return res
+}
+
+// cached returns the cached response for the message, if any
+func (o *openAIChecker) cached(msg string) (spamcheck.Response, bool) {
+	if o.cache == nil {
+		return spamcheck.Response{}, false
+	}
+	resp, ok := o.cache.get(o.cacheKey(msg))
+	if !ok {
+		return spamcheck.Response{}, false
+	}
+	o.limits.countCached()
+	resp.Details += " (cached)"
+	return resp, true
 }
 
-// check checks if a text is spam
-func (o *openAIChecker) check(msg string) (spam bool, cr spamcheck.Response) {
-	if o.client == nil {
+// cacheKey returns the key of the response in the cache, the message with the hash of the request parameters
+func (o *openAIChecker) cacheKey(msg string) string {
+	return o.cacheID + "\n" + msg
+}
+
+// check checks if a message is spam, the prompt data is used if the prompt template is set.
+// The request should be reserved by the limits, the reservation is released if the request is not sent.
+func (o *openAIChecker) check(ctx context.Context, data LLMPromptData) (spam bool, cr spamcheck.Response) {
+	if o.provider == nil {
+		o.limits.release()
 		return false, spamcheck.Response{}
 	}
 
-	resp, err := o.sendRequest(msg)
+	resp, err := o.sendRequest(ctx, data)
 	if err != nil {
 		return false, spamcheck.Response{Spam: false, Name: "openai", Details: fmt.Sprintf("OpenAI error: %v", err)}
 	}
-	return resp.IsSpam, spamcheck.Response{Spam: resp.IsSpam, Name: "openai",
+	score := 0.0
+	if resp.IsSpam {
+		score = float64(resp.Confidence) / 100
+	}
+	cr = spamcheck.Response{Spam: resp.IsSpam, Name: "openai", Score: score,
 		Details: strings.TrimSuffix(resp.Reason, ".") + ", confidence: " + fmt.Sprintf("%d%%", resp.Confidence)}
+	if o.cache != nil {
+		o.cache.put(o.cacheKey(data.Message), cr)
+	}
+	return resp.IsSpam, cr
 }
 
-func (o *openAIChecker) sendRequest(msg string) (response openAIResponse, err error) {
-	// Reduce the request size with tokenizer and fallback to default reducer if it fails
+func (o *openAIChecker) sendRequest(ctx context.Context, data LLMPromptData) (openAIResponse, error) {
+	// Reduce the request size with tokenizer and fallback to symbols if it fails
 	// The API supports 4097 tokens ~16000 characters (<=4 per token) for request + result together
 	// The response is limited to 1000 tokens and OpenAI always reserved it for the result
 	// So the max length of the request should be 3000 tokens or ~12000 characters
-	reduceRequest := func(text string) (result string) {
-		// defaultReducer is a fallback if tokenizer fails
-		defaultReducer := func(text string) (result string) {
-			if len(text) <= o.params.MaxSymbolsRequest {
-				return text
-			}
-			return text[:o.params.MaxSymbolsRequest]
+	budget := newRequestBudget(o.params.MaxTokensRequest, o.params.MaxSymbolsRequest)
+	msg := budget.reduce(data.Message, 0)
+	if o.prompt != nil {
+		text, err := o.prompt.build(data, budget)
+		if err != nil {
+			log.Printf("[WARN] failed to build openai prompt, message sent as is: %v", err)
+		} else {
+			msg = text
 		}
+	}
 
-		encoder, tokErr := tokenizer.NewEncoder()
-		if tokErr != nil {
-			return defaultReducer(text)
-		}
+	req := LLMRequest{Model: o.params.Model, SystemPrompt: o.params.SystemPrompt, Message: msg,
+		MaxTokens: o.params.MaxTokensResponse}
+	if o.params.StructuredOutput {
+		req.Schema = llmVerdictSchema()
+	}
+	resp, err := o.provider.Complete(ctx, req)
+	o.limits.record(resp) // failed request counted as well, with tokens unknown
+	if err != nil {
+		return openAIResponse{}, err
+	}
+	return parseLLMVerdict(resp.Content)
+}
 
-		tokens, encErr := encoder.Encode(text)
-		if encErr != nil {
-			return defaultReducer(text)
-		}
+// OpenAIProvider is LLMProvider for OpenAI chat completions API and compatible servers
+type OpenAIProvider struct {
+	client openAIClient
+}
 
-		if len(tokens) <= o.params.MaxTokensRequest {
-			return text
-		}
+// NewOpenAIProvider makes a provider with the client, usually *openai.Client
+func NewOpenAIProvider(client openAIClient) *OpenAIProvider {
+	return &OpenAIProvider{client: client}
+}
 
-		return encoder.Decode(tokens[:o.params.MaxTokensRequest])
+// Complete sends the system prompt and the message to chat completions API, and returns the first choice.
+// The image, if any, is sent with the message as a data url.
+// With the schema in the request, json mode is used, as the closest structured output mode supported by the client.
+// The schema itself is not sent, and the api rejects requests without "json" word in the system prompt.
+func (p *OpenAIProvider) Complete(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	creq := openai.ChatCompletionRequest{Model: req.Model, MaxTokens: req.MaxTokens, Messages: []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: req.SystemPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: req.Message},
+	}}
+	if req.Image != nil {
+		dataURL := "data:" + req.Image.MimeType + ";base64," + base64.StdEncoding.EncodeToString(req.Image.Data)
+		creq.Messages[1] = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: req.Message},
+			{Type: openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{URL: dataURL, Detail: openai.ImageURLDetail(req.Image.Detail)}},
+		}}
 	}
-
-	r := reduceRequest(msg)
-
-	data := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: o.params.SystemPrompt},
-		{Role: openai.ChatMessageRoleUser, Content: r},
+	if req.Schema != nil {
+		creq.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
 	}
 
-	resp, err := o.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{Model: o.params.Model, MaxTokens: o.params.MaxTokensResponse, Messages: data},
-	)
-
+	resp, err := p.client.CreateChatCompletion(ctx, creq)
 	if err != nil {
-		return openAIResponse{}, err
+		return LLMResponse{}, err
 	}
 
 	// OpenAI platform supports returning multiple chat completion choices, but we use only the first one:
 	// https://platform.openai.com/docs/api-reference/chat/create#chat/create-n
 	if len(resp.Choices) == 0 {
-		return openAIResponse{}, fmt.Errorf("no choices in response")
+		return LLMResponse{}, errors.New("no choices in response")
 	}
-
-	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &response); err != nil {
-		return openAIResponse{}, fmt.Errorf("can't unmarshal response: %w", err)
-	}
-
-	return response, nil
+	return LLMResponse{Content: resp.Choices[0].Message.Content, InputTokens: resp.Usage.PromptTokens,
+		OutputTokens: resp.Usage.CompletionTokens}, nil
 }
@@ -6,7 +6,9 @@ import (
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/umputun/tg-spam/lib/spamcheck"
 	"github.com/umputun/tg-spam/lib/tgspam/mocks"
 )
 
@@ -23,7 +25,7 @@ func TestOpenAIChecker_Check(t *testing.T) {
 		},
 	}
 
-	checker := newOpenAIChecker(clientMock, OpenAIConfig{
+	checker := newOpenAIChecker(NewOpenAIProvider(clientMock), OpenAIConfig{
 		MaxTokensResponse: 300,
 		MaxTokensRequest:  3000,
 		MaxSymbolsRequest: 12000,
@@ -39,7 +41,7 @@ func TestOpenAIChecker_Check(t *testing.T) {
 				}},
 			}, nil
 		}
-		spam, details := checker.check("some text")
+		spam, details := checker.check(context.Background(), LLMPromptData{Message: "some text"})
 		t.Logf("spam: %v, details: %+v", spam, details)
 		assert.True(t, spam)
 		assert.Equal(t, "openai", details.Name)
@@ -55,7 +57,7 @@ func TestOpenAIChecker_Check(t *testing.T) {
 				}},
 			}, nil
 		}
-		spam, details := checker.check("some text")
+		spam, details := checker.check(context.Background(), LLMPromptData{Message: "some text"})
 		t.Logf("spam: %v, details: %+v", spam, details)
 		assert.False(t, spam)
 		assert.Equal(t, "openai", details.Name)
@@ -67,7 +69,7 @@ func TestOpenAIChecker_Check(t *testing.T) {
 			contextMoqParam context.Context, chatCompletionRequest openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
 			return openai.ChatCompletionResponse{}, assert.AnError
 		}
-		spam, details := checker.check("some text")
+		spam, details := checker.check(context.Background(), LLMPromptData{Message: "some text"})
 		t.Logf("spam: %v, details: %+v", spam, details)
 		assert.False(t, spam)
 		assert.Equal(t, "openai", details.Name)
@@ -83,7 +85,7 @@ func TestOpenAIChecker_Check(t *testing.T) {
 				}},
 			}, nil
 		}
-		spam, details := checker.check("some text")
+		spam, details := checker.check(context.Background(), LLMPromptData{Message: "some text"})
 		t.Logf("spam: %v, details: %+v", spam, details)
 		assert.False(t, spam)
 		assert.Equal(t, "openai", details.Name)
@@ -95,10 +97,68 @@ func TestOpenAIChecker_Check(t *testing.T) {
 			contextMoqParam context.Context, chatCompletionRequest openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
 			return openai.ChatCompletionResponse{}, nil
 		}
-		spam, details := checker.check("some text")
+		spam, details := checker.check(context.Background(), LLMPromptData{Message: "some text"})
 		t.Logf("spam: %v, details: %+v", spam, details)
 		assert.False(t, spam)
 		assert.Equal(t, "openai", details.Name)
 		assert.Equal(t, "OpenAI error: no choices in response", details.Details)
 	})
 }
+
+func TestOpenAIProvider_Complete(t *testing.T) {
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "{\"spam\": true}"}}},
+				Usage:   openai.Usage{PromptTokens: 30, CompletionTokens: 10, TotalTokens: 40},
+			}, nil
+		},
+	}
+	p := NewOpenAIProvider(clientMock)
+
+	resp, err := p.Complete(context.Background(), LLMRequest{Model: "gpt-4o", SystemPrompt: "prompt", Message: "msg", MaxTokens: 50})
+	require.NoError(t, err)
+	assert.Equal(t, LLMResponse{Content: "{\"spam\": true}", InputTokens: 30, OutputTokens: 10}, resp)
+	require.Len(t, clientMock.CreateChatCompletionCalls(), 1)
+	req := clientMock.CreateChatCompletionCalls()[0].ChatCompletionRequest
+	assert.Equal(t, "gpt-4o", req.Model)
+	assert.Equal(t, 50, req.MaxTokens)
+	assert.Equal(t, []openai.ChatCompletionMessage{{Role: "system", Content: "prompt"}, {Role: "user", Content: "msg"}}, req.Messages)
+	assert.Nil(t, req.ResponseFormat)
+
+	_, err = p.Complete(context.Background(), LLMRequest{Model: "gpt-4o", Message: "msg", Schema: llmVerdictSchema()})
+	require.NoError(t, err)
+	require.Len(t, clientMock.CreateChatCompletionCalls(), 2)
+	assert.Equal(t, &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+		clientMock.CreateChatCompletionCalls()[1].ChatCompletionRequest.ResponseFormat, "json mode for structured output")
+
+	_, err = p.Complete(context.Background(), LLMRequest{Model: "gpt-4o", SystemPrompt: "prompt", Message: "msg",
+		Image: &LLMImage{Data: []byte("image data"), MimeType: "image/jpeg", Detail: "low"}})
+	require.NoError(t, err)
+	require.Len(t, clientMock.CreateChatCompletionCalls(), 3)
+	assert.Equal(t, []openai.ChatCompletionMessage{{Role: "system", Content: "prompt"}, {Role: "user", MultiContent: []openai.ChatMessagePart{
+		{Type: openai.ChatMessagePartTypeText, Text: "msg"},
+		{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/jpeg;base64,aW1hZ2UgZGF0YQ==",
+			Detail: openai.ImageURLDetailLow}},
+	}}}, clientMock.CreateChatCompletionCalls()[2].ChatCompletionRequest.Messages, "image sent as data url")
+}
+
+func TestOpenAIChecker_CheckStructuredAndFenced(t *testing.T) {
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{
+				Content: "```json\n{\"spam\": true, \"reason\":\"bad text\", \"confidence\":75}\n```"}}}}, nil
+		},
+	}
+	checker := newOpenAIChecker(NewOpenAIProvider(clientMock), OpenAIConfig{Model: "some-model", StructuredOutput: true})
+	spam, details := checker.check(context.Background(), LLMPromptData{Message: "some text"})
+	assert.True(t, spam)
+	assert.Equal(t, spamcheck.Response{Name: "openai", Spam: true, Score: 0.75, Details: "bad text, confidence: 75%"}, details)
+	require.Len(t, clientMock.CreateChatCompletionCalls(), 1)
+	req := clientMock.CreateChatCompletionCalls()[0].ChatCompletionRequest
+	assert.Equal(t, "some-model", req.Model)
+	assert.Equal(t, 1024, req.MaxTokens)
+	assert.Equal(t, []openai.ChatCompletionMessage{{Role: "system", Content: defaultPrompt}, {Role: "user", Content: "some text"}},
+		req.Messages)
+	assert.NotNil(t, req.ResponseFormat, "json mode for structured output")
+}
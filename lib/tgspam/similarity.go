@@ -0,0 +1,283 @@
+package tgspam
+
+import (
+	"maps"
+	"math"
+	"sort"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// spamIndex is an inverted index of tokenized spam samples, used to find the sample most similar to a message
+// without comparing the message with every sample. Also used for ham samples, to find the nearest examples for
+// openai prompt. Not thread-safe, protected by the detector's lock.
+type spamIndex struct {
+	samples  []map[string]int       // tokenized samples, position in the slice is the sample id
+	refs     []spamcheck.Sample     // original samples with the source, by sample id
+	postings map[string]map[int]int // token to ids of samples with the token and the token frequency in the sample
+}
+
+// newSpamIndex makes an empty index
+func newSpamIndex() *spamIndex {
+	return &spamIndex{samples: []map[string]int{}, refs: []spamcheck.Sample{}, postings: map[string]map[int]int{}}
+}
+
+// size returns the number of samples in the index
+func (x *spamIndex) size() int { return len(x.samples) }
+
+// add adds tokenized sample to the index, with the original sample reported as the nearest one
+func (x *spamIndex) add(sample map[string]int, ref spamcheck.Sample) {
+	id := len(x.samples)
+	x.samples = append(x.samples, sample)
+	x.refs = append(x.refs, ref)
+	for token, freq := range sample {
+		if x.postings[token] == nil {
+			x.postings[token] = map[int]int{}
+		}
+		x.postings[token][id] = freq
+	}
+}
+
+// remove removes a single sample equal to the given one, dynamic sample preferred if there are several.
+// The last sample takes the id of the removed one, so the cost is proportional to the size of those two samples
+// and not to the number of samples. Returns false if there is no such sample.
+func (x *spamIndex) remove(sample map[string]int) bool {
+	id := x.find(sample)
+	if id < 0 {
+		return false
+	}
+	for token := range x.samples[id] {
+		x.unpost(token, id)
+	}
+
+	last := len(x.samples) - 1
+	if id != last {
+		moved := x.samples[last]
+		for token, freq := range moved {
+			delete(x.postings[token], last)
+			x.postings[token][id] = freq
+		}
+		x.samples[id] = moved
+		x.refs[id] = x.refs[last]
+	}
+	x.samples[last] = nil
+	x.samples = x.samples[:last]
+	x.refs = x.refs[:last]
+	return true
+}
+
+// find returns the id of a sample equal to the given one, -1 if not found. If there are several equal samples,
+// a dynamic one is returned. Only samples sharing a token with the given one are compared.
+func (x *spamIndex) find(sample map[string]int) int {
+	res := -1
+	check := func(id int) bool {
+		if !maps.Equal(sample, x.samples[id]) {
+			return false
+		}
+		if res < 0 || x.refs[id].Dynamic {
+			res = id
+		}
+		return x.refs[res].Dynamic // stop on the first dynamic sample
+	}
+
+	if len(sample) == 0 {
+		for id := range x.samples {
+			if check(id) {
+				break
+			}
+		}
+		return res
+	}
+	for token := range sample {
+		for id := range x.postings[token] {
+			if check(id) {
+				break
+			}
+		}
+		break // equal sample must have all the tokens, checking postings of one token is enough
+	}
+	return res
+}
+
+// unpost removes sample id from the postings of the token
+func (x *spamIndex) unpost(token string, id int) {
+	delete(x.postings[token], id)
+	if len(x.postings[token]) == 0 {
+		delete(x.postings, token)
+	}
+}
+
+// nearest returns the id of the sample most similar to the message by cosine similarity, and the similarity.
+// Similarity function is a cosine similarity with token frequencies multiplied by the token weight, i.e. 1
+// for raw frequencies or IDF for TF-IDF. Returns -1 and 0 if no sample shares a token with the message.
+//
+// Only samples sharing a token with the message can be similar, those are found by the message tokens postings,
+// from the rarest tokens to the most common ones. By Cauchy-Schwarz inequality, the similarity of a sample having
+// none of the tokens checked so far can't exceed the norm of the remaining message tokens divided by the message norm.
+// The search stops once this bound is not greater than the best similarity found, so the common tokens with long
+// postings are usually not scanned at all. The result is exact, the same as comparing with every sample.
+func (x *spamIndex) nearest(msg map[string]int, weight func(token string) float64,
+	similarity func(a, b map[string]int) float64) (id int, best float64) {
+	tokens, bounds := x.matchedTokens(msg, weight)
+	id = -1
+	seen := map[int]bool{}
+	for k, t := range tokens {
+		if id >= 0 && bounds[k] <= best {
+			break // no unseen sample can be more similar than the best one
+		}
+		for sid := range t.postings {
+			if seen[sid] {
+				continue
+			}
+			seen[sid] = true
+			if sim := similarity(msg, x.samples[sid]); sim > best || id < 0 {
+				id, best = sid, sim
+			}
+		}
+	}
+	return id, best
+}
+
+// nearestK returns ids of up to k samples most similar to the message by cosine similarity, the most similar first,
+// samples with equal similarity by id. Samples with equal text are returned once. The search is pruned by the same
+// bound as in nearest, it stops once the bound is less than the similarity of the k-th sample found.
+func (x *spamIndex) nearestK(msg map[string]int, k int, weight func(token string) float64,
+	similarity func(a, b map[string]int) float64) []int {
+	type candidate struct {
+		id  int
+		sim float64
+	}
+	if k <= 0 {
+		return []int{}
+	}
+	less := func(a, b candidate) bool { return a.sim > b.sim || a.sim == b.sim && a.id < b.id }
+
+	tokens, bounds := x.matchedTokens(msg, weight)
+	top := make([]candidate, 0, k+1) // the best candidates with distinct texts, sorted
+	seen := map[int]bool{}
+	for i, t := range tokens {
+		if len(top) == k && bounds[i] < top[k-1].sim {
+			break // no unseen sample can be in the top
+		}
+		for id := range t.postings {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			c := candidate{id: id, sim: similarity(msg, x.samples[id])}
+			dup := -1
+			for j, tc := range top {
+				if x.refs[tc.id].Text == x.refs[id].Text {
+					dup = j
+					break
+				}
+			}
+			switch {
+			case dup >= 0 && less(c, top[dup]):
+				top[dup] = c
+			case dup >= 0:
+				continue
+			default:
+				top = append(top, c)
+			}
+			sort.Slice(top, func(a, b int) bool { return less(top[a], top[b]) })
+			if len(top) > k {
+				top = top[:k]
+			}
+		}
+	}
+
+	res := make([]int, 0, len(top))
+	for _, c := range top {
+		res = append(res, c.id)
+	}
+	return res
+}
+
+// matchedTokens returns the message tokens found in the index with their postings, from the rarest tokens to the most
+// common ones, and the bound of similarity of a sample having none of the previous tokens, for each token.
+func (x *spamIndex) matchedTokens(msg map[string]int, weight func(token string) float64) (tokens []indexToken, bounds []float64) {
+	normSq := 0.0
+	for token, freq := range msg {
+		w := float64(freq) * weight(token)
+		normSq += w * w
+		if p, ok := x.postings[token]; ok {
+			tokens = append(tokens, indexToken{token: token, weighted: w, postings: p})
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if len(tokens[i].postings) != len(tokens[j].postings) {
+			return len(tokens[i].postings) < len(tokens[j].postings)
+		}
+		return tokens[i].token < tokens[j].token // stable order for the same input
+	})
+
+	// the bound is the norm of the remaining tokens, from k to the end, divided by the message norm
+	bounds = make([]float64, len(tokens))
+	suffixSq := 0.0
+	for k := len(tokens) - 1; k >= 0; k-- {
+		suffixSq += tokens[k].weighted * tokens[k].weighted
+		bounds[k] = math.Sqrt(suffixSq) / math.Sqrt(normSq)
+	}
+	return tokens, bounds
+}
+
+// indexToken is a message token found in the index
+type indexToken struct {
+	token    string
+	weighted float64 // token frequency multiplied by the token weight
+	postings map[int]int
+}
+
+// similarity calculates the similarity of tokenized message and sample, with raw frequencies or with TF-IDF
+// weights, if Config.SimilarityTFIDF is set
+func (d *Detector) similarity(a, b map[string]int) float64 {
+	if !d.SimilarityTFIDF {
+		return d.cosineSimilarity(a, b)
+	}
+	return weightedCosineSimilarity(a, b, d.idf)
+}
+
+// tokenWeight returns the weight of the token for similarity, IDF if Config.SimilarityTFIDF is set, 1 otherwise
+func (d *Detector) tokenWeight(token string) float64 {
+	if !d.SimilarityTFIDF {
+		return 1
+	}
+	return d.idf(token)
+}
+
+// idf returns the inverse document frequency of the token in all the spam and ham samples, with smoothing.
+// Common tokens have low IDF, close to 1, while rare tokens have high IDF. Document frequencies are taken from
+// the classifier, so IDF is always up to date with loaded, updated and removed samples.
+func (d *Detector) idf(token string) float64 {
+	df := 0
+	for _, n := range d.classifier.learningResults[token] {
+		df += n
+	}
+	return math.Log(float64(1+d.classifier.nAllDocument)/float64(1+df)) + 1
+}
+
+// weightedCosineSimilarity calculates the cosine similarity between two token frequency maps,
+// with frequencies multiplied by the weight of the token.
+func weightedCosineSimilarity(a, b map[string]int, weight func(token string) float64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0.0
+	}
+
+	dotProduct, normA, normB := 0.0, 0.0, 0.0
+	for token, freq := range a {
+		w := weight(token)
+		wa := float64(freq) * w
+		dotProduct += wa * float64(b[token]) * w
+		normA += wa * wa
+	}
+	for token, freq := range b {
+		wb := float64(freq) * weight(token)
+		normB += wb * wb
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0.0
+	}
+	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,269 @@
+package tgspam
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam/mocks"
+)
+
+func TestSpamIndex_NearestK(t *testing.T) {
+	d := NewDetector(Config{})
+	x := newSpamIndex()
+	for _, s := range []string{"win free iphone now", "free crypto prize", "win free iphone now", "win a prize",
+		"hello world"} {
+		x.add(d.tokenize(s), spamcheck.Sample{Text: s})
+	}
+
+	texts := func(ids []int) []string {
+		res := []string{}
+		for _, id := range ids {
+			res = append(res, x.refs[id].Text)
+		}
+		return res
+	}
+	msg := d.tokenize("win free iphone prize")
+	assert.Equal(t, []string{"win free iphone now", "win a prize", "free crypto prize"},
+		texts(x.nearestK(msg, 3, d.tokenWeight, d.cosineSimilarity)), "most similar first, duplicates skipped")
+	assert.Equal(t, []string{"win free iphone now"}, texts(x.nearestK(msg, 1, d.tokenWeight, d.cosineSimilarity)))
+	assert.Empty(t, x.nearestK(d.tokenize("something else"), 3, d.tokenWeight, d.cosineSimilarity), "no shared tokens")
+}
+
+func TestSpamIndex_AddRemove(t *testing.T) {
+	x := newSpamIndex()
+	x.add(map[string]int{"win": 1, "free": 1, "iphone": 1}, spamcheck.Sample{Text: "win free iphone"})
+	x.add(map[string]int{"free": 2, "money": 1}, spamcheck.Sample{Text: "free free money"})
+	x.add(map[string]int{}, spamcheck.Sample{Text: "a"})
+	x.add(map[string]int{"lottery": 1, "prize": 1}, spamcheck.Sample{Text: "lottery prize"})
+	assert.Equal(t, 4, x.size())
+	assert.Equal(t, map[int]int{0: 1, 1: 2}, x.postings["free"])
+
+	assert.False(t, x.remove(map[string]int{"free": 1, "money": 1}), "frequencies differ")
+	assert.False(t, x.remove(map[string]int{"unknown": 1}))
+
+	require.True(t, x.remove(map[string]int{"win": 1, "free": 1, "iphone": 1}))
+	assert.Equal(t, 3, x.size())
+	assert.Equal(t, map[string]int{"lottery": 1, "prize": 1}, x.samples[0], "last sample moved to the removed one")
+	assert.Equal(t, spamcheck.Sample{Text: "lottery prize"}, x.refs[0], "ref of the last sample moved too")
+	assert.Equal(t, map[int]int{1: 2}, x.postings["free"])
+	assert.Equal(t, map[int]int{0: 1}, x.postings["lottery"])
+	assert.NotContains(t, x.postings, "win")
+
+	require.True(t, x.remove(map[string]int{}))
+	require.True(t, x.remove(map[string]int{"free": 2, "money": 1}))
+	require.True(t, x.remove(map[string]int{"lottery": 1, "prize": 1}))
+	assert.Equal(t, 0, x.size())
+	assert.Empty(t, x.postings)
+	assert.Empty(t, x.refs)
+
+	t.Run("dynamic sample preferred", func(t *testing.T) {
+		x := newSpamIndex()
+		x.add(map[string]int{"free": 1, "money": 1}, spamcheck.Sample{Text: "free money", Source: "static.txt"})
+		x.add(map[string]int{"free": 1, "money": 1}, spamcheck.Sample{Text: "Free Money", Source: "dynamic.txt", Dynamic: true})
+		x.add(map[string]int{"free": 1, "money": 1}, spamcheck.Sample{Text: "free money!", Source: "static.txt"})
+		require.True(t, x.remove(map[string]int{"free": 1, "money": 1}))
+		assert.Equal(t, []spamcheck.Sample{{Text: "free money", Source: "static.txt"},
+			{Text: "free money!", Source: "static.txt"}}, x.refs)
+	})
+}
+
+func TestSpamIndex_Nearest(t *testing.T) {
+	d := NewDetector(Config{})
+	x := newSpamIndex()
+	x.add(map[string]int{"win": 1, "free": 1, "iphone": 1}, spamcheck.Sample{Text: "win free iphone"})
+	x.add(map[string]int{"lottery": 1, "prize": 1}, spamcheck.Sample{Text: "lottery prize"})
+
+	id, sim := x.nearest(map[string]int{"free": 1, "lottery": 1, "prize": 1}, d.tokenWeight, d.similarity)
+	assert.Equal(t, 1, id)
+	assert.InDelta(t, 0.816, sim, 0.001)
+
+	id, sim = x.nearest(map[string]int{"hello": 1, "world": 1}, d.tokenWeight, d.similarity)
+	assert.Equal(t, -1, id)
+	assert.InDelta(t, 0, sim, 0.0001)
+
+	id, sim = x.nearest(map[string]int{}, d.tokenWeight, d.similarity)
+	assert.Equal(t, -1, id)
+	assert.InDelta(t, 0, sim, 0.0001)
+}
+
+func TestSpamIndex_NearestSameAsFullScan(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42)) //nolint:gosec // no need for secure random in tests
+	// zipf distribution makes some tokens common and most of them rare, like in real texts
+	zipf := rand.NewZipf(rnd, 1.2, 1, 5000)
+	randomSample := func() map[string]int {
+		res := map[string]int{}
+		for i := 0; i < 3+rnd.Intn(20); i++ {
+			res[fmt.Sprintf("t%d", zipf.Uint64())]++
+		}
+		return res
+	}
+
+	x := newSpamIndex()
+	for i := 0; i < 10000; i++ {
+		x.add(randomSample(), spamcheck.Sample{Text: strconv.Itoa(i)})
+	}
+	// remove some samples to make sure the index is consistent after removal
+	for i := 0; i < 500; i++ {
+		require.True(t, x.remove(x.samples[rnd.Intn(x.size())]))
+	}
+
+	weights := map[string]func(token string) float64{
+		"raw":      func(string) float64 { return 1 },
+		"weighted": func(token string) float64 { return 1 + float64(len(token)%4) },
+	}
+	for name, weight := range weights {
+		t.Run(name, func(t *testing.T) {
+			similarity := func(a, b map[string]int) float64 { return weightedCosineSimilarity(a, b, weight) }
+			compared, comparedK, candidates := 0, 0, 0
+			counted := func(a, b map[string]int) float64 {
+				compared++
+				return similarity(a, b)
+			}
+			countedK := func(a, b map[string]int) float64 {
+				comparedK++
+				return similarity(a, b)
+			}
+			for i := 0; i < 100; i++ {
+				msg := randomSample()
+				if i%2 == 0 {
+					msg = x.samples[rnd.Intn(x.size())] // exact match
+				}
+				expected := 0.0
+				sims := []float64{}
+				for _, s := range x.samples {
+					sim := similarity(msg, s)
+					if sim > expected {
+						expected = sim
+					}
+					if sim > 0 {
+						sims = append(sims, sim)
+					}
+				}
+				id, sim := x.nearest(msg, weight, counted)
+				assert.InDelta(t, expected, sim, 1e-9)
+				if id >= 0 {
+					assert.InDelta(t, sim, similarity(msg, x.samples[id]), 1e-9)
+				}
+
+				candidates += len(sims)
+				sort.Sort(sort.Reverse(sort.Float64Slice(sims)))
+				ids := x.nearestK(msg, 3, weight, countedK)
+				require.Len(t, ids, min(3, len(sims)))
+				for j, id := range ids {
+					assert.InDelta(t, sims[j], similarity(msg, x.samples[id]), 1e-9)
+				}
+			}
+			t.Logf("compared %d samples per message, out of %d, %d for 3 nearest out of %d sharing a token", compared/100,
+				x.size(), comparedK/100, candidates/100)
+			assert.Less(t, compared/100, x.size()/4, "most of samples should be skipped")
+			assert.Less(t, comparedK, candidates/2, "most of samples sharing a token should be skipped for 3 nearest")
+		})
+	}
+}
+
+func TestDetector_CheckSimilarityTFIDF(t *testing.T) {
+	// "hello everyone" is common for spam and ham, so it shouldn't make the message similar to spam
+	spamSamples := "hello everyone, earn money online today\nhello everyone, free crypto signals"
+	hamSamples := "hello everyone, the meeting is at noon\nhello everyone, thanks for the help\nhello everyone, see you tomorrow"
+	msg := spamcheck.Request{Msg: "hello everyone, the new release is out"}
+
+	check := func(cfg Config) spamcheck.Response {
+		d := NewDetector(cfg)
+		_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(spamSamples)},
+			[]io.Reader{strings.NewReader(hamSamples)})
+		require.NoError(t, err)
+		d.SetCheckEnabled("classifier", false)
+		_, cr := d.Check(msg)
+		require.Len(t, cr, 1)
+		return cr[0]
+	}
+
+	raw := check(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.35})
+	assert.True(t, raw.Spam, "common words make the message similar with raw frequencies, %s", raw.Details)
+
+	tfidf := check(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.35, SimilarityTFIDF: true})
+	assert.False(t, tfidf.Spam, "common words have low weight with TF-IDF, %s", tfidf.Details)
+	assert.Less(t, tfidf.Score, raw.Score)
+
+	t.Run("idf updated with samples", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.35, SimilarityTFIDF: true})
+		d.WithHamUpdater(&mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }})
+		_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(spamSamples)},
+			[]io.Reader{strings.NewReader(hamSamples)})
+		require.NoError(t, err)
+		before := d.idf("release")
+		require.NoError(t, d.UpdateHam("the new release is ready"))
+		assert.Less(t, d.idf("release"), before)
+		require.NoError(t, d.RemoveHam("the new release is ready"))
+		assert.InDelta(t, before, d.idf("release"), 1e-9)
+	})
+}
+
+func TestDetector_CheckSimilarityNearestSample(t *testing.T) {
+	tmpDir := t.TempDir()
+	staticFile, dynamicFile := filepath.Join(tmpDir, "spam-samples.txt"), filepath.Join(tmpDir, "spam-dynamic.txt")
+	require.NoError(t, os.WriteFile(staticFile, []byte("win a free iphone today\nlottery prize is waiting for you\n"), 0o600))
+	require.NoError(t, os.WriteFile(dynamicFile, []byte("earn money online fast\n"), 0o600))
+
+	d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+	d.WithSpamUpdater(&namedUpdater{name: dynamicFile, SampleUpdaterMock: &mocks.SampleUpdaterMock{
+		AppendFunc: func(msg string) error { return nil },
+	}})
+	sfh, err := os.Open(staticFile)
+	require.NoError(t, err)
+	defer sfh.Close()
+	dfh, err := os.Open(dynamicFile)
+	require.NoError(t, err)
+	defer dfh.Close()
+	_, err = d.LoadSamples(strings.NewReader(""), []io.Reader{sfh, dfh, strings.NewReader("crypto signals channel")},
+		[]io.Reader{strings.NewReader("hello world")})
+	require.NoError(t, err)
+	d.SetCheckEnabled("classifier", false)
+
+	check := func(msg string) spamcheck.Response {
+		_, cr := d.Check(spamcheck.Request{Msg: msg})
+		require.Len(t, cr, 1)
+		require.Equal(t, "similarity", cr[0].Name)
+		return cr[0]
+	}
+
+	resp := check("win a free iphone")
+	assert.True(t, resp.Spam)
+	assert.Equal(t, &spamcheck.Sample{Text: "win a free iphone today", Source: "spam-samples.txt"}, resp.Sample)
+
+	resp = check("earn money online")
+	assert.True(t, resp.Spam)
+	assert.Equal(t, &spamcheck.Sample{Text: "earn money online fast", Source: "spam-dynamic.txt", Dynamic: true}, resp.Sample)
+
+	resp = check("join crypto signals channel")
+	assert.True(t, resp.Spam)
+	assert.Equal(t, &spamcheck.Sample{Text: "crypto signals channel"}, resp.Sample, "reader without name")
+
+	resp = check("hello, how are you doing")
+	assert.False(t, resp.Spam)
+	assert.Nil(t, resp.Sample, "no sample reported for ham")
+
+	require.NoError(t, d.UpdateSpam("cheap pills delivery"))
+	resp = check("cheap pills delivery")
+	assert.True(t, resp.Spam)
+	assert.Equal(t, &spamcheck.Sample{Text: "cheap pills delivery", Source: "spam-dynamic.txt", Dynamic: true}, resp.Sample)
+}
+
+// namedUpdater is a sample updater with a file name, like the updater of a dynamic samples file
+type namedUpdater struct {
+	*mocks.SampleUpdaterMock
+	name string
+}
+
+func (u *namedUpdater) Name() string { return u.name }
@@ -0,0 +1,168 @@
+package tgspam
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// snapshotVersion is the version of snapshot format. Should be incremented on any change of the format,
+// or the training (tokenization, classifier) logic, to invalidate snapshots made by the previous versions.
+const snapshotVersion = 7
+
+// snapshot is a trained state of the detector, saved to Config.SnapshotFile and restored by LoadSamples
+// if the sample inputs are not changed.
+type snapshot struct {
+	Version        int
+	Hash           string // hash of the samples inputs
+	LoadResult     LoadResult
+	ExcludedTokens []string
+	TokenizedSpam  []map[string]int
+	SpamSamples    []spamcheck.Sample // original spam samples with the sources, by index of tokenized ones
+	TokenizedHam   []map[string]int
+	HamSamples     []spamcheck.Sample // original ham samples, by index of tokenized ones
+
+	// classifier state, prior probabilities are not saved as they are calculated from the document counts
+	LearningResults   map[string]map[spamClass]int
+	NDocumentByClass  map[spamClass]int
+	NFrequencyByClass map[spamClass]int
+	NAllDocument      int
+}
+
+// samplesHash calculates the hash of the samples inputs: tokenization used for training, excluded tokens,
+// spam samples with their sources and ham samples. Each input is hashed with its length, so the content moved
+// between inputs changes the hash.
+func samplesHash(tokenization string, excl []byte, spam, ham [][]byte, spamSources []spamcheck.Sample) string {
+	h := sha256.New()
+	write := func(section string, data []byte) {
+		_ = binary.Write(h, binary.LittleEndian, int64(len(data)))
+		h.Write([]byte(section))
+		h.Write(data)
+	}
+	_ = binary.Write(h, binary.LittleEndian, int64(snapshotVersion))
+	write("tokenization", []byte(tokenization))
+	write("excl", excl)
+	for i, s := range spam {
+		write("spam", s)
+		write("source", []byte(spamSources[i].Source+":"+strconv.FormatBool(spamSources[i].Dynamic)))
+	}
+	for _, s := range ham {
+		write("ham", s)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readAll reads all the readers to memory
+func readAll(readers ...io.Reader) ([][]byte, error) {
+	res := make([][]byte, 0, len(readers))
+	for _, r := range readers {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, data)
+	}
+	return res, nil
+}
+
+// saveSnapshot writes the current trained state to Config.SnapshotFile, atomically.
+// Should be called under the lock.
+func (d *Detector) saveSnapshot(hash string, lr LoadResult) error {
+	snap := snapshot{
+		Version:           snapshotVersion,
+		Hash:              hash,
+		LoadResult:        lr,
+		ExcludedTokens:    d.excludedTokens,
+		TokenizedSpam:     d.spamIndex.samples,
+		SpamSamples:       d.spamIndex.refs,
+		TokenizedHam:      d.hamIndex.samples,
+		HamSamples:        d.hamIndex.refs,
+		LearningResults:   d.classifier.learningResults,
+		NDocumentByClass:  d.classifier.nDocumentByClass,
+		NFrequencyByClass: d.classifier.nFrequencyByClass,
+		NAllDocument:      d.classifier.nAllDocument,
+	}
+
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(snap); err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(d.SnapshotFile), filepath.Base(d.SnapshotFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name()) // no-op after successful rename
+
+	if _, err := tmpFile.Write(buf.Bytes()); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot temp file: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), d.SnapshotFile); err != nil {
+		return fmt.Errorf("failed to rename snapshot temp file: %w", err)
+	}
+	return nil
+}
+
+// restoreSnapshot restores the trained state from Config.SnapshotFile if the snapshot is made by the same version
+// and for the same samples inputs. Returns the load result of the snapshot and false if not restored.
+// Should be called under the lock.
+func (d *Detector) restoreSnapshot(hash string) (LoadResult, bool, error) {
+	fh, err := os.Open(d.SnapshotFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return LoadResult{}, false, nil
+		}
+		return LoadResult{}, false, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer fh.Close()
+
+	var snap snapshot
+	if err := gob.NewDecoder(fh).Decode(&snap); err != nil {
+		return LoadResult{}, false, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion || snap.Hash != hash {
+		return LoadResult{}, false, nil
+	}
+
+	// gob decodes empty slices and maps as nil, keep the state initialized as after reset
+	d.excludedTokens = []string{}
+	d.excludedTokens = append(d.excludedTokens, snap.ExcludedTokens...)
+	restoreIndex := func(tokenized []map[string]int, refs []spamcheck.Sample) *spamIndex {
+		res := newSpamIndex()
+		for i, s := range tokenized {
+			if s == nil {
+				s = map[string]int{}
+			}
+			ref := spamcheck.Sample{}
+			if i < len(refs) {
+				ref = refs[i]
+			}
+			res.add(s, ref)
+		}
+		return res
+	}
+	d.spamIndex = restoreIndex(snap.TokenizedSpam, snap.SpamSamples)
+	d.hamIndex = restoreIndex(snap.TokenizedHam, snap.HamSamples)
+	d.classifier.reset()
+	if snap.NAllDocument > 0 {
+		d.classifier.learningResults = snap.LearningResults
+		d.classifier.nDocumentByClass = snap.NDocumentByClass
+		d.classifier.nFrequencyByClass = snap.NFrequencyByClass
+		d.classifier.nAllDocument = snap.NAllDocument
+		d.classifier.updatePriors()
+	}
+	return snap.LoadResult, true, nil
+}
@@ -0,0 +1,116 @@
+package tgspam
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestDetector_LoadSamplesWithSnapshot(t *testing.T) {
+	snapFile := filepath.Join(t.TempDir(), "classifier.snapshot")
+	load := func(d *Detector, spam, ham string) LoadResult {
+		lr, err := d.LoadSamples(strings.NewReader("xyz"), []io.Reader{strings.NewReader(spam)},
+			[]io.Reader{strings.NewReader(ham)})
+		require.NoError(t, err)
+		return lr
+	}
+	spamSamples, hamSamples := "win free iPhone\nlottery prize xyz", "hello world\nhow are you\nhave a good day"
+	msg := spamcheck.Request{Msg: "free lottery prize"}
+
+	// train without snapshot to get the reference results
+	ref := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+	refLr := load(ref, spamSamples, hamSamples)
+	refSpam, refCr := ref.Check(msg)
+
+	// the first load trains and saves the snapshot
+	d1 := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5, SnapshotFile: snapFile})
+	assert.Equal(t, refLr, load(d1, spamSamples, hamSamples))
+	st, err := os.Stat(snapFile)
+	require.NoError(t, err)
+	assert.Positive(t, st.Size())
+
+	// mark the snapshot with a different load result to make sure it is restored and not retrained
+	hash := samplesHash("words", []byte("xyz"), [][]byte{[]byte(spamSamples)}, [][]byte{[]byte(hamSamples)},
+		[]spamcheck.Sample{{}})
+	require.NoError(t, d1.saveSnapshot(hash, LoadResult{SpamSamples: 42}))
+
+	// the second load restores from the snapshot, no samples are trained, and the results are the same
+	d2 := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5, SnapshotFile: snapFile})
+	lr, err := d2.LoadSamples(strings.NewReader("xyz"), []io.Reader{strings.NewReader(spamSamples)},
+		[]io.Reader{strings.NewReader(hamSamples)})
+	require.NoError(t, err)
+	assert.Equal(t, LoadResult{SpamSamples: 42}, lr, "restored from snapshot")
+	assert.Equal(t, ref.spamIndex.samples, d2.spamIndex.samples)
+	assert.Equal(t, ref.spamIndex.refs, d2.spamIndex.refs)
+	assert.Equal(t, ref.hamIndex.samples, d2.hamIndex.samples)
+	assert.Equal(t, ref.hamIndex.refs, d2.hamIndex.refs)
+	assert.Equal(t, ref.excludedTokens, d2.excludedTokens)
+	assert.Equal(t, ref.classifier, d2.classifier)
+	spam, cr := d2.Check(msg)
+	assert.Equal(t, refSpam, spam)
+	assert.Equal(t, refCr, cr)
+
+	// changed samples ignore the snapshot and update it
+	mtime := st.ModTime()
+	lr = load(d2, spamSamples+"\nnew spam sample", hamSamples)
+	assert.Equal(t, 3, lr.SpamSamples)
+	assert.Len(t, d2.spamIndex.samples, 3)
+	st, err = os.Stat(snapFile)
+	require.NoError(t, err)
+	assert.True(t, !st.ModTime().Before(mtime))
+
+	d3 := NewDetector(Config{MaxAllowedEmoji: -1, SnapshotFile: snapFile})
+	lr = load(d3, spamSamples+"\nnew spam sample", hamSamples)
+	assert.Equal(t, 3, lr.SpamSamples)
+	assert.Equal(t, d2.classifier, d3.classifier)
+
+	t.Run("broken snapshot ignored", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(snapFile, []byte("bad data"), 0o600))
+		d := NewDetector(Config{MaxAllowedEmoji: -1, SnapshotFile: snapFile})
+		assert.Equal(t, refLr, load(d, spamSamples, hamSamples))
+		assert.Equal(t, ref.classifier, d.classifier)
+	})
+
+	t.Run("empty samples", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, SnapshotFile: snapFile})
+		load(d, "", "")
+		d = NewDetector(Config{MaxAllowedEmoji: -1, SnapshotFile: snapFile})
+		assert.Equal(t, LoadResult{ExcludedTokens: 1}, load(d, "", ""))
+		assert.Equal(t, newClassifier(), d.classifier)
+		assert.Empty(t, d.spamIndex.samples)
+		require.NoError(t, d.UpdateHam("hello")) // no updater, but must not panic on restored state
+		d.classifier.learn(newDocument("ham", "hello"))
+	})
+
+	t.Run("few-shot examples ignore snapshot without ham samples", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, SnapshotFile: snapFile})
+		load(d, spamSamples, hamSamples)
+		assert.Empty(t, d.hamIndex.samples)
+
+		d = NewDetector(Config{MaxAllowedEmoji: -1, SnapshotFile: snapFile})
+		d.WithOpenAIChecker(nil, OpenAIConfig{FewShotSamples: 2})
+		load(d, spamSamples, hamSamples)
+		assert.Len(t, d.hamIndex.samples, 3, "retrained with ham samples")
+	})
+}
+
+func TestSamplesHash(t *testing.T) {
+	src1, src2 := []spamcheck.Sample{{}}, []spamcheck.Sample{{}, {}}
+	spam := [][]byte{[]byte("spam1"), []byte("spam2")}
+	h1 := samplesHash("words", []byte("excl"), spam, [][]byte{[]byte("ham")}, src2)
+	assert.Len(t, h1, 64)
+	assert.Equal(t, h1, samplesHash("words", []byte("excl"), spam, [][]byte{[]byte("ham")}, src2))
+	assert.NotEqual(t, h1, samplesHash("words", []byte("excl"), [][]byte{[]byte("spam1spam2")}, [][]byte{[]byte("ham")}, src1))
+	assert.NotEqual(t, h1, samplesHash("words", []byte("excl"), spam, [][]byte{[]byte("ham2")}, src2))
+	assert.NotEqual(t, h1, samplesHash("words", []byte("excl"), [][]byte{[]byte("spam1")}, [][]byte{[]byte("spam2"), []byte("ham")}, src1))
+	assert.NotEqual(t, h1, samplesHash("char-ngrams:3", []byte("excl"), spam, [][]byte{[]byte("ham")}, src2))
+	assert.NotEqual(t, h1, samplesHash("words", []byte("excl"), spam, [][]byte{[]byte("ham")},
+		[]spamcheck.Sample{{Source: "spam.txt"}, {Source: "spam-dynamic.txt", Dynamic: true}}))
+}
@@ -0,0 +1,67 @@
+package tgspam
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// prefixes of stop-word rules, a line without prefix is a plain phrase matched as a substring
+const (
+	stopWordRegexPrefix = "re:"   // regular expression, case-insensitive
+	stopWordWholePrefix = "word:" // whole word or phrase, not a part of another word
+	stopWordGlobPrefix  = "glob:" // glob pattern of whole words, "*" matches any part of a word, "?" - a single letter
+)
+
+// word boundaries for patterns, unicode-aware, unlike \b in regexp matching ascii word boundaries only
+const (
+	wordStart = `(?:^|[^\p{L}\p{N}_])`
+	wordEnd   = `(?:$|[^\p{L}\p{N}_])`
+)
+
+// stopPattern is a stop-word rule compiled to a regular expression
+type stopPattern struct {
+	rule string // original rule, reported in the check details
+	re   *regexp.Regexp
+	raw  bool // match the lowercased message as is too, for re: rules not converted to canonical form
+}
+
+// parseStopWord parses a stop-word line. Returns the plain phrase in canonical lowercased form, or the compiled
+// pattern for re:, word: and glob: rules. Regular expressions are kept as typed, and matched against both the message
+// as is and its canonical form. Returns error for invalid patterns.
+func (d *Detector) parseStopWord(line string) (phrase string, pattern *stopPattern, err error) {
+	switch {
+	case strings.HasPrefix(line, stopWordRegexPrefix):
+		re, err := regexp.Compile("(?i)" + strings.TrimPrefix(line, stopWordRegexPrefix))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid stop-word %q: %w", line, err)
+		}
+		return "", &stopPattern{rule: line, re: re, raw: true}, nil
+
+	case strings.HasPrefix(line, stopWordWholePrefix):
+		words := strings.Fields(strings.ToLower(d.canonical(strings.TrimPrefix(line, stopWordWholePrefix))))
+		if len(words) == 0 {
+			return "", nil, fmt.Errorf("invalid stop-word %q: empty phrase", line)
+		}
+		for i, w := range words {
+			words[i] = regexp.QuoteMeta(w)
+		}
+		re := regexp.MustCompile(wordStart + strings.Join(words, `\s+`) + wordEnd)
+		return "", &stopPattern{rule: line, re: re}, nil
+
+	case strings.HasPrefix(line, stopWordGlobPrefix):
+		words := strings.Fields(strings.ToLower(d.canonical(strings.TrimPrefix(line, stopWordGlobPrefix))))
+		if len(words) == 0 {
+			return "", nil, fmt.Errorf("invalid stop-word %q: empty pattern", line)
+		}
+		for i, w := range words {
+			w = regexp.QuoteMeta(w)
+			w = strings.ReplaceAll(w, `\*`, `[^\s]*`)
+			w = strings.ReplaceAll(w, `\?`, `[^\s]`)
+			words[i] = w
+		}
+		re := regexp.MustCompile(wordStart + strings.Join(words, `\s+`) + wordEnd)
+		return "", &stopPattern{rule: line, re: re}, nil
+	}
+	return strings.ToLower(d.canonical(line)), nil, nil
+}
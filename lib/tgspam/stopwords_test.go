@@ -0,0 +1,102 @@
+package tgspam
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestParseStopWord(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		phrase  string
+		pattern string
+		wantErr bool
+	}{
+		{name: "plain phrase", line: "Всем Привет", phrase: "всем привет"},
+		{name: "plain phrase with homoglyphs", line: "в личкy", phrase: "в личку"}, // latin y
+		{name: "regex", line: `re:\d+\s*usdt`, pattern: `(?i)\d+\s*usdt`},
+		{name: "whole word", line: "word:Class", pattern: wordStart + `class` + wordEnd},
+		{name: "whole phrase", line: "word:work  from home", pattern: wordStart + `work\s+from\s+home` + wordEnd},
+		{name: "whole word with meta chars", line: "word:c++", pattern: wordStart + `c\+\+` + wordEnd},
+		{name: "glob", line: "glob:earn* $?00", pattern: wordStart + `earn[^\s]*\s+\$[^\s]00` + wordEnd},
+		{name: "invalid regex", line: "re:(abc", wantErr: true},
+		{name: "empty whole word", line: "word:  ", wantErr: true},
+		{name: "empty glob", line: "glob:", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phrase, pattern, err := NewDetector(Config{}).parseStopWord(tt.line)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.line)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.phrase, phrase)
+			if tt.pattern == "" {
+				assert.Nil(t, pattern)
+				return
+			}
+			require.NotNil(t, pattern)
+			assert.Equal(t, tt.line, pattern.rule)
+			assert.Equal(t, tt.pattern, pattern.re.String())
+		})
+	}
+}
+
+func TestDetector_CheckStopWordPatterns(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, ObfuscationThreshold: 1}) // threshold enables de-obfuscation
+	d.SetCheckEnabled("obfuscation", false)
+	lr, err := d.LoadStopWords(bytes.NewBufferString("в личку\nre:\\d+\\s*usdt\nword:class\nglob:earn* fast\nre:(broken\n" +
+		"re:курс\\s*\\d+"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, lr.StopWords)
+	require.Len(t, lr.InvalidStopWords, 1)
+	assert.Contains(t, lr.InvalidStopWords[0], `"re:(broken"`)
+
+	tests := []struct {
+		name     string
+		message  string
+		expected bool
+		details  string
+	}{
+		{name: "plain phrase", message: "пишите в личку", expected: true, details: "в личку"},
+		{name: "regex", message: "get 100 USDT today", expected: true, details: `re:\d+\s*usdt`},
+		{name: "regex no match", message: "get USDT today", expected: false, details: "not found"},
+		{name: "regex cyrillic", message: "Лучший КУРС 95 рублей", expected: true, details: `re:курс\s*\d+`},
+		{name: "whole word", message: "join our Class today", expected: true, details: "word:class"},
+		{name: "whole word with punctuation", message: "first class!", expected: true, details: "word:class"},
+		{name: "whole word inside another word", message: "a classic car", expected: false, details: "not found"},
+		{name: "whole word obfuscated", message: "join c.l.a.s.s now", expected: true, details: "word:class"},
+		{name: "glob", message: "Earning FAST is easy", expected: true, details: "glob:earn* fast"},
+		{name: "glob no match", message: "learn fast", expected: false, details: "not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spam, cr := d.Check(spamcheck.Request{Msg: tt.message})
+			assert.Equal(t, tt.expected, spam)
+			require.Len(t, cr, 1)
+			assert.Equal(t, "stopword", cr[0].Name)
+			assert.Equal(t, tt.details, cr[0].Details)
+		})
+	}
+
+	t.Run("patterns only", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1})
+		lr, err := d.LoadStopWords(bytes.NewBufferString("word:class"))
+		require.NoError(t, err)
+		assert.Equal(t, LoadResult{StopWords: 1}, lr)
+		spam, cr := d.Check(spamcheck.Request{Msg: "first class"})
+		assert.True(t, spam)
+		require.Len(t, cr, 1)
+		assert.Equal(t, "word:class", cr[0].Details)
+	})
+}
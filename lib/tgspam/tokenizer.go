@@ -0,0 +1,78 @@
+package tgspam
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenization strategies, see Config.Tokenization
+const (
+	TokenizeWords       = "words"        // words, the default
+	TokenizeCharNgrams  = "char-ngrams"  // character n-grams of words, for languages without spaces and misspelled words
+	TokenizeWordBigrams = "word-bigrams" // pairs of adjacent words, to take the word order into account
+)
+
+// defaultNgramSize is the size of character n-grams if Config.NgramSize is not set
+const defaultNgramSize = 3
+
+// tokenizationID returns the tokenization strategy with its parameters, used to invalidate the snapshot
+// made with a different tokenization. De-obfuscation, enabled with the obfuscation check, changes tokens as well.
+func (d *Detector) tokenizationID() string {
+	res := TokenizeWords
+	switch d.Tokenization {
+	case TokenizeCharNgrams:
+		res = fmt.Sprintf("%s:%d", TokenizeCharNgrams, d.ngramSize())
+	case TokenizeWordBigrams:
+		res = TokenizeWordBigrams
+	}
+	if d.ObfuscationThreshold > 0 {
+		res += "+deobfuscated"
+	}
+	return res
+}
+
+// ngramSize returns the size of character n-grams, default if not set
+func (d *Detector) ngramSize() int {
+	if d.NgramSize <= 0 {
+		return defaultNgramSize
+	}
+	return d.NgramSize
+}
+
+// wordTokens returns the frequencies of the words
+func wordTokens(words []string) map[string]int {
+	res := make(map[string]int)
+	for _, w := range words {
+		res[w]++
+	}
+	return res
+}
+
+// charNgrams returns the frequencies of character n-grams of each word. Words not longer than n are used as is.
+func charNgrams(words []string, n int) map[string]int {
+	res := make(map[string]int)
+	for _, w := range words {
+		runes := []rune(w)
+		if len(runes) <= n {
+			res[w]++
+			continue
+		}
+		for i := 0; i+n <= len(runes); i++ {
+			res[string(runes[i:i+n])]++
+		}
+	}
+	return res
+}
+
+// wordBigrams returns the frequencies of pairs of adjacent words. A single word is used as is.
+func wordBigrams(words []string) map[string]int {
+	res := make(map[string]int)
+	if len(words) == 1 {
+		res[words[0]]++
+		return res
+	}
+	for i := 0; i+1 < len(words); i++ {
+		res[strings.Join(words[i:i+2], " ")]++
+	}
+	return res
+}
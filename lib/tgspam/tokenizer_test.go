@@ -0,0 +1,102 @@
+package tgspam
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestDetector_tokenizeStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		input    string
+		expected map[string]int
+	}{
+		{name: "words default", config: Config{}, input: "Hello world, hello the",
+			expected: map[string]int{"hello": 2, "world": 1}},
+		{name: "words", config: Config{Tokenization: TokenizeWords}, input: "hello world",
+			expected: map[string]int{"hello": 1, "world": 1}},
+		{name: "char ngrams", config: Config{Tokenization: TokenizeCharNgrams}, input: "hello the world",
+			expected: map[string]int{"hel": 1, "ell": 1, "llo": 1, "wor": 1, "orl": 1, "rld": 1}},
+		{name: "char ngrams, size 4", config: Config{Tokenization: TokenizeCharNgrams, NgramSize: 4}, input: "hello abc",
+			expected: map[string]int{"hell": 1, "ello": 1, "abc": 1}},
+		{name: "char ngrams, no spaces", config: Config{Tokenization: TokenizeCharNgrams, NgramSize: 2}, input: "免费赚钱",
+			expected: map[string]int{"免费": 1, "费赚": 1, "赚钱": 1}},
+		{name: "word bigrams", config: Config{Tokenization: TokenizeWordBigrams}, input: "free money for the free money",
+			expected: map[string]int{"free money": 2, "money for": 1, "for free": 1}},
+		{name: "word bigrams, single word", config: Config{Tokenization: TokenizeWordBigrams}, input: "hello",
+			expected: map[string]int{"hello": 1}},
+		{name: "word bigrams, empty", config: Config{Tokenization: TokenizeWordBigrams}, input: "",
+			expected: map[string]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(tt.config)
+			d.excludedTokens = []string{"the"}
+			assert.Equal(t, tt.expected, d.tokenize(tt.input))
+		})
+	}
+}
+
+func TestDetector_tokenizationID(t *testing.T) {
+	assert.Equal(t, "words", NewDetector(Config{}).tokenizationID())
+	assert.Equal(t, "words", NewDetector(Config{Tokenization: "unknown"}).tokenizationID())
+	assert.Equal(t, "char-ngrams:3", NewDetector(Config{Tokenization: TokenizeCharNgrams}).tokenizationID())
+	assert.Equal(t, "char-ngrams:5", NewDetector(Config{Tokenization: TokenizeCharNgrams, NgramSize: 5}).tokenizationID())
+	assert.Equal(t, "word-bigrams", NewDetector(Config{Tokenization: TokenizeWordBigrams, NgramSize: 5}).tokenizationID())
+	assert.Equal(t, "words+deobfuscated", NewDetector(Config{ObfuscationThreshold: 0.5}).tokenizationID())
+}
+
+func TestDetector_CheckWithCharNgrams(t *testing.T) {
+	spamSamples := "earn money from home with crypto investments\nguaranteed income from cryptocurrency trading"
+	hamSamples := "hello everyone, what time is the meeting\nthanks for the help with the project"
+	msg := spamcheck.Request{Msg: "earrn mony frm home with crypt0 investmnts"} // misspelled spam sample
+
+	check := func(cfg Config) (bool, []spamcheck.Response) {
+		d := NewDetector(cfg)
+		_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(spamSamples)},
+			[]io.Reader{strings.NewReader(hamSamples)})
+		require.NoError(t, err)
+		return d.Check(msg)
+	}
+
+	_, cr := check(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+	require.Len(t, cr, 2)
+	assert.Equal(t, "similarity", cr[0].Name)
+	assert.False(t, cr[0].Spam, "misspelled words are not similar as words")
+
+	spam, cr := check(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5, Tokenization: TokenizeCharNgrams})
+	require.Len(t, cr, 2)
+	assert.True(t, spam)
+	assert.Equal(t, "similarity", cr[0].Name)
+	assert.True(t, cr[0].Spam, "misspelled words are similar as n-grams, %s", cr[0].Details)
+	assert.Equal(t, "classifier", cr[1].Name)
+	assert.True(t, cr[1].Spam, cr[1].Details)
+}
+
+func TestDetector_LoadSamplesWithSnapshotTokenization(t *testing.T) {
+	snapFile := filepath.Join(t.TempDir(), "classifier.snapshot")
+	load := func(d *Detector) {
+		_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader("win free iphone")},
+			[]io.Reader{strings.NewReader("hello world")})
+		require.NoError(t, err)
+	}
+
+	d := NewDetector(Config{SnapshotFile: snapFile})
+	load(d)
+	assert.Contains(t, d.spamIndex.samples[0], "iphone")
+
+	// snapshot made with words tokenization is not used for n-grams
+	d = NewDetector(Config{SnapshotFile: snapFile, Tokenization: TokenizeCharNgrams})
+	load(d)
+	assert.NotContains(t, d.spamIndex.samples[0], "iphone")
+	assert.Contains(t, d.spamIndex.samples[0], "iph")
+}
@@ -0,0 +1,248 @@
+package tgspam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// TuneGrid is a set of values of detector parameters to try. The current value from the detector config
+// is used for a parameter without values.
+type TuneGrid struct {
+	SimilarityThreshold []float64 `json:"similarity_threshold,omitempty"`
+	MinSpamProbability  []float64 `json:"min_spam_probability,omitempty"`
+	MaxAllowedEmoji     []int     `json:"max_allowed_emoji,omitempty"`
+	MinMsgLen           []int     `json:"min_msg_len,omitempty"`
+}
+
+// DefaultTuneGrid returns a grid of reasonable values for all the tuned parameters.
+func DefaultTuneGrid() TuneGrid {
+	return TuneGrid{
+		SimilarityThreshold: []float64{0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9},
+		MinSpamProbability:  []float64{50, 60, 70, 80, 90, 95},
+		MaxAllowedEmoji:     []int{-1, 1, 2, 3, 5},
+		MinMsgLen:           []int{0, 10, 25, 50, 100},
+	}
+}
+
+// WithDefaults returns the grid with the values of DefaultTuneGrid for parameters without values.
+func (g TuneGrid) WithDefaults() TuneGrid {
+	def := DefaultTuneGrid()
+	if len(g.SimilarityThreshold) == 0 {
+		g.SimilarityThreshold = def.SimilarityThreshold
+	}
+	if len(g.MinSpamProbability) == 0 {
+		g.MinSpamProbability = def.MinSpamProbability
+	}
+	if len(g.MaxAllowedEmoji) == 0 {
+		g.MaxAllowedEmoji = def.MaxAllowedEmoji
+	}
+	if len(g.MinMsgLen) == 0 {
+		g.MinMsgLen = def.MinMsgLen
+	}
+	return g
+}
+
+// TunePoint is a combination of parameter values with the evaluation result for it.
+type TunePoint struct {
+	SimilarityThreshold float64 `json:"similarity_threshold"`
+	MinSpamProbability  float64 `json:"min_spam_probability"`
+	MaxAllowedEmoji     int     `json:"max_allowed_emoji"`
+	MinMsgLen           int     `json:"min_msg_len"`
+
+	Confusion
+	FalsePositiveRate float64 `json:"fpr"` // share of ham detected as spam
+	FalseNegativeRate float64 `json:"fnr"` // share of spam detected as ham
+}
+
+// String returns the parameter values and the main metrics of the point.
+func (p TunePoint) String() string {
+	return fmt.Sprintf("similarity: %.2f, probability: %.0f, emoji: %d, msg len: %d, fpr: %.3f, fnr: %.3f, f1: %.3f",
+		p.SimilarityThreshold, p.MinSpamProbability, p.MaxAllowedEmoji, p.MinMsgLen, p.FalsePositiveRate,
+		p.FalseNegativeRate, p.F1())
+}
+
+// TuneReport is a result of parameters tuning.
+type TuneReport struct {
+	Evaluated   int         `json:"evaluated"`   // number of evaluated combinations
+	Front       []TunePoint `json:"front"`       // pareto front by false-positive and false-negative rates, by FPR
+	Recommended TunePoint   `json:"recommended"` // point of the front with the best F1
+}
+
+// tuneFeatures is a labeled message with results of all the checks not affected by the tuned parameters
+// and raw values for the checks affected by them
+type tuneFeatures struct {
+	spam    bool
+	req     spamcheck.Request             // request of the message, for the ready checks
+	fixed   map[string]spamcheck.Response // results of checks by name
+	simID   int                           // nearest spam sample, for similarity check
+	sim     float64                       // similarity to the nearest spam sample
+	class   spamClass                     // for classifier check
+	prob    float64
+	certain bool
+	emojis  int // for emoji check
+}
+
+// Tune sweeps SimilarityThreshold, MinSpamProbability, MaxAllowedEmoji and MinMsgLen over the grid, and evaluates
+// the detector with each combination on the labeled messages. Returns the pareto front of combinations, i.e. ones
+// not beaten by any other combination in both false-positive and false-negative rates, and the recommended one
+// with the best F1. Of combinations with the same results, the first one in the grid order is reported.
+//
+// Each message is checked once, and the verdicts for the combinations are made from the results of the checks,
+// so tuning is cheap even for a large grid. OpenAI check is not used, as its result depends on the other checks.
+// Messages are checked with a synthetic user id, so checks based on user id, like CAS, should be disabled by
+// the caller. The detector is locked during the tuning, and its config is not changed.
+func Tune(ctx context.Context, d *Detector, msgs []LabeledMessage, grid TuneGrid) (TuneReport, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	spamCount := 0
+	for _, m := range msgs {
+		if m.Spam {
+			spamCount++
+		}
+	}
+	if spamCount == 0 || spamCount == len(msgs) {
+		return TuneReport{}, errors.New("both spam and ham messages required for tuning")
+	}
+
+	origConfig := d.Config
+	defer func() { d.Config = origConfig }()
+
+	features := make([]tuneFeatures, 0, len(msgs))
+	for i, m := range msgs {
+		if err := ctx.Err(); err != nil {
+			return TuneReport{}, err
+		}
+		features = append(features, d.tuneFeatures(ctx, m, fmt.Sprintf("tune-%d", i)))
+	}
+
+	valuesOrCurrent := func(vals []float64, current float64) []float64 {
+		if len(vals) == 0 {
+			return []float64{current}
+		}
+		return vals
+	}
+	intValuesOrCurrent := func(vals []int, current int) []int {
+		if len(vals) == 0 {
+			return []int{current}
+		}
+		return vals
+	}
+
+	points := []TunePoint{}
+	for _, simThreshold := range valuesOrCurrent(grid.SimilarityThreshold, origConfig.SimilarityThreshold) {
+		for _, minProb := range valuesOrCurrent(grid.MinSpamProbability, origConfig.MinSpamProbability) {
+			for _, maxEmoji := range intValuesOrCurrent(grid.MaxAllowedEmoji, origConfig.MaxAllowedEmoji) {
+				for _, minLen := range intValuesOrCurrent(grid.MinMsgLen, origConfig.MinMsgLen) {
+					if err := ctx.Err(); err != nil {
+						return TuneReport{}, err
+					}
+					d.SimilarityThreshold, d.MinSpamProbability, d.MaxAllowedEmoji, d.MinMsgLen = simThreshold, minProb, maxEmoji, minLen
+					p := TunePoint{SimilarityThreshold: simThreshold, MinSpamProbability: minProb,
+						MaxAllowedEmoji: maxEmoji, MinMsgLen: minLen}
+					for _, f := range features {
+						p.add(f.spam, d.tuneVerdict(f))
+					}
+					p.FalsePositiveRate = float64(p.FP) / float64(p.FP+p.TN)
+					p.FalseNegativeRate = float64(p.FN) / float64(p.FN+p.TP)
+					points = append(points, p)
+				}
+			}
+		}
+	}
+
+	front := paretoFront(points)
+	res := TuneReport{Evaluated: len(points), Front: front, Recommended: front[0]}
+	for _, p := range front[1:] {
+		if p.F1() > res.Recommended.F1() {
+			res.Recommended = p
+		}
+	}
+	return res, nil
+}
+
+// tuneFeatures checks the message with all the checks not affected by the tuned parameters, and collects raw values
+// for the checks affected by them. Should be called under the lock.
+func (d *Detector) tuneFeatures(ctx context.Context, m LabeledMessage, userID string) tuneFeatures {
+	req := spamcheck.Request{Msg: m.Msg, UserID: userID}
+	res := tuneFeatures{spam: m.Spam, req: req, fixed: map[string]spamcheck.Response{}, simID: -1}
+	for _, c := range d.checkers {
+		if d.disabledChecks[c.Name()] {
+			continue
+		}
+		switch c.Name() {
+		case "similarity":
+			if d.spamIndex.size() > 0 {
+				res.simID, res.sim = d.spamIndex.nearest(d.tokenize(m.Msg), d.tokenWeight, d.similarity)
+			}
+		case "classifier":
+			if d.classifier.nAllDocument > 0 {
+				tm := d.tokenize(m.Msg)
+				tokens := make([]string, 0, len(tm))
+				for token := range tm {
+					tokens = append(tokens, token)
+				}
+				res.class, res.prob, res.certain = d.classifier.classify(tokens...)
+			}
+		case "emoji":
+			res.emojis = countEmoji(m.Msg)
+		default:
+			if c.ready != nil && !c.ready(req) {
+				continue
+			}
+			resp := d.runCheck(ctx, c.Name(), func(ctx context.Context) spamcheck.Response { return c.Check(ctx, req) })
+			res.fixed[c.Name()] = withDefaultScore(resp)
+		}
+	}
+	return res
+}
+
+// tuneVerdict makes the verdict for the message features with the current config, the same way as CheckCtx
+func (d *Detector) tuneVerdict(f tuneFeatures) bool {
+	active, tooShort := d.activeCheckers(f.req)
+	cr := make([]spamcheck.Response, 0, len(active)+1)
+	for _, c := range active {
+		switch c.Name() {
+		case "similarity":
+			cr = append(cr, withDefaultScore(d.similarityResponse(f.simID, f.sim)))
+		case "classifier":
+			cr = append(cr, withDefaultScore(d.classifierResponse(f.class, f.prob, f.certain)))
+		case "emoji":
+			cr = append(cr, withDefaultScore(d.emojiResponse(f.emojis)))
+		default:
+			if resp, ok := f.fixed[c.Name()]; ok {
+				cr = append(cr, resp)
+			}
+		}
+	}
+	if tooShort {
+		cr = append(cr, spamcheck.Response{Name: "message length", Spam: false, Details: "too short"})
+	}
+	spam, _ := d.verdict(cr)
+	return spam
+}
+
+// paretoFront returns points not dominated by other points in both false positives and false negatives,
+// ordered by false positives. Of points with the same counts, the first one is kept.
+func paretoFront(points []TunePoint) []TunePoint {
+	sorted := make([]TunePoint, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].FP != sorted[j].FP {
+			return sorted[i].FP < sorted[j].FP
+		}
+		return sorted[i].FN < sorted[j].FN
+	})
+
+	res := []TunePoint{}
+	for _, p := range sorted {
+		if len(res) == 0 || p.FN < res[len(res)-1].FN {
+			res = append(res, p)
+		}
+	}
+	return res
+}
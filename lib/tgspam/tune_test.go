@@ -0,0 +1,141 @@
+package tgspam
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTune(t *testing.T) {
+	newDetector := func(cfg Config) *Detector {
+		d := NewDetector(cfg)
+		_, err := d.LoadStopWords(strings.NewReader("в личку\nword:usdt"))
+		require.NoError(t, err)
+		spam := "win free iphone now\nlottery prize win today\nfree crypto prize here\nearn money fast online 💰💰💰"
+		ham := "hello world and everyone\nhow are you doing today\nhave a good day friends\nsee you tomorrow at work 👍"
+		_, err = d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(spam)}, []io.Reader{strings.NewReader(ham)})
+		require.NoError(t, err)
+		return d
+	}
+
+	msgs := []LabeledMessage{
+		{Msg: "win a free iphone today", Spam: true},
+		{Msg: "free usdt", Spam: true},
+		{Msg: "пишите в личку за подробностями", Spam: true},
+		{Msg: "🔥🔥🔥 earn money 🔥🔥", Spam: true},
+		{Msg: "crypto prize", Spam: true},
+		{Msg: "hello everyone, have a good day", Spam: false},
+		{Msg: "see you at work tomorrow", Spam: false},
+		{Msg: "отвечу в личку", Spam: false},
+		{Msg: "happy birthday 🎉🎉🎉", Spam: false},
+		{Msg: "free day today", Spam: false},
+	}
+	cfg := Config{SimilarityThreshold: 0.5, MinSpamProbability: 50, MaxAllowedEmoji: 2, MinMsgLen: 10}
+	grid := TuneGrid{SimilarityThreshold: []float64{0.3, 0.5, 0.9}, MinSpamProbability: []float64{50, 80},
+		MaxAllowedEmoji: []int{-1, 2, 4}, MinMsgLen: []int{0, 15}}
+
+	d := newDetector(cfg)
+	rep, err := Tune(context.Background(), d, msgs, grid)
+	require.NoError(t, err)
+	t.Logf("%v", rep)
+	assert.Equal(t, 3*2*3*2, rep.Evaluated)
+	assert.Equal(t, cfg.SimilarityThreshold, d.SimilarityThreshold, "config restored")
+	assert.Equal(t, cfg.MinMsgLen, d.MinMsgLen, "config restored")
+	require.NotEmpty(t, rep.Front)
+	assert.Contains(t, rep.Front, rep.Recommended)
+
+	for i, p := range rep.Front {
+		if i > 0 { // ordered by false positives, and each point improves false negatives
+			assert.Greater(t, p.FP, rep.Front[i-1].FP)
+			assert.Less(t, p.FN, rep.Front[i-1].FN)
+		}
+		assert.InDelta(t, float64(p.FP)/5, p.FalsePositiveRate, 0.0001)
+		assert.InDelta(t, float64(p.FN)/5, p.FalseNegativeRate, 0.0001)
+		assert.GreaterOrEqual(t, rep.Recommended.F1(), p.F1())
+
+		// the verdicts of the point should be the same as of the detector with the point's config
+		cfg := Config{SimilarityThreshold: p.SimilarityThreshold, MinSpamProbability: p.MinSpamProbability,
+			MaxAllowedEmoji: p.MaxAllowedEmoji, MinMsgLen: p.MinMsgLen}
+		er, err := Evaluate(context.Background(), newDetector(cfg), msgs)
+		require.NoError(t, err)
+		assert.Equal(t, er.Total, p.Confusion, "point %+v", p)
+	}
+
+	// verdicts of every combination should be the same as of the detector with this config
+	for _, scoreThreshold := range []float64{0, 1.5} {
+		for _, sim := range grid.SimilarityThreshold {
+			for _, prob := range grid.MinSpamProbability {
+				for _, emoji := range grid.MaxAllowedEmoji {
+					for _, minLen := range grid.MinMsgLen {
+						cfg := Config{SimilarityThreshold: sim, MinSpamProbability: prob, MaxAllowedEmoji: emoji,
+							MinMsgLen: minLen, ScoreThreshold: scoreThreshold}
+						single := TuneGrid{SimilarityThreshold: []float64{sim}, MinSpamProbability: []float64{prob},
+							MaxAllowedEmoji: []int{emoji}, MinMsgLen: []int{minLen}}
+						rep, err := Tune(context.Background(), newDetector(Config{ScoreThreshold: scoreThreshold}), msgs, single)
+						require.NoError(t, err)
+						require.Len(t, rep.Front, 1)
+						er, err := Evaluate(context.Background(), newDetector(cfg), msgs)
+						require.NoError(t, err)
+						assert.Equal(t, er.Total, rep.Front[0].Confusion, "config %+v", cfg)
+					}
+				}
+			}
+		}
+	}
+
+	t.Run("current values for empty grid", func(t *testing.T) {
+		rep, err := Tune(context.Background(), newDetector(cfg), msgs, TuneGrid{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, rep.Evaluated)
+		require.Len(t, rep.Front, 1)
+		p := rep.Front[0]
+		assert.Equal(t, TunePoint{SimilarityThreshold: 0.5, MinSpamProbability: 50, MaxAllowedEmoji: 2, MinMsgLen: 10,
+			Confusion: p.Confusion, FalsePositiveRate: p.FalsePositiveRate, FalseNegativeRate: p.FalseNegativeRate}, p)
+		er, err := Evaluate(context.Background(), newDetector(cfg), msgs)
+		require.NoError(t, err)
+		assert.Equal(t, er.Total, p.Confusion)
+	})
+
+	t.Run("no ham", func(t *testing.T) {
+		_, err := Tune(context.Background(), newDetector(cfg), msgs[:5], grid)
+		assert.EqualError(t, err, "both spam and ham messages required for tuning")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := Tune(ctx, newDetector(cfg), msgs, grid)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestParetoFront(t *testing.T) {
+	points := []TunePoint{
+		{MinMsgLen: 1, Confusion: Confusion{FP: 3, FN: 1}},
+		{MinMsgLen: 2, Confusion: Confusion{FP: 0, FN: 5}},
+		{MinMsgLen: 3, Confusion: Confusion{FP: 1, FN: 2}},
+		{MinMsgLen: 4, Confusion: Confusion{FP: 1, FN: 2}}, // same as 3, dropped
+		{MinMsgLen: 5, Confusion: Confusion{FP: 2, FN: 2}}, // dominated by 3
+		{MinMsgLen: 6, Confusion: Confusion{FP: 0, FN: 6}}, // dominated by 2
+		{MinMsgLen: 7, Confusion: Confusion{FP: 5, FN: 0}},
+	}
+	res := paretoFront(points)
+	lens := []int{}
+	for _, p := range res {
+		lens = append(lens, p.MinMsgLen)
+	}
+	assert.Equal(t, []int{2, 3, 1, 7}, lens)
+}
+
+func TestTuneGrid_WithDefaults(t *testing.T) {
+	def := DefaultTuneGrid()
+	assert.Equal(t, def, TuneGrid{}.WithDefaults())
+
+	g := TuneGrid{SimilarityThreshold: []float64{0.7}, MinMsgLen: []int{20, 30}}.WithDefaults()
+	assert.Equal(t, TuneGrid{SimilarityThreshold: []float64{0.7}, MinSpamProbability: def.MinSpamProbability,
+		MaxAllowedEmoji: def.MaxAllowedEmoji, MinMsgLen: []int{20, 30}}, g)
+}
@@ -0,0 +1,121 @@
+package tgspam
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+//go:generate moq --out mocks/image_loader.go --pkg mocks --skip-ensure --with-resets . ImageLoader
+
+// ImageLoader loads an image of the message by spamcheck.MetaData.ImageID, e.g. telegram file id.
+// The loader is responsible for the limits of the image size.
+type ImageLoader interface {
+	LoadImage(ctx context.Context, id string) (data []byte, mimeType string, err error)
+}
+
+// VisionConfig contains parameters for the vision check
+type VisionConfig struct {
+	Model             string // vision-capable model, gpt-4o if empty
+	SystemPrompt      string // system prompt, builtin default if empty
+	MaxTokensResponse int    // hard limit for the number of tokens in the response, 1024 if 0
+	Detail            string // image detail for OpenAI: low, high or auto, low if empty
+	StructuredOutput  bool   // ask for a response matching the verdict json schema, see OpenAIConfig.StructuredOutput
+}
+
+const defaultVisionPrompt = `I'll give you an image from a message in the messaging application, with the text of the message if any, and you will return me a json with three fields: {"spam": true/false, "reason":"why this is spam", "confidence":1-100}. Spam images are usually ads, fake job offers, crypto and easy money schemes, and invitations to private chats, often as screenshots. Set spam:true only of confidence above 80`
+
+// visionChecker asks a vision-capable language model to check if an image of the message is spam
+type visionChecker struct {
+	provider LLMProvider
+	loader   ImageLoader
+	params   VisionConfig
+	limits   *llmLimits // rate limit, daily budget and usage, shared with openai check if set
+	cache    *llmCache  // responses by image and message text, shared with openai check, nil if disabled
+	cacheID  string     // hash of the request parameters, part of the cache keys
+}
+
+// newVisionChecker makes a checker for the language model provider and the image loader, with the limits and the cache
+// of language model calls. The cache is optional.
+func newVisionChecker(provider LLMProvider, loader ImageLoader, params VisionConfig, limits *llmLimits,
+	cache *llmCache) *visionChecker {
+	if params.Model == "" {
+		params.Model = "gpt-4o"
+	}
+	if params.SystemPrompt == "" {
+		params.SystemPrompt = defaultVisionPrompt
+	}
+	if params.MaxTokensResponse == 0 {
+		params.MaxTokensResponse = 1024
+	}
+	if params.Detail == "" {
+		params.Detail = "low"
+	}
+	return &visionChecker{provider: provider, loader: loader, params: params, limits: limits, cache: cache,
+		cacheID: llmParamsHash(params.Model, params.SystemPrompt, params.MaxTokensResponse, params.Detail, params.StructuredOutput)}
+}
+
+// check loads the image of the message and asks the model if it is spam, with the text of the message.
+// The response for the same image and text is taken from the cache. The check is skipped by the rate limit
+// or the daily budget, as the openai check.
+func (v *visionChecker) check(ctx context.Context, req spamcheck.Request) spamcheck.Response {
+	key := v.cacheKey(req)
+	if v.cache != nil {
+		if resp, ok := v.cache.get(key); ok {
+			v.limits.countCached()
+			resp.Details += " (cached)"
+			return resp
+		}
+	}
+
+	data, mimeType, err := v.loader.LoadImage(ctx, req.Meta.ImageID)
+	if err != nil {
+		return spamcheck.Response{Name: "vision", Spam: false, Details: fmt.Sprintf("can't load image: %v", err)}
+	}
+	if reason := v.limits.reserve(); reason != "" {
+		return spamcheck.Response{Name: "vision", Spam: false, Details: "skipped, " + reason}
+	}
+
+	msg := "the message has no text"
+	if strings.TrimSpace(req.Msg) != "" {
+		msg = req.Msg
+	}
+	lreq := LLMRequest{Model: v.params.Model, SystemPrompt: v.params.SystemPrompt, Message: msg,
+		MaxTokens: v.params.MaxTokensResponse, Image: &LLMImage{Data: data, MimeType: mimeType, Detail: v.params.Detail}}
+	if v.params.StructuredOutput {
+		lreq.Schema = llmVerdictSchema()
+	}
+	resp, err := v.provider.Complete(ctx, lreq)
+	v.limits.record(resp) // failed request counted as well, with tokens unknown
+	if err != nil {
+		return spamcheck.Response{Name: "vision", Spam: false, Details: fmt.Sprintf("vision error: %v", err)}
+	}
+	verdict, err := parseLLMVerdict(resp.Content)
+	if err != nil {
+		return spamcheck.Response{Name: "vision", Spam: false, Details: fmt.Sprintf("vision error: %v", err)}
+	}
+
+	score := 0.0
+	if verdict.IsSpam {
+		score = float64(verdict.Confidence) / 100
+	}
+	cr := spamcheck.Response{Name: "vision", Spam: verdict.IsSpam, Score: score,
+		Details: fmt.Sprintf("%s, confidence: %d%%", strings.TrimSuffix(verdict.Reason, "."), verdict.Confidence)}
+	if v.cache != nil {
+		v.cache.put(key, cr)
+	}
+	return cr
+}
+
+// cacheKey returns the key of the response in the cache: the unique id of the image, or the image id if not set,
+// with the text of the message and the hash of the request parameters. It is prefixed to keep it apart from the
+// messages of openai check.
+func (v *visionChecker) cacheKey(req spamcheck.Request) string {
+	id := req.Meta.ImageUniqueID
+	if id == "" {
+		id = req.Meta.ImageID
+	}
+	return "vision:" + v.cacheID + ":" + id + "\n" + req.Msg
+}
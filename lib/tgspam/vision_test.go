@@ -0,0 +1,175 @@
+package tgspam
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam/mocks"
+)
+
+func TestVisionChecker_Check(t *testing.T) {
+	loaderMock := &mocks.ImageLoaderMock{
+		LoadImageFunc: func(ctx context.Context, id string) ([]byte, string, error) {
+			if id == "bad" {
+				return nil, "", errors.New("too large")
+			}
+			return []byte("image data"), "image/jpeg", nil
+		},
+	}
+	content, apiErr := `{"spam": true, "reason":"fake job offer.", "confidence":95}`, error(nil)
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+				Message: openai.ChatCompletionMessage{Content: content}}}}, apiErr
+		},
+	}
+	vc := newVisionChecker(NewOpenAIProvider(clientMock), loaderMock, VisionConfig{}, &llmLimits{}, nil)
+
+	t.Run("spam image without text", func(t *testing.T) {
+		resp := vc.check(context.Background(), spamcheck.Request{Meta: spamcheck.MetaData{Images: 1, ImageID: "file1"}})
+		assert.Equal(t, spamcheck.Response{Name: "vision", Spam: true, Score: 0.95, Details: "fake job offer, confidence: 95%"}, resp)
+		require.Len(t, loaderMock.LoadImageCalls(), 1)
+		assert.Equal(t, "file1", loaderMock.LoadImageCalls()[0].ID)
+
+		req := clientMock.CreateChatCompletionCalls()[0].ChatCompletionRequest
+		assert.Equal(t, "gpt-4o", req.Model)
+		assert.Equal(t, 1024, req.MaxTokens)
+		assert.Equal(t, defaultVisionPrompt, req.Messages[0].Content)
+		require.Len(t, req.Messages[1].MultiContent, 2)
+		assert.Equal(t, "the message has no text", req.Messages[1].MultiContent[0].Text)
+		assert.Equal(t, &openai.ChatMessageImageURL{URL: "data:image/jpeg;base64,aW1hZ2UgZGF0YQ==", Detail: openai.ImageURLDetailLow},
+			req.Messages[1].MultiContent[1].ImageURL)
+	})
+
+	t.Run("ham image with caption", func(t *testing.T) {
+		content = `{"spam": false, "reason":"a photo of a cat", "confidence":90}`
+		resp := vc.check(context.Background(), spamcheck.Request{Msg: "my cat", Meta: spamcheck.MetaData{ImageID: "file2"}})
+		assert.Equal(t, spamcheck.Response{Name: "vision", Spam: false, Details: "a photo of a cat, confidence: 90%"}, resp)
+		calls := clientMock.CreateChatCompletionCalls()
+		assert.Equal(t, "my cat", calls[len(calls)-1].ChatCompletionRequest.Messages[1].MultiContent[0].Text)
+	})
+
+	t.Run("load error", func(t *testing.T) {
+		resp := vc.check(context.Background(), spamcheck.Request{Meta: spamcheck.MetaData{ImageID: "bad"}})
+		assert.Equal(t, spamcheck.Response{Name: "vision", Spam: false, Details: "can't load image: too large"}, resp)
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		apiErr = errors.New("api error")
+		defer func() { apiErr = nil }()
+		resp := vc.check(context.Background(), spamcheck.Request{Meta: spamcheck.MetaData{ImageID: "file3"}})
+		assert.Equal(t, spamcheck.Response{Name: "vision", Spam: false, Details: "vision error: api error"}, resp)
+	})
+
+	t.Run("bad response", func(t *testing.T) {
+		content = "not a json"
+		resp := vc.check(context.Background(), spamcheck.Request{Meta: spamcheck.MetaData{ImageID: "file4"}})
+		assert.False(t, resp.Spam)
+		assert.Contains(t, resp.Details, "vision error: can't unmarshal response")
+		assert.Equal(t, int64(4), vc.limits.stats().Calls, "failed calls counted as well, not loaded image is not")
+	})
+
+	t.Run("cached by unique id and text", func(t *testing.T) {
+		content = `{"spam": true, "reason":"crypto ad", "confidence":90}`
+		calls := len(clientMock.CreateChatCompletionCalls())
+		loaderMock.ResetCalls()
+		limits := &llmLimits{}
+		vc := newVisionChecker(NewOpenAIProvider(clientMock), loaderMock, VisionConfig{}, limits, newLLMCache(time.Hour, 10))
+		expected := spamcheck.Response{Name: "vision", Spam: true, Score: 0.9, Details: "crypto ad, confidence: 90%"}
+		resp := vc.check(context.Background(), spamcheck.Request{Msg: "text", Meta: spamcheck.MetaData{ImageID: "f1", ImageUniqueID: "u1"}})
+		assert.Equal(t, expected, resp)
+
+		expected.Details += " (cached)"
+		resp = vc.check(context.Background(), spamcheck.Request{Msg: "text", Meta: spamcheck.MetaData{ImageID: "f2", ImageUniqueID: "u1"}})
+		assert.Equal(t, expected, resp, "the same image with another file id")
+		assert.Len(t, loaderMock.LoadImageCalls(), 1)
+
+		vc.check(context.Background(), spamcheck.Request{Msg: "other text", Meta: spamcheck.MetaData{ImageID: "f1", ImageUniqueID: "u1"}})
+		vc.check(context.Background(), spamcheck.Request{Msg: "text", Meta: spamcheck.MetaData{ImageID: "f3"}})
+		assert.Len(t, clientMock.CreateChatCompletionCalls(), calls+3)
+		stats := limits.stats()
+		assert.Equal(t, int64(3), stats.Calls)
+		assert.Equal(t, int64(1), stats.Cached)
+	})
+
+	t.Run("limited", func(t *testing.T) {
+		calls := len(clientMock.CreateChatCompletionCalls())
+		limits := &llmLimits{params: OpenAIConfig{RequestsPerMinute: 1}}
+		vc := newVisionChecker(NewOpenAIProvider(clientMock), loaderMock, VisionConfig{}, limits, nil)
+		resp := vc.check(context.Background(), spamcheck.Request{Meta: spamcheck.MetaData{ImageID: "f1"}})
+		assert.True(t, resp.Spam)
+		resp = vc.check(context.Background(), spamcheck.Request{Meta: spamcheck.MetaData{ImageID: "f2"}})
+		assert.Equal(t, spamcheck.Response{Name: "vision", Spam: false,
+			Details: "skipped, rate limit of 1 requests per minute reached"}, resp)
+		assert.Len(t, clientMock.CreateChatCompletionCalls(), calls+1)
+		assert.Equal(t, int64(1), limits.stats().Limited)
+	})
+}
+
+func TestDetector_CheckWithVision(t *testing.T) {
+	loaderMock := &mocks.ImageLoaderMock{
+		LoadImageFunc: func(ctx context.Context, id string) ([]byte, string, error) {
+			return []byte("image data"), "image/png", nil
+		},
+	}
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+				Message: openai.ChatCompletionMessage{Content: `{"spam": true, "reason":"crypto ad", "confidence":90}`}}}}, nil
+		},
+	}
+	d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 10})
+	d.WithVisionChecker(NewOpenAIProvider(clientMock), loaderMock, VisionConfig{Model: "vision-model"})
+
+	spam, cr := d.Check(spamcheck.Request{UserID: "1", Meta: spamcheck.MetaData{Images: 1, ImageID: "file1"}})
+	assert.True(t, spam, "image-only message checked regardless of min length")
+	assert.Equal(t, []spamcheck.Response{
+		{Name: "vision", Spam: true, Score: 0.9, Details: "crypto ad, confidence: 90%"},
+		{Name: "message length", Spam: false, Details: "too short"},
+	}, cr)
+	assert.Equal(t, "vision-model", clientMock.CreateChatCompletionCalls()[0].ChatCompletionRequest.Model)
+
+	d.SetCheckEnabled("vision", false)
+	spam, cr = d.Check(spamcheck.Request{UserID: "2", Meta: spamcheck.MetaData{Images: 1, ImageID: "file2"}})
+	assert.False(t, spam)
+	assert.Equal(t, []spamcheck.Response{{Name: "message length", Spam: false, Details: "too short"}}, cr)
+	assert.Len(t, loaderMock.LoadImageCalls(), 1)
+
+	t.Run("no image not checked", func(t *testing.T) {
+		d.SetCheckEnabled("vision", true)
+		spam, cr = d.Check(spamcheck.Request{UserID: "3", Msg: "some message text"})
+		assert.False(t, spam)
+		assert.Empty(t, cr)
+		assert.Len(t, loaderMock.LoadImageCalls(), 1)
+	})
+
+	t.Run("shared limits and stats with openai check", func(t *testing.T) {
+		calls := len(clientMock.CreateChatCompletionCalls())
+		d := NewDetector(Config{MaxAllowedEmoji: -1})
+		d.WithOpenAIChecker(clientMock, OpenAIConfig{RequestsPerMinute: 1, CacheTTL: time.Hour})
+		d.WithVisionChecker(NewOpenAIProvider(clientMock), loaderMock, VisionConfig{})
+		storage := &memLLMUsage{usage: map[string]LLMUsage{}}
+		require.NoError(t, d.WithLLMUsageStorage(storage))
+
+		spam, _ := d.Check(spamcheck.Request{UserID: "1", Meta: spamcheck.MetaData{ImageID: "file1"}})
+		assert.True(t, spam)
+		_, cr := d.Check(spamcheck.Request{UserID: "2", Meta: spamcheck.MetaData{ImageID: "file2"}})
+		assert.Equal(t, "skipped, rate limit of 1 requests per minute reached", cr[0].Details)
+		_, cr = d.Check(spamcheck.Request{UserID: "3", Meta: spamcheck.MetaData{ImageID: "file1"}})
+		assert.Equal(t, "crypto ad, confidence: 90% (cached)", cr[0].Details)
+
+		assert.Len(t, clientMock.CreateChatCompletionCalls(), calls+1)
+		stats := d.LLMStats()
+		assert.Equal(t, int64(1), stats.Calls)
+		assert.Equal(t, int64(1), stats.Limited)
+		assert.Equal(t, int64(1), stats.Cached)
+		assert.Len(t, storage.usage, 1, "usage stored")
+	})
+}